@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"math"
+	"time"
+)
+
+// TokenBucket описывает ведро токенов: в нём помещается Capacity токенов,
+// и за Period оно полностью восстанавливается. Пока ведро не пусто, запросы
+// проходят пачкой; дальше — со скоростью Capacity/Period.
+type TokenBucket struct {
+	Capacity int
+	Period   time.Duration
+}
+
+// TakeResult — состояние ведра после попытки забрать токен.
+type TakeResult struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter — через сколько появится следующий токен (если отказано).
+	RetryAfter time.Duration
+	// Reset — через сколько ведро наполнится полностью.
+	Reset time.Duration
+}
+
+// perMilli — скорость пополнения в токенах за миллисекунду.
+func (b TokenBucket) perMilli() float64 {
+	return float64(b.Capacity) / float64(b.Period.Milliseconds())
+}
+
+// take пополняет ведро за время с последнего обращения и забирает токен.
+// Redis выполняет то же самое в takeScript, локальный кэш — здесь.
+func (b TokenBucket) take(tokens float64, lastMs, nowMs int64) (float64, bool) {
+	tokens = math.Min(float64(b.Capacity), tokens+float64(max(0, nowMs-lastMs))*b.perMilli())
+	if tokens < 1 {
+		return tokens, false
+	}
+	return tokens - 1, true
+}
+
+// result описывает ведро, в котором осталось tokens токенов.
+func (b TokenBucket) result(tokens float64, allowed bool) TakeResult {
+	rate := b.perMilli()
+	res := TakeResult{
+		Allowed:   allowed,
+		Remaining: int(tokens),
+		Reset:     millis(math.Ceil((float64(b.Capacity) - tokens) / rate)),
+	}
+	if !allowed {
+		res.RetryAfter = millis(math.Ceil((1 - tokens) / rate))
+	}
+	return res
+}
+
+func millis(ms float64) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
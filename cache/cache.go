@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrMiss возвращается, когда ключа нет в кэше или срок его жизни истёк.
+var ErrMiss = errors.New("cache miss")
+
+const (
+	BackendRedis = "redis"
+	BackendLocal = "local"
+)
+
+// Cache — общий интерфейс кэша. Middleware и сервисы получают его через
+// конструкторы, поэтому Redis можно заменить локальным LRU.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+	// DeletePattern удаляет ключи по glob-шаблону в синтаксисе Redis SCAN MATCH (* и ?).
+	DeletePattern(ctx context.Context, pattern string) error
+	// Increment увеличивает счётчик и ставит TTL при первом инкременте.
+	Increment(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	// Take атомарно забирает один токен из ведра key.
+	Take(ctx context.Context, key string, bucket TokenBucket) (TakeResult, error)
+	// SetWithTags сохраняет значение и регистрирует ключ под тегами,
+	// чтобы InvalidateTags мог удалить его вместе с остальными записями тега.
+	SetWithTags(ctx context.Context, key string, value []byte, ttl time.Duration, tags []string) error
+	// InvalidateTags удаляет все ключи, зарегистрированные под любым из тегов.
+	InvalidateTags(ctx context.Context, tags ...string) error
+	Flush(ctx context.Context) error
+	Ping(ctx context.Context) error
+	// Backend сообщает, какое хранилище сейчас обслуживает запросы.
+	Backend() string
+}
+
+// GetJSON читает значение и десериализует его в dest.
+func GetJSON(ctx context.Context, c Cache, key string, dest interface{}) error {
+	data, err := c.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		return fmt.Errorf("cache unmarshal failed: %w", err)
+	}
+	return nil
+}
+
+// SetJSON сериализует value в JSON и сохраняет его, регистрируя под tags.
+func SetJSON(ctx context.Context, c Cache, key string, value interface{}, ttl time.Duration, tags ...string) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("cache marshal failed: %w", err)
+	}
+
+	if len(tags) > 0 {
+		return c.SetWithTags(ctx, key, data, ttl, tags)
+	}
+	return c.Set(ctx, key, data, ttl)
+}
@@ -0,0 +1,377 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// FallbackCache обслуживает запросы из Redis, а при его недоступности
+// переключается на локальный LRU. Фоновая проверка возвращает Redis,
+// как только он снова отвечает на PING.
+type FallbackCache struct {
+	redis    *RedisCache
+	local    *LocalCache
+	logger   *zap.Logger
+	interval time.Duration
+
+	degraded atomic.Bool
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+
+	// pending — инвалидации, которые пока применены только к локальному
+	// кэшу; после восстановления Redis они повторяются в нём.
+	mu      sync.Mutex
+	pending pendingWrites
+}
+
+// pendingWrites — изменения кэша за время недоступности Redis. Обычные
+// записи не запоминаются: значение в Redis могло устареть, только если
+// данные изменились, а изменение всегда сопровождается инвалидацией.
+type pendingWrites struct {
+	flush    bool
+	keys     map[string]struct{}
+	patterns map[string]struct{}
+	tags     map[string]struct{}
+	// clocks — отметки времени записи под тегами (TouchTags): их нужно
+	// перенести в Redis, иначе Last-Modified откатится назад.
+	clocks map[string][]byte
+}
+
+func (p *pendingWrites) empty() bool {
+	return !p.flush && len(p.keys) == 0 && len(p.patterns) == 0 && len(p.tags) == 0 && len(p.clocks) == 0
+}
+
+// merge возвращает в p изменения, которые не удалось повторить.
+func (p *pendingWrites) merge(other pendingWrites) {
+	p.flush = p.flush || other.flush
+	p.keys = mergeSet(p.keys, other.keys)
+	p.patterns = mergeSet(p.patterns, other.patterns)
+	p.tags = mergeSet(p.tags, other.tags)
+	for key, value := range other.clocks {
+		if _, newer := p.clocks[key]; !newer {
+			if p.clocks == nil {
+				p.clocks = make(map[string][]byte)
+			}
+			p.clocks[key] = value
+		}
+	}
+}
+
+func mergeSet(dst, src map[string]struct{}) map[string]struct{} {
+	for key := range src {
+		dst = addToSet(dst, key)
+	}
+	return dst
+}
+
+func addToSet(set map[string]struct{}, key string) map[string]struct{} {
+	if set == nil {
+		set = make(map[string]struct{})
+	}
+	set[key] = struct{}{}
+	return set
+}
+
+// apply повторяет изменения в Redis.
+func (p *pendingWrites) apply(ctx context.Context, r *RedisCache) error {
+	if p.flush {
+		if err := r.Flush(ctx); err != nil {
+			return err
+		}
+	}
+	keys := make([]string, 0, len(p.keys))
+	for key := range p.keys {
+		keys = append(keys, key)
+	}
+	if err := r.Delete(ctx, keys...); err != nil {
+		return err
+	}
+	for pattern := range p.patterns {
+		if err := r.DeletePattern(ctx, pattern); err != nil {
+			return err
+		}
+	}
+	tags := make([]string, 0, len(p.tags))
+	for tag := range p.tags {
+		tags = append(tags, tag)
+	}
+	if err := r.InvalidateTags(ctx, tags...); err != nil {
+		return err
+	}
+	for key, value := range p.clocks {
+		if err := r.Set(ctx, key, value, writeClockTTL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func NewFallbackCache(redis *RedisCache, local *LocalCache, logger *zap.Logger, checkInterval time.Duration) *FallbackCache {
+	f := &FallbackCache{
+		redis:    redis,
+		local:    local,
+		logger:   logger,
+		interval: checkInterval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkInterval)
+	defer cancel()
+	if err := redis.Ping(ctx); err != nil {
+		f.markDown(err)
+	} else {
+		logger.Info("redis_connected")
+	}
+
+	go f.monitor()
+	return f
+}
+
+// Degraded сообщает, работает ли кэш сейчас на локальном LRU.
+func (f *FallbackCache) Degraded() bool {
+	return f.degraded.Load()
+}
+
+func (f *FallbackCache) markDown(err error) {
+	if f.degraded.CompareAndSwap(false, true) {
+		f.logger.Warn("redis_unavailable_fallback_to_local", zap.Error(err))
+	}
+}
+
+// markUp возвращает Redis в работу. Пока он был недоступен, инвалидации
+// применялись только к локальному кэшу — повторяем их в Redis. Redis
+// целиком не сбрасывается: он общий для всех экземпляров и хранит ещё
+// ведра лимитов и отметки времени записи.
+func (f *FallbackCache) markUp(ctx context.Context) {
+	if err := f.replay(ctx); err != nil {
+		f.logger.Warn("redis_replay_after_reconnect_failed", zap.Error(err))
+		return
+	}
+	f.local.Flush(ctx)
+
+	if f.degraded.CompareAndSwap(true, false) {
+		f.logger.Info("redis_reconnected")
+	}
+	// Инвалидации, сделанные между повтором и переключением.
+	if err := f.replay(ctx); err != nil {
+		f.logger.Warn("redis_replay_after_reconnect_failed", zap.Error(err))
+	}
+}
+
+// remember запоминает изменение, сделанное только в локальном кэше.
+func (f *FallbackCache) remember(change func(p *pendingWrites)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	change(&f.pending)
+}
+
+// replay повторяет в Redis накопленные изменения. Неудачные остаются
+// до следующей попытки.
+func (f *FallbackCache) replay(ctx context.Context) error {
+	f.mu.Lock()
+	pending := f.pending
+	f.pending = pendingWrites{}
+	f.mu.Unlock()
+
+	if pending.empty() {
+		return nil
+	}
+	if err := pending.apply(ctx, f.redis); err != nil {
+		f.remember(func(p *pendingWrites) { p.merge(pending) })
+		return err
+	}
+	return nil
+}
+
+func (f *FallbackCache) monitor() {
+	defer close(f.done)
+
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			f.check()
+		}
+	}
+}
+
+func (f *FallbackCache) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), f.interval)
+	defer cancel()
+
+	err := f.redis.Ping(ctx)
+	switch {
+	case err != nil:
+		f.markDown(err)
+	case f.Degraded():
+		f.markUp(ctx)
+	}
+}
+
+// unavailable решает, означает ли ошибка Redis его недоступность.
+// Промах и отмена запроса вызывающей стороной переключения не вызывают,
+// а таймаут самого Redis — вызывает.
+func (f *FallbackCache) unavailable(ctx context.Context, err error) bool {
+	if err == nil || errors.Is(err, ErrMiss) || ctx.Err() != nil || !connectionError(err) {
+		return false
+	}
+	f.markDown(err)
+	return true
+}
+
+// connectionError сообщает, что Redis не ответил: ошибка сети, таймаут
+// или закрытый клиент. Ответ с ошибкой (WRONGTYPE, ошибка скрипта) значит,
+// что сервер работает, — такая ошибка возвращается вызывающему.
+func connectionError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, redis.ErrClosed) ||
+		errors.Is(err, redis.ErrPoolTimeout)
+}
+
+func (f *FallbackCache) Get(ctx context.Context, key string) ([]byte, error) {
+	if !f.Degraded() {
+		val, err := f.redis.Get(ctx, key)
+		if !f.unavailable(ctx, err) {
+			return val, err
+		}
+	}
+	return f.local.Get(ctx, key)
+}
+
+func (f *FallbackCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if !f.Degraded() {
+		if err := f.redis.Set(ctx, key, value, ttl); !f.unavailable(ctx, err) {
+			return err
+		}
+	}
+	if strings.HasPrefix(key, writeClockPrefix) {
+		f.remember(func(p *pendingWrites) {
+			if p.clocks == nil {
+				p.clocks = make(map[string][]byte)
+			}
+			p.clocks[key] = value
+		})
+	}
+	return f.local.Set(ctx, key, value, ttl)
+}
+
+func (f *FallbackCache) Delete(ctx context.Context, keys ...string) error {
+	if !f.Degraded() {
+		if err := f.redis.Delete(ctx, keys...); !f.unavailable(ctx, err) {
+			return err
+		}
+	}
+	f.remember(func(p *pendingWrites) {
+		for _, key := range keys {
+			p.keys = addToSet(p.keys, key)
+		}
+	})
+	return f.local.Delete(ctx, keys...)
+}
+
+func (f *FallbackCache) DeletePattern(ctx context.Context, pattern string) error {
+	if !f.Degraded() {
+		if err := f.redis.DeletePattern(ctx, pattern); !f.unavailable(ctx, err) {
+			return err
+		}
+	}
+	f.remember(func(p *pendingWrites) { p.patterns = addToSet(p.patterns, pattern) })
+	return f.local.DeletePattern(ctx, pattern)
+}
+
+func (f *FallbackCache) SetWithTags(ctx context.Context, key string, value []byte, ttl time.Duration, tags []string) error {
+	if !f.Degraded() {
+		if err := f.redis.SetWithTags(ctx, key, value, ttl, tags); !f.unavailable(ctx, err) {
+			return err
+		}
+	}
+	return f.local.SetWithTags(ctx, key, value, ttl, tags)
+}
+
+func (f *FallbackCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	if !f.Degraded() {
+		if err := f.redis.InvalidateTags(ctx, tags...); !f.unavailable(ctx, err) {
+			return err
+		}
+	}
+	f.remember(func(p *pendingWrites) {
+		for _, tag := range tags {
+			p.tags = addToSet(p.tags, tag)
+		}
+	})
+	return f.local.InvalidateTags(ctx, tags...)
+}
+
+func (f *FallbackCache) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	if !f.Degraded() {
+		val, err := f.redis.Increment(ctx, key, ttl)
+		if !f.unavailable(ctx, err) {
+			return val, err
+		}
+	}
+	return f.local.Increment(ctx, key, ttl)
+}
+
+func (f *FallbackCache) Take(ctx context.Context, key string, bucket TokenBucket) (TakeResult, error) {
+	if !f.Degraded() {
+		res, err := f.redis.Take(ctx, key, bucket)
+		if !f.unavailable(ctx, err) {
+			return res, err
+		}
+	}
+	return f.local.Take(ctx, key, bucket)
+}
+
+func (f *FallbackCache) Flush(ctx context.Context) error {
+	if !f.Degraded() {
+		if err := f.redis.Flush(ctx); !f.unavailable(ctx, err) {
+			if err != nil {
+				return err
+			}
+			return f.local.Flush(ctx)
+		}
+	}
+	// Сброс, запрошенный во время сбоя, повторится в Redis.
+	f.remember(func(p *pendingWrites) { p.flush = true })
+	return f.local.Flush(ctx)
+}
+
+// Ping всегда проверяет Redis, чтобы /health показывал его реальное состояние.
+func (f *FallbackCache) Ping(ctx context.Context) error {
+	return f.redis.Ping(ctx)
+}
+
+func (f *FallbackCache) Backend() string {
+	if f.Degraded() {
+		return BackendLocal
+	}
+	return BackendRedis
+}
+
+// Close останавливает фоновую проверку и закрывает соединение с Redis.
+func (f *FallbackCache) Close() error {
+	f.stopOnce.Do(func() {
+		close(f.stop)
+		<-f.done
+	})
+	return f.redis.Close()
+}
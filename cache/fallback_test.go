@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+func newTestFallback(t *testing.T) (*FallbackCache, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{
+		Addr:        mr.Addr(),
+		DialTimeout: 100 * time.Millisecond,
+		ReadTimeout: 100 * time.Millisecond,
+		MaxRetries:  -1,
+	})
+	f := NewFallbackCache(NewRedisCache(client), NewLocalCache(100), zap.NewNop(), 20*time.Millisecond)
+	t.Cleanup(func() { f.Close() })
+	return f, mr
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not reached in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFallbackCacheDegradesAndRecovers(t *testing.T) {
+	ctx := context.Background()
+	f, mr := newTestFallback(t)
+
+	if f.Backend() != BackendRedis {
+		t.Fatalf("backend = %s, want redis", f.Backend())
+	}
+	if err := f.Set(ctx, "k", []byte("from-redis"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if !mr.Exists("k") {
+		t.Fatal("value was not written to redis")
+	}
+
+	mr.Close()
+
+	// Первая же операция замечает недоступность Redis и уходит в локальный кэш.
+	if err := f.Set(ctx, "k", []byte("local"), time.Minute); err != nil {
+		t.Fatalf("set during outage: %v", err)
+	}
+	if !f.Degraded() || f.Backend() != BackendLocal {
+		t.Fatal("cache did not degrade to local backend")
+	}
+	val, err := f.Get(ctx, "k")
+	if err != nil || string(val) != "local" {
+		t.Fatalf("get during outage = %q, %v", val, err)
+	}
+	if n, err := f.Increment(ctx, "rate", time.Minute); err != nil || n != 1 {
+		t.Fatalf("increment during outage = %d, %v", n, err)
+	}
+
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return !f.Degraded() })
+
+	if f.Backend() != BackendRedis {
+		t.Fatalf("backend after reconnect = %s", f.Backend())
+	}
+	if f.local.Len() != 0 {
+		t.Fatal("local cache was not flushed after reconnect")
+	}
+}
+
+func TestFallbackCacheReplaysInvalidationsAfterReconnect(t *testing.T) {
+	ctx := context.Background()
+	f, mr := newTestFallback(t)
+
+	if err := f.SetWithTags(ctx, "habits-list", []byte("old"), time.Minute, []string{"habits:1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Set(ctx, "other", []byte("kept"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Set(ctx, "gone", []byte("v"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	bucket := TokenBucket{Capacity: 2, Period: time.Hour}
+	if _, err := f.Take(ctx, "bucket", bucket); err != nil {
+		t.Fatal(err)
+	}
+
+	mr.Close()
+	if err := f.InvalidateTags(ctx, "habits:1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Delete(ctx, "gone"); err != nil {
+		t.Fatal(err)
+	}
+	written := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	if err := TouchTags(ctx, f, written, "habits:1"); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Degraded() {
+		t.Fatal("cache did not degrade")
+	}
+
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return !f.Degraded() })
+
+	for _, key := range []string{"habits-list", "gone"} {
+		if _, err := f.Get(ctx, key); err != ErrMiss {
+			t.Fatalf("%s: invalidation was not replayed, got %v", key, err)
+		}
+	}
+	if val, err := f.Get(ctx, "other"); err != nil || string(val) != "kept" {
+		t.Fatalf("untouched entry = %q, %v; redis must not be flushed", val, err)
+	}
+	if res, err := f.Take(ctx, "bucket", bucket); err != nil || res.Remaining != 0 {
+		t.Fatalf("rate limit bucket was reset: %+v, %v", res, err)
+	}
+	if at, err := LastWrite(ctx, f, "habits:1"); err != nil || !at.Equal(written) {
+		t.Fatalf("write clock = %v, %v; want %v", at, err, written)
+	}
+}
+
+func TestFallbackCacheIgnoresReplyErrors(t *testing.T) {
+	ctx := context.Background()
+	f, mr := newTestFallback(t)
+
+	if _, err := mr.Lpush("list", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Get(ctx, "list"); err == nil || err == ErrMiss {
+		t.Fatalf("get of a list = %v, want WRONGTYPE", err)
+	}
+	if f.Degraded() {
+		t.Fatal("a reply error must not switch the cache to local")
+	}
+}
+
+func TestFallbackCacheStartsDegradedWithoutRedis(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr:        "127.0.0.1:1",
+		DialTimeout: 50 * time.Millisecond,
+		MaxRetries:  -1,
+	})
+	f := NewFallbackCache(NewRedisCache(client), NewLocalCache(10), zap.NewNop(), 50*time.Millisecond)
+	defer f.Close()
+
+	if !f.Degraded() {
+		t.Fatal("expected degraded mode when redis is unreachable at startup")
+	}
+
+	ctx := context.Background()
+	if err := f.Set(ctx, "k", []byte("v"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := f.Get(ctx, "k"); err != nil || string(val) != "v" {
+		t.Fatalf("local get = %q, %v", val, err)
+	}
+}
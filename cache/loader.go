@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/utils"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// State описывает, откуда Loader взял значение.
+type State string
+
+const (
+	StateHit   State = "hit"
+	StateMiss  State = "miss"
+	StateStale State = "stale"
+)
+
+// backgroundRefreshTimeout ограничивает фоновое обновление, которое
+// не привязано к контексту запроса.
+const backgroundRefreshTimeout = 30 * time.Second
+
+// Policy задаёт время жизни и поведение при устаревании записи.
+type Policy struct {
+	// TTL — сколько запись считается свежей.
+	TTL time.Duration
+	// StaleFor — сколько после TTL можно отдавать устаревшее значение,
+	// пока оно обновляется. Ноль отключает stale-while-revalidate.
+	StaleFor time.Duration
+	// Beta — коэффициент вероятностного раннего истечения (XFetch).
+	// Ноль отключает раннее обновление, 1 — рекомендуемое значение.
+	Beta float64
+	// Background обновляет запись в отдельной горутине. Без него обновление
+	// выполняет первый запрос, заставший запись устаревшей, а остальные
+	// в это время получают старое значение.
+	Background bool
+	// Tags — теги инвалидации записи.
+	Tags []string
+}
+
+// envelope — то, что Loader хранит в кэше вместо голого значения.
+type envelope struct {
+	Value      []byte        `json:"value"`
+	FreshUntil time.Time     `json:"fresh_until"`
+	Delta      time.Duration `json:"delta"` // сколько заняла последняя загрузка
+}
+
+// Loader защищает источник данных от лавины запросов при истечении
+// горячего ключа: одновременные промахи по одному ключу объединяются
+// в одну загрузку, а устаревшее значение отдаётся, пока его обновляет
+// один запрос. Объединение работает в пределах процесса.
+type Loader struct {
+	cache      Cache
+	name       string
+	logger     *zap.Logger
+	group      singleflight.Group
+	refreshing sync.Map
+	now        func() time.Time
+	random     func() float64
+}
+
+// NewLoader создаёт Loader; name попадает в метку cache метрики
+// app_cache_requests_total.
+func NewLoader(c Cache, name string, logger *zap.Logger) *Loader {
+	return &Loader{
+		cache:  c,
+		name:   name,
+		logger: logger,
+		now:    time.Now,
+		random: rand.Float64,
+	}
+}
+
+// Fetch возвращает значение ключа, загружая его через load при промахе.
+// Ошибка load возвращается только если отдать нечего; при устаревшем
+// значении оно отдаётся как есть, а ошибка пишется в лог.
+func (l *Loader) Fetch(ctx context.Context, key string, p Policy, load func(context.Context) ([]byte, error)) ([]byte, State, error) {
+	var env envelope
+	if err := GetJSON(ctx, l.cache, key, &env); err != nil {
+		val, err := l.load(ctx, key, p, load)
+		if err != nil {
+			return nil, StateMiss, err
+		}
+		l.count(StateMiss)
+		return val, StateMiss, nil
+	}
+
+	now := l.now()
+	state := StateHit
+	if !now.Before(env.FreshUntil) {
+		state = StateStale
+	}
+
+	if state == StateStale || l.expiresEarly(env, p.Beta, now) {
+		if p.Background {
+			l.refreshInBackground(ctx, key, p, load)
+		} else if _, busy := l.refreshing.LoadOrStore(key, struct{}{}); !busy {
+			val, err := l.load(ctx, key, p, load)
+			l.refreshing.Delete(key)
+			if err == nil {
+				l.count(StateMiss)
+				return val, StateMiss, nil
+			}
+			l.logger.Warn("cache_refresh_failed", zap.String("key", key), zap.Error(err))
+		}
+	}
+
+	l.count(state)
+	return env.Value, state, nil
+}
+
+// load выполняет загрузку один раз на ключ, сколько бы запросов её ни ждали.
+func (l *Loader) load(ctx context.Context, key string, p Policy, load func(context.Context) ([]byte, error)) ([]byte, error) {
+	val, err, _ := l.group.Do(key, func() (interface{}, error) {
+		start := l.now()
+		val, err := load(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		env := envelope{
+			Value:      val,
+			FreshUntil: l.now().Add(p.TTL),
+			Delta:      l.now().Sub(start),
+		}
+		if err := SetJSON(ctx, l.cache, key, env, p.TTL+p.StaleFor, p.Tags...); err != nil {
+			l.logger.Warn("cache_set_failed", zap.String("key", key), zap.Error(err))
+		}
+		return val, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return val.([]byte), nil
+}
+
+func (l *Loader) refreshInBackground(ctx context.Context, key string, p Policy, load func(context.Context) ([]byte, error)) {
+	if _, busy := l.refreshing.LoadOrStore(key, struct{}{}); busy {
+		return
+	}
+
+	go func() {
+		defer l.refreshing.Delete(key)
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), backgroundRefreshTimeout)
+		defer cancel()
+
+		if _, err := l.load(ctx, key, p, load); err != nil {
+			l.logger.Warn("cache_refresh_failed", zap.String("key", key), zap.Error(err))
+		}
+	}()
+}
+
+// expiresEarly реализует XFetch: чем ближе истечение и чем дольше
+// загрузка, тем вероятнее, что запись обновят заранее.
+func (l *Loader) expiresEarly(env envelope, beta float64, now time.Time) bool {
+	if beta <= 0 || env.Delta <= 0 {
+		return false
+	}
+	gap := time.Duration(float64(env.Delta) * beta * -math.Log(1-l.random()))
+	return !now.Add(gap).Before(env.FreshUntil)
+}
+
+func (l *Loader) count(state State) {
+	utils.CacheRequests.WithLabelValues(l.name, string(state)).Inc()
+}
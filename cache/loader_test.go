@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func newTestLoader(name string) (*Loader, *time.Time) {
+	l := NewLoader(NewLocalCache(100), name, zap.NewNop())
+	now := time.Now()
+	l.now = func() time.Time { return now }
+	l.random = func() float64 { return 0 }
+	return l, &now
+}
+
+func TestLoaderCoalescesConcurrentMisses(t *testing.T) {
+	l, _ := newTestLoader("test_coalesce")
+	ctx := context.Background()
+	policy := Policy{TTL: time.Minute}
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	load := func(context.Context) ([]byte, error) {
+		calls.Add(1)
+		<-release
+		return []byte("value"), nil
+	}
+
+	const workers = 20
+	var wg sync.WaitGroup
+	results := make(chan string, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			val, _, err := l.Fetch(ctx, "hot", policy, load)
+			if err != nil {
+				t.Error(err)
+			}
+			results <- string(val)
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("load called %d times, want 1", n)
+	}
+	for val := range results {
+		if val != "value" {
+			t.Fatalf("got %q", val)
+		}
+	}
+}
+
+func TestLoaderServesStaleWhileRefreshingInBackground(t *testing.T) {
+	l, now := newTestLoader("test_swr")
+	ctx := context.Background()
+	policy := Policy{TTL: time.Minute, StaleFor: time.Hour, Background: true}
+
+	version := atomic.Int32{}
+	refreshed := make(chan struct{}, 1)
+	load := func(context.Context) ([]byte, error) {
+		if version.Add(1) > 1 {
+			defer func() { refreshed <- struct{}{} }()
+			return []byte("new"), nil
+		}
+		return []byte("old"), nil
+	}
+
+	if _, state, _ := l.Fetch(ctx, "k", policy, load); state != StateMiss {
+		t.Fatalf("first fetch state = %s", state)
+	}
+	if val, state, _ := l.Fetch(ctx, "k", policy, load); state != StateHit || string(val) != "old" {
+		t.Fatalf("second fetch = %q, %s", val, state)
+	}
+
+	*now = now.Add(2 * time.Minute)
+	val, state, err := l.Fetch(ctx, "k", policy, load)
+	if err != nil || state != StateStale || string(val) != "old" {
+		t.Fatalf("stale fetch = %q, %s, %v", val, state, err)
+	}
+
+	select {
+	case <-refreshed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("background refresh did not run")
+	}
+	waitFor(t, func() bool {
+		_, busy := l.refreshing.Load("k")
+		return !busy
+	})
+
+	if val, state, _ := l.Fetch(ctx, "k", policy, load); state != StateHit || string(val) != "new" {
+		t.Fatalf("after refresh = %q, %s", val, state)
+	}
+
+	stale := testutil.ToFloat64(utils.CacheRequests.WithLabelValues("test_swr", "stale"))
+	hits := testutil.ToFloat64(utils.CacheRequests.WithLabelValues("test_swr", "hit"))
+	if stale != 1 || hits != 2 {
+		t.Fatalf("metrics: stale = %v, hit = %v", stale, hits)
+	}
+}
+
+func TestLoaderInlineRefreshAndStaleOnError(t *testing.T) {
+	l, now := newTestLoader("test_inline")
+	ctx := context.Background()
+	policy := Policy{TTL: time.Minute, StaleFor: time.Hour}
+
+	l.Fetch(ctx, "k", policy, func(context.Context) ([]byte, error) { return []byte("v1"), nil })
+
+	*now = now.Add(2 * time.Minute)
+	val, state, err := l.Fetch(ctx, "k", policy, func(context.Context) ([]byte, error) { return []byte("v2"), nil })
+	if err != nil || state != StateMiss || string(val) != "v2" {
+		t.Fatalf("inline refresh = %q, %s, %v", val, state, err)
+	}
+
+	// Если обновить не удалось, отдаём то, что есть.
+	*now = now.Add(2 * time.Minute)
+	val, state, err = l.Fetch(ctx, "k", policy, func(context.Context) ([]byte, error) { return nil, errors.New("db down") })
+	if err != nil || state != StateStale || string(val) != "v2" {
+		t.Fatalf("stale on error = %q, %s, %v", val, state, err)
+	}
+}
+
+func TestLoaderMissErrorIsNotCached(t *testing.T) {
+	l, _ := newTestLoader("test_error")
+	ctx := context.Background()
+	policy := Policy{TTL: time.Minute}
+
+	boom := errors.New("boom")
+	if _, _, err := l.Fetch(ctx, "k", policy, func(context.Context) ([]byte, error) { return nil, boom }); !errors.Is(err, boom) {
+		t.Fatalf("err = %v, want boom", err)
+	}
+	if _, err := l.cache.Get(ctx, "k"); !errors.Is(err, ErrMiss) {
+		t.Fatalf("failed load was cached: %v", err)
+	}
+}
+
+func TestLoaderExpiresEarly(t *testing.T) {
+	l, now := newTestLoader("test_early")
+	env := envelope{FreshUntil: now.Add(time.Second), Delta: 100 * time.Millisecond}
+
+	if l.expiresEarly(env, 1, *now) {
+		t.Fatal("random = 0 must never expire early")
+	}
+
+	// random близкий к 1 даёт большой запас: запись обновляется заранее.
+	l.random = func() float64 { return 0.9999999 }
+	if !l.expiresEarly(env, 1, *now) {
+		t.Fatal("expected early expiration")
+	}
+	if l.expiresEarly(env, 0, *now) {
+		t.Fatal("beta = 0 must disable early expiration")
+	}
+}
@@ -0,0 +1,276 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LocalCache — in-process LRU с TTL. Используется как запасной кэш,
+// когда Redis недоступен, и как самостоятельный кэш в тестах.
+type LocalCache struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List // в начале — самые недавно использованные
+	tags     map[string]map[string]struct{}
+	now      func() time.Time
+}
+
+type localEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time // нулевое значение — без срока жизни
+	tags      []string
+}
+
+func NewLocalCache(capacity int) *LocalCache {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &LocalCache{
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+		tags:     make(map[string]map[string]struct{}),
+		now:      time.Now,
+	}
+}
+
+func (l *LocalCache) expired(e *localEntry) bool {
+	return !e.expiresAt.IsZero() && !l.now().Before(e.expiresAt)
+}
+
+func (l *LocalCache) removeElement(el *list.Element) {
+	entry := el.Value.(*localEntry)
+	l.order.Remove(el)
+	delete(l.items, entry.key)
+
+	for _, tag := range entry.tags {
+		keys := l.tags[tag]
+		delete(keys, entry.key)
+		if len(keys) == 0 {
+			delete(l.tags, tag)
+		}
+	}
+}
+
+// lookup возвращает живую запись и помечает её как недавно использованную.
+// Вызывается под l.mu.
+func (l *LocalCache) lookup(key string) *localEntry {
+	el, ok := l.items[key]
+	if !ok {
+		return nil
+	}
+	entry := el.Value.(*localEntry)
+	if l.expired(entry) {
+		l.removeElement(el)
+		return nil
+	}
+	l.order.MoveToFront(el)
+	return entry
+}
+
+// store записывает значение, вытесняя самые старые записи при переполнении.
+// Вызывается под l.mu.
+func (l *LocalCache) store(key string, value []byte, expiresAt time.Time) *localEntry {
+	if el, ok := l.items[key]; ok {
+		entry := el.Value.(*localEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		l.order.MoveToFront(el)
+		return entry
+	}
+
+	entry := &localEntry{key: key, value: value, expiresAt: expiresAt}
+	l.items[key] = l.order.PushFront(entry)
+	for l.order.Len() > l.capacity {
+		l.removeElement(l.order.Back())
+	}
+	return entry
+}
+
+func (l *LocalCache) expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return l.now().Add(ttl)
+}
+
+func (l *LocalCache) Get(ctx context.Context, key string) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry := l.lookup(key)
+	if entry == nil {
+		return nil, ErrMiss
+	}
+	return append([]byte(nil), entry.value...), nil
+}
+
+func (l *LocalCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.store(key, append([]byte(nil), value...), l.expiry(ttl))
+	return nil
+}
+
+func (l *LocalCache) SetWithTags(ctx context.Context, key string, value []byte, ttl time.Duration, tags []string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry := l.store(key, append([]byte(nil), value...), l.expiry(ttl))
+	for _, tag := range tags {
+		keys, ok := l.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			l.tags[tag] = keys
+		}
+		if _, ok := keys[key]; !ok {
+			keys[key] = struct{}{}
+			entry.tags = append(entry.tags, tag)
+		}
+	}
+	return nil
+}
+
+func (l *LocalCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, tag := range tags {
+		for key := range l.tags[tag] {
+			if el, ok := l.items[key]; ok {
+				l.removeElement(el)
+			}
+		}
+		delete(l.tags, tag)
+	}
+	return nil
+}
+
+func (l *LocalCache) Delete(ctx context.Context, keys ...string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, key := range keys {
+		if el, ok := l.items[key]; ok {
+			l.removeElement(el)
+		}
+	}
+	return nil
+}
+
+func (l *LocalCache) DeletePattern(ctx context.Context, pattern string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, el := range l.items {
+		if matchPattern(pattern, key) {
+			l.removeElement(el)
+		}
+	}
+	return nil
+}
+
+func (l *LocalCache) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var val int64
+	expiresAt := l.expiry(ttl)
+	if entry := l.lookup(key); entry != nil {
+		current, err := strconv.ParseInt(string(entry.value), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		val = current
+		expiresAt = entry.expiresAt
+	}
+
+	val++
+	l.store(key, []byte(strconv.FormatInt(val, 10)), expiresAt)
+	return val, nil
+}
+
+func (l *LocalCache) Take(ctx context.Context, key string, bucket TokenBucket) (TakeResult, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	nowMs := l.now().UnixMilli()
+	tokens, lastMs := float64(bucket.Capacity), nowMs
+	if entry := l.lookup(key); entry != nil {
+		// Значение хранится как "tokens:at", как поля хеша в Redis.
+		if t, at, ok := strings.Cut(string(entry.value), ":"); ok {
+			tokens, _ = strconv.ParseFloat(t, 64)
+			lastMs, _ = strconv.ParseInt(at, 10, 64)
+		}
+	}
+
+	tokens, allowed := bucket.take(tokens, lastMs, nowMs)
+	res := bucket.result(tokens, allowed)
+
+	value := strconv.FormatFloat(tokens, 'f', -1, 64) + ":" + strconv.FormatInt(nowMs, 10)
+	l.store(key, []byte(value), l.expiry(res.Reset+time.Second))
+	return res, nil
+}
+
+func (l *LocalCache) Flush(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.items = make(map[string]*list.Element)
+	l.tags = make(map[string]map[string]struct{})
+	l.order.Init()
+	return nil
+}
+
+func (l *LocalCache) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (l *LocalCache) Backend() string {
+	return BackendLocal
+}
+
+// Len возвращает количество записей, включая ещё не удалённые просроченные.
+func (l *LocalCache) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.order.Len()
+}
+
+// matchPattern сопоставляет ключ с glob-шаблоном Redis: * — любая
+// последовательность, ? — один символ. Классы [..] не поддерживаются.
+func matchPattern(pattern, key string) bool {
+	p, k := 0, 0
+	star, match := -1, 0
+
+	for k < len(key) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == key[k]):
+			p++
+			k++
+		case p < len(pattern) && pattern[p] == '*':
+			star = p
+			match = k
+			p++
+		case star != -1:
+			p = star + 1
+			match++
+			k = match
+		default:
+			return false
+		}
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
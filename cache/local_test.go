@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLocalCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	c := NewLocalCache(2)
+
+	c.Set(ctx, "a", []byte("1"), 0)
+	c.Set(ctx, "b", []byte("2"), 0)
+	if _, err := c.Get(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	c.Set(ctx, "c", []byte("3"), 0)
+
+	if _, err := c.Get(ctx, "b"); !errors.Is(err, ErrMiss) {
+		t.Fatalf("b should be evicted, got %v", err)
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, err := c.Get(ctx, key); err != nil {
+			t.Fatalf("%s should survive eviction: %v", key, err)
+		}
+	}
+}
+
+func TestLocalCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	c := NewLocalCache(10)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	c.Set(ctx, "k", []byte("v"), time.Minute)
+	if count, _ := c.Increment(ctx, "counter", time.Minute); count != 1 {
+		t.Fatalf("first increment = %d", count)
+	}
+	if count, _ := c.Increment(ctx, "counter", time.Minute); count != 2 {
+		t.Fatalf("second increment = %d", count)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := c.Get(ctx, "k"); !errors.Is(err, ErrMiss) {
+		t.Fatalf("expired key returned %v", err)
+	}
+	if count, _ := c.Increment(ctx, "counter", time.Minute); count != 1 {
+		t.Fatalf("counter did not reset after TTL, got %d", count)
+	}
+}
+
+func TestLocalCacheDeletePattern(t *testing.T) {
+	ctx := context.Background()
+	c := NewLocalCache(10)
+
+	c.Set(ctx, "cache:1:/api/diary?", []byte("x"), 0)
+	c.Set(ctx, "cache:1:/api/habits/logs?user_id=2", []byte("x"), 0)
+	c.Set(ctx, "cache:12:/api/diary?", []byte("x"), 0)
+
+	if err := c.DeletePattern(ctx, "cache:1:*"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 1 {
+		t.Fatalf("got %d keys left, want 1", c.Len())
+	}
+	if _, err := c.Get(ctx, "cache:12:/api/diary?"); err != nil {
+		t.Fatalf("foreign key deleted: %v", err)
+	}
+}
+
+func TestLocalCacheInvalidateTags(t *testing.T) {
+	ctx := context.Background()
+	c := NewLocalCache(10)
+
+	c.SetWithTags(ctx, "a", []byte("1"), time.Minute, []string{"user:1", "diary:1"})
+	c.SetWithTags(ctx, "b", []byte("2"), time.Minute, []string{"user:1", "habits:1"})
+	c.SetWithTags(ctx, "c", []byte("3"), time.Minute, []string{"user:2", "diary:2"})
+
+	if err := c.InvalidateTags(ctx, "diary:1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(ctx, "a"); !errors.Is(err, ErrMiss) {
+		t.Fatalf("a should be invalidated, got %v", err)
+	}
+	for _, key := range []string{"b", "c"} {
+		if _, err := c.Get(ctx, key); err != nil {
+			t.Fatalf("%s should survive: %v", key, err)
+		}
+	}
+
+	c.InvalidateTags(ctx, "user:1")
+	if c.Len() != 1 {
+		t.Fatalf("got %d keys left, want 1", c.Len())
+	}
+
+	// Удалённый ключ не должен оставаться в индексах тегов.
+	c.Delete(ctx, "c")
+	if len(c.tags) != 0 {
+		t.Fatalf("tag index leaked: %v", c.tags)
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	cases := []struct {
+		pattern, key string
+		want         bool
+	}{
+		{"*", "anything", true},
+		{"cache:?:*", "cache:1:/x", true},
+		{"cache:?:*", "cache:12:/x", false},
+		{"user_stats:*", "user_stats:5", true},
+		{"user_stats:*", "cache:5", false},
+		{"a*b*c", "a--b--c", true},
+		{"a*b*c", "a--c", false},
+	}
+	for _, tc := range cases {
+		if got := matchPattern(tc.pattern, tc.key); got != tc.want {
+			t.Errorf("matchPattern(%q, %q) = %v, want %v", tc.pattern, tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestLocalCacheTokenBucket(t *testing.T) {
+	ctx := context.Background()
+	c := NewLocalCache(10)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	bucket := TokenBucket{Capacity: 3, Period: 3 * time.Second}
+
+	for i := 0; i < 3; i++ {
+		res, _ := c.Take(ctx, "b", bucket)
+		if !res.Allowed || res.Remaining != 2-i {
+			t.Fatalf("take %d = %+v", i, res)
+		}
+	}
+
+	res, _ := c.Take(ctx, "b", bucket)
+	if res.Allowed || res.RetryAfter != time.Second || res.Reset != 3*time.Second {
+		t.Fatalf("empty bucket = %+v", res)
+	}
+
+	// Токен восстанавливается за Period/Capacity.
+	now = now.Add(time.Second)
+	if res, _ := c.Take(ctx, "b", bucket); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("after refill = %+v", res)
+	}
+}
@@ -2,32 +2,18 @@
 package cache
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"net/http"
 	"os"
+	"strconv"
 	"time"
 
-	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
-	"go.uber.org/zap"
 )
 
-var (
-	Client *redis.Client
-	ctx    = context.Background()
-)
-
-type CachedResponse struct {
-	Status      int         `json:"status"`
-	ContentType string      `json:"content_type"`
-	Body        []byte      `json:"body"`
-	Headers     http.Header `json:"headers"`
-}
-
-func InitRedis(logger *zap.Logger) error {
+// NewRedisClient создаёт клиент по REDIS_HOST/REDIS_PORT. Соединение
+// устанавливается лениво, поэтому клиент создаётся даже при недоступном Redis.
+func NewRedisClient() *redis.Client {
 	redisHost := os.Getenv("REDIS_HOST")
 	if redisHost == "" {
 		redisHost = "localhost"
@@ -38,10 +24,8 @@ func InitRedis(logger *zap.Logger) error {
 		redisPort = "6379"
 	}
 
-	addr := fmt.Sprintf("%s:%s", redisHost, redisPort)
-
-	Client = redis.NewClient(&redis.Options{
-		Addr:         addr,
+	return redis.NewClient(&redis.Options{
+		Addr:         fmt.Sprintf("%s:%s", redisHost, redisPort),
 		Password:     "",
 		DB:           0,
 		DialTimeout:  5 * time.Second,
@@ -49,67 +33,59 @@ func InitRedis(logger *zap.Logger) error {
 		WriteTimeout: 3 * time.Second,
 		PoolSize:     10,
 	})
+}
 
-	if err := Client.Ping(ctx).Err(); err != nil {
-		logger.Error("redis_connection_failed",
-			zap.Error(err),
-			zap.String("addr", addr),
-		)
-		return err
-	}
-
-	logger.Info("redis_connected",
-		zap.String("addr", addr),
-	)
-
-	return nil
+// RedisCache — реализация Cache поверх go-redis.
+type RedisCache struct {
+	client *redis.Client
 }
 
-func Set(key string, value interface{}, expiration time.Duration) error {
-	data, err := json.Marshal(value)
-	if err != nil {
-		return fmt.Errorf("cache marshal failed: %w", err)
-	}
+func NewRedisCache(client *redis.Client) *RedisCache {
+	return &RedisCache{client: client}
+}
 
-	return Client.Set(ctx, key, data, expiration).Err()
+// Client отдаёт исходный клиент для операций, которых нет в интерфейсе Cache.
+func (r *RedisCache) Client() *redis.Client {
+	return r.client
 }
 
-// Get читает значение из Redis и десериализует в dest
-func Get(key string, dest interface{}) error {
-	val, err := Client.Get(ctx, key).Result()
+func (r *RedisCache) Get(ctx context.Context, key string) ([]byte, error) {
+	val, err := r.client.Get(ctx, key).Bytes()
 	if err == redis.Nil {
-		return fmt.Errorf("cache miss: %w", err)
+		return nil, ErrMiss
 	} else if err != nil {
-		return fmt.Errorf("cache get failed: %w", err)
-	}
-
-	if err := json.Unmarshal([]byte(val), dest); err != nil {
-		return fmt.Errorf("cache unmarshal failed: %w", err)
+		return nil, fmt.Errorf("cache get failed: %w", err)
 	}
+	return val, nil
+}
 
-	return nil
+func (r *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(ctx, key, value, ttl).Err()
 }
 
-// Delete удаляет ключ
-func Delete(key string) error {
-	return Client.Del(ctx, key).Err()
+func (r *RedisCache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return r.client.Del(ctx, keys...).Err()
 }
 
 // DeletePattern удаляет все ключи по шаблону (например, cache:1:*)
-func DeletePattern(pattern string) error {
+func (r *RedisCache) DeletePattern(ctx context.Context, pattern string) error {
 	var cursor uint64
 	for {
-		keys, cursor, err := Client.Scan(ctx, cursor, pattern, 100).Result()
+		keys, next, err := r.client.Scan(ctx, cursor, pattern, 100).Result()
 		if err != nil {
 			return fmt.Errorf("scan failed: %w", err)
 		}
 
 		if len(keys) > 0 {
-			if err := Client.Del(ctx, keys...).Err(); err != nil {
+			if err := r.client.Del(ctx, keys...).Err(); err != nil {
 				return fmt.Errorf("delete keys failed: %w", err)
 			}
 		}
 
+		cursor = next
 		if cursor == 0 {
 			break
 		}
@@ -117,16 +93,16 @@ func DeletePattern(pattern string) error {
 	return nil
 }
 
-// IncrementCounter увеличивает счётчик и устанавливает TTL при первом инкременте
-func IncrementCounter(key string, expiration time.Duration) (int64, error) {
-	val, err := Client.Incr(ctx, key).Result()
+// Increment увеличивает счётчик и устанавливает TTL при первом инкременте
+func (r *RedisCache) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	val, err := r.client.Incr(ctx, key).Result()
 	if err != nil {
 		return 0, err
 	}
 
 	// Устанавливаем TTL только при первом увеличении (когда val становится 1)
 	if val == 1 {
-		if err := Client.Expire(ctx, key, expiration).Err(); err != nil {
+		if err := r.client.Expire(ctx, key, ttl).Err(); err != nil {
 			return val, err
 		}
 	}
@@ -134,26 +110,127 @@ func IncrementCounter(key string, expiration time.Duration) (int64, error) {
 	return val, nil
 }
 
-// Close закрывает соединение с Redis
-func Close() error {
-	if Client != nil {
-		return Client.Close()
+// setWithTagsScript атомарно пишет значение и добавляет ключ в множества тегов.
+// Множество живёт не меньше самой долгоживущей записи в нём, иначе тег
+// «забудет» ключ раньше, чем тот истечёт.
+// KEYS[1] — ключ, KEYS[2..] — множества тегов; ARGV[1] — значение, ARGV[2] — TTL в мс.
+var setWithTagsScript = redis.NewScript(`
+local ttl = tonumber(ARGV[2])
+if ttl > 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ttl)
+else
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+for i = 2, #KEYS do
+	redis.call('SADD', KEYS[i], KEYS[1])
+	if ttl > 0 then
+		local current = redis.call('PTTL', KEYS[i])
+		if (current == -1 and redis.call('SCARD', KEYS[i]) == 1) or (current >= 0 and current < ttl) then
+			redis.call('PEXPIRE', KEYS[i], ttl)
+		end
+	else
+		redis.call('PERSIST', KEYS[i])
+	end
+end
+return 1
+`)
+
+// invalidateTagsScript удаляет ключи из множеств тегов и сами множества.
+// KEYS — множества тегов.
+var invalidateTagsScript = redis.NewScript(`
+local deleted = 0
+for i = 1, #KEYS do
+	local members = redis.call('SMEMBERS', KEYS[i])
+	for j = 1, #members, 500 do
+		deleted = deleted + redis.call('DEL', unpack(members, j, math.min(j + 499, #members)))
+	end
+	redis.call('DEL', KEYS[i])
+end
+return deleted
+`)
+
+func (r *RedisCache) SetWithTags(ctx context.Context, key string, value []byte, ttl time.Duration, tags []string) error {
+	keys := make([]string, 0, len(tags)+1)
+	keys = append(keys, key)
+	for _, tag := range tags {
+		keys = append(keys, tagKey(tag))
+	}
+
+	if err := setWithTagsScript.Run(ctx, r.client, keys, value, ttl.Milliseconds()).Err(); err != nil {
+		return fmt.Errorf("cache set with tags failed: %w", err)
+	}
+	return nil
+}
+
+func (r *RedisCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		keys = append(keys, tagKey(tag))
+	}
+
+	if err := invalidateTagsScript.Run(ctx, r.client, keys).Err(); err != nil {
+		return fmt.Errorf("invalidate tags failed: %w", err)
 	}
 	return nil
 }
 
-// Вспомогательная функция для логирования тела ответа (используется в middleware)
-type bodyLogWriter struct {
-	gin.ResponseWriter
-	body *bytes.Buffer
+// takeScript — атомарная версия TokenBucket.take: состояние ведра хранится
+// в хеше (tokens, at) и живёт, пока ведро не наполнится снова.
+// KEYS[1] — ведро; ARGV[1] — ёмкость, ARGV[2] — токенов в мс, ARGV[3] — текущее время в мс.
+var takeScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'at')
+local tokens = tonumber(state[1]) or capacity
+local at = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - at) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'at', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) / rate) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+func (r *RedisCache) Take(ctx context.Context, key string, bucket TokenBucket) (TakeResult, error) {
+	reply, err := takeScript.Run(ctx, r.client, []string{key},
+		bucket.Capacity, bucket.perMilli(), time.Now().UnixMilli()).Slice()
+	if err != nil {
+		return TakeResult{}, fmt.Errorf("take token failed: %w", err)
+	}
+	if len(reply) != 2 {
+		return TakeResult{}, fmt.Errorf("take token: unexpected reply %v", reply)
+	}
+
+	allowed, _ := reply[0].(int64)
+	raw, _ := reply[1].(string)
+	tokens, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return TakeResult{}, fmt.Errorf("take token: parse tokens %q: %w", raw, err)
+	}
+	return bucket.result(tokens, allowed == 1), nil
+}
+
+func (r *RedisCache) Flush(ctx context.Context) error {
+	return r.client.FlushDB(ctx).Err()
 }
 
-func (w *bodyLogWriter) Write(b []byte) (int, error) {
-	w.body.Write(b)
-	return w.ResponseWriter.Write(b)
+func (r *RedisCache) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
 }
 
-func (w *bodyLogWriter) WriteString(s string) (int, error) {
-	w.body.WriteString(s)
-	return w.ResponseWriter.WriteString(s)
+func (r *RedisCache) Backend() string {
+	return BackendRedis
+}
+
+// Close закрывает соединение с Redis
+func (r *RedisCache) Close() error {
+	return r.client.Close()
 }
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisCacheInvalidateTags(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	r := NewRedisCache(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+
+	if err := r.SetWithTags(ctx, "short", []byte("1"), time.Minute, []string{"user:1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetWithTags(ctx, "long", []byte("2"), time.Hour, []string{"user:1", "diary:1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetWithTags(ctx, "other", []byte("3"), time.Minute, []string{"user:2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Множество тега живёт не меньше самой долгоживущей записи.
+	if ttl := mr.TTL(tagKey("user:1")); ttl != time.Hour {
+		t.Fatalf("tag ttl = %v, want 1h", ttl)
+	}
+
+	if err := r.InvalidateTags(ctx, "user:1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"short", "long", tagKey("user:1")} {
+		if mr.Exists(key) {
+			t.Fatalf("%s survived invalidation", key)
+		}
+	}
+	if !mr.Exists("other") {
+		t.Fatal("foreign key was invalidated")
+	}
+}
+
+func TestRedisCacheTokenBucket(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	r := NewRedisCache(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	bucket := TokenBucket{Capacity: 2, Period: time.Hour}
+
+	for i := 0; i < 2; i++ {
+		res, err := r.Take(ctx, "b", bucket)
+		if err != nil || !res.Allowed || res.Remaining != 1-i {
+			t.Fatalf("take %d = %+v, %v", i, res, err)
+		}
+	}
+
+	res, err := r.Take(ctx, "b", bucket)
+	if err != nil || res.Allowed {
+		t.Fatalf("empty bucket = %+v, %v", res, err)
+	}
+	if res.RetryAfter <= 0 || res.RetryAfter > 30*time.Minute {
+		t.Fatalf("retry after = %v", res.RetryAfter)
+	}
+	if ttl := mr.TTL("b"); ttl <= 0 || ttl > time.Hour+time.Second {
+		t.Fatalf("bucket ttl = %v", ttl)
+	}
+
+	if res, _ := r.Take(ctx, "other", bucket); !res.Allowed {
+		t.Fatal("buckets must be independent")
+	}
+}
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// writeClockTTL — сколько хранится время последней записи под тегом.
+const writeClockTTL = 30 * 24 * time.Hour
+
+// Ресурсы, по которым строятся теги инвалидации.
+const (
+	ResourceHabits = "habits" // привычки, их логи и статистика
+	ResourceDiary  = "diary"
+)
+
+// UserTag объединяет все записи, закэшированные для пользователя.
+func UserTag(userID uint) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// ResourceTag помечает записи с данными ресурса одного владельца.
+func ResourceTag(resource string, ownerID uint) string {
+	return fmt.Sprintf("%s:%d", resource, ownerID)
+}
+
+// AllResourceTag помечает выборки, в которые могут попасть данные
+// любого пользователя, — например, админские списки.
+func AllResourceTag(resource string) string {
+	return resource + ":all"
+}
+
+// WriteTags возвращает теги, которые нужно сбросить после изменения
+// ресурса указанных владельцев.
+func WriteTags(resource string, ownerIDs ...uint) []string {
+	tags := make([]string, 0, len(ownerIDs)+1)
+	for _, id := range ownerIDs {
+		tags = append(tags, ResourceTag(resource, id))
+	}
+	return append(tags, AllResourceTag(resource))
+}
+
+// tagKey — ключ множества, в котором хранятся ключи тега.
+func tagKey(tag string) string {
+	return "tag:" + tag
+}
+
+// TouchTags запоминает время последней записи под тегами. Оно нужно для
+// Last-Modified выборок: удалённая запись не оставляет updated_at,
+// по которому изменение можно было бы заметить.
+func TouchTags(ctx context.Context, c Cache, at time.Time, tags ...string) error {
+	value := []byte(at.UTC().Format(time.RFC3339Nano))
+	for _, tag := range tags {
+		if err := c.Set(ctx, writeClockKey(tag), value, writeClockTTL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LastWrite возвращает время последней записи под тегом или ErrMiss,
+// если отметки нет (записей не было или кэш сброшен).
+func LastWrite(ctx context.Context, c Cache, tag string) (time.Time, error) {
+	data, err := c.Get(ctx, writeClockKey(tag))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339Nano, string(data))
+}
+
+const writeClockPrefix = "tag_clock:"
+
+func writeClockKey(tag string) string {
+	return writeClockPrefix + tag
+}
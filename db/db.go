@@ -42,10 +42,13 @@ func Connect() {
 	for i := 0; i < maxRetries; i++ {
 		DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
 			Logger: gormLogger,
+			// Postgres хранит время с точностью до микросекунд; обрезаем заранее,
+			// чтобы значение в структуре совпадало с сохранённым (на нём строятся ETag).
 			NowFunc: func() time.Time {
-				return time.Now().UTC()
+				return time.Now().UTC().Truncate(time.Microsecond)
 			},
-			PrepareStmt: true,
+			PrepareStmt:    true,
+			TranslateError: true,
 		})
 
 		if err == nil {
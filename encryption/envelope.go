@@ -0,0 +1,189 @@
+// Package encryption шифрует данные при хранении конвертным способом:
+// каждое значение шифруется своим случайным ключом данных (DEK), а DEK —
+// мастер-ключом из локального файла. Смена мастер-ключа не требует
+// перешифровывать данные: достаточно оставить старый ключ в файле.
+package encryption
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// prefix отмечает зашифрованные значения; строки без него считаются
+// открытым текстом, записанным до включения шифрования.
+const prefix = "sealed:v1:"
+
+var (
+	ErrUnknownKey = errors.New("unknown master key")
+	ErrMalformed  = errors.New("malformed sealed value")
+)
+
+// Envelope хранит мастер-ключи. Новые значения шифруются активным ключом,
+// расшифровываются — ключом, id которого записан в значении.
+type Envelope struct {
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+// NewEnvelope создаёт Envelope из ключей AES-256; активный ключ — active.
+func NewEnvelope(active string, keys map[string][]byte) (*Envelope, error) {
+	if _, ok := keys[active]; !ok {
+		return nil, fmt.Errorf("active key %q: %w", active, ErrUnknownKey)
+	}
+	e := &Envelope{active: active, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid key id %q", id)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		e.keys[id] = aead
+	}
+	return e, nil
+}
+
+// LoadKeyFile читает файл мастер-ключей: по строке "id:base64-ключ" на ключ,
+// пустые строки и строки с # пропускаются. Активный ключ — первый в файле.
+// Ключ можно получить командой `openssl rand -base64 32`.
+func LoadKeyFile(path string) (*Envelope, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var active string
+	keys := make(map[string][]byte)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		id, encoded, ok := strings.Cut(text, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected id:key", path, line)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: key is not base64: %w", path, line, err)
+		}
+		if _, dup := keys[id]; dup {
+			return nil, fmt.Errorf("%s:%d: duplicate key id %q", path, line, id)
+		}
+		if active == "" {
+			active = id
+		}
+		keys[id] = key
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if active == "" {
+		return nil, fmt.Errorf("%s: no keys", path)
+	}
+	return NewEnvelope(active, keys)
+}
+
+// Seal шифрует plaintext и возвращает строку вида
+// sealed:v1:<id ключа>:<зашифрованный DEK>:<шифротекст>.
+func (e *Envelope) Seal(plaintext string) (string, error) {
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	wrapped, err := seal(e.keys[e.active], dek)
+	if err != nil {
+		return "", err
+	}
+	data, err := newAEAD(dek)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(data, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return prefix + e.active + ":" +
+		base64.RawStdEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Open расшифровывает значение Seal; открытый текст возвращается как есть.
+func (e *Envelope) Open(value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", ErrMalformed
+	}
+	master, ok := e.keys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("key %q: %w", parts[0], ErrUnknownKey)
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	dek, err := open(master, wrapped)
+	if err != nil {
+		return "", fmt.Errorf("unwrap data key: %w", err)
+	}
+	data, err := newAEAD(dek)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(data, ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("decrypt: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// IsSealed сообщает, зашифровано ли значение.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal возвращает nonce, за которым следует шифротекст.
+func seal(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(aead cipher.AEAD, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
@@ -0,0 +1,99 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func randomKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	e, err := NewEnvelope("k1", map[string][]byte{"k1": randomKey(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := e.Seal("Сегодня был хороший день")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSealed(sealed) || strings.Contains(sealed, "хороший") {
+		t.Fatalf("value not sealed: %q", sealed)
+	}
+	again, _ := e.Seal("Сегодня был хороший день")
+	if again == sealed {
+		t.Fatal("sealing the same text twice must differ")
+	}
+
+	plain, err := e.Open(sealed)
+	if err != nil || plain != "Сегодня был хороший день" {
+		t.Fatalf("open: %q, %v", plain, err)
+	}
+	if plain, err := e.Open("legacy plaintext"); err != nil || plain != "legacy plaintext" {
+		t.Fatalf("plaintext passthrough: %q, %v", plain, err)
+	}
+
+	tampered := sealed[:len(sealed)-2] + "AA"
+	if _, err := e.Open(tampered); err == nil {
+		t.Fatal("tampered value must not decrypt")
+	}
+}
+
+func TestLoadKeyFileRotation(t *testing.T) {
+	oldKey, newKey := randomKey(t), randomKey(t)
+	previous, _ := NewEnvelope("old", map[string][]byte{"old": oldKey})
+	sealed, _ := previous.Seal("secret")
+
+	path := filepath.Join(t.TempDir(), "keys")
+	content := "# активный ключ первым\n" +
+		"new:" + base64.StdEncoding.EncodeToString(newKey) + "\n\n" +
+		"old:" + base64.StdEncoding.EncodeToString(oldKey) + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := LoadKeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := e.Open(sealed); err != nil || plain != "secret" {
+		t.Fatalf("old key must still decrypt: %q, %v", plain, err)
+	}
+	fresh, _ := e.Seal("secret")
+	if !strings.HasPrefix(fresh, prefix+"new:") {
+		t.Fatalf("new values must use the active key: %q", fresh)
+	}
+
+	onlyNew, _ := NewEnvelope("new", map[string][]byte{"new": newKey})
+	if _, err := onlyNew.Open(sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected ErrUnknownKey, got %v", err)
+	}
+}
+
+func TestLoadKeyFileRejectsBadKeys(t *testing.T) {
+	for name, content := range map[string]string{
+		"empty":     "# нет ключей\n",
+		"no id":     base64.StdEncoding.EncodeToString(make([]byte, 32)) + "\n",
+		"short key": "k:" + base64.StdEncoding.EncodeToString(make([]byte, 16)) + "\n",
+	} {
+		path := filepath.Join(t.TempDir(), "keys")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadKeyFile(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
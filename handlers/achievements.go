@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/services"
+	"github.com/Bekzhanizb/HabitTrackerBackend/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// AchievementHandler выдаёт достижения пользователям.
+type AchievementHandler struct {
+	achievements *services.AchievementService
+}
+
+func NewAchievementHandler(achievements *services.AchievementService) *AchievementHandler {
+	return &AchievementHandler{achievements: achievements}
+}
+
+type AwardAchievementRequest struct {
+	Title       string `json:"title" binding:"required,min=1,max=100"`
+	Description string `json:"description" binding:"max=500"`
+}
+
+// AwardAchievement — POST /api/admin/users/:id/achievements: выдаёт
+// достижение и отвечает сразу; пользователь уведомляется по всем каналам
+// в фоне.
+func (h *AchievementHandler) AwardAchievement(c *gin.Context) {
+	userID, ok := parseIDParam(c, "AwardAchievement")
+	if !ok {
+		return
+	}
+
+	var req AwardAchievementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorCount.WithLabelValues("AwardAchievement", "validation").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректные данные", "details": err.Error()})
+		return
+	}
+
+	achievement, err := h.achievements.Award(c.Request.Context(), userID, strings.TrimSpace(req.Title), strings.TrimSpace(req.Description))
+	if err != nil {
+		respondServiceError(c, "AwardAchievement", err)
+		return
+	}
+
+	utils.Logger.Info("achievement_awarded",
+		zap.Uint("achievement_id", achievement.ID),
+		zap.Uint("user_id", userID),
+	)
+	c.JSON(http.StatusCreated, achievement)
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/middleware"
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/services"
+	"github.com/Bekzhanizb/HabitTrackerBackend/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// multipartOverhead — запас на заголовки multipart сверх размера файла.
+const multipartOverhead = 64 << 10
+
+// AttachmentHandler обслуживает вложения записей дневника. Файлы отдаются
+// только через эти маршруты, с проверкой прав, в отличие от аватаров
+// в публичной папке /uploads.
+type AttachmentHandler struct {
+	attachments *services.AttachmentService
+}
+
+func NewAttachmentHandler(attachments *services.AttachmentService) *AttachmentHandler {
+	return &AttachmentHandler{attachments: attachments}
+}
+
+// AttachmentResponse дополняет вложение адресами для скачивания. Адреса
+// требуют авторизации: токен в заголовке или cookie.
+type AttachmentResponse struct {
+	models.DiaryAttachment
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+func attachmentResponse(a models.DiaryAttachment) AttachmentResponse {
+	resp := AttachmentResponse{
+		DiaryAttachment: a,
+		URL:             fmt.Sprintf("/api/diary/%d/attachments/%d", a.DiaryID, a.ID),
+	}
+	if a.ThumbnailKey != "" {
+		resp.ThumbnailURL = resp.URL + "/thumbnail"
+	}
+	return resp
+}
+
+// UploadAttachment — POST /api/diary/:id/attachments, файл в поле file.
+func (h *AttachmentHandler) UploadAttachment(c *gin.Context) {
+	id, ok := parseIDParam(c, "UploadAttachment")
+	if !ok {
+		return
+	}
+
+	currentUser, ok := userFromContext(c, "UploadAttachment")
+	if !ok {
+		return
+	}
+
+	maxSize := h.attachments.Limits().MaxFileSize
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+multipartOverhead)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondServiceError(c, "UploadAttachment", fmt.Errorf("request body over %d bytes: %w", tooLarge.Limit, services.ErrTooLarge))
+			return
+		}
+		utils.ErrorCount.WithLabelValues("UploadAttachment", "validation").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Файл не передан", "details": err.Error()})
+		return
+	}
+	if header.Size > maxSize {
+		respondServiceError(c, "UploadAttachment", fmt.Errorf("file is %d bytes, limit %d: %w", header.Size, maxSize, services.ErrTooLarge))
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		respondServiceError(c, "UploadAttachment", err)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		respondServiceError(c, "UploadAttachment", err)
+		return
+	}
+
+	attachment, err := h.attachments.Upload(c.Request.Context(), currentUser, id, header.Filename, data)
+	if err != nil {
+		respondServiceError(c, "UploadAttachment", err)
+		return
+	}
+
+	utils.Logger.Info("attachment_uploaded",
+		zap.Uint("diary_id", id),
+		zap.Uint("attachment_id", attachment.ID),
+		zap.String("content_type", attachment.ContentType),
+		zap.Int64("size", attachment.Size),
+	)
+	c.JSON(http.StatusCreated, attachmentResponse(*attachment))
+}
+
+// GetAttachments — GET /api/diary/:id/attachments.
+func (h *AttachmentHandler) GetAttachments(c *gin.Context) {
+	id, ok := parseIDParam(c, "GetAttachments")
+	if !ok {
+		return
+	}
+
+	currentUser, ok := userFromContext(c, "GetAttachments")
+	if !ok {
+		return
+	}
+
+	attachments, err := h.attachments.List(c.Request.Context(), currentUser, id)
+	if err != nil {
+		respondServiceError(c, "GetAttachments", err)
+		return
+	}
+
+	resp := make([]AttachmentResponse, 0, len(attachments))
+	for _, a := range attachments {
+		resp = append(resp, attachmentResponse(a))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// DownloadAttachment — GET /api/diary/:id/attachments/:attachmentID.
+func (h *AttachmentHandler) DownloadAttachment(c *gin.Context) {
+	h.serve(c, "DownloadAttachment", false)
+}
+
+// GetThumbnail — GET /api/diary/:id/attachments/:attachmentID/thumbnail.
+func (h *AttachmentHandler) GetThumbnail(c *gin.Context) {
+	h.serve(c, "GetThumbnail", true)
+}
+
+func (h *AttachmentHandler) serve(c *gin.Context, handler string, thumb bool) {
+	id, ok := parseIDParam(c, handler)
+	if !ok {
+		return
+	}
+	attachmentID, ok := attachmentIDParam(c, handler)
+	if !ok {
+		return
+	}
+
+	currentUser, ok := userFromContext(c, handler)
+	if !ok {
+		return
+	}
+
+	attachment, content, err := h.attachments.Open(c.Request.Context(), currentUser, id, attachmentID, thumb)
+	if err != nil {
+		respondServiceError(c, handler, err)
+		return
+	}
+	defer content.Close()
+
+	contentType, name := attachment.ContentType, attachment.FileName
+	if thumb {
+		contentType, name = "image/jpeg", "thumbnail.jpg"
+	}
+	// Изображения показываются на странице, остальное только скачивается,
+	// а sandbox не даёт выполнить скрипты, даже если браузер откроет файл.
+	disposition := "attachment"
+	if strings.HasPrefix(contentType, "image/") {
+		disposition = "inline"
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": name}))
+	c.Header("Content-Security-Policy", "default-src 'none'; sandbox")
+	if attachment.Encrypted {
+		middleware.NoStore(c)
+	} else {
+		c.Header("Cache-Control", "private, max-age=3600")
+	}
+	http.ServeContent(c.Writer, c.Request, name, attachment.CreatedAt, content)
+}
+
+// DeleteAttachment — DELETE /api/diary/:id/attachments/:attachmentID.
+func (h *AttachmentHandler) DeleteAttachment(c *gin.Context) {
+	id, ok := parseIDParam(c, "DeleteAttachment")
+	if !ok {
+		return
+	}
+	attachmentID, ok := attachmentIDParam(c, "DeleteAttachment")
+	if !ok {
+		return
+	}
+
+	currentUser, ok := userFromContext(c, "DeleteAttachment")
+	if !ok {
+		return
+	}
+
+	if err := h.attachments.Delete(c.Request.Context(), currentUser, id, attachmentID); err != nil {
+		respondServiceError(c, "DeleteAttachment", err)
+		return
+	}
+
+	utils.Logger.Info("attachment_deleted", zap.Uint("diary_id", id), zap.Uint("attachment_id", attachmentID))
+	c.JSON(http.StatusOK, gin.H{"message": "Вложение удалено"})
+}
+
+// GetAttachmentUsage — GET /api/diary/attachments/usage: занятое место
+// и лимиты; администратор может передать user_id.
+func (h *AttachmentHandler) GetAttachmentUsage(c *gin.Context) {
+	currentUser, ok := userFromContext(c, "GetAttachmentUsage")
+	if !ok {
+		return
+	}
+
+	ownerID, err := ownerParam(c, currentUser)
+	if err != nil {
+		respondBadQuery(c, "GetAttachmentUsage", err)
+		return
+	}
+
+	usage, err := h.attachments.Usage(c.Request.Context(), currentUser, ownerID)
+	if err != nil {
+		respondServiceError(c, "GetAttachmentUsage", err)
+		return
+	}
+	c.JSON(http.StatusOK, usage)
+}
+
+func attachmentIDParam(c *gin.Context, handler string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("attachmentID"), 10, 64)
+	if err != nil || id == 0 {
+		utils.ErrorCount.WithLabelValues(handler, "validation").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment id"})
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -5,15 +5,15 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/Bekzhanizb/HabitTrackerBackend/db"
 	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
 	"github.com/Bekzhanizb/HabitTrackerBackend/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+func AuthMiddleware(users repository.UserRepository) gin.HandlerFunc {
 	var JwtKey = []byte("supersecretkey")
 
 	return func(c *gin.Context) {
@@ -91,8 +91,8 @@ func AuthMiddleware() gin.HandlerFunc {
 		userID := uint(userIDFloat)
 		utils.Logger.Info("user_id_extracted", zap.Uint("user_id", userID))
 
-		var user models.User
-		if err := db.DB.First(&user, userID).Error; err != nil {
+		user, err := users.GetByID(c.Request.Context(), userID)
+		if err != nil {
 			utils.Logger.Warn("user_not_found_in_db",
 				zap.Uint("user_id", userID),
 				zap.Error(err))
@@ -107,9 +107,11 @@ func AuthMiddleware() gin.HandlerFunc {
 			zap.String("role", user.Role))
 
 		// Сохраняем пользователя в контексте
-		c.Set("user", user)
+		c.Set("user", *user)
 		c.Set("user_id", user.ID)
 		c.Set("role", user.Role)
+		// Проверенный токен нужен лимиту запросов по токену.
+		c.Set("token", tokenString)
 
 		utils.Logger.Info("user_set_in_context",
 			zap.Uint("user_id", user.ID),
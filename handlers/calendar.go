@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// Календарь по умолчанию показывает последний год, как тепловая карта GitHub.
+const (
+	defaultCalendarDays = 365
+	maxCalendarDays     = 366
+)
+
+// GetHabitCalendar — GET /api/habits/:id/calendar.
+func (h *HabitHandler) GetHabitCalendar(c *gin.Context) {
+	id, ok := parseIDParam(c, "GetHabitCalendar")
+	if !ok {
+		return
+	}
+	currentUser, ok := userFromContext(c, "GetHabitCalendar")
+	if !ok {
+		return
+	}
+
+	rng, err := calendarRange(c)
+	if err != nil {
+		respondBadQuery(c, "GetHabitCalendar", err)
+		return
+	}
+
+	cal, err := h.stats.HabitCalendar(c.Request.Context(), currentUser, id, rng)
+	if err != nil {
+		respondServiceError(c, "GetHabitCalendar", err)
+		return
+	}
+	c.JSON(http.StatusOK, cal)
+}
+
+// GetHabitTimeline — GET /api/habits/:id/timeline: отметки привычки и
+// связанные записи дневника вперемешку, с параметрами календаря.
+func (h *HabitHandler) GetHabitTimeline(c *gin.Context) {
+	id, ok := parseIDParam(c, "GetHabitTimeline")
+	if !ok {
+		return
+	}
+	currentUser, ok := userFromContext(c, "GetHabitTimeline")
+	if !ok {
+		return
+	}
+
+	rng, err := calendarRange(c)
+	if err != nil {
+		respondBadQuery(c, "GetHabitTimeline", err)
+		return
+	}
+
+	timeline, err := h.habits.Timeline(c.Request.Context(), currentUser, id, rng)
+	if err != nil {
+		respondServiceError(c, "GetHabitTimeline", err)
+		return
+	}
+	for _, item := range timeline.Items {
+		if item.Diary != nil {
+			noStoreEncrypted(c, *item.Diary)
+		}
+	}
+	c.JSON(http.StatusOK, timeline)
+}
+
+// GetCalendar — GET /api/habits/calendar: все привычки пользователя сразу.
+func (h *HabitHandler) GetCalendar(c *gin.Context) {
+	currentUser, ok := userFromContext(c, "GetCalendar")
+	if !ok {
+		return
+	}
+
+	rng, err := calendarRange(c)
+	if err != nil {
+		respondBadQuery(c, "GetCalendar", err)
+		return
+	}
+	ownerID, err := ownerParam(c, currentUser)
+	if err != nil {
+		respondBadQuery(c, "GetCalendar", err)
+		return
+	}
+
+	cal, err := h.stats.UserCalendar(c.Request.Context(), currentUser, ownerID, rng)
+	if err != nil {
+		respondServiceError(c, "GetCalendar", err)
+		return
+	}
+	c.JSON(http.StatusOK, cal)
+}
+
+// GetTrends — GET /api/habits/stats/trends: динамика выполнения за диапазон
+// с теми же параметрами from, to и tz, что у календаря.
+func (h *HabitHandler) GetTrends(c *gin.Context) {
+	currentUser, ok := userFromContext(c, "GetTrends")
+	if !ok {
+		return
+	}
+
+	rng, err := calendarRange(c)
+	if err != nil {
+		respondBadQuery(c, "GetTrends", err)
+		return
+	}
+	ownerID, err := ownerParam(c, currentUser)
+	if err != nil {
+		respondBadQuery(c, "GetTrends", err)
+		return
+	}
+
+	trends, err := h.stats.Trends(c.Request.Context(), currentUser, ownerID, rng)
+	if err != nil {
+		respondServiceError(c, "GetTrends", err)
+		return
+	}
+	c.JSON(http.StatusOK, trends)
+}
+
+// GetMoodCorrelations отдаёт связь привычек с настроением и энергией из дневника.
+func (h *HabitHandler) GetMoodCorrelations(c *gin.Context) {
+	currentUser, ok := userFromContext(c, "GetMoodCorrelations")
+	if !ok {
+		return
+	}
+
+	rng, err := calendarRange(c)
+	if err != nil {
+		respondBadQuery(c, "GetMoodCorrelations", err)
+		return
+	}
+	ownerID, err := ownerParam(c, currentUser)
+	if err != nil {
+		respondBadQuery(c, "GetMoodCorrelations", err)
+		return
+	}
+
+	correlations, err := h.stats.MoodCorrelations(c.Request.Context(), currentUser, ownerID, rng)
+	if err != nil {
+		respondServiceError(c, "GetMoodCorrelations", err)
+		return
+	}
+	c.JSON(http.StatusOK, correlations)
+}
+
+// calendarRange читает tz (IANA, по умолчанию UTC) и дни from/to в формате
+// YYYY-MM-DD включительно. Без from/to отдаётся последний год до сегодня.
+func calendarRange(c *gin.Context) (services.CalendarRange, error) {
+	rng := services.CalendarRange{Location: time.UTC}
+	if tz := c.Query("tz"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return rng, badQueryf("unknown time zone %q", tz)
+		}
+		rng.Location = loc
+	}
+
+	now := time.Now().In(rng.Location)
+	rng.To = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if raw := c.Query("to"); raw != "" {
+		to, err := time.Parse(time.DateOnly, raw)
+		if err != nil {
+			return rng, badQueryf("invalid to %q: use YYYY-MM-DD", raw)
+		}
+		rng.To = to
+	}
+
+	rng.From = rng.To.AddDate(0, 0, -(defaultCalendarDays - 1))
+	if raw := c.Query("from"); raw != "" {
+		from, err := time.Parse(time.DateOnly, raw)
+		if err != nil {
+			return rng, badQueryf("invalid from %q: use YYYY-MM-DD", raw)
+		}
+		rng.From = from
+	}
+
+	days := int(rng.To.Sub(rng.From).Hours()/24) + 1
+	if days < 1 || days > maxCalendarDays {
+		return rng, badQueryf("range must cover 1 to %d days", maxCalendarDays)
+	}
+	return rng, nil
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// setLastModified выставляет Last-Modified, только если метка старше текущей
+// секунды. HTTP-дата хранит секунды, и изменение в ту же секунду не сдвинуло бы
+// её — клиент с If-Modified-Since получил бы ложный 304.
+func setLastModified(c *gin.Context, modified time.Time) {
+	if modified.IsZero() {
+		return
+	}
+	if !modified.Truncate(time.Second).Before(time.Now().Truncate(time.Second)) {
+		return
+	}
+	c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+}
+
+// ifMatch возвращает ETag из заголовка If-Match.
+func ifMatch(c *gin.Context) []string {
+	return middleware.ParseETagList(c.GetHeader("If-Match"))
+}
+
+// respondVersioned отдаёт отдельную запись с ETag её версии и отвечает 304,
+// если у клиента та же версия.
+func respondVersioned(c *gin.Context, etag string, modified time.Time, body any) {
+	c.Header("ETag", etag)
+	setLastModified(c, modified)
+
+	if middleware.NotModified(c.Request, c.Writer.Header()) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.JSON(http.StatusOK, body)
+}
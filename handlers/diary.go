@@ -1,23 +1,88 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
 
-	"github.com/Bekzhanizb/HabitTrackerBackend/db"
+	"github.com/Bekzhanizb/HabitTrackerBackend/encryption"
 	"github.com/Bekzhanizb/HabitTrackerBackend/middleware"
 	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+	"github.com/Bekzhanizb/HabitTrackerBackend/services"
 	"github.com/Bekzhanizb/HabitTrackerBackend/utils"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
+// DiaryHandler обслуживает маршруты /api/diary.
+type DiaryHandler struct {
+	diaries *services.DiaryService
+}
+
+func NewDiaryHandler(diaries *services.DiaryService) *DiaryHandler {
+	return &DiaryHandler{diaries: diaries}
+}
+
+const (
+	// maxDiaryContent — предельная длина открытого текста записи в символах.
+	maxDiaryContent = 10000
+	// maxEncryptedContent — предельная длина шифротекста в base64: текст
+	// из maxDiaryContent символов по 4 байта в UTF-8 с тегом AEAD
+	// занимает в base64 чуть больше 53 тысяч символов.
+	maxEncryptedContent = 56000
+)
+
+// CreateDiaryRequest: mood и energy — оценка 1–5. Если указана только
+// emotion, настроение выставляется по ней (см. models.Emotions). Title,
+// tags, mood, energy и emotion хранятся открытыми и при клиентском
+// шифровании: шифруется только content.
 type CreateDiaryRequest struct {
-	Title   string `json:"title" binding:"required,min=1,max=200"`
-	Content string `json:"content" binding:"required,min=1,max=10000"`
-	UserID  uint   `json:"user_id" binding:"required,min=1"`
+	Title   string   `json:"title" binding:"required,min=1,max=200"`
+	Content string   `json:"content" binding:"required,min=1,max=56000"`
+	UserID  uint     `json:"user_id" binding:"required,min=1"`
+	Mood    *int     `json:"mood" binding:"omitempty,min=1,max=5"`
+	Energy  *int     `json:"energy" binding:"omitempty,min=1,max=5"`
+	Emotion string   `json:"emotion" binding:"omitempty,oneof=joy excited grateful calm neutral tired sad anxious angry"`
+	Tags    []string `json:"tags" binding:"omitempty,max=10,dive,min=1,max=32"`
+	// Encryption — параметры клиентского шифрования; с ними content —
+	// шифротекст в base64.
+	Encryption *DiaryEncryptionRequest `json:"encryption"`
+	// HabitID и HabitLogID связывают запись с привычкой или её отметкой.
+	HabitID    *uint `json:"habit_id" binding:"omitempty,min=1"`
+	HabitLogID *uint `json:"habit_log_id" binding:"omitempty,min=1"`
+	// PromptID — подсказка, на которую отвечает запись.
+	PromptID *uint `json:"prompt_id" binding:"omitempty,min=1"`
+}
+
+type DiaryEncryptionRequest struct {
+	Algorithm  string `json:"algorithm" binding:"required,oneof=AES-GCM XChaCha20-Poly1305"`
+	KDF        string `json:"kdf" binding:"required,oneof=PBKDF2-SHA256 argon2id"`
+	Salt       string `json:"salt" binding:"required,base64,max=256"`
+	Iterations int    `json:"iterations" binding:"min=0,max=10000000"`
+	Memory     int    `json:"memory" binding:"min=0,max=4194304"`
+	Nonce      string `json:"nonce" binding:"required,base64,max=256"`
+	KeyHint    string `json:"key_hint" binding:"max=64"`
+}
+
+func (r *DiaryEncryptionRequest) model() *models.DiaryEncryption {
+	if r == nil {
+		return nil
+	}
+	return &models.DiaryEncryption{
+		Algorithm:  r.Algorithm,
+		KDF:        r.KDF,
+		Salt:       r.Salt,
+		Iterations: r.Iterations,
+		Memory:     r.Memory,
+		Nonce:      r.Nonce,
+		KeyHint:    r.KeyHint,
+	}
 }
 
-func CreateDiary(c *gin.Context) {
+func (h *DiaryHandler) CreateDiary(c *gin.Context) {
 	var req CreateDiaryRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -32,35 +97,32 @@ func CreateDiary(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка валидации", "details": err.Error()})
 		return
 	}
-
-	userInterface, exists := c.Get("user")
-	if !exists {
-		utils.ErrorCount.WithLabelValues("CreateDiary", "auth").Inc()
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	if err := checkContentLength(req.Content, req.Encryption != nil); err != nil {
+		utils.ErrorCount.WithLabelValues("CreateDiary", "validation").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректные данные", "details": err.Error()})
 		return
 	}
-	currentUser := userInterface.(models.User)
 
-	if currentUser.Role != models.RoleAdmin && req.UserID != currentUser.ID {
-		utils.Logger.Warn("unauthorized_diary_creation",
-			zap.Uint("current_user_id", currentUser.ID),
-			zap.Uint("requested_user_id", req.UserID),
-		)
-		utils.ErrorCount.WithLabelValues("CreateDiary", "forbidden").Inc()
-		c.JSON(http.StatusForbidden, gin.H{"error": "Нет доступа"})
+	currentUser, ok := userFromContext(c, "CreateDiary")
+	if !ok {
 		return
 	}
 
-	diary := models.Diary{
-		UserID:  req.UserID,
-		Title:   req.Title,
-		Content: req.Content,
-	}
-
-	if err := db.DB.Create(&diary).Error; err != nil {
-		utils.Logger.Error("db_create_diary_failed", zap.Error(err))
-		utils.ErrorCount.WithLabelValues("CreateDiary", "database").Inc()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при создании записи"})
+	diary, err := h.diaries.Create(c.Request.Context(), currentUser, services.CreateDiaryInput{
+		UserID:     req.UserID,
+		Title:      req.Title,
+		Content:    req.Content,
+		Mood:       req.Mood,
+		Energy:     req.Energy,
+		Emotion:    req.Emotion,
+		Tags:       req.Tags,
+		Encryption: req.Encryption.model(),
+		HabitID:    req.HabitID,
+		HabitLogID: req.HabitLogID,
+		PromptID:   req.PromptID,
+	})
+	if err != nil {
+		respondServiceError(c, "CreateDiary", err)
 		return
 	}
 
@@ -69,71 +131,174 @@ func CreateDiary(c *gin.Context) {
 		zap.Uint("user_id", req.UserID),
 	)
 
+	noStoreEncrypted(c, *diary)
+	c.Header("ETag", services.DiaryETag(diary))
 	c.JSON(http.StatusOK, gin.H{"message": "Запись успешно создана", "diary": diary})
 }
 
-func GetDiary(c *gin.Context) {
-	userInterface, exists := c.Get("user")
-	if !exists {
-		utils.ErrorCount.WithLabelValues("GetDiary", "auth").Inc()
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+func (h *DiaryHandler) GetDiary(c *gin.Context) {
+	currentUser, ok := userFromContext(c, "GetDiary")
+	if !ok {
 		return
 	}
-	currentUser := userInterface.(models.User)
-
-	var diaries []models.Diary
-	query := db.DB
 
-	if currentUser.Role != models.RoleAdmin {
-		query = query.Where("user_id = ?", currentUser.ID)
-	} else {
-		userID := c.Query("user_id")
-		if userID != "" {
-			query = query.Where("user_id = ?", userID)
-		}
+	page, err := parsePage(c, repository.DiarySorts, repository.DefaultDiarySort)
+	if err != nil {
+		respondBadQuery(c, "GetDiary", err)
+		return
+	}
+	var filter repository.DiaryFilter
+	if filter.UserID, err = ownerParam(c, currentUser); err != nil {
+		respondBadQuery(c, "GetDiary", err)
+		return
+	}
+	if filter.From, filter.To, err = dateRange(c); err != nil {
+		respondBadQuery(c, "GetDiary", err)
+		return
+	}
+	filter.Tag = strings.ToLower(strings.TrimSpace(c.Query("tag")))
+	if filter.HabitID, err = uintParam(c, "habit_id"); err != nil {
+		respondBadQuery(c, "GetDiary", err)
+		return
+	}
+	if filter.PromptID, err = uintParam(c, "prompt_id"); err != nil {
+		respondBadQuery(c, "GetDiary", err)
+		return
 	}
 
-	if err := query.Order("created_at DESC").Find(&diaries).Error; err != nil {
+	diaries, next, modified, err := h.diaries.List(c.Request.Context(), currentUser, filter, page)
+	if err != nil {
 		utils.Logger.Error("db_get_diary_failed", zap.Error(err))
 		utils.ErrorCount.WithLabelValues("GetDiary", "database").Inc()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении записей"})
 		return
 	}
 
+	noStoreEncrypted(c, diaries...)
+	setNextPage(c, next)
+	setLastModified(c, modified)
 	c.JSON(http.StatusOK, diaries)
 }
 
-type UpdateDiaryRequest struct {
-	Title   *string `json:"title" binding:"omitempty,min=1,max=200"`
-	Content *string `json:"content" binding:"omitempty,min=1,max=10000"`
+// maxSearchQuery — предельная длина поискового запроса в символах.
+const maxSearchQuery = 200
+
+// SearchDiary ищет по заголовку и тексту записей: q — запрос в синтаксисе
+// websearch ("фраза", -исключить, or). Поддерживает from/to, tag и user_id,
+// как GetDiary, и limit; результаты упорядочены по релевантности, поэтому
+// отдаётся только первая страница без курсора.
+func (h *DiaryHandler) SearchDiary(c *gin.Context) {
+	currentUser, ok := userFromContext(c, "SearchDiary")
+	if !ok {
+		return
+	}
+
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" || utf8.RuneCountInString(q) > maxSearchQuery {
+		respondBadQuery(c, "SearchDiary", badQueryf("q must be 1 to %d characters", maxSearchQuery))
+		return
+	}
+	limit, err := limitParam(c)
+	if err != nil {
+		respondBadQuery(c, "SearchDiary", err)
+		return
+	}
+	var filter repository.DiaryFilter
+	if filter.UserID, err = ownerParam(c, currentUser); err != nil {
+		respondBadQuery(c, "SearchDiary", err)
+		return
+	}
+	if filter.From, filter.To, err = dateRange(c); err != nil {
+		respondBadQuery(c, "SearchDiary", err)
+		return
+	}
+	filter.Tag = strings.ToLower(strings.TrimSpace(c.Query("tag")))
+
+	hits, err := h.diaries.Search(c.Request.Context(), currentUser, filter, q, limit)
+	if err != nil {
+		respondServiceError(c, "SearchDiary", err)
+		return
+	}
+	for _, hit := range hits {
+		noStoreEncrypted(c, hit.Diary)
+	}
+	c.JSON(http.StatusOK, hits)
 }
 
-func UpdateDiary(c *gin.Context) {
-	id := c.Param("id")
+// GetMoodTimeline отдаёт настроение по дням; параметры диапазона те же,
+// что у календаря привычек.
+func (h *DiaryHandler) GetMoodTimeline(c *gin.Context) {
+	currentUser, ok := userFromContext(c, "GetMoodTimeline")
+	if !ok {
+		return
+	}
+
+	rng, err := calendarRange(c)
+	if err != nil {
+		respondBadQuery(c, "GetMoodTimeline", err)
+		return
+	}
+	ownerID, err := ownerParam(c, currentUser)
+	if err != nil {
+		respondBadQuery(c, "GetMoodTimeline", err)
+		return
+	}
+
+	timeline, err := h.diaries.MoodTimeline(c.Request.Context(), currentUser, ownerID, rng)
+	if err != nil {
+		respondServiceError(c, "GetMoodTimeline", err)
+		return
+	}
+	c.JSON(http.StatusOK, timeline)
+}
 
-	var diary models.Diary
-	if err := db.DB.First(&diary, id).Error; err != nil {
-		utils.Logger.Warn("diary_not_found", zap.String("id", id))
-		utils.ErrorCount.WithLabelValues("UpdateDiary", "not_found").Inc()
-		c.JSON(http.StatusNotFound, gin.H{"error": "Запись не найдена"})
+func (h *DiaryHandler) GetDiaryByID(c *gin.Context) {
+	id, ok := parseIDParam(c, "GetDiaryByID")
+	if !ok {
 		return
 	}
 
-	userInterface, exists := c.Get("user")
-	if !exists {
-		utils.ErrorCount.WithLabelValues("UpdateDiary", "auth").Inc()
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	currentUser, ok := userFromContext(c, "GetDiaryByID")
+	if !ok {
 		return
 	}
-	currentUser := userInterface.(models.User)
 
-	if diary.UserID != currentUser.ID && currentUser.Role != models.RoleAdmin {
-		utils.Logger.Warn("unauthorized_diary_update",
-			zap.String("diary_id", id),
-			zap.Uint("user_id", currentUser.ID),
-		)
-		utils.ErrorCount.WithLabelValues("UpdateDiary", "forbidden").Inc()
-		c.JSON(http.StatusForbidden, gin.H{"error": "Нет доступа"})
+	diary, err := h.diaries.Get(c.Request.Context(), currentUser, id)
+	if err != nil {
+		respondServiceError(c, "GetDiaryByID", err)
+		return
+	}
+
+	noStoreEncrypted(c, *diary)
+	respondVersioned(c, services.DiaryETag(diary), diary.UpdatedAt, diary)
+}
+
+// UpdateDiaryRequest: mood и energy равные 0 и пустая emotion очищают значение,
+// пустой список tags удаляет теги.
+type UpdateDiaryRequest struct {
+	Title   *string   `json:"title" binding:"omitempty,min=1,max=200"`
+	Content *string   `json:"content" binding:"omitempty,min=1,max=56000"`
+	Mood    *int      `json:"mood" binding:"omitempty,min=0,max=5"`
+	Energy  *int      `json:"energy" binding:"omitempty,min=0,max=5"`
+	Emotion *string   `json:"emotion" binding:"omitempty,oneof='' joy excited grateful calm neutral tired sad anxious angry"`
+	Tags    *[]string `json:"tags" binding:"omitempty,max=10,dive,min=1,max=32"`
+	// Encryption передаётся вместе с новым content зашифрованной записи.
+	Encryption *DiaryEncryptionRequest `json:"encryption"`
+	// HabitID и HabitLogID меняют связь с привычкой; 0 снимает её.
+	HabitID    *uint `json:"habit_id"`
+	HabitLogID *uint `json:"habit_log_id"`
+	// PromptID меняет подсказку записи; 0 снимает её.
+	PromptID *uint `json:"prompt_id"`
+}
+
+func (h *DiaryHandler) UpdateDiary(c *gin.Context) {
+	id, ok := parseIDParam(c, "UpdateDiary")
+	if !ok {
+		return
+	}
+
+	currentUser, ok := userFromContext(c, "UpdateDiary")
+	if !ok {
 		return
 	}
 
@@ -144,61 +309,78 @@ func UpdateDiary(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректные данные", "details": err.Error()})
 		return
 	}
-
-	if req.Title != nil {
-		diary.Title = *req.Title
-	}
 	if req.Content != nil {
-		diary.Content = *req.Content
+		if err := checkContentLength(*req.Content, req.Encryption != nil); err != nil {
+			utils.ErrorCount.WithLabelValues("UpdateDiary", "validation").Inc()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректные данные", "details": err.Error()})
+			return
+		}
 	}
 
-	if err := db.DB.Save(&diary).Error; err != nil {
-		utils.Logger.Error("db_update_diary_failed", zap.Error(err))
-		utils.ErrorCount.WithLabelValues("UpdateDiary", "database").Inc()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при обновлении записи"})
+	diary, err := h.diaries.Update(c.Request.Context(), currentUser, id, services.UpdateDiaryInput{
+		Title:      req.Title,
+		Content:    req.Content,
+		Mood:       req.Mood,
+		Energy:     req.Energy,
+		Emotion:    req.Emotion,
+		Tags:       req.Tags,
+		IfMatch:    ifMatch(c),
+		Encryption: req.Encryption.model(),
+		HabitID:    req.HabitID,
+		HabitLogID: req.HabitLogID,
+		PromptID:   req.PromptID,
+	})
+	if err != nil {
+		respondServiceError(c, "UpdateDiary", err)
 		return
 	}
 
-	utils.Logger.Info("diary_updated", zap.String("diary_id", id))
+	utils.Logger.Info("diary_updated", zap.Uint("diary_id", id))
+	noStoreEncrypted(c, *diary)
+	c.Header("ETag", services.DiaryETag(diary))
 	c.JSON(http.StatusOK, gin.H{"message": "Запись обновлена", "diary": diary})
 }
 
-func DeleteDiary(c *gin.Context) {
-	id := c.Param("id")
-
-	var diary models.Diary
-	if err := db.DB.First(&diary, id).Error; err != nil {
-		utils.Logger.Warn("diary_not_found_for_delete", zap.String("id", id))
-		utils.ErrorCount.WithLabelValues("DeleteDiary", "not_found").Inc()
-		c.JSON(http.StatusNotFound, gin.H{"error": "Запись не найдена"})
+func (h *DiaryHandler) DeleteDiary(c *gin.Context) {
+	id, ok := parseIDParam(c, "DeleteDiary")
+	if !ok {
 		return
 	}
 
-	userInterface, exists := c.Get("user")
-	if !exists {
-		utils.ErrorCount.WithLabelValues("DeleteDiary", "auth").Inc()
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	currentUser, ok := userFromContext(c, "DeleteDiary")
+	if !ok {
 		return
 	}
-	currentUser := userInterface.(models.User)
 
-	if diary.UserID != currentUser.ID && currentUser.Role != models.RoleAdmin {
-		utils.Logger.Warn("unauthorized_diary_delete",
-			zap.String("diary_id", id),
-			zap.Uint("user_id", currentUser.ID),
-		)
-		utils.ErrorCount.WithLabelValues("DeleteDiary", "forbidden").Inc()
-		c.JSON(http.StatusForbidden, gin.H{"error": "Нет доступа"})
+	if err := h.diaries.Delete(c.Request.Context(), currentUser, id); err != nil {
+		respondServiceError(c, "DeleteDiary", err)
 		return
 	}
 
-	if err := db.DB.Delete(&diary).Error; err != nil {
-		utils.Logger.Error("db_delete_diary_failed", zap.Error(err))
-		utils.ErrorCount.WithLabelValues("DeleteDiary", "database").Inc()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при удалении записи"})
-		return
+	utils.Logger.Info("diary_deleted", zap.Uint("diary_id", id))
+	c.JSON(http.StatusOK, gin.H{"message": "Запись удалена"})
+}
+
+// checkContentLength ограничивает текст записи: открытый — maxDiaryContent
+// символами, шифротекст — maxEncryptedContent, так как base64 длиннее
+// исходного текста.
+func checkContentLength(content string, encrypted bool) error {
+	limit := maxDiaryContent
+	if encrypted {
+		limit = maxEncryptedContent
 	}
+	if utf8.RuneCountInString(content) > limit {
+		return fmt.Errorf("content must be at most %d characters", limit)
+	}
+	return nil
+}
 
-	utils.Logger.Info("diary_deleted", zap.String("diary_id", id))
-	c.JSON(http.StatusOK, gin.H{"message": "Запись удалена"})
+// noStoreEncrypted запрещает кэшировать ответ с зашифрованными на клиенте
+// записями: шифротекст не должен оседать ни в Redis, ни в чужих кэшах.
+// При шифровании на сервере не кэшируется ни один ответ с записями, иначе
+// их открытый текст лежал бы в Redis.
+func noStoreEncrypted(c *gin.Context, diaries ...models.Diary) {
+	if encryption.Enabled() || slices.ContainsFunc(diaries, func(d models.Diary) bool { return d.Encrypted }) {
+		middleware.NoStore(c)
+	}
 }
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/middleware"
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/services"
+	"github.com/Bekzhanizb/HabitTrackerBackend/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func (h *DiaryHandler) GetRevisions(c *gin.Context) {
+	id, ok := parseIDParam(c, "GetRevisions")
+	if !ok {
+		return
+	}
+
+	currentUser, ok := userFromContext(c, "GetRevisions")
+	if !ok {
+		return
+	}
+
+	revs, err := h.diaries.Revisions(c.Request.Context(), currentUser, id)
+	if err != nil {
+		respondServiceError(c, "GetRevisions", err)
+		return
+	}
+	if slices.ContainsFunc(revs, func(r models.DiaryRevision) bool { return r.Encryption != nil }) {
+		middleware.NoStore(c)
+	}
+	c.JSON(http.StatusOK, revs)
+}
+
+// DiffRevisions сравнивает ревизии from и to (по умолчанию — последнюю).
+func (h *DiaryHandler) DiffRevisions(c *gin.Context) {
+	id, ok := parseIDParam(c, "DiffRevisions")
+	if !ok {
+		return
+	}
+
+	currentUser, ok := userFromContext(c, "DiffRevisions")
+	if !ok {
+		return
+	}
+
+	from, err := revisionNumber(c.Query("from"))
+	if err != nil || from == 0 {
+		respondBadQuery(c, "DiffRevisions", badQueryf("from must be a revision number"))
+		return
+	}
+	var to int
+	if raw := c.Query("to"); raw != "" {
+		if to, err = revisionNumber(raw); err != nil || to == 0 {
+			respondBadQuery(c, "DiffRevisions", badQueryf("invalid to %q", raw))
+			return
+		}
+	}
+
+	diff, err := h.diaries.DiffRevisions(c.Request.Context(), currentUser, id, from, to)
+	if err != nil {
+		respondServiceError(c, "DiffRevisions", err)
+		return
+	}
+	c.JSON(http.StatusOK, diff)
+}
+
+func (h *DiaryHandler) RestoreRevision(c *gin.Context) {
+	id, ok := parseIDParam(c, "RestoreRevision")
+	if !ok {
+		return
+	}
+	number, err := revisionNumber(c.Param("rev"))
+	if err != nil || number == 0 {
+		utils.ErrorCount.WithLabelValues("RestoreRevision", "validation").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid revision"})
+		return
+	}
+
+	currentUser, ok := userFromContext(c, "RestoreRevision")
+	if !ok {
+		return
+	}
+
+	diary, err := h.diaries.Restore(c.Request.Context(), currentUser, id, number, ifMatch(c))
+	if err != nil {
+		respondServiceError(c, "RestoreRevision", err)
+		return
+	}
+
+	utils.Logger.Info("diary_restored", zap.Uint("diary_id", id), zap.Int("revision", number))
+	noStoreEncrypted(c, *diary)
+	c.Header("ETag", services.DiaryETag(diary))
+	c.JSON(http.StatusOK, gin.H{"message": "Запись восстановлена", "diary": diary})
+}
+
+func revisionNumber(raw string) (int, error) {
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		return 0, strconv.ErrSyntax
+	}
+	return n, nil
+}
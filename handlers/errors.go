@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/services"
+	"github.com/Bekzhanizb/HabitTrackerBackend/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// respondServiceError переводит доменные ошибки сервисов в HTTP-ответы.
+func respondServiceError(c *gin.Context, handler string, err error) {
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		utils.Logger.Warn("resource_not_found", zap.String("handler", handler), zap.Error(err))
+		utils.ErrorCount.WithLabelValues(handler, "not_found").Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Не найдено"})
+	case errors.Is(err, services.ErrForbidden):
+		utils.Logger.Warn("access_forbidden", zap.String("handler", handler), zap.Error(err))
+		utils.ErrorCount.WithLabelValues(handler, "forbidden").Inc()
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нет доступа"})
+	case errors.Is(err, services.ErrInvalidInput):
+		utils.Logger.Warn("invalid_input", zap.String("handler", handler), zap.Error(err))
+		utils.ErrorCount.WithLabelValues(handler, "validation").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка валидации", "details": err.Error()})
+	case errors.Is(err, services.ErrConflict):
+		utils.Logger.Warn("resource_conflict", zap.String("handler", handler), zap.Error(err))
+		utils.ErrorCount.WithLabelValues(handler, "conflict").Inc()
+		c.JSON(http.StatusConflict, gin.H{"error": "Конфликт данных", "details": err.Error()})
+	case errors.Is(err, services.ErrTooLarge):
+		utils.Logger.Warn("payload_too_large", zap.String("handler", handler), zap.Error(err))
+		utils.ErrorCount.WithLabelValues(handler, "too_large").Inc()
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Файл слишком большой", "details": err.Error()})
+	case errors.Is(err, services.ErrUnsupportedMedia):
+		utils.Logger.Warn("unsupported_media_type", zap.String("handler", handler), zap.Error(err))
+		utils.ErrorCount.WithLabelValues(handler, "validation").Inc()
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Неподдерживаемый тип файла", "details": err.Error()})
+	case errors.Is(err, services.ErrPreconditionFailed):
+		utils.Logger.Warn("precondition_failed", zap.String("handler", handler), zap.Error(err))
+		utils.ErrorCount.WithLabelValues(handler, "precondition").Inc()
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Ресурс был изменён, обновите данные"})
+	case errors.Is(err, services.ErrUnavailable):
+		utils.Logger.Warn("feature_unavailable", zap.String("handler", handler), zap.Error(err))
+		utils.ErrorCount.WithLabelValues(handler, "unavailable").Inc()
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Функция недоступна", "details": err.Error()})
+	default:
+		utils.Logger.Error("service_call_failed", zap.String("handler", handler), zap.Error(err))
+		utils.ErrorCount.WithLabelValues(handler, "database").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Внутренняя ошибка сервера"})
+	}
+}
+
+// userFromContext достаёт пользователя, положенного в контекст AuthMiddleware.
+// При отсутствии пользователя ответ 401 уже записан.
+func userFromContext(c *gin.Context, handler string) (models.User, bool) {
+	userInterface, exists := c.Get("user")
+	if !exists {
+		utils.ErrorCount.WithLabelValues(handler, "auth").Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return models.User{}, false
+	}
+
+	user, ok := userInterface.(models.User)
+	if !ok {
+		utils.Logger.Error("invalid_user_type", zap.String("type", fmt.Sprintf("%T", userInterface)))
+		utils.ErrorCount.WithLabelValues(handler, "auth").Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return models.User{}, false
+	}
+
+	return user, true
+}
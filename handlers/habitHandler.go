@@ -1,14 +1,15 @@
 package handlers
 
 import (
-	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/Bekzhanizb/HabitTrackerBackend/db"
 	"github.com/Bekzhanizb/HabitTrackerBackend/middleware"
 	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+	"github.com/Bekzhanizb/HabitTrackerBackend/services"
 	"github.com/Bekzhanizb/HabitTrackerBackend/utils"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -22,7 +23,17 @@ type CreateHabitRequest struct {
 	UserID      uint   `json:"user_id" binding:"required,min=1"`
 }
 
-func CreateHabit(c *gin.Context) {
+// HabitHandler обслуживает маршруты /api/habits.
+type HabitHandler struct {
+	habits *services.HabitService
+	stats  *services.StatsService
+}
+
+func NewHabitHandler(habits *services.HabitService, stats *services.StatsService) *HabitHandler {
+	return &HabitHandler{habits: habits, stats: stats}
+}
+
+func (h *HabitHandler) CreateHabit(c *gin.Context) {
 	var req CreateHabitRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -42,149 +53,134 @@ func CreateHabit(c *gin.Context) {
 		return
 	}
 
-	// 🔥 FIX: Безопасное получение пользователя
-	userInterface, exists := c.Get("user")
-	if !exists {
-		utils.Logger.Error("user_not_found_in_context")
-		utils.ErrorCount.WithLabelValues("CreateHabit", "auth").Inc()
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-
-	currentUser, ok := userInterface.(models.User)
+	user, ok := userFromContext(c, "CreateHabit")
 	if !ok {
-		utils.Logger.Error("invalid_user_type_in_context",
-			zap.String("type", fmt.Sprintf("%T", userInterface)))
-		utils.ErrorCount.WithLabelValues("CreateHabit", "auth").Inc()
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
 		return
 	}
 
-	if currentUser.Role != models.RoleAdmin && req.UserID != currentUser.ID {
-		utils.Logger.Warn("unauthorized_habit_creation",
-			zap.Uint("current_user_id", currentUser.ID),
-			zap.Uint("requested_user_id", req.UserID),
-		)
-		utils.ErrorCount.WithLabelValues("CreateHabit", "forbidden").Inc()
-		c.JSON(http.StatusForbidden, gin.H{"error": "Нет доступа"})
-		return
-	}
-
-	habit := models.Habit{
+	habit, err := h.habits.CreateHabit(c.Request.Context(), user, services.CreateHabitInput{
 		UserID:      req.UserID,
 		Title:       req.Title,
 		Description: req.Description,
 		Frequency:   req.Frequency,
-		IsActive:    true,
-	}
-
-	if err := db.DB.Create(&habit).Error; err != nil {
-		utils.Logger.Error("db_create_habit_failed",
-			zap.Error(err),
-			zap.Uint("user_id", req.UserID),
-		)
-		utils.ErrorCount.WithLabelValues("CreateHabit", "database").Inc()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при создании привычки"})
+	})
+	if err != nil {
+		respondServiceError(c, "CreateHabit", err)
 		return
 	}
 
-	habitLog := models.HabitLog{
-		HabitID:     habit.ID,
-		Date:        time.Now(),
-		IsCompleted: false,
-	}
-	if err := db.DB.Create(&habitLog).Error; err != nil {
-		utils.Logger.Error("db_create_habitlog_failed",
-			zap.Error(err),
-			zap.Uint("habit_id", habit.ID),
-		)
-		utils.ErrorCount.WithLabelValues("CreateHabit", "database").Inc()
-	}
-
 	utils.Logger.Info("habit_created",
 		zap.Uint("habit_id", habit.ID),
 		zap.Uint("user_id", req.UserID),
 		zap.String("title", req.Title),
 	)
 
+	c.Header("ETag", services.HabitETag(habit))
 	c.JSON(http.StatusOK, gin.H{"message": "Привычка успешно создана", "habit": habit})
 }
 
-func GetHabits(c *gin.Context) {
-	utils.Logger.Info("GetHabits started", zap.String("path", c.Request.URL.Path))
-
-	userInterface, exists := c.Get("user")
-	if !exists {
-		utils.Logger.Error("user_not_found_in_context",
-			zap.String("headers", fmt.Sprintf("%v", c.Request.Header)))
-		utils.ErrorCount.WithLabelValues("GetHabits", "auth").Inc()
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized - user not in context"})
+func (h *HabitHandler) GetHabits(c *gin.Context) {
+	currentUser, ok := userFromContext(c, "GetHabits")
+	if !ok {
 		return
 	}
 
-	utils.Logger.Info("user_interface_type", zap.String("type", fmt.Sprintf("%T", userInterface)))
-
-	currentUser, ok := userInterface.(models.User)
-	if !ok {
-		utils.Logger.Error("invalid_user_type_assertion",
-			zap.String("expected", "models.User"),
-			zap.String("actual", fmt.Sprintf("%T", userInterface)),
-			zap.Any("value", userInterface),
-		)
-		utils.ErrorCount.WithLabelValues("GetHabits", "auth").Inc()
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Invalid user type in context",
-			"debug": fmt.Sprintf("Expected models.User, got %T", userInterface),
-		})
-		return
-	}
-
-	utils.Logger.Info("current_user_retrieved",
-		zap.Uint("id", currentUser.ID),
-		zap.String("username", currentUser.Username),
-		zap.String("role", currentUser.Role))
-
-	var habits []models.Habit
-	query := db.DB.Preload("Logs").Preload("User")
-
-	if currentUser.Role != models.RoleAdmin {
-		query = query.Where("user_id = ?", currentUser.ID)
-		utils.Logger.Info("user_query", zap.Uint("user_id", currentUser.ID))
-	} else {
-		userID := c.Query("user_id")
-		utils.Logger.Info("admin_query", zap.String("user_id_param", userID))
-		if userID != "" {
-			if id, err := strconv.Atoi(userID); err == nil {
-				query = query.Where("user_id = ?", id)
-			} else {
-				utils.Logger.Warn("invalid_user_id_param", zap.String("user_id", userID))
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
-				return
-			}
-		}
+	filter, page, err := habitListQuery(c, currentUser)
+	if err != nil {
+		respondBadQuery(c, "GetHabits", err)
+		return
 	}
 
-	utils.Logger.Info("executing_database_query")
-	if err := query.Find(&habits).Error; err != nil {
+	habits, next, modified, err := h.habits.ListHabits(c.Request.Context(), currentUser, filter, page)
+	if err != nil {
 		utils.Logger.Error("db_get_habits_failed", zap.Error(err))
 		utils.ErrorCount.WithLabelValues("GetHabits", "database").Inc()
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Ошибка при получении привычек",
-			"details": err.Error(),
-		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении привычек"})
 		return
 	}
 
-	utils.Logger.Info("habits_retrieved_successfully", zap.Int("count", len(habits)))
+	utils.Logger.Info("habits_retrieved_successfully",
+		zap.Uint("user_id", currentUser.ID),
+		zap.Int("count", len(habits)),
+	)
+	setNextPage(c, next)
+	setLastModified(c, modified)
 	c.JSON(http.StatusOK, habits)
 }
 
+// Логи в списке привычек нужны для отметок последних дней, поэтому по
+// умолчанию к каждой привычке прикладываются только последние логи.
+const (
+	defaultHabitLogs = 30
+	maxHabitLogs     = 366
+)
+
+// habitListQuery разбирает фильтры GET /api/habits: is_active, frequency,
+// from/to по дате создания и logs — сколько последних логов приложить
+// к привычке (0 — без логов).
+func habitListQuery(c *gin.Context, actor models.User) (repository.HabitFilter, repository.Page, error) {
+	var filter repository.HabitFilter
+
+	page, err := parsePage(c, repository.HabitSorts, repository.DefaultHabitSort)
+	if err != nil {
+		return filter, page, err
+	}
+	if filter.UserID, err = ownerParam(c, actor); err != nil {
+		return filter, page, err
+	}
+	if filter.IsActive, err = boolParam(c, "is_active"); err != nil {
+		return filter, page, err
+	}
+	if filter.CreatedFrom, filter.CreatedTo, err = dateRange(c); err != nil {
+		return filter, page, err
+	}
+
+	switch frequency := c.Query("frequency"); frequency {
+	case "", "daily", "weekly", "monthly":
+		filter.Frequency = frequency
+	default:
+		return filter, page, badQueryf("invalid frequency %q", frequency)
+	}
+
+	filter.LogsLimit = defaultHabitLogs
+	if raw := c.Query("logs"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 || n > maxHabitLogs {
+			return filter, page, badQueryf("logs must be between 0 and %d", maxHabitLogs)
+		}
+		filter.LogsLimit = n
+	}
+	filter.WithLogs = filter.LogsLimit > 0
+	return filter, page, nil
+}
+
+func (h *HabitHandler) GetHabit(c *gin.Context) {
+	id, ok := parseIDParam(c, "GetHabit")
+	if !ok {
+		return
+	}
+
+	currentUser, ok := userFromContext(c, "GetHabit")
+	if !ok {
+		return
+	}
+
+	habit, err := h.habits.GetHabit(c.Request.Context(), currentUser, id)
+	if err != nil {
+		respondServiceError(c, "GetHabit", err)
+		return
+	}
+
+	respondVersioned(c, services.HabitETag(habit), habit.UpdatedAt, habit)
+}
+
 type LogHabitRequest struct {
-	HabitID     uint  `json:"habit_id" binding:"required,min=1"`
-	IsCompleted *bool `json:"is_completed"`
+	HabitID     uint   `json:"habit_id" binding:"required,min=1"`
+	IsCompleted *bool  `json:"is_completed"`
+	Note        string `json:"note" binding:"max=280"`
 }
 
-func LogHabit(c *gin.Context) {
+func (h *HabitHandler) LogHabit(c *gin.Context) {
 	var req LogHabitRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -200,36 +196,8 @@ func LogHabit(c *gin.Context) {
 		return
 	}
 
-	userInterface, exists := c.Get("user")
-	if !exists {
-		utils.ErrorCount.WithLabelValues("LogHabit", "auth").Inc()
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-
-	currentUser, ok := userInterface.(models.User)
+	user, ok := userFromContext(c, "LogHabit")
 	if !ok {
-		utils.Logger.Error("invalid_user_type", zap.String("type", fmt.Sprintf("%T", userInterface)))
-		utils.ErrorCount.WithLabelValues("LogHabit", "auth").Inc()
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
-		return
-	}
-
-	var habit models.Habit
-	if err := db.DB.First(&habit, req.HabitID).Error; err != nil {
-		utils.Logger.Warn("habit_not_found", zap.Uint("habit_id", req.HabitID))
-		utils.ErrorCount.WithLabelValues("LogHabit", "not_found").Inc()
-		c.JSON(http.StatusNotFound, gin.H{"error": "Habit not found"})
-		return
-	}
-
-	if habit.UserID != currentUser.ID && currentUser.Role != models.RoleAdmin {
-		utils.Logger.Warn("unauthorized_habit_log",
-			zap.Uint("habit_id", req.HabitID),
-			zap.Uint("user_id", currentUser.ID),
-		)
-		utils.ErrorCount.WithLabelValues("LogHabit", "forbidden").Inc()
-		c.JSON(http.StatusForbidden, gin.H{"error": "Нет доступа к этой привычке"})
 		return
 	}
 
@@ -238,19 +206,9 @@ func LogHabit(c *gin.Context) {
 		isCompleted = *req.IsCompleted
 	}
 
-	log := models.HabitLog{
-		HabitID:     req.HabitID,
-		Date:        time.Now(),
-		IsCompleted: isCompleted,
-	}
-
-	if err := db.DB.Create(&log).Error; err != nil {
-		utils.Logger.Error("db_create_log_failed",
-			zap.Error(err),
-			zap.Uint("habit_id", req.HabitID),
-		)
-		utils.ErrorCount.WithLabelValues("LogHabit", "database").Inc()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при сохранении лога"})
+	log, err := h.habits.LogHabit(c.Request.Context(), user, req.HabitID, isCompleted, strings.TrimSpace(req.Note))
+	if err != nil {
+		respondServiceError(c, "LogHabit", err)
 		return
 	}
 
@@ -262,130 +220,144 @@ func LogHabit(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Привычка отмечена", "log": log})
 }
 
-func GetHabitLogs(c *gin.Context) {
-	start := time.Now()
+type UpdateLogNoteRequest struct {
+	Note string `json:"note" binding:"max=280"`
+}
 
-	utils.ReqCount.WithLabelValues("GET", "/api/habits/logs", "started").Inc()
+// UpdateLogNote — PATCH /api/habits/logs/:id: меняет заметку отметки;
+// пустая строка удаляет её.
+func (h *HabitHandler) UpdateLogNote(c *gin.Context) {
+	id, ok := parseIDParam(c, "UpdateLogNote")
+	if !ok {
+		return
+	}
 
-	userInterface, exists := c.Get("user")
-	if !exists {
-		utils.Logger.Warn("get_habit_logs_no_user")
-		utils.ErrorCount.WithLabelValues("GetHabitLogs", "auth").Inc()
+	var req UpdateLogNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorCount.WithLabelValues("UpdateLogNote", "validation").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректные данные", "details": err.Error()})
+		return
+	}
 
-		utils.ReqDuration.WithLabelValues("GET", "/api/habits/logs").Observe(time.Since(start).Seconds())
+	user, ok := userFromContext(c, "UpdateLogNote")
+	if !ok {
+		return
+	}
 
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	log, err := h.habits.UpdateLogNote(c.Request.Context(), user, id, strings.TrimSpace(req.Note))
+	if err != nil {
+		respondServiceError(c, "UpdateLogNote", err)
 		return
 	}
 
-	currentUser, ok := userInterface.(models.User)
-	if !ok {
-		utils.Logger.Error("invalid_user_type",
-			zap.String("type", fmt.Sprintf("%T", userInterface)))
-		utils.ErrorCount.WithLabelValues("GetHabitLogs", "auth").Inc()
+	utils.Logger.Info("habit_log_note_updated", zap.Uint("log_id", id))
+	c.JSON(http.StatusOK, gin.H{"message": "Заметка сохранена", "log": log})
+}
 
-		utils.ReqDuration.WithLabelValues("GET", "/api/habits/logs").Observe(time.Since(start).Seconds())
+func (h *HabitHandler) GetHabitLogs(c *gin.Context) {
+	start := time.Now()
 
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+	currentUser, ok := userFromContext(c, "GetHabitLogs")
+	if !ok {
 		return
 	}
 
-	utils.Logger.Info("get_habit_logs_request",
-		zap.Uint("user_id", currentUser.ID),
-		zap.String("role", currentUser.Role),
-	)
-
-	var logs []models.HabitLog
-	query := db.DB.Preload("Habit")
+	filter, page, err := habitLogListQuery(c, currentUser)
+	if err != nil {
+		respondBadQuery(c, "GetHabitLogs", err)
+		return
+	}
 
 	queryType := "user"
 	if currentUser.Role == models.RoleAdmin {
 		queryType = "admin"
-		userID := c.Query("user_id")
-		if userID != "" {
+		if filter.UserID != nil || filter.HabitID != nil {
 			queryType = "admin_filtered"
-			query = query.Joins("JOIN habits ON habits.id = habit_logs.habit_id").
-				Where("habits.user_id = ?", userID)
 		}
-	} else {
-		query = query.Joins("JOIN habits ON habits.id = habit_logs.habit_id").
-			Where("habits.user_id = ?", currentUser.ID)
 	}
 
 	dbStart := time.Now()
+	logs, next, err := h.habits.ListLogs(c.Request.Context(), currentUser, filter, page)
+	dbDuration := time.Since(dbStart).Seconds()
 
-	if err := query.Find(&logs).Error; err != nil {
-		dbDuration := time.Since(dbStart).Seconds()
-
+	if err != nil {
 		utils.Logger.Error("db_get_logs_failed",
 			zap.Error(err),
 			zap.Float64("db_duration", dbDuration),
 		)
-
 		utils.ErrorCount.WithLabelValues("GetHabitLogs", "database").Inc()
-
-		utils.ReqDuration.WithLabelValues("GET", "/api/habits/logs").Observe(time.Since(start).Seconds())
-
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении логов"})
 		return
 	}
 
-	dbDuration := time.Since(dbStart).Seconds()
-	totalDuration := time.Since(start).Seconds()
-
-	utils.ReqDuration.WithLabelValues("GET", "/api/habits/logs").Observe(totalDuration)
-
 	utils.Logger.Info("get_habit_logs_success",
 		zap.Uint("user_id", currentUser.ID),
 		zap.String("query_type", queryType),
 		zap.Int("logs_count", len(logs)),
 		zap.Float64("db_duration_ms", dbDuration*1000),
-		zap.Float64("total_duration_ms", totalDuration*1000),
+		zap.Float64("total_duration_ms", time.Since(start).Seconds()*1000),
 	)
 
+	setNextPage(c, next)
 	c.JSON(http.StatusOK, logs)
 }
 
-type UpdateHabitRequest struct {
-	Title       *string `json:"title" binding:"omitempty,min=1,max=100"`
-	Description *string `json:"description" binding:"omitempty,max=500"`
-	Frequency   *string `json:"frequency" binding:"omitempty,oneof=daily weekly monthly"`
-	IsActive    *bool   `json:"is_active"`
-}
+// habitLogListQuery разбирает фильтры GET /api/habits/logs: habit_id,
+// is_completed и from/to по дате лога.
+func habitLogListQuery(c *gin.Context, actor models.User) (repository.HabitLogFilter, repository.Page, error) {
+	var filter repository.HabitLogFilter
 
-func UpdateHabit(c *gin.Context) {
-	id := c.Param("id")
+	page, err := parsePage(c, repository.HabitLogSorts, repository.DefaultHabitLogSort)
+	if err != nil {
+		return filter, page, err
+	}
+	if filter.UserID, err = ownerParam(c, actor); err != nil {
+		return filter, page, err
+	}
+	if filter.HabitID, err = uintParam(c, "habit_id"); err != nil {
+		return filter, page, err
+	}
+	if filter.IsCompleted, err = boolParam(c, "is_completed"); err != nil {
+		return filter, page, err
+	}
+	if filter.From, filter.To, err = dateRange(c); err != nil {
+		return filter, page, err
+	}
+	return filter, page, nil
+}
 
-	var habit models.Habit
-	if err := db.DB.First(&habit, id).Error; err != nil {
-		utils.Logger.Warn("habit_not_found_for_update", zap.String("id", id))
-		utils.ErrorCount.WithLabelValues("UpdateHabit", "not_found").Inc()
-		c.JSON(http.StatusNotFound, gin.H{"error": "Habit not found"})
+func (h *HabitHandler) GetStats(c *gin.Context) {
+	currentUser, ok := userFromContext(c, "GetHabitStats")
+	if !ok {
 		return
 	}
 
-	userInterface, exists := c.Get("user")
-	if !exists {
-		utils.ErrorCount.WithLabelValues("UpdateHabit", "auth").Inc()
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	stats, err := h.stats.CalculateUserHabitStats(c.Request.Context(), currentUser.ID)
+	if err != nil {
+		utils.Logger.Error("calculate_stats_failed", zap.Error(err))
+		utils.ErrorCount.WithLabelValues("GetHabitStats", "calculation").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate statistics"})
 		return
 	}
 
-	currentUser, ok := userInterface.(models.User)
+	c.JSON(http.StatusOK, stats)
+}
+
+type UpdateHabitRequest struct {
+	Title       *string `json:"title" binding:"omitempty,min=1,max=100"`
+	Description *string `json:"description" binding:"omitempty,max=500"`
+	Frequency   *string `json:"frequency" binding:"omitempty,oneof=daily weekly monthly"`
+	IsActive    *bool   `json:"is_active"`
+}
+
+func (h *HabitHandler) UpdateHabit(c *gin.Context) {
+	id, ok := parseIDParam(c, "UpdateHabit")
 	if !ok {
-		utils.Logger.Error("invalid_user_type", zap.String("type", fmt.Sprintf("%T", userInterface)))
-		utils.ErrorCount.WithLabelValues("UpdateHabit", "auth").Inc()
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
 		return
 	}
 
-	if habit.UserID != currentUser.ID && currentUser.Role != models.RoleAdmin {
-		utils.Logger.Warn("unauthorized_habit_update",
-			zap.String("habit_id", id),
-			zap.Uint("user_id", currentUser.ID),
-		)
-		utils.ErrorCount.WithLabelValues("UpdateHabit", "forbidden").Inc()
-		c.JSON(http.StatusForbidden, gin.H{"error": "Нет доступа к этой привычке"})
+	user, ok := userFromContext(c, "UpdateHabit")
+	if !ok {
 		return
 	}
 
@@ -397,90 +369,72 @@ func UpdateHabit(c *gin.Context) {
 		return
 	}
 
-	if req.Title != nil {
-		habit.Title = *req.Title
-	}
-	if req.Description != nil {
-		habit.Description = *req.Description
-	}
-	if req.Frequency != nil {
-		habit.Frequency = *req.Frequency
-	}
-	if req.IsActive != nil {
-		habit.IsActive = *req.IsActive
-	}
-
-	if err := db.DB.Save(&habit).Error; err != nil {
-		utils.Logger.Error("db_update_habit_failed", zap.Error(err), zap.String("habit_id", id))
-		utils.ErrorCount.WithLabelValues("UpdateHabit", "database").Inc()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update habit"})
+	habit, err := h.habits.UpdateHabit(c.Request.Context(), user, id, services.UpdateHabitInput{
+		Title:       req.Title,
+		Description: req.Description,
+		Frequency:   req.Frequency,
+		IsActive:    req.IsActive,
+		IfMatch:     ifMatch(c),
+	})
+	if err != nil {
+		respondServiceError(c, "UpdateHabit", err)
 		return
 	}
 
-	utils.Logger.Info("habit_updated", zap.String("habit_id", id))
+	utils.Logger.Info("habit_updated", zap.Uint("habit_id", id))
+	c.Header("ETag", services.HabitETag(habit))
 	c.JSON(http.StatusOK, gin.H{"message": "Habit updated", "habit": habit})
 }
 
-func DeleteHabit(c *gin.Context) {
-	id := c.Param("id")
-
-	var habit models.Habit
-	if err := db.DB.First(&habit, id).Error; err != nil {
-		utils.Logger.Warn("habit_not_found_for_delete", zap.String("id", id))
-		utils.ErrorCount.WithLabelValues("DeleteHabit", "not_found").Inc()
-		c.JSON(http.StatusNotFound, gin.H{"error": "Habit not found"})
-		return
-	}
-
-	userInterface, exists := c.Get("user")
-	if !exists {
-		utils.ErrorCount.WithLabelValues("DeleteHabit", "auth").Inc()
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+func (h *HabitHandler) DeleteHabit(c *gin.Context) {
+	id, ok := parseIDParam(c, "DeleteHabit")
+	if !ok {
 		return
 	}
 
-	currentUser, ok := userInterface.(models.User)
+	user, ok := userFromContext(c, "DeleteHabit")
 	if !ok {
-		utils.Logger.Error("invalid_user_type", zap.String("type", fmt.Sprintf("%T", userInterface)))
-		utils.ErrorCount.WithLabelValues("DeleteHabit", "auth").Inc()
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
 		return
 	}
 
-	if habit.UserID != currentUser.ID && currentUser.Role != models.RoleAdmin {
-		utils.Logger.Warn("unauthorized_habit_delete",
-			zap.String("habit_id", id),
-			zap.Uint("user_id", currentUser.ID),
-		)
-		utils.ErrorCount.WithLabelValues("DeleteHabit", "forbidden").Inc()
-		c.JSON(http.StatusForbidden, gin.H{"error": "Нет доступа к этой привычке"})
+	if err := h.habits.DeleteHabit(c.Request.Context(), user, id); err != nil {
+		respondServiceError(c, "DeleteHabit", err)
 		return
 	}
 
-	if err := db.DB.Where("habit_id = ?", habit.ID).Delete(&models.HabitLog{}).Error; err != nil {
-		utils.Logger.Error("db_delete_logs_failed", zap.Error(err))
-		utils.ErrorCount.WithLabelValues("DeleteHabit", "database").Inc()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete habit logs"})
+	utils.Logger.Info("habit_deleted", zap.Uint("habit_id", id))
+	c.JSON(http.StatusOK, gin.H{"message": "Habit deleted"})
+}
+
+type BulkActivateRequest struct {
+	HabitIDs []uint `json:"habit_ids" binding:"required"`
+	IsActive bool   `json:"is_active"`
+}
+
+func (h *HabitHandler) BulkActivate(c *gin.Context) {
+	var req BulkActivateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
 		return
 	}
 
-	if err := db.DB.Delete(&habit).Error; err != nil {
-		utils.Logger.Error("db_delete_habit_failed", zap.Error(err))
-		utils.ErrorCount.WithLabelValues("DeleteHabit", "database").Inc()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete habit"})
+	if err := h.habits.BulkSetActive(c.Request.Context(), req.HabitIDs, req.IsActive); err != nil {
+		respondServiceError(c, "BulkActivateHabits", err)
 		return
 	}
 
-	utils.Logger.Info("habit_deleted", zap.String("habit_id", id))
-	c.JSON(http.StatusOK, gin.H{"message": "Habit deleted"})
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Habits updated successfully",
+		"count":   len(req.HabitIDs),
+	})
 }
-func GetUsersHandler(c *gin.Context) {
-	var users []models.User
 
-	if err := db.DB.Preload("City").Find(&users).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
-		return
+func parseIDParam(c *gin.Context, handler string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		utils.ErrorCount.WithLabelValues(handler, "validation").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return 0, false
 	}
-
-	c.JSON(http.StatusOK, users)
+	return uint(id), true
 }
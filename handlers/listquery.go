@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+	"github.com/Bekzhanizb/HabitTrackerBackend/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Параметры списков общие для всех списочных маршрутов:
+//
+//	limit   — размер страницы, по умолчанию defaultPageSize;
+//	sort    — поле из разрешённых для ресурса, "-field" для обратного порядка;
+//	cursor  — значение next_cursor из предыдущего ответа;
+//	from/to — диапазон дат (YYYY-MM-DD или RFC 3339), to включительно для дат;
+//	user_id — владелец, учитывается только для администратора.
+//
+// Курсор следующей страницы возвращается в X-Next-Cursor и в Link rel="next".
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// errBadQuery помечает ошибки разбора параметров запроса.
+var errBadQuery = errors.New("bad query")
+
+func badQueryf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", errBadQuery, fmt.Sprintf(format, args...))
+}
+
+// respondBadQuery отвечает 400 на некорректные параметры списка.
+func respondBadQuery(c *gin.Context, handler string, err error) {
+	utils.Logger.Warn("invalid_list_query", zap.String("handler", handler), zap.Error(err))
+	utils.ErrorCount.WithLabelValues(handler, "validation").Inc()
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректные параметры запроса", "details": err.Error()})
+}
+
+// parsePage читает limit, sort и cursor. Курсор хранит сортировку, с которой
+// он выдан, поэтому sort на следующих страницах можно не передавать.
+func parsePage(c *gin.Context, fields repository.SortFields, def repository.Sort) (repository.Page, error) {
+	limit, err := limitParam(c)
+	if err != nil {
+		return repository.Page{}, err
+	}
+	page := repository.Page{Limit: limit}
+
+	sort, err := fields.Parse(c.Query("sort"), def)
+	if err != nil {
+		return page, badQueryf("%v", err)
+	}
+	page.Sort = sort
+
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := repository.DecodeCursor(raw, fields)
+		if err != nil {
+			return page, badQueryf("%v", err)
+		}
+		if c.Query("sort") != "" && cursor.Sort != sort {
+			return page, badQueryf("cursor was issued for sort %q", cursor.Sort)
+		}
+		page.Sort = cursor.Sort
+		page.After = cursor
+	}
+
+	return page, nil
+}
+
+// limitParam читает размер страницы limit; по умолчанию defaultPageSize.
+func limitParam(c *gin.Context) (int, error) {
+	raw := c.Query("limit")
+	if raw == "" {
+		return defaultPageSize, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 1 || limit > maxPageSize {
+		return 0, badQueryf("limit must be between 1 and %d", maxPageSize)
+	}
+	return limit, nil
+}
+
+// ownerParam читает user_id. Обычному пользователю доступны только свои
+// данные, поэтому для него параметр игнорируется.
+func ownerParam(c *gin.Context, actor models.User) (*uint, error) {
+	raw := c.Query("user_id")
+	if raw == "" || actor.Role != models.RoleAdmin {
+		return nil, nil
+	}
+	id, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return nil, badQueryf("invalid user_id %q", raw)
+	}
+	owner := uint(id)
+	return &owner, nil
+}
+
+func uintParam(c *gin.Context, name string) (*uint, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return nil, badQueryf("invalid %s %q", name, raw)
+	}
+	u := uint(v)
+	return &u, nil
+}
+
+func boolParam(c *gin.Context, name string) (*bool, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, badQueryf("invalid %s %q", name, raw)
+	}
+	return &v, nil
+}
+
+// dateRange читает from и to как полуинтервал [from, to). Дата без времени
+// в to означает весь этот день.
+func dateRange(c *gin.Context) (from, to *time.Time, err error) {
+	if from, _, err = timeParam(c, "from"); err != nil {
+		return nil, nil, err
+	}
+	var dateOnly bool
+	if to, dateOnly, err = timeParam(c, "to"); err != nil {
+		return nil, nil, err
+	}
+	if to != nil && dateOnly {
+		end := to.AddDate(0, 0, 1)
+		to = &end
+	}
+	if from != nil && to != nil && !from.Before(*to) {
+		return nil, nil, badQueryf("from must be before to")
+	}
+	return from, to, nil
+}
+
+func timeParam(c *gin.Context, name string) (*time.Time, bool, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, false, nil
+	}
+	if t, err := time.Parse(time.DateOnly, raw); err == nil {
+		return &t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, false, badQueryf("invalid %s %q: use YYYY-MM-DD or RFC 3339", name, raw)
+	}
+	return &t, false, nil
+}
+
+// setNextPage сообщает курсор следующей страницы. Ссылка в Link повторяет
+// текущий запрос со всеми фильтрами, меняется только cursor.
+func setNextPage(c *gin.Context, next *repository.Cursor) {
+	if next == nil {
+		return
+	}
+
+	cursor := next.Encode()
+	query := c.Request.URL.Query()
+	query.Set("cursor", cursor)
+	link := *c.Request.URL
+	link.RawQuery = query.Encode()
+
+	c.Header("X-Next-Cursor", cursor)
+	c.Header("Link", fmt.Sprintf(`<%s>; rel="next"`, link.RequestURI()))
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+	"github.com/Bekzhanizb/HabitTrackerBackend/services"
+	"github.com/Bekzhanizb/HabitTrackerBackend/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// NotificationHandler обслуживает уведомления: входящие пользователя
+// и недоставленные — для администратора.
+type NotificationHandler struct {
+	notifications *services.NotificationService
+}
+
+func NewNotificationHandler(notifications *services.NotificationService) *NotificationHandler {
+	return &NotificationHandler{notifications: notifications}
+}
+
+// GetNotifications — GET /api/notifications: входящие от новых к старым;
+// unread=true оставляет непрочитанные.
+func (h *NotificationHandler) GetNotifications(c *gin.Context) {
+	currentUser, ok := userFromContext(c, "GetNotifications")
+	if !ok {
+		return
+	}
+
+	page, err := parsePage(c, repository.NotificationSorts, repository.DefaultNotificationSort)
+	if err != nil {
+		respondBadQuery(c, "GetNotifications", err)
+		return
+	}
+	unread, err := boolParam(c, "unread")
+	if err != nil {
+		respondBadQuery(c, "GetNotifications", err)
+		return
+	}
+
+	filter := repository.NotificationFilter{Unread: unread != nil && *unread}
+	notifications, next, err := h.notifications.Inbox(c.Request.Context(), currentUser, filter, page)
+	if err != nil {
+		respondServiceError(c, "GetNotifications", err)
+		return
+	}
+	setNextPage(c, next)
+	c.JSON(http.StatusOK, notifications)
+}
+
+// GetUnreadCount — GET /api/notifications/unread-count.
+func (h *NotificationHandler) GetUnreadCount(c *gin.Context) {
+	currentUser, ok := userFromContext(c, "GetUnreadCount")
+	if !ok {
+		return
+	}
+
+	count, err := h.notifications.UnreadCount(c.Request.Context(), currentUser)
+	if err != nil {
+		respondServiceError(c, "GetUnreadCount", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"unread": count})
+}
+
+// MarkNotificationRead — POST /api/notifications/:id/read. Повторная
+// отметка не меняет время прочтения.
+func (h *NotificationHandler) MarkNotificationRead(c *gin.Context) {
+	id, ok := parseIDParam(c, "MarkNotificationRead")
+	if !ok {
+		return
+	}
+	currentUser, ok := userFromContext(c, "MarkNotificationRead")
+	if !ok {
+		return
+	}
+
+	notification, err := h.notifications.MarkRead(c.Request.Context(), currentUser, id)
+	if err != nil {
+		respondServiceError(c, "MarkNotificationRead", err)
+		return
+	}
+	c.JSON(http.StatusOK, notification)
+}
+
+// MarkAllNotificationsRead — POST /api/notifications/read-all.
+func (h *NotificationHandler) MarkAllNotificationsRead(c *gin.Context) {
+	currentUser, ok := userFromContext(c, "MarkAllNotificationsRead")
+	if !ok {
+		return
+	}
+
+	updated, err := h.notifications.MarkAllRead(c.Request.Context(), currentUser)
+	if err != nil {
+		respondServiceError(c, "MarkAllNotificationsRead", err)
+		return
+	}
+
+	utils.Logger.Info("notifications_marked_read", zap.Uint("user_id", currentUser.ID), zap.Int64("updated", updated))
+	c.JSON(http.StatusOK, gin.H{"updated": updated})
+}
+
+// GetDeadLetters — GET /api/admin/notifications/dead-letters: недоставленные
+// уведомления от новых к старым, с фильтрами channel и user_id.
+func (h *NotificationHandler) GetDeadLetters(c *gin.Context) {
+	page, err := parsePage(c, repository.DeadLetterSorts, repository.DefaultDeadLetterSort)
+	if err != nil {
+		respondBadQuery(c, "GetDeadLetters", err)
+		return
+	}
+	filter := repository.DeadLetterFilter{Channel: c.Query("channel")}
+	if filter.UserID, err = uintParam(c, "user_id"); err != nil {
+		respondBadQuery(c, "GetDeadLetters", err)
+		return
+	}
+
+	letters, next, err := h.notifications.DeadLetters(c.Request.Context(), filter, page)
+	if err != nil {
+		respondServiceError(c, "GetDeadLetters", err)
+		return
+	}
+	setNextPage(c, next)
+	c.JSON(http.StatusOK, letters)
+}
+
+// RetryDeadLetter — POST /api/admin/notifications/dead-letters/:id/retry:
+// одна попытка отправить уведомление снова. Неудача — не ошибка запроса:
+// ответ 200 с delivered=false и текстом ошибки канала.
+func (h *NotificationHandler) RetryDeadLetter(c *gin.Context) {
+	id, ok := parseIDParam(c, "RetryDeadLetter")
+	if !ok {
+		return
+	}
+
+	res, err := h.notifications.RetryDeadLetter(c.Request.Context(), id)
+	if err != nil {
+		respondServiceError(c, "RetryDeadLetter", err)
+		return
+	}
+
+	resp := gin.H{
+		"channel":   res.Channel,
+		"delivered": res.Err == nil && !res.Skipped,
+		"skipped":   res.Skipped,
+	}
+	if res.Err != nil {
+		resp["error"] = res.Err.Error()
+	}
+	utils.Logger.Info("dead_letter_retried",
+		zap.Uint("dead_letter_id", id),
+		zap.String("channel", res.Channel),
+		zap.Bool("delivered", res.Err == nil),
+	)
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+	"github.com/Bekzhanizb/HabitTrackerBackend/services"
+	"github.com/Bekzhanizb/HabitTrackerBackend/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// PromptHandler выдаёт подсказки для дневника и управляет их библиотекой.
+type PromptHandler struct {
+	prompts *services.PromptService
+}
+
+func NewPromptHandler(prompts *services.PromptService) *PromptHandler {
+	return &PromptHandler{prompts: prompts}
+}
+
+type CreatePromptRequest struct {
+	Category string `json:"category" binding:"required,oneof=daily gratitude weekly"`
+	Text     string `json:"text" binding:"required,min=1,max=500"`
+	IsActive *bool  `json:"is_active"`
+}
+
+type UpdatePromptRequest struct {
+	Category string `json:"category" binding:"omitempty,oneof=daily gratitude weekly"`
+	Text     string `json:"text" binding:"omitempty,min=1,max=500"`
+	IsActive *bool  `json:"is_active"`
+}
+
+func promptCategoryParam(c *gin.Context) (string, error) {
+	switch category := c.Query("category"); category {
+	case "", models.PromptDaily, models.PromptGratitude, models.PromptWeekly:
+		return category, nil
+	default:
+		return "", badQueryf("category must be %q, %q or %q", models.PromptDaily, models.PromptGratitude, models.PromptWeekly)
+	}
+}
+
+// GetTodayPrompt — GET /api/diary/prompt/today: подсказка на сегодня
+// в часовом поясе tz, по желанию из одной категории.
+func (h *PromptHandler) GetTodayPrompt(c *gin.Context) {
+	currentUser, ok := userFromContext(c, "GetTodayPrompt")
+	if !ok {
+		return
+	}
+
+	category, err := promptCategoryParam(c)
+	if err != nil {
+		respondBadQuery(c, "GetTodayPrompt", err)
+		return
+	}
+	loc := time.UTC
+	if tz := c.Query("tz"); tz != "" {
+		if loc, err = time.LoadLocation(tz); err != nil {
+			respondBadQuery(c, "GetTodayPrompt", badQueryf("unknown time zone %q", tz))
+			return
+		}
+	}
+
+	today, err := h.prompts.Today(c.Request.Context(), currentUser, category, loc)
+	if err != nil {
+		respondServiceError(c, "GetTodayPrompt", err)
+		return
+	}
+	c.JSON(http.StatusOK, today)
+}
+
+// GetActivePrompts — GET /api/diary/prompts: активные подсказки, чтобы
+// выбрать вопрос самому.
+func (h *PromptHandler) GetActivePrompts(c *gin.Context) {
+	category, err := promptCategoryParam(c)
+	if err != nil {
+		respondBadQuery(c, "GetActivePrompts", err)
+		return
+	}
+
+	active := true
+	prompts, err := h.prompts.List(c.Request.Context(), repository.PromptFilter{Category: category, IsActive: &active})
+	if err != nil {
+		respondServiceError(c, "GetActivePrompts", err)
+		return
+	}
+	c.JSON(http.StatusOK, prompts)
+}
+
+// GetPrompts — GET /api/admin/prompts: вся библиотека, с фильтрами
+// category и active.
+func (h *PromptHandler) GetPrompts(c *gin.Context) {
+	var filter repository.PromptFilter
+	var err error
+	if filter.Category, err = promptCategoryParam(c); err != nil {
+		respondBadQuery(c, "GetPrompts", err)
+		return
+	}
+	if filter.IsActive, err = boolParam(c, "active"); err != nil {
+		respondBadQuery(c, "GetPrompts", err)
+		return
+	}
+
+	prompts, err := h.prompts.List(c.Request.Context(), filter)
+	if err != nil {
+		respondServiceError(c, "GetPrompts", err)
+		return
+	}
+	c.JSON(http.StatusOK, prompts)
+}
+
+func (h *PromptHandler) CreatePrompt(c *gin.Context) {
+	var req CreatePromptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorCount.WithLabelValues("CreatePrompt", "validation").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректные данные", "details": err.Error()})
+		return
+	}
+
+	prompt, err := h.prompts.Create(c.Request.Context(), services.PromptInput{
+		Category: req.Category,
+		Text:     req.Text,
+		IsActive: req.IsActive,
+	})
+	if err != nil {
+		respondServiceError(c, "CreatePrompt", err)
+		return
+	}
+
+	utils.Logger.Info("prompt_created", zap.Uint("prompt_id", prompt.ID), zap.String("category", prompt.Category))
+	c.JSON(http.StatusCreated, prompt)
+}
+
+func (h *PromptHandler) UpdatePrompt(c *gin.Context) {
+	id, ok := parseIDParam(c, "UpdatePrompt")
+	if !ok {
+		return
+	}
+
+	var req UpdatePromptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorCount.WithLabelValues("UpdatePrompt", "validation").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректные данные", "details": err.Error()})
+		return
+	}
+
+	prompt, err := h.prompts.Update(c.Request.Context(), id, services.PromptInput{
+		Category: req.Category,
+		Text:     req.Text,
+		IsActive: req.IsActive,
+	})
+	if err != nil {
+		respondServiceError(c, "UpdatePrompt", err)
+		return
+	}
+
+	utils.Logger.Info("prompt_updated", zap.Uint("prompt_id", id))
+	c.JSON(http.StatusOK, prompt)
+}
+
+func (h *PromptHandler) DeletePrompt(c *gin.Context) {
+	id, ok := parseIDParam(c, "DeletePrompt")
+	if !ok {
+		return
+	}
+
+	if err := h.prompts.Delete(c.Request.Context(), id); err != nil {
+		respondServiceError(c, "DeletePrompt", err)
+		return
+	}
+
+	utils.Logger.Info("prompt_deleted", zap.Uint("prompt_id", id))
+	c.JSON(http.StatusOK, gin.H{"message": "Подсказка удалена"})
+}
+
+// GetPromptEngagement — GET /api/admin/prompts/stats: выдачи и ответы
+// по подсказкам за from..to.
+func (h *PromptHandler) GetPromptEngagement(c *gin.Context) {
+	var filter repository.PromptStatsFilter
+	var err error
+	if filter.From, filter.To, err = dateRange(c); err != nil {
+		respondBadQuery(c, "GetPromptEngagement", err)
+		return
+	}
+
+	report, err := h.prompts.Engagement(c.Request.Context(), filter)
+	if err != nil {
+		respondServiceError(c, "GetPromptEngagement", err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/middleware"
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+	"github.com/Bekzhanizb/HabitTrackerBackend/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RateLimitHandler управляет списком исключений из rate limit.
+type RateLimitHandler struct {
+	overrides repository.RateLimitOverrideRepository
+	limiter   *middleware.RateLimiter
+}
+
+func NewRateLimitHandler(overrides repository.RateLimitOverrideRepository, limiter *middleware.RateLimiter) *RateLimitHandler {
+	return &RateLimitHandler{overrides: overrides, limiter: limiter}
+}
+
+type rateLimitOverrideRequest struct {
+	// Subject — ключ лимита: user:<id>, token:<hash> или ip:<адрес>.
+	Subject    string  `json:"subject" binding:"required,max=128"`
+	Multiplier float64 `json:"multiplier"`
+	Exempt     bool    `json:"exempt"`
+	Note       string  `json:"note" binding:"max=255"`
+}
+
+var rateLimitSubjectPrefixes = []string{"user:", "token:", "ip:"}
+
+func validRateLimitSubject(subject string) bool {
+	for _, prefix := range rateLimitSubjectPrefixes {
+		if strings.HasPrefix(subject, prefix) && len(subject) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *RateLimitHandler) List(c *gin.Context) {
+	overrides, err := h.overrides.List(c.Request.Context())
+	if err != nil {
+		respondServiceError(c, "ListRateLimits", err)
+		return
+	}
+	c.JSON(http.StatusOK, overrides)
+}
+
+func (h *RateLimitHandler) Upsert(c *gin.Context) {
+	var req rateLimitOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Logger.Warn("invalid_rate_limit_request", zap.Error(err))
+		utils.ErrorCount.WithLabelValues("UpsertRateLimit", "validation").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректные данные", "details": err.Error()})
+		return
+	}
+	if !validRateLimitSubject(req.Subject) {
+		utils.ErrorCount.WithLabelValues("UpsertRateLimit", "validation").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "subject должен начинаться с user:, token: или ip:"})
+		return
+	}
+	if req.Multiplier == 0 {
+		req.Multiplier = 1
+	}
+	if req.Multiplier < 0 {
+		utils.ErrorCount.WithLabelValues("UpsertRateLimit", "validation").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "multiplier должен быть больше нуля"})
+		return
+	}
+
+	override := models.RateLimitOverride{
+		Subject:    req.Subject,
+		Multiplier: req.Multiplier,
+		Exempt:     req.Exempt,
+		Note:       req.Note,
+	}
+	if err := h.overrides.Upsert(c.Request.Context(), &override); err != nil {
+		respondServiceError(c, "UpsertRateLimit", err)
+		return
+	}
+	h.reload(c)
+
+	utils.Logger.Info("rate_limit_override_saved",
+		zap.String("subject", override.Subject),
+		zap.Float64("multiplier", override.Multiplier),
+		zap.Bool("exempt", override.Exempt),
+	)
+	c.JSON(http.StatusOK, override)
+}
+
+func (h *RateLimitHandler) Delete(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	if err := h.overrides.Delete(c.Request.Context(), uint(id)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Не найдено"})
+			return
+		}
+		respondServiceError(c, "DeleteRateLimit", err)
+		return
+	}
+	h.reload(c)
+
+	utils.Logger.Info("rate_limit_override_deleted", zap.Uint64("id", id))
+	c.JSON(http.StatusOK, gin.H{"message": "Override deleted"})
+}
+
+// reload применяет изменения сразу на этом инстансе; остальные подхватят
+// их при плановом обновлении списка.
+func (h *RateLimitHandler) reload(c *gin.Context) {
+	if err := h.limiter.Reload(c.Request.Context()); err != nil {
+		utils.Logger.Warn("rate_limit_overrides_reload_failed", zap.Error(err))
+	}
+}
@@ -1,20 +1,50 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/Bekzhanizb/HabitTrackerBackend/db"
+	"github.com/Bekzhanizb/HabitTrackerBackend/cache"
 	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
 	"github.com/Bekzhanizb/HabitTrackerBackend/utils"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
-func RegisterHandler(c *gin.Context) {
+// UserHandler обслуживает регистрацию, список пользователей и справочник городов.
+type UserHandler struct {
+	users       repository.UserRepository
+	cities      repository.CityRepository
+	citiesCache *cache.Loader
+}
+
+func NewUserHandler(users repository.UserRepository, cities repository.CityRepository, c cache.Cache) *UserHandler {
+	return &UserHandler{
+		users:       users,
+		cities:      cities,
+		citiesCache: cache.NewLoader(c, "cities", utils.Logger),
+	}
+}
+
+// citiesPolicy: справочник меняется редко, поэтому после истечения
+// его можно ещё долго отдавать, обновляя в фоне.
+var citiesPolicy = cache.Policy{
+	TTL:        time.Hour,
+	StaleFor:   24 * time.Hour,
+	Beta:       1,
+	Background: true,
+}
+
+func (h *UserHandler) Register(c *gin.Context) {
 	username := c.PostForm("username")
 	password := c.PostForm("password")
 
@@ -71,8 +101,7 @@ func RegisterHandler(c *gin.Context) {
 		return
 	}
 
-	var city models.City
-	if err := db.DB.First(&city, cityID).Error; err != nil {
+	if _, err := h.cities.GetByID(c.Request.Context(), uint(cityID)); err != nil {
 		utils.Logger.Warn("register_city_not_found", zap.Int("city_id", cityID))
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Город не найден",
@@ -80,8 +109,7 @@ func RegisterHandler(c *gin.Context) {
 		return
 	}
 
-	var existing models.User
-	if err := db.DB.Where("username = ?", username).First(&existing).Error; err == nil {
+	if _, err := h.users.GetByUsername(c.Request.Context(), username); err == nil {
 		utils.Logger.Warn("register_user_exists", zap.String("username", username))
 		c.JSON(http.StatusConflict, gin.H{
 			"error": "Пользователь с таким именем уже существует",
@@ -143,7 +171,14 @@ func RegisterHandler(c *gin.Context) {
 		Role:         models.RoleUser,
 	}
 
-	if err := db.DB.Create(&user).Error; err != nil {
+	if err := h.users.Create(c.Request.Context(), &user); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "Пользователь с таким именем уже существует",
+			})
+			return
+		}
+
 		utils.Logger.Error("register_db_create_failed",
 			zap.Error(err),
 			zap.String("username", username),
@@ -181,3 +216,45 @@ func RegisterHandler(c *gin.Context) {
 		"token": token,
 	})
 }
+
+// GetUsers отдаёт страницу пользователей; фильтры — role и city_id.
+func (h *UserHandler) GetUsers(c *gin.Context) {
+	page, err := parsePage(c, repository.UserSorts, repository.DefaultUserSort)
+	if err != nil {
+		respondBadQuery(c, "GetUsers", err)
+		return
+	}
+	filter := repository.UserFilter{Role: c.Query("role")}
+	if filter.CityID, err = uintParam(c, "city_id"); err != nil {
+		respondBadQuery(c, "GetUsers", err)
+		return
+	}
+
+	users, next, err := h.users.List(c.Request.Context(), filter, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	setNextPage(c, next)
+	c.JSON(http.StatusOK, users)
+}
+
+func (h *UserHandler) GetCities(c *gin.Context) {
+	data, state, err := h.citiesCache.Fetch(c.Request.Context(), "cities:all", citiesPolicy, func(ctx context.Context) ([]byte, error) {
+		cities, err := h.cities.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(cities)
+	})
+	if err != nil {
+		utils.Logger.Error("get_cities_failed", zap.Error(err))
+		utils.ErrorCount.WithLabelValues("GetCities", "database").Inc()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cities"})
+		return
+	}
+
+	c.Header("X-Cache", strings.ToUpper(string(state)))
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
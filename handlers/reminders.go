@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/services"
+	"github.com/Bekzhanizb/HabitTrackerBackend/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ReminderHandler управляет напоминаниями о привычках.
+type ReminderHandler struct {
+	reminders *services.ReminderService
+}
+
+func NewReminderHandler(reminders *services.ReminderService) *ReminderHandler {
+	return &ReminderHandler{reminders: reminders}
+}
+
+// ReminderRequest — местное время HH:MM и дни недели от 1 (понедельник)
+// до 7; без days — каждый день.
+type ReminderRequest struct {
+	Time string `json:"time" binding:"required,datetime=15:04"`
+	Days []int  `json:"days" binding:"max=7,dive,min=1,max=7"`
+}
+
+// GetReminders — GET /api/habits/:id/reminders.
+func (h *ReminderHandler) GetReminders(c *gin.Context) {
+	habitID, ok := parseIDParam(c, "GetReminders")
+	if !ok {
+		return
+	}
+	user, ok := userFromContext(c, "GetReminders")
+	if !ok {
+		return
+	}
+
+	reminders, err := h.reminders.List(c.Request.Context(), user, habitID)
+	if err != nil {
+		respondServiceError(c, "GetReminders", err)
+		return
+	}
+	c.JSON(http.StatusOK, reminders)
+}
+
+// CreateReminder — POST /api/habits/:id/reminders. Время считается
+// в часовом поясе из профиля владельца.
+func (h *ReminderHandler) CreateReminder(c *gin.Context) {
+	habitID, ok := parseIDParam(c, "CreateReminder")
+	if !ok {
+		return
+	}
+
+	var req ReminderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorCount.WithLabelValues("CreateReminder", "validation").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректные данные", "details": err.Error()})
+		return
+	}
+
+	user, ok := userFromContext(c, "CreateReminder")
+	if !ok {
+		return
+	}
+
+	reminder, err := h.reminders.Create(c.Request.Context(), user, habitID, services.ReminderInput{Time: req.Time, Days: req.Days})
+	if err != nil {
+		respondServiceError(c, "CreateReminder", err)
+		return
+	}
+
+	utils.Logger.Info("reminder_created",
+		zap.Uint("reminder_id", reminder.ID),
+		zap.Uint("habit_id", habitID),
+		zap.String("time", reminder.Time),
+	)
+	c.JSON(http.StatusCreated, reminder)
+}
+
+// UpdateReminder — PUT /api/habits/reminders/:id: заменяет время и дни.
+func (h *ReminderHandler) UpdateReminder(c *gin.Context) {
+	id, ok := parseIDParam(c, "UpdateReminder")
+	if !ok {
+		return
+	}
+
+	var req ReminderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorCount.WithLabelValues("UpdateReminder", "validation").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректные данные", "details": err.Error()})
+		return
+	}
+
+	user, ok := userFromContext(c, "UpdateReminder")
+	if !ok {
+		return
+	}
+
+	reminder, err := h.reminders.Update(c.Request.Context(), user, id, services.ReminderInput{Time: req.Time, Days: req.Days})
+	if err != nil {
+		respondServiceError(c, "UpdateReminder", err)
+		return
+	}
+
+	utils.Logger.Info("reminder_updated", zap.Uint("reminder_id", id), zap.String("time", reminder.Time))
+	c.JSON(http.StatusOK, reminder)
+}
+
+// DeleteReminder — DELETE /api/habits/reminders/:id.
+func (h *ReminderHandler) DeleteReminder(c *gin.Context) {
+	id, ok := parseIDParam(c, "DeleteReminder")
+	if !ok {
+		return
+	}
+	user, ok := userFromContext(c, "DeleteReminder")
+	if !ok {
+		return
+	}
+
+	if err := h.reminders.Delete(c.Request.Context(), user, id); err != nil {
+		respondServiceError(c, "DeleteReminder", err)
+		return
+	}
+
+	utils.Logger.Info("reminder_deleted", zap.Uint("reminder_id", id))
+	c.JSON(http.StatusOK, gin.H{"message": "Напоминание удалено"})
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+	"github.com/Bekzhanizb/HabitTrackerBackend/services"
+	"github.com/Bekzhanizb/HabitTrackerBackend/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ReportHandler отдаёт сохранённые отчёты о прогрессе.
+type ReportHandler struct {
+	reports *services.ReportService
+}
+
+func NewReportHandler(reports *services.ReportService) *ReportHandler {
+	return &ReportHandler{reports: reports}
+}
+
+func reportPeriodParam(c *gin.Context) (string, error) {
+	switch period := c.Query("period"); period {
+	case "", models.ReportWeekly, models.ReportMonthly:
+		return period, nil
+	default:
+		return "", badQueryf("period must be %q or %q", models.ReportWeekly, models.ReportMonthly)
+	}
+}
+
+// GetReports — GET /api/reports: отчёты от новых к старым.
+func (h *ReportHandler) GetReports(c *gin.Context) {
+	currentUser, ok := userFromContext(c, "GetReports")
+	if !ok {
+		return
+	}
+
+	page, err := parsePage(c, repository.ReportSorts, repository.DefaultReportSort)
+	if err != nil {
+		respondBadQuery(c, "GetReports", err)
+		return
+	}
+	var filter repository.ReportFilter
+	if filter.UserID, err = ownerParam(c, currentUser); err != nil {
+		respondBadQuery(c, "GetReports", err)
+		return
+	}
+	if filter.Period, err = reportPeriodParam(c); err != nil {
+		respondBadQuery(c, "GetReports", err)
+		return
+	}
+
+	reports, next, err := h.reports.List(c.Request.Context(), currentUser, filter, page)
+	if err != nil {
+		respondServiceError(c, "GetReports", err)
+		return
+	}
+	setNextPage(c, next)
+	c.JSON(http.StatusOK, reports)
+}
+
+// GetReport — GET /api/reports/:id?format=json|markdown|html.
+func (h *ReportHandler) GetReport(c *gin.Context) {
+	id, ok := parseIDParam(c, "GetReport")
+	if !ok {
+		return
+	}
+	currentUser, ok := userFromContext(c, "GetReport")
+	if !ok {
+		return
+	}
+
+	report, data, err := h.reports.Get(c.Request.Context(), currentUser, id)
+	if err != nil {
+		respondServiceError(c, "GetReport", err)
+		return
+	}
+
+	switch format := c.DefaultQuery("format", "json"); format {
+	case "json":
+		c.JSON(http.StatusOK, report)
+	case "markdown", "html":
+		render, contentType := data.RenderMarkdown, "text/markdown; charset=utf-8"
+		if format == "html" {
+			render, contentType = data.RenderHTML, "text/html; charset=utf-8"
+		}
+		body, err := render()
+		if err != nil {
+			respondServiceError(c, "GetReport", err)
+			return
+		}
+		c.Data(http.StatusOK, contentType, []byte(body))
+	default:
+		respondBadQuery(c, "GetReport", badQueryf("format must be json, markdown or html"))
+	}
+}
+
+type generateReportsRequest struct {
+	Period string `json:"period" binding:"required,oneof=weekly monthly"`
+	// Date — любой день периода в формате YYYY-MM-DD; по умолчанию сегодня.
+	Date   string `json:"date"`
+	UserID *uint  `json:"user_id"`
+}
+
+// GenerateReports — POST /api/admin/reports/generate: отчёт одному
+// пользователю или всем, у кого его ещё нет.
+func (h *ReportHandler) GenerateReports(c *gin.Context) {
+	var req generateReportsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Logger.Warn("invalid_generate_reports_request", zap.Error(err))
+		utils.ErrorCount.WithLabelValues("GenerateReports", "validation").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректные данные", "details": err.Error()})
+		return
+	}
+
+	day := time.Now().UTC()
+	if req.Date != "" {
+		var err error
+		if day, err = time.Parse(time.DateOnly, req.Date); err != nil {
+			respondBadQuery(c, "GenerateReports", badQueryf("invalid date %q: use YYYY-MM-DD", req.Date))
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	if req.UserID != nil {
+		report, err := h.reports.Generate(ctx, *req.UserID, req.Period, day)
+		if err != nil {
+			respondServiceError(c, "GenerateReports", err)
+			return
+		}
+		c.JSON(http.StatusCreated, report)
+		return
+	}
+
+	created, err := h.reports.GenerateAll(ctx, req.Period, day)
+	if err != nil {
+		respondServiceError(c, "GenerateReports", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"created": created})
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// RollupHandler даёт администратору пересобрать сводки статистики.
+type RollupHandler struct {
+	rollups *services.RollupService
+}
+
+func NewRollupHandler(rollups *services.RollupService) *RollupHandler {
+	return &RollupHandler{rollups: rollups}
+}
+
+// Rebuild — POST /api/admin/rollups/rebuild[?user_id=].
+// Сводки одного пользователя пересобираются сразу, полная пересборка
+// уходит в фон и отвечает 202.
+func (h *RollupHandler) Rebuild(c *gin.Context) {
+	userID, err := uintParam(c, "user_id")
+	if err != nil {
+		respondBadQuery(c, "RebuildRollups", err)
+		return
+	}
+
+	if userID == nil {
+		if err := h.rollups.RebuildAsync(); err != nil {
+			respondServiceError(c, "RebuildRollups", err)
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"message": "Пересборка сводок запущена"})
+		return
+	}
+
+	if err := h.rollups.Rebuild(c.Request.Context(), userID); err != nil {
+		respondServiceError(c, "RebuildRollups", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Сводки пересобраны", "user_id": *userID})
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/cache"
+	"github.com/Bekzhanizb/HabitTrackerBackend/middleware"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+	"github.com/Bekzhanizb/HabitTrackerBackend/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// SystemHandler обслуживает служебные маршруты: health-check и управление кэшем.
+type SystemHandler struct {
+	store   repository.Store
+	cache   cache.Cache
+	version string
+}
+
+func NewSystemHandler(store repository.Store, c cache.Cache, version string) *SystemHandler {
+	return &SystemHandler{store: store, cache: c, version: version}
+}
+
+func (h *SystemHandler) Health(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+	defer cancel()
+
+	dbStatus := "connected"
+	if err := h.store.Ping(ctx); err != nil {
+		dbStatus = "disconnected"
+	}
+
+	redisStatus := "connected"
+	if h.cache.Backend() != cache.BackendRedis || h.cache.Ping(ctx) != nil {
+		redisStatus = "disconnected"
+	}
+
+	// Без Redis приложение продолжает работать на локальном кэше,
+	// но rate limit и кэш ответов перестают быть общими между инстансами.
+	status := "ok"
+	if dbStatus != "connected" || redisStatus != "connected" {
+		status = "degraded"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":        status,
+		"timestamp":     time.Now(),
+		"database":      dbStatus,
+		"redis":         redisStatus,
+		"cache_backend": h.cache.Backend(),
+		"version":       h.version,
+	})
+}
+
+func (h *SystemHandler) ClearCache(c *gin.Context) {
+	if err := h.cache.Flush(c.Request.Context()); err != nil {
+		utils.Logger.Error("cache_clear_failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear cache"})
+		return
+	}
+
+	utils.Logger.Info("cache_cleared_by_admin")
+	c.JSON(http.StatusOK, gin.H{"message": "Cache cleared successfully"})
+}
+
+func (h *SystemHandler) ClearUserCache(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := middleware.InvalidateUserCache(c.Request.Context(), h.cache, uint(id)); err != nil {
+		utils.Logger.Error("user_cache_clear_failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear user cache"})
+		return
+	}
+
+	utils.Logger.Info("user_cache_cleared", zap.Uint64("user_id", id))
+	c.JSON(http.StatusOK, gin.H{"message": "User cache cleared"})
+}
+
+func (h *SystemHandler) DebugContext(c *gin.Context) {
+	userInterface, exists := c.Get("user")
+	c.JSON(http.StatusOK, gin.H{
+		"user_exists": exists,
+		"user_type":   fmt.Sprintf("%T", userInterface),
+		"user_value":  userInterface,
+	})
+}
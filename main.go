@@ -12,18 +12,27 @@ import (
 
 	"github.com/Bekzhanizb/HabitTrackerBackend/cache"
 	"github.com/Bekzhanizb/HabitTrackerBackend/db"
-	"github.com/Bekzhanizb/HabitTrackerBackend/handlers"
-	"github.com/Bekzhanizb/HabitTrackerBackend/middleware"
+	"github.com/Bekzhanizb/HabitTrackerBackend/encryption"
 	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/notify"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
 	"github.com/Bekzhanizb/HabitTrackerBackend/routes"
 	"github.com/Bekzhanizb/HabitTrackerBackend/services"
+	"github.com/Bekzhanizb/HabitTrackerBackend/storage"
 	"github.com/Bekzhanizb/HabitTrackerBackend/utils"
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
+const (
+	// rollupRebuildInterval — как часто фоновая задача пересобирает сводки.
+	rollupRebuildInterval = 6 * time.Hour
+	// reportInterval — как часто задание проверяет, пора ли собирать отчёты.
+	reportInterval = time.Hour
+	// reminderInterval — как часто проверяются наступившие напоминания.
+	reminderInterval = time.Minute
+)
+
 func main() {
 	utils.InitLogger()
 	defer utils.Logger.Sync()
@@ -40,136 +49,160 @@ func main() {
 		&models.HabitLog{},
 		&models.Achievement{},
 		&models.Diary{},
+		&models.DiaryRevision{},
+		&models.DiaryAttachment{},
+		&models.JournalPrompt{},
+		&models.PromptAssignment{},
+		&models.HabitReminder{},
+		&models.Notification{},
+		&models.NotificationDeadLetter{},
+		&models.RateLimitOverride{},
+		&models.HabitDailyRollup{},
+		&models.UserWeeklyRollup{},
+		&models.Report{},
 	); err != nil {
 		utils.Logger.Fatal("migration_failed", zap.Error(err))
 	}
-
-	if err := cache.InitRedis(utils.Logger); err != nil {
-		utils.Logger.Fatal("redis_initialization_failed", zap.Error(err))
+	// Названия привычек не обязаны быть уникальными; индекс, который
+	// создавали прежние сборки, больше не нужен.
+	if err := db.DB.Exec("DROP INDEX IF EXISTS idx_habits_user_title").Error; err != nil {
+		utils.Logger.Warn("migration_failed", zap.Error(err))
+	}
+	// Раньше поисковый индекс дневника был генерируемой колонкой; теперь его
+	// пишет репозиторий, потому что Content может храниться зашифрованным.
+	if err := db.DB.Exec("ALTER TABLE diaries ALTER COLUMN search_vector DROP EXPRESSION IF EXISTS").Error; err != nil {
+		utils.Logger.Fatal("migration_failed", zap.Error(err))
 	}
-	defer cache.Close()
-
-	seedCities()
 
-	gin.SetMode(gin.ReleaseMode)
-	r := gin.New()
+	// DIARY_KEY_FILE включает шифрование текстов дневника при хранении.
+	// Уже сохранённые открытые записи читаются как есть и шифруются
+	// при следующей правке. Шифруется только Content: заголовки остаются
+	// открытыми ради сортировки по title. Полнотекстовый индекс хранил бы
+	// текст открытым, поэтому с ключом он очищается, а поиск по дневнику
+	// отвечает 501; ответы с записями не кэшируются в Redis.
+	if path := os.Getenv("DIARY_KEY_FILE"); path != "" {
+		envelope, err := encryption.LoadKeyFile(path)
+		if err != nil {
+			utils.Logger.Fatal("diary_key_load_failed", zap.String("path", path), zap.Error(err))
+		}
+		encryption.Enable(envelope)
+		if err := db.DB.Exec("UPDATE diaries SET search_vector = NULL WHERE search_vector IS NOT NULL").Error; err != nil {
+			utils.Logger.Fatal("migration_failed", zap.Error(err))
+		}
+		utils.Logger.Info("diary_encryption_enabled")
+	}
 
-	r.Use(cors.New(cors.Config{
-		AllowOrigins: []string{
-			"http://localhost:3000",
-		},
-		AllowMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders: []string{
-			"Origin",
-			"Content-Type",
-			"Accept",
-			"Authorization",
-			"X-CSRF-Token",
-			"X-Requested-With",
-		},
-		ExposeHeaders: []string{
-			"Content-Length",
-			"X-CSRF-Token",
-		},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
-
-	r.Use(middleware.Recovery())
-	r.Use(middleware.RequestLogger())
-	r.Use(middleware.SecurityHeaders())
-
-	r.Use(middleware.RateLimitMiddleware(100, time.Minute))
-
-	csrfMiddleware := middleware.CSRFMiddleware(
-		[]byte("32-byte-long-supersecret-key-1234567890"),
-		"/api/csrf",
-		"/health",
-		"/metrics",
-		"/api/login",
-		"/api/register",
-		"/api/cities",
-		"/api/habits",
-		"/api/habits/log",
-		"/api/diary",
+	// Недоступный Redis не мешает старту: кэш работает на локальном LRU
+	// и переключается обратно, когда Redis снова отвечает.
+	appCache := cache.NewFallbackCache(
+		cache.NewRedisCache(cache.NewRedisClient()),
+		cache.NewLocalCache(10000),
+		utils.Logger,
+		5*time.Second,
 	)
+	defer appCache.Close()
 
-	r.Use(csrfMiddleware)
+	store := repository.NewPostgresStore(db.DB)
+	rollups := services.NewRollupService(store, appCache, utils.Logger)
+
+	// `rebuild-rollups` пересобирает сводки после миграций и завершается —
+	// для первого запуска и ручного ремонта.
+	if len(os.Args) > 1 && os.Args[1] == "rebuild-rollups" {
+		if err := rollups.Rebuild(context.Background(), nil); err != nil {
+			utils.Logger.Fatal("rollups_rebuild_failed", zap.Error(err))
+		}
+		return
+	}
 
-	r.Static("/uploads", "./uploads")
+	seedCities(store)
+	seedPrompts(store)
 
-	r.GET("/health", healthCheckHandler)
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go rollups.Run(jobsCtx, rollupRebuildInterval)
 
-	r.GET("/api/csrf", middleware.GetCSRFToken())
+	notifications := services.NewNotificationService(store, utils.Logger, services.DefaultRetryPolicy, notifiers(store)...)
 
-	public := r.Group("/api")
-	{
-		public.POST("/register", handlers.RegisterHandler)
-		public.POST("/login", routes.Login)
-		public.GET("/cities", getCitiesHandler)
+	// Доставка отчётов включается REPORT_NOTIFICATIONS=true; без неё
+	// отчёты только сохраняются и доступны через /api/reports.
+	var notifyReports services.NotifyFunc
+	if os.Getenv("REPORT_NOTIFICATIONS") == "true" {
+		notifyReports = notifications.Process
 	}
+	reports := services.NewReportService(store, appCache, utils.Logger, notifyReports)
+	go reports.Run(jobsCtx, reportInterval)
 
-	api := r.Group("/api")
-	api.Use(handlers.AuthMiddleware())
-	{
-		api.GET("/profile", routes.Profile)
-		api.PUT("/profile", routes.UpdateProfile)
-
-		habits := api.Group("/habits")
-		{
-			habits.GET("", handlers.GetHabits)
-			habits.POST("", handlers.CreateHabit)
-			habits.POST("/log", handlers.LogHabit)
-			habits.PUT("/:id", handlers.UpdateHabit)
-			habits.DELETE("/:id", handlers.DeleteHabit)
-			habits.GET("/stats", getHabitStatsHandler)
-			habits.GET("/logs",
-				handlers.RoleMiddleware(models.RoleAdmin),
-				middleware.CacheMiddleware(5*time.Minute),
-				handlers.GetHabitLogs,
-			)
-			habits.POST("/bulk/activate",
-				handlers.RoleMiddleware(models.RoleAdmin),
-				bulkActivateHabitsHandler,
-			)
-		}
-
-		diary := api.Group("/diary")
-		{
-			diary.GET("", middleware.CacheMiddleware(2*time.Minute), handlers.GetDiary)
-			diary.POST("", handlers.CreateDiary)
-			diary.PUT("/:id", handlers.UpdateDiary)
-			diary.DELETE("/:id", handlers.DeleteDiary)
-		}
+	reminders := services.NewReminderService(store, appCache, utils.Logger, notifications.Process)
+	go reminders.Run(jobsCtx, reminderInterval)
 
-		cacheAPI := api.Group("/cache")
-		cacheAPI.Use(handlers.RoleMiddleware(models.RoleAdmin))
-		{
-			cacheAPI.DELETE("/clear", clearCacheHandler)
-			cacheAPI.DELETE("/user/:id", clearUserCacheHandler)
-		}
+	// Вложения дневника лежат вне ./uploads: их отдают только хендлеры
+	// с проверкой прав.
+	attachmentsDir := os.Getenv("ATTACHMENTS_DIR")
+	if attachmentsDir == "" {
+		attachmentsDir = "./data/attachments"
+	}
+	attachments, err := storage.NewLocalStore(attachmentsDir)
+	if err != nil {
+		utils.Logger.Fatal("attachments_storage_failed", zap.String("dir", attachmentsDir), zap.Error(err))
 	}
 
-	r.GET("/api/users", handlers.GetUsersHandler)
+	gin.SetMode(gin.ReleaseMode)
+	r := routes.NewRouter(routes.Dependencies{
+		Store:       store,
+		Cache:       appCache,
+		Logger:      utils.Logger,
+		CSRFKey:     []byte("32-byte-long-supersecret-key-1234567890"),
+		Version:     "2.0.0",
+		Rollups:     rollups,
+		Reports:     reports,
+		Reminders:   reminders,
+		Attachments: attachments,
+
+		Notifications: notifications,
+	})
+
+	startServerWithGracefulShutdown(r, appCache.Backend())
+}
 
-	r.Use(middleware.RequestLogger())
-	r.GET("/debug/context", handlers.AuthMiddleware(), func(c *gin.Context) {
-		userInterface, exists := c.Get("user")
-		c.JSON(200, gin.H{
-			"user_exists": exists,
-			"user_type":   fmt.Sprintf("%T", userInterface),
-			"user_value":  userInterface,
+// notifiers собирает каналы уведомлений. Входящие в приложении работают
+// всегда; почта включается SMTP_ADDR и SMTP_FROM, webhook —
+// NOTIFY_WEBHOOK_URL (подпись — NOTIFY_WEBHOOK_SECRET).
+func notifiers(store repository.Store) []notify.Notifier {
+	channels := []notify.Notifier{notify.NewInboxNotifier(store.Notifications())}
+
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		smtpNotifier, err := notify.NewSMTPNotifier(notify.SMTPConfig{
+			Addr:     addr,
+			From:     os.Getenv("SMTP_FROM"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
 		})
-	})
+		if err != nil {
+			utils.Logger.Fatal("smtp_config_invalid", zap.Error(err))
+		}
+		channels = append(channels, smtpNotifier)
+	}
 
-	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	if url := os.Getenv("NOTIFY_WEBHOOK_URL"); url != "" {
+		channels = append(channels, notify.NewWebhookNotifier(url, []byte(os.Getenv("NOTIFY_WEBHOOK_SECRET")), nil))
+	}
 
-	startServerWithGracefulShutdown(r)
+	names := make([]string, 0, len(channels))
+	for _, n := range channels {
+		names = append(names, n.Channel())
+	}
+	utils.Logger.Info("notification_channels", zap.Strings("channels", names))
+	return channels
 }
 
-func seedCities() {
-	var count int64
-	db.DB.Model(&models.City{}).Count(&count)
+func seedCities(store repository.Store) {
+	ctx := context.Background()
+
+	count, err := store.Cities().Count(ctx)
+	if err != nil {
+		utils.Logger.Error("seed_cities_count_failed", zap.Error(err))
+		return
+	}
 	if count == 0 {
 		cities := []models.City{
 			{Name: "Almaty"},
@@ -180,7 +213,7 @@ func seedCities() {
 			{Name: "Taraz"},
 			{Name: "Pavlodar"},
 		}
-		if err := db.DB.Create(&cities).Error; err != nil {
+		if err := store.Cities().CreateBatch(ctx, cities); err != nil {
 			utils.Logger.Error("seed_cities_failed", zap.Error(err))
 		} else {
 			utils.Logger.Info("seed_cities_created", zap.Int("count", len(cities)))
@@ -188,122 +221,44 @@ func seedCities() {
 	}
 }
 
-func healthCheckHandler(c *gin.Context) {
-	sqlDB, err := db.DB.DB()
-	dbStatus := "connected"
-	if err != nil || sqlDB.Ping() != nil {
-		dbStatus = "disconnected"
-	}
-
-	redisStatus := "connected"
-	if err := cache.Client.Ping(context.Background()).Err(); err != nil {
-		redisStatus = "disconnected"
-	}
+// seedPrompts заполняет библиотеку подсказок, если она пуста.
+func seedPrompts(store repository.Store) {
+	ctx := context.Background()
 
-	c.JSON(http.StatusOK, gin.H{
-		"status":    "ok",
-		"timestamp": time.Now(),
-		"database":  dbStatus,
-		"redis":     redisStatus,
-		"version":   "2.0.0",
-	})
-}
-
-func getCitiesHandler(c *gin.Context) {
-	var cities []models.City
-	cacheKey := "cities:all"
-
-	if err := cache.Get(cacheKey, &cities); err == nil {
-		c.Header("X-Cache", "HIT")
-		c.JSON(http.StatusOK, cities)
-		return
-	}
-
-	if err := db.DB.Find(&cities).Error; err != nil {
-		utils.Logger.Error("get_cities_failed", zap.Error(err))
-		utils.ErrorCount.WithLabelValues("GetCities", "database").Inc()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cities"})
-		return
-	}
-
-	cache.Set(cacheKey, cities, time.Hour)
-	c.Header("X-Cache", "MISS")
-	c.JSON(http.StatusOK, cities)
-}
-
-func getHabitStatsHandler(c *gin.Context) {
-	userInterface, exists := c.Get("user")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-	currentUser := userInterface.(models.User)
-
-	stats, err := services.CalculateUserHabitStatsConcurrently(currentUser.ID, utils.Logger)
+	existing, err := store.Prompts().List(ctx, repository.PromptFilter{})
 	if err != nil {
-		utils.Logger.Error("calculate_stats_failed", zap.Error(err))
-		utils.ErrorCount.WithLabelValues("GetHabitStats", "calculation").Inc()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate statistics"})
-		return
-	}
-
-	c.JSON(http.StatusOK, stats)
-}
-
-func bulkActivateHabitsHandler(c *gin.Context) {
-	var req struct {
-		HabitIDs []uint `json:"habit_ids" binding:"required"`
-		IsActive bool   `json:"is_active"`
-	}
-
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		utils.Logger.Error("seed_prompts_list_failed", zap.Error(err))
 		return
 	}
-
-	if err := services.BulkUpdateHabitsActiveStatus(req.HabitIDs, req.IsActive, utils.Logger); err != nil {
-		utils.Logger.Error("bulk_update_failed", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update habits"})
+	if len(existing) > 0 {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Habits updated successfully",
-		"count":   len(req.HabitIDs),
-	})
-}
-
-func clearCacheHandler(c *gin.Context) {
-	if err := cache.Client.FlushDB(context.Background()).Err(); err != nil {
-		utils.Logger.Error("cache_clear_failed", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear cache"})
-		return
+	prompts := []models.JournalPrompt{
+		{Category: models.PromptDaily, Text: "Что сегодня получилось лучше, чем вы ожидали?"},
+		{Category: models.PromptDaily, Text: "Что отняло больше всего сил и почему?"},
+		{Category: models.PromptDaily, Text: "Какое одно дело сделает завтрашний день удачным?"},
+		{Category: models.PromptDaily, Text: "Что помешало выполнить привычки сегодня?"},
+		{Category: models.PromptGratitude, Text: "За что вы благодарны сегодня?"},
+		{Category: models.PromptGratitude, Text: "Кто из людей помог вам на этой неделе?"},
+		{Category: models.PromptGratitude, Text: "Какая мелочь сегодня вас порадовала?"},
+		{Category: models.PromptWeekly, Text: "Какая привычка давалась легче всего на этой неделе?"},
+		{Category: models.PromptWeekly, Text: "Чему вы научились за неделю?"},
+		{Category: models.PromptWeekly, Text: "Что вы хотите изменить на следующей неделе?"},
 	}
-
-	utils.Logger.Info("cache_cleared_by_admin")
-	c.JSON(http.StatusOK, gin.H{"message": "Cache cleared successfully"})
-}
-
-func clearUserCacheHandler(c *gin.Context) {
-	userID := c.Param("id")
-
-	var id uint
-	if _, err := fmt.Sscanf(userID, "%d", &id); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
-		return
-	}
-
-	if err := middleware.InvalidateUserCache(id); err != nil {
-		utils.Logger.Error("user_cache_clear_failed", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear user cache"})
-		return
+	created := 0
+	for i := range prompts {
+		prompts[i].IsActive = true
+		if err := store.Prompts().Create(ctx, &prompts[i]); err != nil {
+			utils.Logger.Error("seed_prompts_failed", zap.Error(err))
+			return
+		}
+		created++
 	}
-
-	utils.Logger.Info("user_cache_cleared", zap.Uint("user_id", id))
-	c.JSON(http.StatusOK, gin.H{"message": "User cache cleared"})
+	utils.Logger.Info("seed_prompts_created", zap.Int("count", created))
 }
 
-func startServerWithGracefulShutdown(router *gin.Engine) {
+func startServerWithGracefulShutdown(router *gin.Engine, cacheBackend string) {
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -338,9 +293,10 @@ func startServerWithGracefulShutdown(router *gin.Engine) {
 	fmt.Printf("   🌐 Server:  http://localhost:%s\n", port)
 	fmt.Printf("   📊 Metrics: http://localhost:%s/metrics\n", port)
 	fmt.Printf("   ❤️  Health: http://localhost:%s/health\n", port)
-	fmt.Printf("   🔒 Redis:   Connected\n")
+	fmt.Printf("   🔒 Cache:   %s\n", cacheBackend)
 	fmt.Printf("   💾 DB:      Connected\n")
-	fmt.Println("   ================================\n")
+	fmt.Println("   ================================")
+	fmt.Println()
 
 	go func() {
 		if gin.Mode() == gin.ReleaseMode && fileExists("./certs/server.crt") {
@@ -0,0 +1,365 @@
+// Package markdown переводит текст записей дневника в HTML. Рендерер
+// безопасен по построению: весь текст экранируется, а теги порождает
+// только он сам из короткого списка, так что сырой HTML из записи в
+// результат не попадает. Поддерживается подмножество CommonMark, которого
+// хватает дневнику: заголовки, абзацы, цитаты, списки без вложенности,
+// блоки и фрагменты кода, выделение, зачёркивание, ссылки и линии.
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	headingRe = regexp.MustCompile(`^(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	ruleRe    = regexp.MustCompile(`^(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	bulletRe  = regexp.MustCompile(`^[-*+][ \t]+(.*)$`)
+	orderedRe = regexp.MustCompile(`^(\d{1,9})[.)][ \t]+(.*)$`)
+	fenceRe   = regexp.MustCompile("^(`{3,}|~{3,})[ \t]*([A-Za-z0-9_+-]*)")
+	langRe    = regexp.MustCompile(`^[A-Za-z0-9_+-]+$`)
+)
+
+// Render переводит Markdown в HTML. Переводы строк внутри абзаца
+// становятся <br>: в дневнике их почти всегда ставят намеренно.
+func Render(src string) string {
+	var b strings.Builder
+	renderBlocks(&b, splitLines(src))
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func splitLines(src string) []string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = strings.ReplaceAll(src, "\r", "\n")
+	return strings.Split(src, "\n")
+}
+
+func renderBlocks(b *strings.Builder, lines []string) {
+	var para []string
+	flush := func() {
+		if len(para) == 0 {
+			return
+		}
+		b.WriteString("<p>")
+		for i, line := range para {
+			if i > 0 {
+				b.WriteString("<br>\n")
+			}
+			b.WriteString(renderInline(strings.TrimSpace(line), false))
+		}
+		b.WriteString("</p>\n")
+		para = nil
+	}
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			flush()
+			i++
+
+		case fenceRe.MatchString(trimmed):
+			flush()
+			m := fenceRe.FindStringSubmatch(trimmed)
+			fence := m[1]
+			i++
+			var code []string
+			for i < len(lines) && !isClosingFence(lines[i], fence) {
+				code = append(code, lines[i])
+				i++
+			}
+			i++ // закрывающая черта или конец текста
+			b.WriteString("<pre><code")
+			if m[2] != "" && langRe.MatchString(m[2]) {
+				b.WriteString(` class="language-` + m[2] + `"`)
+			}
+			b.WriteString(">")
+			for _, l := range code {
+				b.WriteString(html.EscapeString(l))
+				b.WriteString("\n")
+			}
+			b.WriteString("</code></pre>\n")
+
+		case headingRe.MatchString(trimmed):
+			flush()
+			m := headingRe.FindStringSubmatch(trimmed)
+			level := string(rune('0' + len(m[1])))
+			b.WriteString("<h" + level + ">" + renderInline(m[2], false) + "</h" + level + ">\n")
+			i++
+
+		case ruleRe.MatchString(trimmed):
+			flush()
+			b.WriteString("<hr>\n")
+			i++
+
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			var quote []string
+			for i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">") {
+				l := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quote = append(quote, strings.TrimPrefix(l, " "))
+				i++
+			}
+			b.WriteString("<blockquote>\n")
+			renderBlocks(b, quote)
+			b.WriteString("</blockquote>\n")
+
+		case bulletRe.MatchString(trimmed), orderedRe.MatchString(trimmed):
+			flush()
+			i = renderList(b, lines, i)
+
+		default:
+			para = append(para, line)
+			i++
+		}
+	}
+	flush()
+}
+
+func isClosingFence(line, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// renderList выводит список, начинающийся со строки start, и возвращает
+// индекс первой строки после него. Строки с отступом продолжают пункт.
+func renderList(b *strings.Builder, lines []string, start int) int {
+	item := bulletRe
+	tag := "ul"
+	if m := orderedRe.FindStringSubmatch(strings.TrimSpace(lines[start])); m != nil {
+		item, tag = orderedRe, "ol"
+		b.WriteString("<ol")
+		if n := strings.TrimLeft(m[1], "0"); n != "1" && n != "" {
+			b.WriteString(` start="` + n + `"`)
+		}
+		b.WriteString(">\n")
+	} else {
+		b.WriteString("<ul>\n")
+	}
+
+	var items [][]string
+	i := start
+	for i < len(lines) {
+		line := lines[i]
+		if m := item.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			items = append(items, []string{m[len(m)-1]})
+		} else if len(items) > 0 && strings.TrimSpace(line) != "" && (strings.HasPrefix(line, "  ") || strings.HasPrefix(line, "\t")) {
+			last := len(items) - 1
+			items[last] = append(items[last], strings.TrimSpace(line))
+		} else {
+			break
+		}
+		i++
+	}
+
+	for _, parts := range items {
+		b.WriteString("<li>")
+		for j, part := range parts {
+			if j > 0 {
+				b.WriteString("<br>\n")
+			}
+			b.WriteString(renderInline(part, false))
+		}
+		b.WriteString("</li>\n")
+	}
+	b.WriteString("</" + tag + ">\n")
+	return i
+}
+
+// renderInline экранирует текст строки и размечает выделение, код и
+// ссылки. inLink запрещает ссылки внутри текста ссылки.
+func renderInline(s string, inLink bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && isPunct(s[i+1]):
+			b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			continue
+
+		case c == '`':
+			run := countRun(s[i:], '`')
+			if end := strings.Index(s[i+run:], strings.Repeat("`", run)); end >= 0 {
+				code := strings.TrimSpace(s[i+run : i+run+end])
+				b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i += run + end + run
+				continue
+			}
+			b.WriteString(strings.Repeat("`", run))
+			i += run
+			continue
+
+		case (c == '[' || (c == '!' && strings.HasPrefix(s[i+1:], "["))) && !inLink:
+			// Картинки показываются ссылками: внешние изображения выдали
+			// бы стороннему серверу, что запись открыта.
+			skip := 0
+			if c == '!' {
+				skip = 1
+			}
+			if text, href, n, ok := parseLink(s[i+skip:]); ok {
+				if u, safe := safeURL(href); safe {
+					b.WriteString(`<a href="` + html.EscapeString(u) + `" rel="nofollow noopener noreferrer">` + renderInline(text, true) + "</a>")
+				} else {
+					b.WriteString(renderInline(text, true))
+				}
+				i += skip + n
+				continue
+			}
+
+		case c == '<' && !inLink:
+			if end := strings.IndexByte(s[i:], '>'); end > 0 {
+				if u, safe := safeURL(s[i+1 : i+end]); safe && strings.Contains(u, ":") && !strings.ContainsAny(u, " \t") {
+					b.WriteString(`<a href="` + html.EscapeString(u) + `" rel="nofollow noopener noreferrer">` + html.EscapeString(u) + "</a>")
+					i += end + 1
+					continue
+				}
+			}
+
+		case c == '*' || c == '_' || c == '~':
+			if out, n, ok := emphasis(s, i, inLink); ok {
+				b.WriteString(out)
+				i += n
+				continue
+			}
+		}
+
+		b.WriteString(html.EscapeString(s[i : i+1]))
+		i++
+	}
+	return b.String()
+}
+
+// emphasis размечает **сильное**, *обычное* выделение и ~~зачёркивание~~,
+// начинающиеся с позиции i. Подчёркивания внутри слова выделением
+// не считаются, чтобы не ломать имена_с_подчёркиваниями.
+func emphasis(s string, i int, inLink bool) (string, int, bool) {
+	c := s[i]
+	run := countRun(s[i:], c)
+	if c == '~' && run != 2 {
+		return "", 0, false
+	}
+	if run > 2 {
+		run = 2
+	}
+	if c == '_' && i > 0 && isWordByte(s[i-1]) {
+		return "", 0, false
+	}
+
+	delim := strings.Repeat(string(c), run)
+	body := s[i+run:]
+	if body == "" || body[0] == ' ' || body[0] == '\t' {
+		return "", 0, false
+	}
+	for from := 0; from < len(body); {
+		end := strings.Index(body[from:], delim)
+		if end < 0 {
+			return "", 0, false
+		}
+		end += from
+		after := end + run
+		closes := end > 0 && body[end-1] != ' ' && body[end-1] != '\t' &&
+			(c != '_' || after >= len(body) || !isWordByte(body[after])) &&
+			(run == 2 || after >= len(body) || body[after] != c)
+		if closes {
+			tag := "em"
+			switch {
+			case c == '~':
+				tag = "del"
+			case run == 2:
+				tag = "strong"
+			}
+			return "<" + tag + ">" + renderInline(body[:end], inLink) + "</" + tag + ">", run + after, true
+		}
+		from = end + 1
+	}
+	return "", 0, false
+}
+
+// parseLink разбирает [текст](адрес "заголовок") в начале s. Заголовок
+// отбрасывается. n — длина разобранного фрагмента.
+func parseLink(s string) (text, href string, n int, ok bool) {
+	depth := 0
+	closeText := -1
+	for i := 0; i < len(s) && closeText < 0; i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				closeText = i
+			}
+		}
+	}
+	if closeText < 0 || !strings.HasPrefix(s[closeText+1:], "(") {
+		return "", "", 0, false
+	}
+	// Скобки внутри адреса должны быть парными, как в CommonMark.
+	rest := s[closeText+2:]
+	end := -1
+	for i, parens := 0, 0; i < len(rest) && end < 0; i++ {
+		switch rest[i] {
+		case '\\':
+			i++
+		case '(':
+			parens++
+		case ')':
+			if parens == 0 {
+				end = i
+			}
+			parens--
+		}
+	}
+	if end < 0 {
+		return "", "", 0, false
+	}
+	dest := strings.TrimSpace(rest[:end])
+	if sp := strings.IndexAny(dest, " \t"); sp >= 0 {
+		dest = dest[:sp]
+	}
+	dest = strings.TrimSuffix(strings.TrimPrefix(dest, "<"), ">")
+	return s[1:closeText], dest, closeText + 2 + end + 1, true
+}
+
+// safeScheme — схемы, которые разрешено ставить в ссылки; относительные
+// адреса тоже допускаются.
+var safeScheme = map[string]bool{"http": true, "https": true, "mailto": true}
+
+// safeURL проверяет адрес ссылки. Браузеры выбрасывают из схемы пробелы и
+// управляющие символы, поэтому адреса с ними не принимаются вовсе.
+func safeURL(raw string) (string, bool) {
+	if raw == "" || strings.IndexFunc(raw, func(r rune) bool { return r <= ' ' || r == 0x7f }) >= 0 {
+		return "", false
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	if u.Scheme != "" && !safeScheme[strings.ToLower(u.Scheme)] {
+		return "", false
+	}
+	return raw, true
+}
+
+func countRun(s string, c byte) int {
+	n := 0
+	for n < len(s) && s[n] == c {
+		n++
+	}
+	return n
+}
+
+func isPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isWordByte(c byte) bool {
+	return c >= 0x80 || c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,76 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	cases := []struct {
+		name, src, want string
+	}{
+		{"paragraph breaks", "one\ntwo\n\nthree", "<p>one<br>\ntwo</p>\n<p>three</p>"},
+		{"heading", "## Plan for C# ##", "<h2>Plan for C#</h2>"},
+		{"hashtag is text", "#mood", "<p>#mood</p>"},
+		{"emphasis", "**bold** and *it* and ~~gone~~", "<p><strong>bold</strong> and <em>it</em> and <del>gone</del></p>"},
+		{"intraword underscore", "snake_case_name", "<p>snake_case_name</p>"},
+		{"inline code", "run `a<b>` now", "<p>run <code>a&lt;b&gt;</code> now</p>"},
+		{"fenced code", "```go\nif a < b {}\n```", "<pre><code class=\"language-go\">if a &lt; b {}\n</code></pre>"},
+		{"lists", "- a\n- b\n\n3. c\n4. d", "<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n<ol start=\"3\">\n<li>c</li>\n<li>d</li>\n</ol>"},
+		{"quote", "> calm\n> day", "<blockquote>\n<p>calm<br>\nday</p>\n</blockquote>"},
+		{"rule", "---", "<hr>"},
+		{"link", "[site](https://example.com \"t\")", `<p><a href="https://example.com" rel="nofollow noopener noreferrer">site</a></p>`},
+		{"autolink", "<https://example.com/?a=1&b=2>", `<p><a href="https://example.com/?a=1&amp;b=2" rel="nofollow noopener noreferrer">https://example.com/?a=1&amp;b=2</a></p>`},
+		{"parens in url", "[wiki](https://en.wikipedia.org/wiki/Go_(language)).", `<p><a href="https://en.wikipedia.org/wiki/Go_(language)" rel="nofollow noopener noreferrer">wiki</a>.</p>`},
+		{"image as link", "![cat](/img/cat.png)", `<p><a href="/img/cat.png" rel="nofollow noopener noreferrer">cat</a></p>`},
+		{"escaped", `\*not em\*`, "<p>*not em*</p>"},
+		{"unicode", "Сегодня **хорошо**", "<p>Сегодня <strong>хорошо</strong></p>"},
+	}
+	for _, tc := range cases {
+		if got := Render(tc.src); got != tc.want {
+			t.Errorf("%s: Render(%q)\n got %q\nwant %q", tc.name, tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestRenderNeutralizesXSS(t *testing.T) {
+	for _, src := range []string{
+		`<script>alert(1)</script>`,
+		`<img src=x onerror=alert(1)>`,
+		`[click](javascript:alert(1))`,
+		`[click](JaVaScRiPt:alert(1))`,
+		"[click](java\tscript:alert(1))",
+		`[click](data:text/html;base64,PHNjcmlwdD4=)`,
+		`[x](https://e.com" onmouseover="alert(1))`,
+		`<javascript:alert(1)>`,
+		"```\"><script>\nx\n```",
+		`**<svg onload=alert(1)>**`,
+	} {
+		got := strings.ToLower(Render(src))
+		for _, bad := range []string{"<script", "<img", "<svg", `href="javascript`, `href="data`, `" onmouseover`} {
+			if strings.Contains(got, bad) {
+				t.Errorf("Render(%q) = %q contains %q", src, got, bad)
+			}
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	cases := []struct {
+		src, want string
+	}{
+		{"hi <script>alert(1)</script>there", "hi there"},
+		{"<b>bold</b> <a href=\"javascript:x\">link</a>", "bold link"},
+		{"<scr<b>ipt>alert(1)</script>", "alert(1)"},
+		{"keep a < b and 1<2", "keep a < b and 1<2"},
+		{"note<!-- hidden -->s", "notes"},
+		{"bell\x07 and\ttab\r\nline", "bell and\ttab\nline"},
+		{"`<b>` stays", "`<b>` stays"},
+		{"```html\n<script>x</script>\n```\n<i>after</i>", "```html\n<script>x</script>\n```\nafter"},
+	}
+	for _, tc := range cases {
+		if got := Sanitize(tc.src); got != tc.want {
+			t.Errorf("Sanitize(%q) = %q, want %q", tc.src, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	// dangerousRe — элементы, содержимое которых не нужно даже как текст.
+	// В RE2 нет обратных ссылок, поэтому у каждого тега своя ветка.
+	dangerousRe = regexp.MustCompile(`(?is)<script\b.*?</script\s*>|<style\b.*?</style\s*>|<iframe\b.*?</iframe\s*>|<object\b.*?</object\s*>|<noscript\b.*?</noscript\s*>|<template\b.*?</template\s*>|<svg\b.*?</svg\s*>|<math\b.*?</math\s*>`)
+	commentRe   = regexp.MustCompile(`(?s)<!--.*?(?:-->|$)`)
+	// tagRe требует букву сразу после <, так что «a < b» и «1<2» остаются.
+	tagRe        = regexp.MustCompile(`</?[A-Za-z][A-Za-z0-9-]*(?:\s[^<>]*)?/?>|<![A-Za-z][^<>]*>|<\?[^<>]*>`)
+	inlineCodeRe = regexp.MustCompile("`+[^`\n]*`+")
+)
+
+// Sanitize убирает из Markdown сырой HTML: опасные элементы вместе
+// с содержимым, комментарии и остальные теги, оставляя их текст, а также
+// управляющие символы кроме перевода строки и табуляции. Блоки и фрагменты
+// кода не трогаются: рендерер всё равно выводит их как текст.
+func Sanitize(src string) string {
+	src = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+		if unicode.IsControl(r) || r == unicode.ReplacementChar {
+			return -1
+		}
+		return r
+	}, strings.ReplaceAll(src, "\r\n", "\n"))
+
+	var out, text strings.Builder
+	flushText := func() {
+		out.WriteString(stripOutsideCode(text.String()))
+		text.Reset()
+	}
+
+	lines := strings.Split(src, "\n")
+	for i := 0; i < len(lines); i++ {
+		if i > 0 {
+			text.WriteString("\n")
+		}
+		m := fenceRe.FindStringSubmatch(strings.TrimSpace(lines[i]))
+		if m == nil {
+			text.WriteString(lines[i])
+			continue
+		}
+
+		flushText()
+		out.WriteString(lines[i])
+		for i+1 < len(lines) {
+			i++
+			out.WriteString("\n" + lines[i])
+			if isClosingFence(lines[i], m[1]) {
+				break
+			}
+		}
+	}
+	flushText()
+	return out.String()
+}
+
+// stripOutsideCode убирает HTML из текста, пропуская фрагменты `кода`.
+func stripOutsideCode(s string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range inlineCodeRe.FindAllStringIndex(s, -1) {
+		b.WriteString(stripHTML(s[last:loc[0]]))
+		b.WriteString(s[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	b.WriteString(stripHTML(s[last:]))
+	return b.String()
+}
+
+func stripHTML(s string) string {
+	s = dangerousRe.ReplaceAllString(s, "")
+	s = commentRe.ReplaceAllString(s, "")
+	// Повторяем, пока что-то меняется: удаление одного тега может
+	// склеить из остатков другой, как в «<scr<b>ipt>».
+	for {
+		stripped := tagRe.ReplaceAllString(s, "")
+		if stripped == s {
+			return s
+		}
+		s = stripped
+	}
+}
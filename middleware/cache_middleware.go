@@ -2,8 +2,13 @@ package middleware
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/Bekzhanizb/HabitTrackerBackend/cache"
@@ -13,7 +18,20 @@ import (
 	"go.uber.org/zap"
 )
 
-func CacheMiddleware(duration time.Duration) gin.HandlerFunc {
+// errNotCacheable прерывает загрузку, если обработчик ответил не 200:
+// такой ответ не кэшируется, а ожидавшие его запросы выполняются сами.
+var errNotCacheable = errors.New("response is not cacheable")
+
+// CacheMiddleware кэширует успешные GET-ответы ресурса resource. Запись
+// регистрируется под тегом пользователя и тегом ресурса, поэтому сервисы
+// сбрасывают её при изменении данных (см. cache.WriteTags).
+//
+// Одновременные промахи по одному ключу выполняют обработчик один раз.
+// После истечения duration ответ ещё столько же отдаётся как устаревший
+// (X-Cache: STALE), пока его обновляет первый заставший это запрос.
+func CacheMiddleware(store cache.Cache, duration time.Duration, resource string) gin.HandlerFunc {
+	loader := cache.NewLoader(store, "response:"+resource, utils.Logger)
+
 	return func(c *gin.Context) {
 		if c.Request.Method != http.MethodGet {
 			c.Next()
@@ -21,9 +39,11 @@ func CacheMiddleware(duration time.Duration) gin.HandlerFunc {
 		}
 
 		userID := uint(0)
+		isAdmin := false
 		if userInterface, exists := c.Get("user"); exists {
 			if user, ok := userInterface.(models.User); ok {
 				userID = user.ID
+				isAdmin = user.Role == models.RoleAdmin
 				utils.Logger.Debug("cache_user_found", zap.Uint("user_id", userID))
 			} else {
 				utils.Logger.Warn("cache_invalid_user_type",
@@ -41,51 +61,106 @@ func CacheMiddleware(duration time.Duration) gin.HandlerFunc {
 			zap.String("key", cacheKey),
 			zap.Uint("user_id", userID))
 
-		var cachedResponse CachedResponse
-		if err := cache.Get(cacheKey, &cachedResponse); err == nil {
-			utils.Logger.Info("cache_hit", zap.String("key", cacheKey))
+		// Администратор видит данные всех пользователей, поэтому его
+		// ответы должны сбрасываться при любой записи в ресурс.
+		resourceTag := cache.ResourceTag(resource, userID)
+		if isAdmin {
+			resourceTag = cache.AllResourceTag(resource)
+		}
+		policy := cache.Policy{
+			TTL:      duration,
+			StaleFor: duration,
+			Beta:     1,
+			Tags:     []string{cache.UserTag(userID), resourceTag},
+		}
+
+		// served становится true, если обработчик выполнился в этом запросе
+		// и уже записал ответ клиенту.
+		served := false
+		data, state, err := loader.Fetch(c.Request.Context(), cacheKey, policy, func(ctx context.Context) ([]byte, error) {
+			served = true
+			utils.Logger.Info("cache_miss", zap.String("key", cacheKey))
+			c.Header("X-Cache", "MISS")
+
+			// Тело буферизуется целиком: ETag считается по нему и должен
+			// попасть в заголовки до отправки ответа.
+			bw := &bufferedWriter{body: &bytes.Buffer{}, ResponseWriter: c.Writer}
+			c.Writer = bw
+			c.Next()
+			c.Writer = bw.ResponseWriter
 
-			for key, values := range cachedResponse.Headers {
-				for _, value := range values {
-					c.Header(key, value)
-				}
+			if c.Writer.Status() != http.StatusOK || noStore(c.Writer.Header()) {
+				c.Writer.Write(bw.body.Bytes())
+				return nil, errNotCacheable
 			}
-			c.Header("X-Cache", "HIT")
 
-			c.Data(cachedResponse.Status, cachedResponse.ContentType, cachedResponse.Body)
-			c.Abort()
+			if c.Writer.Header().Get("ETag") == "" {
+				c.Header("ETag", BodyETag(bw.body.Bytes()))
+			}
+			resp := CachedResponse{
+				Status:      c.Writer.Status(),
+				ContentType: c.Writer.Header().Get("Content-Type"),
+				Body:        bw.body.Bytes(),
+				Headers:     cachedHeaders(c.Writer.Header()),
+			}
+			writeConditional(c, resp.Status, resp.Body)
+			return json.Marshal(resp)
+		})
+		if served {
 			return
 		}
 
-		utils.Logger.Info("cache_miss", zap.String("key", cacheKey))
-		c.Header("X-Cache", "MISS")
-
-		blw := &bodyLogWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
-		c.Writer = blw
+		var cachedResponse CachedResponse
+		if err == nil {
+			err = json.Unmarshal(data, &cachedResponse)
+		}
+		if err != nil {
+			// Ответ, которого ждал запрос, не закэширован — выполняем обработчик сами.
+			if !errors.Is(err, errNotCacheable) {
+				utils.Logger.Warn("cache_fetch_failed", zap.String("key", cacheKey), zap.Error(err))
+			}
+			c.Next()
+			return
+		}
 
-		c.Next()
+		utils.Logger.Info("cache_"+string(state), zap.String("key", cacheKey))
 
-		if c.Writer.Status() == http.StatusOK {
-			cachedResp := CachedResponse{
-				Status:      c.Writer.Status(),
-				ContentType: c.Writer.Header().Get("Content-Type"),
-				Body:        blw.body.Bytes(),
-				Headers:     c.Writer.Header(),
+		for key, values := range cachedResponse.Headers {
+			for _, value := range values {
+				c.Header(key, value)
 			}
+		}
+		c.Header("X-Cache", strings.ToUpper(string(state)))
 
-			if err := cache.Set(cacheKey, cachedResp, duration); err != nil {
-				utils.Logger.Warn("cache_set_failed",
-					zap.Error(err),
-					zap.String("key", cacheKey),
-				)
-			} else {
-				utils.Logger.Info("cache_set_success",
-					zap.String("key", cacheKey),
-					zap.Duration("ttl", duration),
-				)
-			}
+		writeConditional(c, cachedResponse.Status, cachedResponse.Body)
+		c.Abort()
+	}
+}
+
+// cacheableHeaders — заголовки, которые описывают само тело ответа и
+// повторяются при выдаче из кэша. Остальные относятся к конкретному
+// запросу: например, заголовки лимитера из первого промаха иначе
+// заменили бы текущие значения у всех последующих попаданий.
+var cacheableHeaders = []string{"Content-Type", "ETag", "Last-Modified", "Link", "X-Next-Cursor"}
+
+func cachedHeaders(h http.Header) http.Header {
+	kept := make(http.Header, len(cacheableHeaders))
+	for _, name := range cacheableHeaders {
+		if values := h.Values(name); len(values) > 0 {
+			kept[name] = slices.Clone(values)
 		}
 	}
+	return kept
+}
+
+// NoStore запрещает кэшировать ответ: его не сохранит ни CacheMiddleware,
+// ни браузер или прокси.
+func NoStore(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+}
+
+func noStore(h http.Header) bool {
+	return strings.Contains(h.Get("Cache-Control"), "no-store")
 }
 
 type CachedResponse struct {
@@ -95,61 +170,39 @@ type CachedResponse struct {
 	Headers     http.Header `json:"headers"`
 }
 
-type bodyLogWriter struct {
+// bufferedWriter придерживает тело ответа, не отправляя его клиенту.
+// Статус и заголовки пишутся в исходный writer, который отправит их
+// только вместе с телом.
+type bufferedWriter struct {
 	gin.ResponseWriter
 	body *bytes.Buffer
 }
 
-func (w bodyLogWriter) Write(b []byte) (int, error) {
-	w.body.Write(b)
-	return w.ResponseWriter.Write(b)
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
 }
 
-func (w bodyLogWriter) WriteString(s string) (int, error) {
-	w.body.WriteString(s)
-	return w.ResponseWriter.WriteString(s)
-}
-
-func InvalidateUserCache(userID uint) error {
-	pattern := fmt.Sprintf("cache:%d:*", userID)
-	utils.Logger.Info("invalidating_user_cache", zap.Uint("user_id", userID))
-	return cache.DeletePattern(pattern)
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
 }
 
-func RateLimitMiddleware(maxRequests int, window time.Duration) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		clientIP := c.ClientIP()
-		key := fmt.Sprintf("rate_limit:%s", clientIP)
-
-		count, err := cache.IncrementCounter(key, window)
-		if err != nil {
-			utils.Logger.Error("rate_limit_error", zap.Error(err))
-			c.Next()
-			return
-		}
+func (w *bufferedWriter) WriteHeaderNow() {}
 
-		c.Header("X-RateLimit-Limit", fmt.Sprintf("%d", maxRequests))
-		c.Header("X-RateLimit-Remaining", fmt.Sprintf("%d", max(0, maxRequests-int(count))))
-
-		if count > int64(maxRequests) {
-			utils.Logger.Warn("rate_limit_exceeded",
-				zap.String("ip", clientIP),
-				zap.Int64("count", count),
-			)
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "Слишком много запросов. Попробуйте позже.",
-			})
-			c.Abort()
-			return
-		}
-
-		c.Next()
+// writeConditional отправляет тело или 304, если у клиента актуальная копия.
+func writeConditional(c *gin.Context, status int, body []byte) {
+	if status == http.StatusOK && NotModified(c.Request, c.Writer.Header()) {
+		c.Status(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return
 	}
+
+	c.Status(status)
+	c.Writer.Write(body)
 }
 
-func max(a, b int) int {
-	if a > b {
-		return a
-	}
-	return b
+// InvalidateUserCache сбрасывает всё, что закэшировано для пользователя:
+// ответы CacheMiddleware и статистику.
+func InvalidateUserCache(ctx context.Context, store cache.Cache, userID uint) error {
+	utils.Logger.Info("invalidating_user_cache", zap.Uint("user_id", userID))
+	return store.InvalidateTags(ctx, cache.UserTag(userID))
 }
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNotModified(t *testing.T) {
+	header := http.Header{}
+	header.Set("ETag", `"abc"`)
+	header.Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+
+	cases := []struct {
+		name    string
+		request map[string]string
+		want    bool
+	}{
+		{"no preconditions", nil, false},
+		{"etag match", map[string]string{"If-None-Match": `"abc"`}, true},
+		{"weak etag match", map[string]string{"If-None-Match": `W/"abc"`}, true},
+		{"etag in list", map[string]string{"If-None-Match": `"x", "abc"`}, true},
+		{"wildcard", map[string]string{"If-None-Match": "*"}, true},
+		{"etag mismatch", map[string]string{"If-None-Match": `"x"`}, false},
+		{"not modified since", map[string]string{"If-Modified-Since": "Mon, 02 Jan 2006 15:04:05 GMT"}, true},
+		{"modified since", map[string]string{"If-Modified-Since": "Mon, 02 Jan 2006 15:04:04 GMT"}, false},
+		{"invalid date", map[string]string{"If-Modified-Since": "yesterday"}, false},
+		// If-None-Match важнее If-Modified-Since.
+		{"etag wins over date", map[string]string{
+			"If-None-Match":     `"x"`,
+			"If-Modified-Since": "Mon, 02 Jan 2006 15:04:05 GMT",
+		}, false},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for k, v := range tc.request {
+			req.Header.Set(k, v)
+		}
+		if got := NotModified(req, header); got != tc.want {
+			t.Errorf("%s: NotModified = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -48,12 +48,19 @@ func CSRFMiddleware(authKey []byte, skipPaths ...string) gin.HandlerFunc {
 			return
 		}
 
+		passed := false
 		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			passed = true
 			c.Request = r
 			c.Next()
 		})
 
 		gorillaCSRF(handler).ServeHTTP(c.Writer, c.Request)
+
+		// Ответ 403 уже записан ErrorHandler'ом — остальная цепочка не должна выполняться.
+		if !passed {
+			c.Abort()
+		}
 	}
 }
 func GetCSRFToken() gin.HandlerFunc {
@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/cache"
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+	"github.com/Bekzhanizb/HabitTrackerBackend/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// overridesRefreshInterval — как часто лимитер перечитывает список исключений,
+// чтобы изменения, сделанные на другом инстансе, применялись и здесь.
+const overridesRefreshInterval = 30 * time.Second
+
+// KeyFunc определяет, чей лимит расходует запрос.
+type KeyFunc func(c *gin.Context) string
+
+// KeyByIP считает запросы по адресу клиента.
+func KeyByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// KeyByUser считает запросы по пользователю из AuthMiddleware, а для
+// анонимных запросов — по IP. До AuthMiddleware токен не проверен,
+// поэтому ставить этот лимит нужно после неё.
+func KeyByUser(c *gin.Context) string {
+	if value, exists := c.Get("user"); exists {
+		if user, ok := value.(models.User); ok {
+			return fmt.Sprintf("user:%d", user.ID)
+		}
+	}
+	return KeyByIP(c)
+}
+
+// KeyByToken считает запросы по токену, проверенному AuthMiddleware, так
+// что у каждого устройства пользователя свой лимит. Как и KeyByUser,
+// ставится после AuthMiddleware.
+func KeyByToken(c *gin.Context) string {
+	if token := c.GetString("token"); token != "" {
+		sum := sha256.Sum256([]byte(token))
+		return "token:" + hex.EncodeToString(sum[:8])
+	}
+	return KeyByIP(c)
+}
+
+// RateLimitPolicy — лимит маршрута: Limit запросов за Period с допустимой
+// пачкой до Limit запросов подряд.
+type RateLimitPolicy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+	Key    KeyFunc
+}
+
+// RateLimiter ограничивает запросы ведром токенов в общем кэше, поэтому
+// лимиты общие для всех инстансов. Администратор может поднять или снять
+// лимит для конкретного пользователя, токена или IP.
+type RateLimiter struct {
+	store     cache.Cache
+	overrides repository.RateLimitOverrideRepository
+
+	subjects  atomic.Pointer[map[string]models.RateLimitOverride]
+	loadedAt  atomic.Int64
+	reloading sync.Mutex
+}
+
+func NewRateLimiter(store cache.Cache, overrides repository.RateLimitOverrideRepository) *RateLimiter {
+	l := &RateLimiter{store: store, overrides: overrides}
+	l.subjects.Store(&map[string]models.RateLimitOverride{})
+	return l
+}
+
+// Reload перечитывает список исключений из БД.
+func (l *RateLimiter) Reload(ctx context.Context) error {
+	list, err := l.overrides.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	subjects := make(map[string]models.RateLimitOverride, len(list))
+	for _, override := range list {
+		subjects[override.Subject] = override
+	}
+	l.subjects.Store(&subjects)
+	l.loadedAt.Store(time.Now().UnixNano())
+	return nil
+}
+
+// override возвращает исключение для subject, при необходимости обновляя
+// список. Обновляет один запрос, остальные пользуются прежним списком.
+func (l *RateLimiter) override(ctx context.Context, subject string) (models.RateLimitOverride, bool) {
+	if time.Since(time.Unix(0, l.loadedAt.Load())) > overridesRefreshInterval && l.reloading.TryLock() {
+		if err := l.Reload(ctx); err != nil {
+			utils.Logger.Warn("rate_limit_overrides_reload_failed", zap.Error(err))
+			// Не повторяем на каждом запросе, пока БД недоступна.
+			l.loadedAt.Store(time.Now().UnixNano())
+		}
+		l.reloading.Unlock()
+	}
+
+	override, ok := (*l.subjects.Load())[subject]
+	return override, ok
+}
+
+// Middleware применяет policy к маршруту. Ответ содержит заголовки
+// RateLimit-* (draft-ietf-httpapi-ratelimit-headers), а отказ — Retry-After.
+func (l *RateLimiter) Middleware(policy RateLimitPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subject := policy.Key(c)
+
+		bucket := cache.TokenBucket{Capacity: policy.Limit, Period: policy.Period}
+		if override, ok := l.override(c.Request.Context(), subject); ok {
+			if override.Exempt {
+				c.Next()
+				return
+			}
+			if override.Multiplier > 0 {
+				bucket.Capacity = max(1, int(math.Round(float64(policy.Limit)*override.Multiplier)))
+			}
+		}
+
+		key := fmt.Sprintf("rate_limit:%s:%s", policy.Name, subject)
+		res, err := l.store.Take(c.Request.Context(), key, bucket)
+		if err != nil {
+			utils.Logger.Error("rate_limit_error", zap.String("policy", policy.Name), zap.Error(err))
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", bucket.Capacity, int(policy.Period.Seconds())))
+		c.Header("RateLimit-Limit", strconv.Itoa(bucket.Capacity))
+		c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+		// Старые заголовки оставлены для существующих клиентов.
+		c.Header("X-RateLimit-Limit", strconv.Itoa(bucket.Capacity))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+
+		if !res.Allowed {
+			utils.Logger.Warn("rate_limit_exceeded",
+				zap.String("policy", policy.Name),
+				zap.String("subject", subject),
+				zap.Duration("retry_after", res.RetryAfter),
+			)
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Слишком много запросов. Попробуйте позже.",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -1,7 +1,11 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
+
+	// Регистрирует сериализатор sealed для полей, шифруемых при хранении.
+	_ "github.com/Bekzhanizb/HabitTrackerBackend/encryption"
 )
 
 type City struct {
@@ -12,6 +16,8 @@ type City struct {
 type User struct {
 	ID           uint          `gorm:"primaryKey" json:"id"`
 	Username     string        `gorm:"unique" json:"username"`
+	Email        string        `gorm:"size:254" json:"email,omitempty"`   // пустой — письма не отправляются
+	Timezone     string        `gorm:"size:64" json:"timezone,omitempty"` // IANA; пустой — UTC
 	PasswordHash string        `json:"password_hash"`
 	CityID       *uint         `json:"city_id"`
 	City         City          `gorm:"foreignKey:CityID"`
@@ -35,16 +41,35 @@ type Habit struct {
 	Description string     `json:"description"`
 	Frequency   string     `json:"frequency"`
 	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"autoUpdateTime;default:CURRENT_TIMESTAMP" json:"updated_at"`
 	IsActive    bool       `gorm:"default:true" json:"is_active"`
 	Logs        []HabitLog `gorm:"foreignKey:HabitID" json:"logs"`
 }
 
+// HabitReminder — напоминание о привычке в заданное местное время
+// владельца. Days — дни недели от 1 (понедельник) до 7 (воскресенье);
+// пустой список — каждый день.
+type HabitReminder struct {
+	ID      uint   `gorm:"primaryKey" json:"id"`
+	HabitID uint   `gorm:"index;not null" json:"habit_id"`
+	UserID  uint   `gorm:"index;not null" json:"user_id"`
+	Time    string `gorm:"column:remind_at;size:5;not null" json:"time"` // HH:MM
+	Days    []int  `gorm:"serializer:json;type:jsonb" json:"days"`
+	// LastSentOn — местный день последней отправки, YYYY-MM-DD: за день
+	// напоминание приходит не больше одного раза.
+	LastSentOn string    `gorm:"size:10" json:"last_sent_on,omitempty"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
 type HabitLog struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
 	HabitID     uint      `json:"habit_id"`
 	Date        time.Time `json:"date"`
 	IsCompleted bool      `gorm:"default:false" json:"is_completed"`
-	Habit       Habit     `gorm:"foreignKey:HabitID" json:"habit,omitempty"`
+	// Note — короткий комментарий к отметке, например почему день пропущен.
+	Note  string `gorm:"size:280" json:"note,omitempty"`
+	Habit Habit  `gorm:"foreignKey:HabitID" json:"habit,omitempty"`
 }
 
 type Achievement struct {
@@ -55,10 +80,225 @@ type Achievement struct {
 	EarnedAt    time.Time `gorm:"autoCreateTime" json:"earned_at"`
 }
 type Diary struct {
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	UserID uint   `json:"user_id"`
+	Title  string `json:"title"`
+	// Content шифруется при хранении, если задан ключ (см. пакет encryption).
+	// У записей с Encrypted это шифротекст клиента в base64.
+	Content string `gorm:"serializer:sealed" json:"content"`
+	// ContentHTML — Content, переведённый из Markdown в безопасный HTML.
+	// Не хранится: заполняется сервисом при выдаче, у зашифрованных
+	// записей пуст.
+	ContentHTML string `gorm:"-" json:"content_html,omitempty"`
+	// Encrypted — запись зашифрована на клиенте: сервер не читает Content,
+	// не индексирует его для поиска и не кэширует ответы с ней. Title, Tags,
+	// Mood, Energy и Emotion остаются открытыми: по ним работают списки,
+	// фильтры и график настроения. Открытые ревизии удаляются при переходе
+	// записи в зашифрованный режим.
+	Encrypted  bool             `gorm:"not null;default:false" json:"encrypted"`
+	Encryption *DiaryEncryption `gorm:"serializer:json;type:jsonb" json:"encryption,omitempty"`
+	// Mood и Energy — самооценка по шкале 1–5; nil — не указано.
+	Mood    *int   `json:"mood"`
+	Energy  *int   `json:"energy"`
+	Emotion string `gorm:"size:32" json:"emotion,omitempty"`
+	// Tags хранятся в нижнем регистре без повторов.
+	Tags []string `gorm:"serializer:json;type:jsonb" json:"tags"`
+	// HabitID и HabitLogID связывают запись с привычкой пользователя и,
+	// по желанию, с конкретной отметкой. Привычка отметки всегда совпадает
+	// с HabitID.
+	HabitID    *uint `gorm:"index" json:"habit_id,omitempty"`
+	HabitLogID *uint `gorm:"index" json:"habit_log_id,omitempty"`
+	// PromptID — подсказка из библиотеки, на которую отвечает запись.
+	PromptID  *uint     `gorm:"index" json:"prompt_id,omitempty"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	// SearchVector — поисковый индекс заголовка и открытого текста. Content
+	// в БД может быть зашифрован, поэтому индекс заполняет репозиторий при
+	// записи; gorm колонку не читает и не пишет.
+	SearchVector string `gorm:"type:tsvector;index:idx_diaries_search,type:gin;->:false;<-:false" json:"-"`
+}
+
+// DiaryEncryption — параметры клиентского шифрования записи: алгоритм,
+// функция вывода ключа из пароля и её параметры. Сервер их не
+// интерпретирует и отдаёт вместе с шифротекстом, чтобы клиент мог
+// расшифровать запись на другом устройстве.
+type DiaryEncryption struct {
+	Algorithm  string `json:"algorithm"`
+	KDF        string `json:"kdf"`
+	Salt       string `json:"salt"`
+	Iterations int    `json:"iterations,omitempty"`
+	// Memory — объём памяти argon2id в КиБ.
+	Memory  int    `json:"memory,omitempty"`
+	Nonce   string `json:"nonce"`
+	KeyHint string `json:"key_hint,omitempty"`
+}
+
+// DiaryRevision — заголовок и текст записи дневника после создания или
+// правки. Таблица только дополняется; ревизии удаляются вместе с записью.
+type DiaryRevision struct {
+	ID      uint `gorm:"primaryKey" json:"id"`
+	DiaryID uint `gorm:"uniqueIndex:idx_diary_revisions_number;not null" json:"diary_id"`
+	// Number — порядковый номер ревизии внутри записи, начиная с 1.
+	Number     int              `gorm:"uniqueIndex:idx_diary_revisions_number;not null" json:"number"`
+	Title      string           `json:"title"`
+	Content    string           `gorm:"serializer:sealed" json:"content"`
+	Encryption *DiaryEncryption `gorm:"serializer:json;type:jsonb" json:"encryption,omitempty"`
+	EditedBy   uint             `json:"edited_by"`
+	// RestoredFrom — номер ревизии, из которой восстановлена эта.
+	RestoredFrom *int      `json:"restored_from,omitempty"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// DiaryAttachment — файл, прикреплённый к записи дневника. Сам файл лежит
+// в хранилище вложений под StorageKey и отдаётся только владельцу записи.
+type DiaryAttachment struct {
+	ID      uint `gorm:"primaryKey" json:"id"`
+	DiaryID uint `gorm:"index;not null" json:"diary_id"`
+	// UserID — владелец записи; по нему считается квота хранилища.
+	UserID      uint   `gorm:"index;not null" json:"user_id"`
+	FileName    string `gorm:"size:255;not null" json:"file_name"`
+	ContentType string `gorm:"size:100;not null" json:"content_type"`
+	Size        int64  `gorm:"not null" json:"size"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+	// Encrypted — вложение зашифрованной на клиенте записи: сервер хранит
+	// его как непрозрачные байты и не делает миниатюру.
+	Encrypted    bool      `gorm:"not null;default:false" json:"encrypted"`
+	StorageKey   string    `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	ThumbnailKey string    `gorm:"size:64" json:"-"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// Emotions — допустимые эмоции записи дневника и соответствующая им
+// оценка настроения, если пользователь не указал её сам.
+var Emotions = map[string]int{
+	"joy":      5,
+	"excited":  5,
+	"grateful": 4,
+	"calm":     4,
+	"neutral":  3,
+	"tired":    2,
+	"sad":      2,
+	"anxious":  2,
+	"angry":    1,
+}
+
+// RateLimitOverride — индивидуальный лимит запросов, который задаёт администратор.
+type RateLimitOverride struct {
+	ID      uint   `gorm:"primaryKey" json:"id"`
+	Subject string `gorm:"uniqueIndex;size:128;not null" json:"subject"` // user:<id>, token:<hash> или ip:<адрес>
+	// Multiplier умножает лимиты всех маршрутов; Exempt снимает их совсем.
+	Multiplier float64   `gorm:"default:1" json:"multiplier"`
+	Exempt     bool      `gorm:"default:false" json:"exempt"`
+	Note       string    `json:"note"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// HabitDailyRollup — итоги логов привычки за день (UTC). Сводки ведутся
+// при записи логов и пересобираются фоновой задачей.
+type HabitDailyRollup struct {
+	HabitID   uint      `gorm:"primaryKey;autoIncrement:false" json:"habit_id"`
+	Day       time.Time `gorm:"primaryKey;type:date;index:idx_habit_daily_rollups_user_day,priority:2" json:"day"`
+	UserID    uint      `gorm:"not null;index:idx_habit_daily_rollups_user_day,priority:1" json:"user_id"`
+	Total     int       `gorm:"not null;default:0" json:"total"`
+	Completed int       `gorm:"not null;default:0" json:"completed"`
+	// RunEnd — длина серии выполненных логов на конец дня с учётом предыдущих
+	// дней, BestRun — самая длинная серия, закончившаяся в этот день.
+	RunEnd    int       `gorm:"not null;default:0" json:"run_end"`
+	BestRun   int       `gorm:"not null;default:0" json:"best_run"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// UserWeeklyRollup — итоги логов пользователя за неделю, начиная с понедельника.
+type UserWeeklyRollup struct {
+	UserID    uint      `gorm:"primaryKey;autoIncrement:false" json:"user_id"`
+	WeekStart time.Time `gorm:"primaryKey;type:date" json:"week_start"`
+	Total     int       `gorm:"not null;default:0" json:"total"`
+	Completed int       `gorm:"not null;default:0" json:"completed"`
+	// ActiveDays — дни недели хотя бы с одним выполненным логом.
+	ActiveDays int       `gorm:"not null;default:0" json:"active_days"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// Категории подсказок для дневника.
+const (
+	PromptDaily     = "daily"
+	PromptGratitude = "gratitude"
+	PromptWeekly    = "weekly"
+)
+
+// JournalPrompt — подсказка-вопрос для записи в дневнике. Неактивные
+// подсказки не выдаются, но остаются у записей, которые на них ответили.
+type JournalPrompt struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Category  string    `gorm:"size:32;index;not null" json:"category"`
+	Text      string    `gorm:"size:500;not null" json:"text"`
+	IsActive  bool      `gorm:"not null" json:"is_active"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// PromptAssignment — подсказка, выданная пользователю на день. Category —
+// категория запроса; пустая строка — подсказка из любой категории.
+type PromptAssignment struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_prompt_assignments_day;not null" json:"user_id"`
+	Day       string    `gorm:"size:10;uniqueIndex:idx_prompt_assignments_day;not null" json:"day"` // YYYY-MM-DD
+	Category  string    `gorm:"size:32;uniqueIndex:idx_prompt_assignments_day;not null" json:"category"`
+	PromptID  uint      `gorm:"index;not null" json:"prompt_id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// Отчётные периоды.
+const (
+	ReportWeekly  = "weekly"
+	ReportMonthly = "monthly"
+)
+
+// Report — отчёт о прогрессе пользователя за период. Data хранит JSON
+// отчёта; Markdown и HTML строятся из него при выдаче.
+type Report struct {
+	ID          uint            `gorm:"primaryKey" json:"id"`
+	UserID      uint            `gorm:"not null;uniqueIndex:idx_reports_user_period,priority:1" json:"user_id"`
+	Period      string          `gorm:"size:16;not null;uniqueIndex:idx_reports_user_period,priority:2" json:"period"`
+	PeriodStart time.Time       `gorm:"type:date;not null;uniqueIndex:idx_reports_user_period,priority:3" json:"period_start"`
+	PeriodEnd   time.Time       `gorm:"type:date;not null" json:"period_end"`
+	Data        json.RawMessage `gorm:"type:jsonb;not null" json:"data"`
+	DeliveredAt *time.Time      `json:"delivered_at"`
+	CreatedAt   time.Time       `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// Каналы доставки уведомлений.
+const (
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+	ChannelInApp   = "inapp"
+)
+
+// Notification — уведомление во входящих пользователя (канал inapp).
+// ReadAt nil — уведомление не прочитано.
+type Notification struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index:idx_notifications_user_read,priority:1" json:"user_id"`
+	Type      string     `gorm:"size:32;not null" json:"type"`
+	Subject   string     `gorm:"size:200" json:"subject"`
+	Body      string     `gorm:"type:text" json:"body"`
+	ReadAt    *time.Time `gorm:"index:idx_notifications_user_read,priority:2" json:"read_at"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// NotificationDeadLetter — уведомление, которое канал не доставил после
+// всех попыток. Администратор может отправить его повторно.
+type NotificationDeadLetter struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	UserID    uint      `json:"user_id"`
-	Title     string    `json:"title"`
-	Content   string    `json:"content"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Channel   string    `gorm:"size:32;not null;index" json:"channel"`
+	Type      string    `gorm:"size:32;not null" json:"type"`
+	Subject   string    `gorm:"size:200" json:"subject"`
+	Body      string    `gorm:"type:text" json:"body"`
+	Attempts  int       `gorm:"not null" json:"attempts"`
+	LastError string    `gorm:"type:text" json:"last_error"`
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 }
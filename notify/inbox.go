@@ -0,0 +1,33 @@
+package notify
+
+import (
+	"context"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+)
+
+// InboxStore сохраняет уведомления во входящие; ему удовлетворяет
+// repository.NotificationRepository.
+type InboxStore interface {
+	Create(ctx context.Context, notification *models.Notification) error
+}
+
+// InboxNotifier кладёт уведомления во входящие пользователя в приложении.
+type InboxNotifier struct {
+	store InboxStore
+}
+
+func NewInboxNotifier(store InboxStore) *InboxNotifier {
+	return &InboxNotifier{store: store}
+}
+
+func (n *InboxNotifier) Channel() string { return models.ChannelInApp }
+
+func (n *InboxNotifier) Notify(ctx context.Context, msg Message) error {
+	return n.store.Create(ctx, &models.Notification{
+		UserID:  msg.UserID,
+		Type:    msg.Type,
+		Subject: msg.Subject,
+		Body:    msg.Body,
+	})
+}
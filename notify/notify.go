@@ -0,0 +1,51 @@
+// Package notify доставляет уведомления пользователям по каналам: почта,
+// webhook и входящие в приложении. Каналы только отправляют одно
+// сообщение; повторы, очередь и недоставленные уведомления — забота
+// вызывающего (services.NotificationService).
+package notify
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrSkipped — канал не применим к сообщению, например у пользователя нет
+// адреса почты. Это не ошибка доставки: повторять и сохранять нечего.
+var ErrSkipped = errors.New("notification channel skipped")
+
+// Message — уведомление одному пользователю. Email заполняется, если
+// у пользователя есть адрес.
+type Message struct {
+	UserID  uint   `json:"user_id"`
+	Email   string `json:"-"`
+	Type    string `json:"type"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Notifier — канал доставки. Notify возвращает ErrSkipped, если канал
+// не применим, и ошибку, обёрнутую в Permanent, если повтор не поможет.
+type Notifier interface {
+	Channel() string
+	Notify(ctx context.Context, msg Message) error
+}
+
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent помечает ошибку как окончательную: сообщение отклонено
+// получателем, и повторная отправка даст тот же результат.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent сообщает, помечена ли ошибка через Permanent.
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
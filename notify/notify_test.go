@@ -0,0 +1,142 @@
+package notify
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+)
+
+func TestSMTPNotifier(t *testing.T) {
+	n, err := NewSMTPNotifier(SMTPConfig{Addr: "mail.example.com:587", From: "Habits <noreply@example.com>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sent []byte
+	var rcpt []string
+	n.send = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		sent, rcpt = msg, to
+		return nil
+	}
+
+	if err := n.Notify(context.Background(), Message{UserID: 1, Subject: "x"}); !errors.Is(err, ErrSkipped) {
+		t.Fatalf("expected skip without address, got %v", err)
+	}
+	if err := n.Notify(context.Background(), Message{Email: "not an address"}); !IsPermanent(err) {
+		t.Fatalf("expected permanent error for bad address, got %v", err)
+	}
+
+	err = n.Notify(context.Background(), Message{
+		UserID:  1,
+		Email:   "alice@example.com",
+		Subject: "Отчёт\r\nBcc: evil@example.com",
+		Body:    "Готово",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rcpt) != 1 || rcpt[0] != "alice@example.com" {
+		t.Fatalf("unexpected recipients %v", rcpt)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(sent)))
+	if err != nil {
+		t.Fatalf("parse sent message: %v", err)
+	}
+	if msg.Header.Get("Bcc") != "" {
+		t.Fatal("subject injected a header")
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Отчёт Bcc: evil@example.com" {
+		t.Fatalf("unexpected subject %q (%v)", subject, err)
+	}
+	raw, _ := io.ReadAll(msg.Body)
+	body, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(raw), "\r\n", ""))
+	if err != nil || string(body) != "Готово" {
+		t.Fatalf("unexpected body %q (%v)", body, err)
+	}
+
+	n.send = func(string, smtp.Auth, string, []string, []byte) error {
+		return &textproto.Error{Code: 550, Msg: "mailbox unavailable"}
+	}
+	if err := n.Notify(context.Background(), Message{Email: "alice@example.com"}); !IsPermanent(err) {
+		t.Fatalf("expected permanent error on 5xx, got %v", err)
+	}
+	n.send = func(string, smtp.Auth, string, []string, []byte) error {
+		return &textproto.Error{Code: 421, Msg: "try later"}
+	}
+	if err := n.Notify(context.Background(), Message{Email: "alice@example.com"}); err == nil || IsPermanent(err) {
+		t.Fatalf("expected temporary error on 4xx, got %v", err)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	secret := []byte("s3cret")
+	status := http.StatusNoContent
+	var got webhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		want := "sha256=" + Sign(secret, r.Header.Get(TimestampHeader), body)
+		if r.Header.Get(SignatureHeader) != want {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := json.Unmarshal(body, &got); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	n := NewWebhookNotifier(srv.URL, secret, srv.Client())
+	msg := Message{UserID: 7, Email: "private@example.com", Type: "report", Subject: "Ready", Body: "Done"}
+	if err := n.Notify(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if got.UserID != 7 || got.Type != "report" || got.Body != "Done" || got.Email != "" || got.SentAt.IsZero() {
+		t.Fatalf("unexpected payload %+v", got)
+	}
+
+	for code, permanent := range map[int]bool{
+		http.StatusBadRequest:          true,
+		http.StatusGone:                true,
+		http.StatusTooManyRequests:     false,
+		http.StatusInternalServerError: false,
+	} {
+		status = code
+		err := n.Notify(context.Background(), msg)
+		if err == nil || IsPermanent(err) != permanent {
+			t.Errorf("status %d: got %v, permanent=%v", code, err, permanent)
+		}
+	}
+
+	unsigned := NewWebhookNotifier(srv.URL, []byte("wrong"), srv.Client())
+	if err := unsigned.Notify(context.Background(), msg); !IsPermanent(err) {
+		t.Fatalf("expected rejected signature, got %v", err)
+	}
+}
+
+func TestInboxNotifier(t *testing.T) {
+	store := repository.NewMemoryStore()
+	n := NewInboxNotifier(store.Notifications())
+	if n.Channel() != models.ChannelInApp {
+		t.Fatalf("unexpected channel %q", n.Channel())
+	}
+	if err := n.Notify(context.Background(), Message{UserID: 3, Type: "report", Subject: "Ready", Body: "Done"}); err != nil {
+		t.Fatal(err)
+	}
+}
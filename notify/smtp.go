@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+)
+
+// SMTPConfig — параметры почтового сервера. Username пустой — без
+// авторизации (например, локальный relay).
+type SMTPConfig struct {
+	// Addr — host:port сервера.
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+// SMTPNotifier отправляет уведомления письмом на адрес пользователя.
+type SMTPNotifier struct {
+	addr string
+	from *mail.Address
+	auth smtp.Auth
+	// send — smtp.SendMail; подменяется в тестах.
+	send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func NewSMTPNotifier(cfg SMTPConfig) (*SMTPNotifier, error) {
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("smtp addr %q: %w", cfg.Addr, err)
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("smtp from %q: %w", cfg.From, err)
+	}
+
+	n := &SMTPNotifier{addr: cfg.Addr, from: from, send: smtp.SendMail}
+	if cfg.Username != "" {
+		// PlainAuth сам отказывается передавать пароль без TLS,
+		// кроме соединений с localhost.
+		n.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, host)
+	}
+	return n, nil
+}
+
+func (n *SMTPNotifier) Channel() string { return models.ChannelEmail }
+
+// Notify отправляет письмо. SendMail не принимает контекст, поэтому
+// отмена прерывает только ожидание до начала отправки.
+func (n *SMTPNotifier) Notify(ctx context.Context, msg Message) error {
+	if msg.Email == "" {
+		return ErrSkipped
+	}
+	to, err := mail.ParseAddress(msg.Email)
+	if err != nil {
+		return Permanent(fmt.Errorf("recipient %q: %w", msg.Email, err))
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := n.send(n.addr, n.auth, n.from.Address, []string{to.Address}, n.compose(to, msg)); err != nil {
+		// Коды 5xx — отказ сервера принять письмо, повтор не поможет.
+		var reply *textproto.Error
+		if errors.As(err, &reply) && reply.Code >= 500 {
+			return Permanent(fmt.Errorf("smtp: %w", err))
+		}
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return nil
+}
+
+// compose собирает письмо. Тема кодируется по RFC 2047, а тело — base64,
+// поэтому переводы строк из текста не попадают в заголовки.
+func (n *SMTPNotifier) compose(to *mail.Address, msg Message) []byte {
+	subject := strings.Join(strings.Fields(msg.Subject), " ")
+	if subject == "" {
+		subject = msg.Type
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", n.from.String())
+	fmt.Fprintf(&b, "To: %s\r\n", to.String())
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	body := base64.StdEncoding.EncodeToString([]byte(msg.Body))
+	for len(body) > 76 {
+		b.WriteString(body[:76] + "\r\n")
+		body = body[76:]
+	}
+	b.WriteString(body + "\r\n")
+	return b.Bytes()
+}
@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+)
+
+// Заголовки подписи webhook: SignatureHeader — "sha256=" и результат Sign,
+// TimestampHeader — время отправки в секундах Unix. Время входит
+// в подпись, чтобы перехваченный запрос нельзя было повторить позже.
+const (
+	SignatureHeader = "X-Habit-Signature"
+	TimestampHeader = "X-Habit-Timestamp"
+)
+
+// webhookTimeout ограничивает один запрос, если контекст без дедлайна.
+const webhookTimeout = 10 * time.Second
+
+// WebhookNotifier отправляет уведомления JSON-запросом POST на заданный
+// адрес, например в интеграцию с мессенджером.
+type WebhookNotifier struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+// NewWebhookNotifier: secret пустой — запросы без подписи; client nil —
+// клиент с таймаутом webhookTimeout.
+func NewWebhookNotifier(url string, secret []byte, client *http.Client) *WebhookNotifier {
+	if client == nil {
+		client = &http.Client{Timeout: webhookTimeout}
+	}
+	return &WebhookNotifier{url: url, secret: secret, client: client}
+}
+
+func (n *WebhookNotifier) Channel() string { return models.ChannelWebhook }
+
+type webhookPayload struct {
+	Message
+	SentAt time.Time `json:"sent_at"`
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, msg Message) error {
+	now := time.Now().UTC()
+	body, err := json.Marshal(webhookPayload{Message: msg, SentAt: now})
+	if err != nil {
+		return Permanent(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(n.secret) > 0 {
+		timestamp := strconv.FormatInt(now.Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, "sha256="+Sign(n.secret, timestamp, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	// Остальные 4xx означают, что получатель отверг запрос, и повтор
+	// ничего не изменит; 408 и 429 — временные.
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return Permanent(fmt.Errorf("webhook: status %d", resp.StatusCode))
+	default:
+		return fmt.Errorf("webhook: status %d", resp.StatusCode)
+	}
+}
+
+// Sign возвращает подпись тела webhook: HMAC-SHA256 от "timestamp.body"
+// в hex. Получатель сверяет её, вычислив подпись тем же секретом.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,1866 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+)
+
+// MemoryStore — полная in-memory реализация Store для тестов и локального запуска.
+// Транзакции сериализуются между собой: при ошибке состояние откатывается
+// к снимку, снятому в начале транзакции.
+type MemoryStore struct {
+	state *memoryState
+	inTx  bool
+}
+
+type memoryState struct {
+	mu   sync.RWMutex
+	txMu sync.Mutex
+	data *memoryData
+}
+
+type memoryData struct {
+	nextID  uint
+	users   map[uint]models.User
+	habits  map[uint]models.Habit
+	logs    map[uint]models.HabitLog
+	diaries map[uint]models.Diary
+	cities  map[uint]models.City
+	limits  map[uint]models.RateLimitOverride
+	daily   map[rollupKey]models.HabitDailyRollup
+	weekly  map[rollupKey]models.UserWeeklyRollup
+	awards  map[uint]models.Achievement
+	reports map[uint]models.Report
+	revs    map[uint]models.DiaryRevision
+	files   map[uint]models.DiaryAttachment
+	prompts map[uint]models.JournalPrompt
+	shown   map[uint]models.PromptAssignment
+	alarms  map[uint]models.HabitReminder
+	inbox   map[uint]models.Notification
+	dead    map[uint]models.NotificationDeadLetter
+}
+
+// rollupKey — id привычки или пользователя и день сводки в формате YYYY-MM-DD.
+type rollupKey struct {
+	id  uint
+	day string
+}
+
+func newMemoryData() *memoryData {
+	return &memoryData{
+		users:   make(map[uint]models.User),
+		habits:  make(map[uint]models.Habit),
+		logs:    make(map[uint]models.HabitLog),
+		diaries: make(map[uint]models.Diary),
+		cities:  make(map[uint]models.City),
+		limits:  make(map[uint]models.RateLimitOverride),
+		daily:   make(map[rollupKey]models.HabitDailyRollup),
+		weekly:  make(map[rollupKey]models.UserWeeklyRollup),
+		awards:  make(map[uint]models.Achievement),
+		reports: make(map[uint]models.Report),
+		revs:    make(map[uint]models.DiaryRevision),
+		files:   make(map[uint]models.DiaryAttachment),
+		prompts: make(map[uint]models.JournalPrompt),
+		shown:   make(map[uint]models.PromptAssignment),
+		alarms:  make(map[uint]models.HabitReminder),
+		inbox:   make(map[uint]models.Notification),
+		dead:    make(map[uint]models.NotificationDeadLetter),
+	}
+}
+
+func (d *memoryData) clone() *memoryData {
+	c := &memoryData{
+		nextID:  d.nextID,
+		users:   cloneMap(d.users),
+		habits:  cloneMap(d.habits),
+		logs:    cloneMap(d.logs),
+		diaries: cloneMap(d.diaries),
+		cities:  cloneMap(d.cities),
+		limits:  cloneMap(d.limits),
+		daily:   cloneMap(d.daily),
+		weekly:  cloneMap(d.weekly),
+		awards:  cloneMap(d.awards),
+		reports: cloneMap(d.reports),
+		revs:    cloneMap(d.revs),
+		files:   cloneMap(d.files),
+		prompts: cloneMap(d.prompts),
+		shown:   cloneMap(d.shown),
+		alarms:  cloneMap(d.alarms),
+		inbox:   cloneMap(d.inbox),
+		dead:    cloneMap(d.dead),
+	}
+	return c
+}
+
+func (d *memoryData) newID() uint {
+	d.nextID++
+	return d.nextID
+}
+
+func cloneMap[K comparable, V any](m map[K]V) map[K]V {
+	c := make(map[K]V, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{state: &memoryState{data: newMemoryData()}}
+}
+
+func (s *MemoryStore) Users() UserRepository         { return &memUserRepo{s.state} }
+func (s *MemoryStore) Habits() HabitRepository       { return &memHabitRepo{s.state} }
+func (s *MemoryStore) HabitLogs() HabitLogRepository { return &memHabitLogRepo{s.state} }
+func (s *MemoryStore) Diaries() DiaryRepository      { return &memDiaryRepo{s.state} }
+func (s *MemoryStore) Cities() CityRepository        { return &memCityRepo{s.state} }
+func (s *MemoryStore) DiaryRevisions() DiaryRevisionRepository {
+	return &memDiaryRevisionRepo{s.state}
+}
+func (s *MemoryStore) Attachments() DiaryAttachmentRepository {
+	return &memDiaryAttachmentRepo{s.state}
+}
+func (s *MemoryStore) Prompts() PromptRepository { return &memPromptRepo{s.state} }
+func (s *MemoryStore) RateLimitOverrides() RateLimitOverrideRepository {
+	return &memRateLimitOverrideRepo{s.state}
+}
+func (s *MemoryStore) Rollups() RollupRepository { return &memRollupRepo{s.state} }
+func (s *MemoryStore) Achievements() AchievementRepository {
+	return &memAchievementRepo{s.state}
+}
+func (s *MemoryStore) Reports() ReportRepository     { return &memReportRepo{s.state} }
+func (s *MemoryStore) Reminders() ReminderRepository { return &memReminderRepo{s.state} }
+func (s *MemoryStore) Notifications() NotificationRepository {
+	return &memNotificationRepo{s.state}
+}
+func (s *MemoryStore) DeadLetters() DeadLetterRepository { return &memDeadLetterRepo{s.state} }
+
+func (s *MemoryStore) Transaction(ctx context.Context, fn func(tx Store) error) error {
+	// Вложенные транзакции ведут себя как savepoint и не берут txMu повторно.
+	if !s.inTx {
+		s.state.txMu.Lock()
+		defer s.state.txMu.Unlock()
+	}
+
+	s.state.mu.RLock()
+	snapshot := s.state.data.clone()
+	s.state.mu.RUnlock()
+
+	if err := fn(&MemoryStore{state: s.state, inTx: true}); err != nil {
+		s.state.mu.Lock()
+		s.state.data = snapshot
+		s.state.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (s *MemoryStore) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// now повторяет NowFunc из db.Connect, чтобы временные метки вели себя одинаково.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+type memUserRepo struct{ s *memoryState }
+
+func (r *memUserRepo) GetByID(ctx context.Context, id uint) (*models.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	user, ok := r.s.data.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (r *memUserRepo) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, user := range r.s.data.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memUserRepo) List(ctx context.Context, filter UserFilter, page Page) ([]models.User, *Cursor, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	users := make([]models.User, 0, len(r.s.data.users))
+	for _, user := range r.s.data.users {
+		if filter.Role != "" && user.Role != filter.Role {
+			continue
+		}
+		if filter.CityID != nil && (user.CityID == nil || *user.CityID != *filter.CityID) {
+			continue
+		}
+		if user.CityID != nil {
+			user.City = r.s.data.cities[*user.CityID]
+		}
+		users = append(users, user)
+	}
+
+	users = pageSlice(users, page, DefaultUserSort, userSortValue, userID)
+	users, next := cutPage(users, page, DefaultUserSort, userSortValue, userID)
+	return users, next, nil
+}
+
+func (r *memUserRepo) Create(ctx context.Context, user *models.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, existing := range r.s.data.users {
+		if existing.Username == user.Username {
+			return ErrDuplicate
+		}
+	}
+
+	user.ID = r.s.data.newID()
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	if user.Picture == "" {
+		user.Picture = "/uploads/default.png"
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now()
+	}
+	r.s.data.users[user.ID] = stripUser(*user)
+	return nil
+}
+
+func (r *memUserRepo) Update(ctx context.Context, user *models.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.data.users[user.ID]; !ok {
+		return ErrNotFound
+	}
+	for _, existing := range r.s.data.users {
+		if existing.ID != user.ID && existing.Username == user.Username {
+			return ErrDuplicate
+		}
+	}
+	r.s.data.users[user.ID] = stripUser(*user)
+	return nil
+}
+
+// stripUser убирает ассоциации: в хранилище лежат только собственные поля строки.
+func stripUser(u models.User) models.User {
+	u.City = models.City{}
+	u.Habits = nil
+	u.Achievements = nil
+	return u
+}
+
+type memHabitRepo struct{ s *memoryState }
+
+func (r *memHabitRepo) GetByID(ctx context.Context, id uint) (*models.Habit, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	habit, ok := r.s.data.habits[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &habit, nil
+}
+
+func (r *memHabitRepo) GetForUpdate(ctx context.Context, id uint) (*models.Habit, error) {
+	return r.GetByID(ctx, id)
+}
+
+func (r *memHabitRepo) List(ctx context.Context, filter HabitFilter, page Page) ([]models.Habit, *Cursor, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	habits := make([]models.Habit, 0)
+	for _, habit := range r.s.data.habits {
+		if filter.UserID != nil && habit.UserID != *filter.UserID {
+			continue
+		}
+		if filter.IsActive != nil && habit.IsActive != *filter.IsActive {
+			continue
+		}
+		if filter.Frequency != "" && habit.Frequency != filter.Frequency {
+			continue
+		}
+		if !inRange(habit.CreatedAt, filter.CreatedFrom, filter.CreatedTo) {
+			continue
+		}
+		habits = append(habits, habit)
+	}
+
+	habits = pageSlice(habits, page, DefaultHabitSort, habitSortValue, habitID)
+	habits, next := cutPage(habits, page, DefaultHabitSort, habitSortValue, habitID)
+
+	for i := range habits {
+		if filter.WithUser {
+			habits[i].User = r.s.data.users[habits[i].UserID]
+		}
+		if filter.WithLogs {
+			habits[i].Logs = r.recentLogs(habits[i].ID, filter.LogsLimit)
+		}
+	}
+	return habits, next, nil
+}
+
+// recentLogs возвращает логи привычки по возрастанию id; при limit > 0 —
+// только limit последних по дате.
+func (r *memHabitRepo) recentLogs(habitID uint, limit int) []models.HabitLog {
+	logs := make([]models.HabitLog, 0)
+	for _, log := range r.s.data.logs {
+		if log.HabitID == habitID {
+			logs = append(logs, log)
+		}
+	}
+	if limit > 0 && len(logs) > limit {
+		logs = pageSlice(logs, Page{}, DefaultHabitLogSort, habitLogSortValue, habitLogID)[:limit]
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].ID < logs[j].ID })
+	return logs
+}
+
+func (r *memHabitRepo) Create(ctx context.Context, habit *models.Habit) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	habit.ID = r.s.data.newID()
+	ts := now()
+	if habit.CreatedAt.IsZero() {
+		habit.CreatedAt = ts
+	}
+	habit.UpdatedAt = ts
+	r.s.data.habits[habit.ID] = stripHabit(*habit)
+	return nil
+}
+
+func (r *memHabitRepo) Update(ctx context.Context, habit *models.Habit) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.data.habits[habit.ID]; !ok {
+		return ErrNotFound
+	}
+	habit.UpdatedAt = now()
+	r.s.data.habits[habit.ID] = stripHabit(*habit)
+	return nil
+}
+
+func (r *memHabitRepo) Delete(ctx context.Context, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.data.habits[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.s.data.habits, id)
+	return nil
+}
+
+func (r *memHabitRepo) SetActive(ctx context.Context, ids []uint, isActive bool) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var updated int64
+	for _, id := range ids {
+		habit, ok := r.s.data.habits[id]
+		if !ok {
+			continue
+		}
+		habit.IsActive = isActive
+		habit.UpdatedAt = now()
+		r.s.data.habits[id] = habit
+		updated++
+	}
+	return updated, nil
+}
+
+func stripHabit(h models.Habit) models.Habit {
+	h.User = models.User{}
+	h.Logs = nil
+	return h
+}
+
+type memHabitLogRepo struct{ s *memoryState }
+
+func (r *memHabitLogRepo) GetByID(ctx context.Context, id uint) (*models.HabitLog, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	log, ok := r.s.data.logs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &log, nil
+}
+
+func (r *memHabitLogRepo) UpdateNote(ctx context.Context, id uint, note string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	log, ok := r.s.data.logs[id]
+	if !ok {
+		return ErrNotFound
+	}
+	log.Note = note
+	r.s.data.logs[id] = log
+	return nil
+}
+
+func (r *memHabitLogRepo) Create(ctx context.Context, log *models.HabitLog) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	log.ID = r.s.data.newID()
+	stored := *log
+	stored.Habit = models.Habit{}
+	r.s.data.logs[log.ID] = stored
+	return nil
+}
+
+func (r *memHabitLogRepo) List(ctx context.Context, filter HabitLogFilter, page Page) ([]models.HabitLog, *Cursor, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	logs := make([]models.HabitLog, 0)
+	for _, log := range r.s.data.logs {
+		if filter.HabitID != nil && log.HabitID != *filter.HabitID {
+			continue
+		}
+		habit := r.s.data.habits[log.HabitID]
+		if filter.UserID != nil && habit.UserID != *filter.UserID {
+			continue
+		}
+		if filter.IsCompleted != nil && log.IsCompleted != *filter.IsCompleted {
+			continue
+		}
+		if !inRange(log.Date, filter.From, filter.To) {
+			continue
+		}
+		if filter.WithHabit {
+			log.Habit = habit
+		}
+		logs = append(logs, log)
+	}
+
+	logs = pageSlice(logs, page, DefaultHabitLogSort, habitLogSortValue, habitLogID)
+	logs, next := cutPage(logs, page, DefaultHabitLogSort, habitLogSortValue, habitLogID)
+	return logs, next, nil
+}
+
+func (r *memHabitLogRepo) Calendar(ctx context.Context, filter CalendarFilter) ([]DayActivity, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	byDay := make(map[string]*DayActivity)
+	for _, log := range r.calendarLogs(filter) {
+		date := log.Date.In(filter.Location).Format(time.DateOnly)
+		day, ok := byDay[date]
+		if !ok {
+			day = &DayActivity{Date: date}
+			byDay[date] = day
+		}
+		day.Total++
+		if log.IsCompleted {
+			day.Completed++
+		}
+	}
+
+	days := make([]DayActivity, 0)
+	for d := filter.From; !d.After(filter.To); d = d.AddDate(0, 0, 1) {
+		date := d.Format(time.DateOnly)
+		if day, ok := byDay[date]; ok {
+			days = append(days, *day)
+		} else {
+			days = append(days, DayActivity{Date: date})
+		}
+	}
+	return days, nil
+}
+
+func (r *memHabitLogRepo) Hours(ctx context.Context, filter CalendarFilter) ([]HourActivity, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	hours := make([]HourActivity, 24)
+	for i := range hours {
+		hours[i].Hour = i
+	}
+	for _, log := range r.calendarLogs(filter) {
+		hour := &hours[log.Date.In(filter.Location).Hour()]
+		hour.Total++
+		if log.IsCompleted {
+			hour.Completed++
+		}
+	}
+	return hours, nil
+}
+
+func (r *memHabitLogRepo) HabitDays(ctx context.Context, filter CalendarFilter) ([]HabitDay, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	byKey := make(map[rollupKey]*HabitDay)
+	for _, log := range r.calendarLogs(filter) {
+		key := rollupKey{log.HabitID, log.Date.In(filter.Location).Format(time.DateOnly)}
+		day, ok := byKey[key]
+		if !ok {
+			day = &HabitDay{HabitID: key.id, Date: key.day}
+			byKey[key] = day
+		}
+		day.Total++
+		if log.IsCompleted {
+			day.Completed++
+		}
+	}
+
+	days := make([]HabitDay, 0, len(byKey))
+	for _, day := range byKey {
+		days = append(days, *day)
+	}
+	sort.Slice(days, func(i, j int) bool {
+		if days[i].HabitID != days[j].HabitID {
+			return days[i].HabitID < days[j].HabitID
+		}
+		return days[i].Date < days[j].Date
+	})
+	return days, nil
+}
+
+// calendarLogs отбирает логи по CalendarFilter; вызывающий держит блокировку.
+func (r *memHabitLogRepo) calendarLogs(filter CalendarFilter) []models.HabitLog {
+	start, end := filter.bounds()
+	var logs []models.HabitLog
+	for _, log := range r.s.data.logs {
+		if filter.HabitID != nil && log.HabitID != *filter.HabitID {
+			continue
+		}
+		if filter.UserID != nil && r.s.data.habits[log.HabitID].UserID != *filter.UserID {
+			continue
+		}
+		if inRange(log.Date, &start, &end) {
+			logs = append(logs, log)
+		}
+	}
+	return logs
+}
+
+func (r *memHabitLogRepo) DeleteByHabit(ctx context.Context, habitID uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, log := range r.s.data.logs {
+		if log.HabitID == habitID {
+			delete(r.s.data.logs, id)
+		}
+	}
+	return nil
+}
+
+type memDiaryRepo struct{ s *memoryState }
+
+func (r *memDiaryRepo) GetByID(ctx context.Context, id uint) (*models.Diary, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	diary, ok := r.s.data.diaries[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	diary = cloneDiary(diary)
+	return &diary, nil
+}
+
+func (r *memDiaryRepo) GetForUpdate(ctx context.Context, id uint) (*models.Diary, error) {
+	return r.GetByID(ctx, id)
+}
+
+func (r *memDiaryRepo) List(ctx context.Context, filter DiaryFilter, page Page) ([]models.Diary, *Cursor, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	diaries := make([]models.Diary, 0)
+	for _, diary := range r.s.data.diaries {
+		if diaryMatches(diary, filter) {
+			diaries = append(diaries, cloneDiary(diary))
+		}
+	}
+
+	diaries = pageSlice(diaries, page, DefaultDiarySort, diarySortValue, diaryID)
+	diaries, next := cutPage(diaries, page, DefaultDiarySort, diarySortValue, diaryID)
+	return diaries, next, nil
+}
+
+func (r *memDiaryRepo) Count(ctx context.Context, filter DiaryFilter) (int64, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var count int64
+	for _, diary := range r.s.data.diaries {
+		if diaryMatches(diary, filter) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Search в памяти упрощён: запрос делится на слова, запись подходит, если
+// каждое слово встречается в заголовке или тексте без учёта регистра.
+// Морфологии нет; совпадение в заголовке весит вдвое больше, как вес A в Postgres.
+func (r *memDiaryRepo) Search(ctx context.Context, filter DiaryFilter, text string, limit int) ([]DiaryHit, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	terms := strings.Fields(strings.ToLower(strings.NewReplacer(`"`, " ", "-", " ").Replace(text)))
+	hits := make([]DiaryHit, 0)
+	for _, diary := range r.s.data.diaries {
+		if len(terms) == 0 || diary.Encrypted || !diaryMatches(diary, filter) {
+			continue
+		}
+		title, content := strings.ToLower(diary.Title), strings.ToLower(diary.Content)
+		hit := DiaryHit{Diary: cloneDiary(diary)}
+		for _, term := range terms {
+			n := 2*strings.Count(title, term) + strings.Count(content, term)
+			if n == 0 {
+				hit.Rank = 0
+				break
+			}
+			hit.Rank += float64(n)
+		}
+		if hit.Rank == 0 {
+			continue
+		}
+		hit.Headline = highlight(markTerms(diary.Title, terms))
+		hit.Snippet = highlight(snippet(markTerms(diary.Content, terms)))
+		hits = append(hits, hit)
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		if a.Rank != b.Rank {
+			return a.Rank > b.Rank
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// markTerms окружает маркерами вхождения слов terms (в нижнем регистре).
+func markTerms(s string, terms []string) string {
+	runes := []rune(s)
+	lower := []rune(strings.ToLower(s))
+	if len(lower) != len(runes) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(runes); {
+		matched := 0
+		for _, term := range terms {
+			t := []rune(term)
+			if len(t) > matched && i+len(t) <= len(lower) && string(lower[i:i+len(t)]) == term {
+				matched = len(t)
+			}
+		}
+		if matched == 0 {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+		b.WriteString(markStart + string(runes[i:i+matched]) + markStop)
+		i += matched
+	}
+	return b.String()
+}
+
+// snippet обрезает текст с маркерами до окна вокруг первого совпадения.
+func snippet(s string) string {
+	const before, width = 40, 200
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	start, end := 0, width
+	if i := slices.Index(runes, markStartRune); i > before {
+		start = i - before
+		end = min(start+width, len(runes))
+	}
+	// Окно не должно разрезать выделенное слово.
+	for i := end - 1; i >= start && runes[i] != markStopRune; i-- {
+		if runes[i] == markStartRune {
+			end = i + slices.Index(runes[i:], markStopRune) + 1
+			break
+		}
+	}
+	out := string(runes[start:end])
+	if start > 0 {
+		out = "…" + out
+	}
+	if end < len(runes) {
+		out += "…"
+	}
+	return out
+}
+
+func diaryMatches(diary models.Diary, filter DiaryFilter) bool {
+	if filter.UserID != nil && diary.UserID != *filter.UserID {
+		return false
+	}
+	if filter.Tag != "" && !slices.Contains(diary.Tags, filter.Tag) {
+		return false
+	}
+	if filter.HabitID != nil && (diary.HabitID == nil || *diary.HabitID != *filter.HabitID) {
+		return false
+	}
+	if filter.PromptID != nil && (diary.PromptID == nil || *diary.PromptID != *filter.PromptID) {
+		return false
+	}
+	return inRange(diary.CreatedAt, filter.From, filter.To)
+}
+
+// cloneDiary копирует запись, чтобы вызывающий не менял теги в хранилище.
+func cloneDiary(d models.Diary) models.Diary {
+	d.Tags = slices.Clone(d.Tags)
+	return d
+}
+
+func (r *memDiaryRepo) MoodTimeline(ctx context.Context, filter MoodFilter) ([]MoodDay, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	type sums struct {
+		day                    MoodDay
+		mood, energy           float64
+		moodCount, energyCount int
+	}
+	start, end := dayBounds(filter.From, filter.To, filter.Location)
+	byDay := make(map[string]*sums)
+	for _, diary := range r.s.data.diaries {
+		if diary.UserID != filter.UserID || !inRange(diary.CreatedAt, &start, &end) {
+			continue
+		}
+
+		date := diary.CreatedAt.In(filter.Location).Format(time.DateOnly)
+		s, ok := byDay[date]
+		if !ok {
+			s = &sums{day: MoodDay{Date: date, Emotions: map[string]int{}}}
+			byDay[date] = s
+		}
+		s.day.Entries++
+		if diary.Mood != nil {
+			s.mood += float64(*diary.Mood)
+			s.moodCount++
+		}
+		if diary.Energy != nil {
+			s.energy += float64(*diary.Energy)
+			s.energyCount++
+		}
+		if diary.Emotion != "" {
+			s.day.Emotions[diary.Emotion]++
+		}
+	}
+
+	days := make([]MoodDay, 0, len(byDay))
+	for _, s := range byDay {
+		if s.moodCount > 0 {
+			avg := s.mood / float64(s.moodCount)
+			s.day.Mood = &avg
+		}
+		if s.energyCount > 0 {
+			avg := s.energy / float64(s.energyCount)
+			s.day.Energy = &avg
+		}
+		days = append(days, s.day)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+	return days, nil
+}
+
+// inRange проверяет t на попадание в [from, to); nil снимает границу.
+func inRange(t time.Time, from, to *time.Time) bool {
+	if from != nil && t.Before(*from) {
+		return false
+	}
+	if to != nil && !t.Before(*to) {
+		return false
+	}
+	return true
+}
+
+func (r *memDiaryRepo) Create(ctx context.Context, diary *models.Diary) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	diary.ID = r.s.data.newID()
+	ts := now()
+	if diary.CreatedAt.IsZero() {
+		diary.CreatedAt = ts
+	}
+	diary.UpdatedAt = ts
+	r.s.data.diaries[diary.ID] = cloneDiary(*diary)
+	return nil
+}
+
+func (r *memDiaryRepo) Update(ctx context.Context, diary *models.Diary) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.data.diaries[diary.ID]; !ok {
+		return ErrNotFound
+	}
+	diary.UpdatedAt = now()
+	r.s.data.diaries[diary.ID] = cloneDiary(*diary)
+	return nil
+}
+
+func (r *memDiaryRepo) UnlinkHabit(ctx context.Context, habitID uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, diary := range r.s.data.diaries {
+		if diary.HabitID != nil && *diary.HabitID == habitID {
+			diary.HabitID, diary.HabitLogID = nil, nil
+			diary.UpdatedAt = now()
+			r.s.data.diaries[id] = diary
+		}
+	}
+	return nil
+}
+
+func (r *memDiaryRepo) Delete(ctx context.Context, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.data.diaries[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.s.data.diaries, id)
+	return nil
+}
+
+type memDiaryRevisionRepo struct{ s *memoryState }
+
+func (r *memDiaryRevisionRepo) List(ctx context.Context, diaryID uint) ([]models.DiaryRevision, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return r.list(diaryID), nil
+}
+
+// list возвращает ревизии записи по номеру; вызывающий держит блокировку.
+func (r *memDiaryRevisionRepo) list(diaryID uint) []models.DiaryRevision {
+	revs := make([]models.DiaryRevision, 0)
+	for _, rev := range r.s.data.revs {
+		if rev.DiaryID == diaryID {
+			revs = append(revs, rev)
+		}
+	}
+	sort.Slice(revs, func(i, j int) bool { return revs[i].Number < revs[j].Number })
+	return revs
+}
+
+func (r *memDiaryRevisionRepo) Get(ctx context.Context, diaryID uint, number int) (*models.DiaryRevision, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, rev := range r.s.data.revs {
+		if rev.DiaryID == diaryID && rev.Number == number {
+			return &rev, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memDiaryRevisionRepo) Latest(ctx context.Context, diaryID uint) (*models.DiaryRevision, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	revs := r.list(diaryID)
+	if len(revs) == 0 {
+		return nil, ErrNotFound
+	}
+	return &revs[len(revs)-1], nil
+}
+
+func (r *memDiaryRevisionRepo) Create(ctx context.Context, rev *models.DiaryRevision) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	rev.ID = r.s.data.newID()
+	rev.Number = len(r.list(rev.DiaryID)) + 1
+	if rev.CreatedAt.IsZero() {
+		rev.CreatedAt = now()
+	}
+	r.s.data.revs[rev.ID] = *rev
+	return nil
+}
+
+func (r *memDiaryRevisionRepo) DeleteByDiary(ctx context.Context, diaryID uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, rev := range r.s.data.revs {
+		if rev.DiaryID == diaryID {
+			delete(r.s.data.revs, id)
+		}
+	}
+	return nil
+}
+
+type memDiaryAttachmentRepo struct{ s *memoryState }
+
+func (r *memDiaryAttachmentRepo) GetByID(ctx context.Context, id uint) (*models.DiaryAttachment, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	attachment, ok := r.s.data.files[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &attachment, nil
+}
+
+func (r *memDiaryAttachmentRepo) ListByDiary(ctx context.Context, diaryID uint) ([]models.DiaryAttachment, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	attachments := make([]models.DiaryAttachment, 0)
+	for _, attachment := range r.s.data.files {
+		if attachment.DiaryID == diaryID {
+			attachments = append(attachments, attachment)
+		}
+	}
+	sort.Slice(attachments, func(i, j int) bool { return attachments[i].ID < attachments[j].ID })
+	return attachments, nil
+}
+
+func (r *memDiaryAttachmentRepo) Usage(ctx context.Context, userID uint) (int64, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var total int64
+	for _, attachment := range r.s.data.files {
+		if attachment.UserID == userID {
+			total += attachment.Size
+		}
+	}
+	return total, nil
+}
+
+func (r *memDiaryAttachmentRepo) Create(ctx context.Context, attachment *models.DiaryAttachment) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, existing := range r.s.data.files {
+		if existing.StorageKey == attachment.StorageKey {
+			return ErrDuplicate
+		}
+	}
+	attachment.ID = r.s.data.newID()
+	if attachment.CreatedAt.IsZero() {
+		attachment.CreatedAt = now()
+	}
+	r.s.data.files[attachment.ID] = *attachment
+	return nil
+}
+
+func (r *memDiaryAttachmentRepo) Delete(ctx context.Context, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.data.files[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.s.data.files, id)
+	return nil
+}
+
+func (r *memDiaryAttachmentRepo) DeleteByDiary(ctx context.Context, diaryID uint) ([]models.DiaryAttachment, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	deleted := make([]models.DiaryAttachment, 0)
+	for id, attachment := range r.s.data.files {
+		if attachment.DiaryID == diaryID {
+			deleted = append(deleted, attachment)
+			delete(r.s.data.files, id)
+		}
+	}
+	return deleted, nil
+}
+
+type memCityRepo struct{ s *memoryState }
+
+func (r *memCityRepo) GetByID(ctx context.Context, id uint) (*models.City, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	city, ok := r.s.data.cities[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &city, nil
+}
+
+func (r *memCityRepo) List(ctx context.Context) ([]models.City, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	cities := make([]models.City, 0, len(r.s.data.cities))
+	for _, city := range r.s.data.cities {
+		cities = append(cities, city)
+	}
+	sort.Slice(cities, func(i, j int) bool { return cities[i].ID < cities[j].ID })
+	return cities, nil
+}
+
+func (r *memCityRepo) Count(ctx context.Context) (int64, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	return int64(len(r.s.data.cities)), nil
+}
+
+func (r *memCityRepo) CreateBatch(ctx context.Context, cities []models.City) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for i := range cities {
+		for _, existing := range r.s.data.cities {
+			if existing.Name == cities[i].Name {
+				return ErrDuplicate
+			}
+		}
+		cities[i].ID = r.s.data.newID()
+		r.s.data.cities[cities[i].ID] = cities[i]
+	}
+	return nil
+}
+
+type memRateLimitOverrideRepo struct{ s *memoryState }
+
+func (r *memRateLimitOverrideRepo) List(ctx context.Context) ([]models.RateLimitOverride, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	overrides := make([]models.RateLimitOverride, 0, len(r.s.data.limits))
+	for _, override := range r.s.data.limits {
+		overrides = append(overrides, override)
+	}
+	sort.Slice(overrides, func(i, j int) bool { return overrides[i].Subject < overrides[j].Subject })
+	return overrides, nil
+}
+
+func (r *memRateLimitOverrideRepo) Upsert(ctx context.Context, override *models.RateLimitOverride) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	ts := now()
+	for id, existing := range r.s.data.limits {
+		if existing.Subject == override.Subject {
+			override.ID = id
+			override.CreatedAt = existing.CreatedAt
+			override.UpdatedAt = ts
+			r.s.data.limits[id] = *override
+			return nil
+		}
+	}
+
+	override.ID = r.s.data.newID()
+	override.CreatedAt = ts
+	override.UpdatedAt = ts
+	r.s.data.limits[override.ID] = *override
+	return nil
+}
+
+func (r *memRateLimitOverrideRepo) Delete(ctx context.Context, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.data.limits[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.s.data.limits, id)
+	return nil
+}
+
+type memRollupRepo struct{ s *memoryState }
+
+func (r *memRollupRepo) ApplyLog(ctx context.Context, userID uint, log models.HabitLog) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	day := log.Date.UTC()
+	key := rollupKey{log.HabitID, day.Format(time.DateOnly)}
+	row, ok := r.s.data.daily[key]
+	if !ok {
+		row = models.HabitDailyRollup{HabitID: log.HabitID, Day: dayStart(day), UserID: userID}
+	}
+
+	row.Total++
+	if log.IsCompleted {
+		row.Completed++
+		row.RunEnd = r.runBefore(log.HabitID, key.day) + 1
+	} else {
+		row.RunEnd = 0
+	}
+	row.BestRun = max(row.BestRun, row.RunEnd)
+	row.UpdatedAt = now()
+	r.s.data.daily[key] = row
+
+	r.refreshWeeks(userID)
+	return nil
+}
+
+// runBefore возвращает серию на конец последней сводки привычки не позже day.
+func (r *memRollupRepo) runBefore(habitID uint, day string) int {
+	var latest *models.HabitDailyRollup
+	for key, row := range r.s.data.daily {
+		if key.id != habitID || key.day > day {
+			continue
+		}
+		if latest == nil || row.Day.After(latest.Day) {
+			latest = &row
+		}
+	}
+	if latest == nil {
+		return 0
+	}
+	return latest.RunEnd
+}
+
+func (r *memRollupRepo) DeleteHabit(ctx context.Context, userID, habitID uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for key := range r.s.data.daily {
+		if key.id == habitID {
+			delete(r.s.data.daily, key)
+		}
+	}
+	r.refreshWeeks(userID)
+	return nil
+}
+
+func (r *memRollupRepo) Rebuild(ctx context.Context, userID *uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for key, row := range r.s.data.daily {
+		if userID == nil || row.UserID == *userID {
+			delete(r.s.data.daily, key)
+		}
+	}
+
+	byHabit := make(map[uint][]models.HabitLog)
+	for _, log := range r.s.data.logs {
+		byHabit[log.HabitID] = append(byHabit[log.HabitID], log)
+	}
+	for habitID, logs := range byHabit {
+		habit, ok := r.s.data.habits[habitID]
+		if !ok || (userID != nil && habit.UserID != *userID) {
+			continue
+		}
+
+		logs = pageSlice(logs, Page{Sort: Sort{Field: "date"}}, DefaultHabitLogSort, habitLogSortValue, habitLogID)
+		run := 0
+		for _, log := range logs {
+			day := log.Date.UTC()
+			key := rollupKey{habitID, day.Format(time.DateOnly)}
+			row, ok := r.s.data.daily[key]
+			if !ok {
+				row = models.HabitDailyRollup{HabitID: habitID, Day: dayStart(day), UserID: habit.UserID, UpdatedAt: now()}
+			}
+			row.Total++
+			run++
+			if log.IsCompleted {
+				row.Completed++
+			} else {
+				run = 0
+			}
+			row.RunEnd = run
+			row.BestRun = max(row.BestRun, run)
+			r.s.data.daily[key] = row
+		}
+	}
+
+	if userID != nil {
+		r.refreshWeeks(*userID)
+		return nil
+	}
+	users := make(map[uint]bool)
+	for key := range r.s.data.weekly {
+		users[key.id] = true
+	}
+	for _, row := range r.s.data.daily {
+		users[row.UserID] = true
+	}
+	for id := range users {
+		r.refreshWeeks(id)
+	}
+	return nil
+}
+
+// refreshWeeks пересобирает недельные сводки пользователя из дневных.
+func (r *memRollupRepo) refreshWeeks(userID uint) {
+	for key := range r.s.data.weekly {
+		if key.id == userID {
+			delete(r.s.data.weekly, key)
+		}
+	}
+
+	activeDays := make(map[rollupKey]map[string]bool)
+	for key, day := range r.s.data.daily {
+		if day.UserID != userID {
+			continue
+		}
+		week := weekStart(day.Day)
+		wkey := rollupKey{userID, week.Format(time.DateOnly)}
+		row, ok := r.s.data.weekly[wkey]
+		if !ok {
+			row = models.UserWeeklyRollup{UserID: userID, WeekStart: week, UpdatedAt: now()}
+			activeDays[wkey] = make(map[string]bool)
+		}
+		row.Total += day.Total
+		row.Completed += day.Completed
+		if day.Completed > 0 && !activeDays[wkey][key.day] {
+			activeDays[wkey][key.day] = true
+			row.ActiveDays++
+		}
+		r.s.data.weekly[wkey] = row
+	}
+}
+
+func (r *memRollupRepo) Stats(ctx context.Context, userID uint) ([]HabitLogStats, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	byHabit := make(map[uint]*HabitLogStats)
+	stats := make([]HabitLogStats, 0)
+	for _, habit := range r.s.data.habits {
+		if habit.UserID == userID {
+			byHabit[habit.ID] = &HabitLogStats{HabitID: habit.ID, IsActive: habit.IsActive}
+		}
+	}
+
+	latest := make(map[uint]time.Time)
+	for _, row := range r.s.data.daily {
+		s, ok := byHabit[row.HabitID]
+		if !ok {
+			continue
+		}
+		s.TotalLogs += row.Total
+		s.CompletedLogs += row.Completed
+		s.LongestStreak = max(s.LongestStreak, row.BestRun)
+		if last, seen := latest[row.HabitID]; !seen || row.Day.After(last) {
+			latest[row.HabitID] = row.Day
+			s.CurrentStreak = row.RunEnd
+		}
+	}
+
+	for _, s := range byHabit {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].HabitID < stats[j].HabitID })
+	return stats, nil
+}
+
+func (r *memRollupRepo) Daily(ctx context.Context, filter RollupFilter) ([]models.HabitDailyRollup, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	from, to := filter.From.Format(time.DateOnly), filter.To.Format(time.DateOnly)
+	rows := make([]models.HabitDailyRollup, 0)
+	for key, row := range r.s.data.daily {
+		if row.UserID == filter.UserID && key.day >= from && key.day <= to {
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].Day.Equal(rows[j].Day) {
+			return rows[i].Day.Before(rows[j].Day)
+		}
+		return rows[i].HabitID < rows[j].HabitID
+	})
+	return rows, nil
+}
+
+func (r *memRollupRepo) Weekly(ctx context.Context, filter RollupFilter) ([]models.UserWeeklyRollup, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	from, to := weekStart(filter.From).Format(time.DateOnly), filter.To.Format(time.DateOnly)
+	rows := make([]models.UserWeeklyRollup, 0)
+	for key, row := range r.s.data.weekly {
+		if key.id == filter.UserID && key.day >= from && key.day <= to {
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].WeekStart.Before(rows[j].WeekStart) })
+	return rows, nil
+}
+
+type memAchievementRepo struct{ s *memoryState }
+
+func (r *memAchievementRepo) List(ctx context.Context, filter AchievementFilter) ([]models.Achievement, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	achievements := make([]models.Achievement, 0)
+	for _, a := range r.s.data.awards {
+		if filter.UserID != nil && a.UserID != *filter.UserID {
+			continue
+		}
+		if inRange(a.EarnedAt, filter.From, filter.To) {
+			achievements = append(achievements, a)
+		}
+	}
+	sort.Slice(achievements, func(i, j int) bool {
+		if !achievements[i].EarnedAt.Equal(achievements[j].EarnedAt) {
+			return achievements[i].EarnedAt.Before(achievements[j].EarnedAt)
+		}
+		return achievements[i].ID < achievements[j].ID
+	})
+	return achievements, nil
+}
+
+func (r *memAchievementRepo) Create(ctx context.Context, achievement *models.Achievement) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	achievement.ID = r.s.data.newID()
+	if achievement.EarnedAt.IsZero() {
+		achievement.EarnedAt = now()
+	}
+	r.s.data.awards[achievement.ID] = *achievement
+	return nil
+}
+
+type memReportRepo struct{ s *memoryState }
+
+func (r *memReportRepo) GetByID(ctx context.Context, id uint) (*models.Report, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	report, ok := r.s.data.reports[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &report, nil
+}
+
+func (r *memReportRepo) List(ctx context.Context, filter ReportFilter, page Page) ([]models.Report, *Cursor, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	reports := make([]models.Report, 0)
+	for _, report := range r.s.data.reports {
+		if filter.UserID != nil && report.UserID != *filter.UserID {
+			continue
+		}
+		if filter.Period != "" && report.Period != filter.Period {
+			continue
+		}
+		reports = append(reports, report)
+	}
+
+	reports = pageSlice(reports, page, DefaultReportSort, reportSortValue, reportID)
+	reports, next := cutPage(reports, page, DefaultReportSort, reportSortValue, reportID)
+	return reports, next, nil
+}
+
+func (r *memReportRepo) Create(ctx context.Context, report *models.Report) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, existing := range r.s.data.reports {
+		if existing.UserID == report.UserID && existing.Period == report.Period &&
+			existing.PeriodStart.Equal(report.PeriodStart) {
+			return ErrDuplicate
+		}
+	}
+
+	report.ID = r.s.data.newID()
+	report.CreatedAt = now()
+	r.s.data.reports[report.ID] = *report
+	return nil
+}
+
+func (r *memReportRepo) MarkDelivered(ctx context.Context, id uint, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	report, ok := r.s.data.reports[id]
+	if !ok {
+		return ErrNotFound
+	}
+	report.DeliveredAt = &at
+	r.s.data.reports[id] = report
+	return nil
+}
+
+type memPromptRepo struct{ s *memoryState }
+
+func (r *memPromptRepo) GetByID(ctx context.Context, id uint) (*models.JournalPrompt, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	prompt, ok := r.s.data.prompts[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &prompt, nil
+}
+
+func (r *memPromptRepo) List(ctx context.Context, filter PromptFilter) ([]models.JournalPrompt, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	prompts := make([]models.JournalPrompt, 0)
+	for _, prompt := range r.s.data.prompts {
+		if filter.Category != "" && prompt.Category != filter.Category {
+			continue
+		}
+		if filter.IsActive != nil && prompt.IsActive != *filter.IsActive {
+			continue
+		}
+		prompts = append(prompts, prompt)
+	}
+	sort.Slice(prompts, func(i, j int) bool {
+		if prompts[i].Category != prompts[j].Category {
+			return prompts[i].Category < prompts[j].Category
+		}
+		return prompts[i].ID < prompts[j].ID
+	})
+	return prompts, nil
+}
+
+func (r *memPromptRepo) Create(ctx context.Context, prompt *models.JournalPrompt) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	prompt.ID = r.s.data.newID()
+	prompt.CreatedAt = now()
+	prompt.UpdatedAt = prompt.CreatedAt
+	r.s.data.prompts[prompt.ID] = *prompt
+	return nil
+}
+
+func (r *memPromptRepo) Update(ctx context.Context, prompt *models.JournalPrompt) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.data.prompts[prompt.ID]; !ok {
+		return ErrNotFound
+	}
+	prompt.UpdatedAt = now()
+	r.s.data.prompts[prompt.ID] = *prompt
+	return nil
+}
+
+func (r *memPromptRepo) Delete(ctx context.Context, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.data.prompts[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.s.data.prompts, id)
+	for key, assignment := range r.s.data.shown {
+		if assignment.PromptID == id {
+			delete(r.s.data.shown, key)
+		}
+	}
+	for key, diary := range r.s.data.diaries {
+		if diary.PromptID != nil && *diary.PromptID == id {
+			diary.PromptID = nil
+			r.s.data.diaries[key] = diary
+		}
+	}
+	return nil
+}
+
+func (r *memPromptRepo) Assignment(ctx context.Context, userID uint, day, category string) (*models.PromptAssignment, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, assignment := range r.s.data.shown {
+		if assignment.UserID == userID && assignment.Day == day && assignment.Category == category {
+			return &assignment, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memPromptRepo) Assign(ctx context.Context, assignment *models.PromptAssignment) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, existing := range r.s.data.shown {
+		if existing.UserID == assignment.UserID && existing.Day == assignment.Day && existing.Category == assignment.Category {
+			return ErrDuplicate
+		}
+	}
+	assignment.ID = r.s.data.newID()
+	if assignment.CreatedAt.IsZero() {
+		assignment.CreatedAt = now()
+	}
+	r.s.data.shown[assignment.ID] = *assignment
+	return nil
+}
+
+func (r *memPromptRepo) LastShown(ctx context.Context, userID uint) (map[uint]string, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	shown := make(map[uint]string)
+	for _, assignment := range r.s.data.shown {
+		if assignment.UserID == userID && assignment.Day > shown[assignment.PromptID] {
+			shown[assignment.PromptID] = assignment.Day
+		}
+	}
+	return shown, nil
+}
+
+func (r *memPromptRepo) Stats(ctx context.Context, filter PromptStatsFilter) ([]PromptStat, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var shown []PromptStat
+	for _, assignment := range r.s.data.shown {
+		if inRange(assignment.CreatedAt, filter.From, filter.To) {
+			shown = append(shown, PromptStat{PromptID: assignment.PromptID, Shown: 1})
+		}
+	}
+
+	users := make(map[uint]map[uint]bool)
+	var answered []PromptStat
+	for _, diary := range r.s.data.diaries {
+		if diary.PromptID == nil || !inRange(diary.CreatedAt, filter.From, filter.To) {
+			continue
+		}
+		stat := PromptStat{PromptID: *diary.PromptID, Answered: 1}
+		if users[stat.PromptID] == nil {
+			users[stat.PromptID] = make(map[uint]bool)
+		}
+		if !users[stat.PromptID][diary.UserID] {
+			users[stat.PromptID][diary.UserID] = true
+			stat.Users = 1
+		}
+		answered = append(answered, stat)
+	}
+	return mergePromptStats(shown, answered), nil
+}
+
+type memReminderRepo struct{ s *memoryState }
+
+func (r *memReminderRepo) GetByID(ctx context.Context, id uint) (*models.HabitReminder, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	reminder, ok := r.s.data.alarms[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &reminder, nil
+}
+
+func (r *memReminderRepo) List(ctx context.Context, filter ReminderFilter) ([]models.HabitReminder, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	reminders := make([]models.HabitReminder, 0)
+	for _, reminder := range r.s.data.alarms {
+		if filter.HabitID != nil && reminder.HabitID != *filter.HabitID {
+			continue
+		}
+		if filter.UserID != nil && reminder.UserID != *filter.UserID {
+			continue
+		}
+		reminders = append(reminders, reminder)
+	}
+	slices.SortFunc(reminders, func(a, b models.HabitReminder) int {
+		return cmp.Or(cmp.Compare(a.Time, b.Time), cmp.Compare(a.ID, b.ID))
+	})
+	return reminders, nil
+}
+
+func (r *memReminderRepo) Due(ctx context.Context, now time.Time, window time.Duration) ([]ScheduledReminder, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var reminders []ScheduledReminder
+	for _, reminder := range r.s.data.alarms {
+		habit, ok := r.s.data.habits[reminder.HabitID]
+		if !ok || !habit.IsActive {
+			continue
+		}
+		tz := r.s.data.users[reminder.UserID].Timezone
+		local := now.In(reminderLocation(tz))
+		if !reminderDue(reminder, local, window) || reminder.LastSentOn == local.Format(time.DateOnly) {
+			continue
+		}
+		reminders = append(reminders, ScheduledReminder{
+			HabitReminder: reminder,
+			HabitTitle:    habit.Title,
+			Timezone:      tz,
+		})
+	}
+	slices.SortFunc(reminders, func(a, b ScheduledReminder) int { return cmp.Compare(a.ID, b.ID) })
+	return reminders, nil
+}
+
+// reminderLocation повторяет выбор часового пояса в dueRemindersQuery.
+func reminderLocation(tz string) *time.Location {
+	if loc, err := time.LoadLocation(tz); err == nil && tz != "" {
+		return loc
+	}
+	return time.UTC
+}
+
+// reminderDue сообщает, наступило ли напоминание в местное время local
+// не раньше чем window назад.
+func reminderDue(r models.HabitReminder, local time.Time, window time.Duration) bool {
+	weekday := (int(local.Weekday())+6)%7 + 1
+	if len(r.Days) > 0 && !slices.Contains(r.Days, weekday) {
+		return false
+	}
+	at, err := time.Parse("15:04", r.Time)
+	if err != nil {
+		return false
+	}
+	due := time.Date(local.Year(), local.Month(), local.Day(), at.Hour(), at.Minute(), 0, 0, local.Location())
+	return !local.Before(due) && local.Sub(due) < window
+}
+
+func (r *memReminderRepo) Create(ctx context.Context, reminder *models.HabitReminder) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	reminder.ID = r.s.data.newID()
+	reminder.CreatedAt = now()
+	reminder.UpdatedAt = reminder.CreatedAt
+	r.s.data.alarms[reminder.ID] = *reminder
+	return nil
+}
+
+func (r *memReminderRepo) Update(ctx context.Context, reminder *models.HabitReminder) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.data.alarms[reminder.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.Time, stored.Days, stored.UpdatedAt = reminder.Time, slices.Clone(reminder.Days), now()
+	r.s.data.alarms[reminder.ID] = stored
+	reminder.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+func (r *memReminderRepo) Delete(ctx context.Context, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.data.alarms[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.s.data.alarms, id)
+	return nil
+}
+
+func (r *memReminderRepo) DeleteByHabit(ctx context.Context, habitID uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, reminder := range r.s.data.alarms {
+		if reminder.HabitID == habitID {
+			delete(r.s.data.alarms, id)
+		}
+	}
+	return nil
+}
+
+func (r *memReminderRepo) MarkSent(ctx context.Context, id uint, day string) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	reminder, ok := r.s.data.alarms[id]
+	if !ok || reminder.LastSentOn == day {
+		return false, nil
+	}
+	reminder.LastSentOn = day
+	r.s.data.alarms[id] = reminder
+	return true, nil
+}
+
+type memNotificationRepo struct{ s *memoryState }
+
+func (r *memNotificationRepo) GetByID(ctx context.Context, id uint) (*models.Notification, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	notification, ok := r.s.data.inbox[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &notification, nil
+}
+
+func (r *memNotificationRepo) List(ctx context.Context, filter NotificationFilter, page Page) ([]models.Notification, *Cursor, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	notifications := make([]models.Notification, 0)
+	for _, notification := range r.s.data.inbox {
+		if notification.UserID != filter.UserID || filter.Unread && notification.ReadAt != nil {
+			continue
+		}
+		notifications = append(notifications, notification)
+	}
+
+	notifications = pageSlice(notifications, page, DefaultNotificationSort, notificationSortValue, notificationID)
+	notifications, next := cutPage(notifications, page, DefaultNotificationSort, notificationSortValue, notificationID)
+	return notifications, next, nil
+}
+
+func (r *memNotificationRepo) Create(ctx context.Context, notification *models.Notification) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	notification.ID = r.s.data.newID()
+	notification.CreatedAt = now()
+	r.s.data.inbox[notification.ID] = *notification
+	return nil
+}
+
+func (r *memNotificationRepo) MarkRead(ctx context.Context, id uint, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	notification, ok := r.s.data.inbox[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if notification.ReadAt == nil {
+		notification.ReadAt = &at
+		r.s.data.inbox[id] = notification
+	}
+	return nil
+}
+
+func (r *memNotificationRepo) MarkAllRead(ctx context.Context, userID uint, at time.Time) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var updated int64
+	for id, notification := range r.s.data.inbox {
+		if notification.UserID == userID && notification.ReadAt == nil {
+			notification.ReadAt = &at
+			r.s.data.inbox[id] = notification
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+func (r *memNotificationRepo) UnreadCount(ctx context.Context, userID uint) (int64, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var count int64
+	for _, notification := range r.s.data.inbox {
+		if notification.UserID == userID && notification.ReadAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+type memDeadLetterRepo struct{ s *memoryState }
+
+func (r *memDeadLetterRepo) GetByID(ctx context.Context, id uint) (*models.NotificationDeadLetter, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	letter, ok := r.s.data.dead[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &letter, nil
+}
+
+func (r *memDeadLetterRepo) List(ctx context.Context, filter DeadLetterFilter, page Page) ([]models.NotificationDeadLetter, *Cursor, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	letters := make([]models.NotificationDeadLetter, 0)
+	for _, letter := range r.s.data.dead {
+		if filter.UserID != nil && letter.UserID != *filter.UserID {
+			continue
+		}
+		if filter.Channel != "" && letter.Channel != filter.Channel {
+			continue
+		}
+		letters = append(letters, letter)
+	}
+
+	letters = pageSlice(letters, page, DefaultDeadLetterSort, deadLetterSortValue, deadLetterID)
+	letters, next := cutPage(letters, page, DefaultDeadLetterSort, deadLetterSortValue, deadLetterID)
+	return letters, next, nil
+}
+
+func (r *memDeadLetterRepo) Create(ctx context.Context, letter *models.NotificationDeadLetter) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	letter.ID = r.s.data.newID()
+	letter.CreatedAt = now()
+	letter.UpdatedAt = letter.CreatedAt
+	r.s.data.dead[letter.ID] = *letter
+	return nil
+}
+
+func (r *memDeadLetterRepo) Update(ctx context.Context, letter *models.NotificationDeadLetter) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.data.dead[letter.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.Attempts, stored.LastError, stored.UpdatedAt = letter.Attempts, letter.LastError, now()
+	r.s.data.dead[letter.ID] = stored
+	letter.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+func (r *memDeadLetterRepo) Delete(ctx context.Context, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.data.dead[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.s.data.dead, id)
+	return nil
+}
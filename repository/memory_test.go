@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+)
+
+func TestMemoryStoreTransactionRollback(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	habit := models.Habit{UserID: 1, Title: "Read"}
+	if err := store.Habits().Create(ctx, &habit); err != nil {
+		t.Fatal(err)
+	}
+
+	errBoom := errors.New("boom")
+	err := store.Transaction(ctx, func(tx Store) error {
+		if err := tx.HabitLogs().Create(ctx, &models.HabitLog{HabitID: habit.ID}); err != nil {
+			return err
+		}
+		if err := tx.Habits().Delete(ctx, habit.ID); err != nil {
+			return err
+		}
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("Transaction error = %v, want %v", err, errBoom)
+	}
+
+	if _, err := store.Habits().GetByID(ctx, habit.ID); err != nil {
+		t.Fatalf("habit was not restored: %v", err)
+	}
+	logs, _, _ := store.HabitLogs().List(ctx, HabitLogFilter{HabitID: &habit.ID}, Page{})
+	if len(logs) != 0 {
+		t.Fatalf("log from rolled back transaction is visible: %+v", logs)
+	}
+}
+
+func TestMemoryStoreNestedTransactionCommits(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	err := store.Transaction(ctx, func(tx Store) error {
+		return tx.Transaction(ctx, func(inner Store) error {
+			return inner.Diaries().Create(ctx, &models.Diary{UserID: 1, Title: "nested"})
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diaries, _, _ := store.Diaries().List(ctx, DiaryFilter{}, Page{})
+	if len(diaries) != 1 {
+		t.Fatalf("got %d diaries, want 1", len(diaries))
+	}
+}
+
+func TestMemoryStoreUniqueUsername(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	if err := store.Users().Create(ctx, &models.User{Username: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	err := store.Users().Create(ctx, &models.User{Username: "alice"})
+	if !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("duplicate username error = %v, want ErrDuplicate", err)
+	}
+}
+
+func TestMemoryStoreCalendarUsesTimeZone(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	habit := models.Habit{UserID: 1, Title: "Read"}
+	if err := store.Habits().Create(ctx, &habit); err != nil {
+		t.Fatal(err)
+	}
+	// 20:30 UTC 1 марта — уже 2 марта в Алматы (UTC+5).
+	late := time.Date(2024, 3, 1, 20, 30, 0, 0, time.UTC)
+	if err := store.HabitLogs().Create(ctx, &models.HabitLog{HabitID: habit.ID, Date: late, IsCompleted: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	almaty := time.FixedZone("UTC+5", 5*60*60)
+	days, err := store.HabitLogs().Calendar(ctx, CalendarFilter{
+		UserID:   &habit.UserID,
+		From:     time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC),
+		Location: almaty,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 3 || days[0].Total != 0 || days[1].Completed != 1 || days[1].Date != "2024-03-02" {
+		t.Fatalf("unexpected days: %+v", days)
+	}
+}
+
+func TestMemoryStoreRollupsMatchRebuild(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	habit := models.Habit{UserID: 1, Title: "Read", IsActive: true}
+	empty := models.Habit{UserID: 1, Title: "Run"}
+	for _, h := range []*models.Habit{&habit, &empty} {
+		if err := store.Habits().Create(ctx, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// От старых к новым: ✓ | ✓ ✓ | ✗ | ✓ ✓ — самая длинная серия 3 и
+	// тянется через границу дня, текущая 2.
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) // пятница
+	days := []int{0, 1, 1, 2, 3, 3}
+	for i, done := range []bool{true, true, true, false, true, true} {
+		log := models.HabitLog{HabitID: habit.ID, Date: start.AddDate(0, 0, days[i]).Add(time.Duration(i) * time.Minute), IsCompleted: done}
+		if err := store.HabitLogs().Create(ctx, &log); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Rollups().ApplyLog(ctx, 1, log); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []HabitLogStats{
+		{HabitID: habit.ID, IsActive: true, TotalLogs: 6, CompletedLogs: 5, CurrentStreak: 2, LongestStreak: 3},
+		{HabitID: empty.ID},
+	}
+	wantWeeks := map[rollupKey]models.UserWeeklyRollup{
+		{1, "2024-02-26"}: {UserID: 1, Total: 4, Completed: 3, ActiveDays: 2},
+		{1, "2024-03-04"}: {UserID: 1, Total: 2, Completed: 2, ActiveDays: 1},
+	}
+
+	check := func(stage string) {
+		t.Helper()
+		stats, err := store.Rollups().Stats(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stats) != len(want) || stats[0] != want[0] || stats[1] != want[1] {
+			t.Fatalf("%s: stats = %+v, want %+v", stage, stats, want)
+		}
+
+		weeks := store.state.data.weekly
+		if len(weeks) != len(wantWeeks) {
+			t.Fatalf("%s: weeks = %+v", stage, weeks)
+		}
+		for key, w := range wantWeeks {
+			got := weeks[key]
+			if got.Total != w.Total || got.Completed != w.Completed || got.ActiveDays != w.ActiveDays {
+				t.Fatalf("%s: week %s = %+v, want %+v", stage, key.day, got, w)
+			}
+		}
+	}
+
+	check("incremental")
+	if err := store.Rollups().Rebuild(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	check("rebuild")
+
+	if err := store.Rollups().DeleteHabit(ctx, 1, habit.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.state.data.daily) != 0 || len(store.state.data.weekly) != 0 {
+		t.Fatalf("rollups left after delete: %+v %+v", store.state.data.daily, store.state.data.weekly)
+	}
+}
+
+func TestMemoryDiarySearch(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	long := strings.Repeat("слово ", 60) + "Пробежка по парку <утром>" + strings.Repeat(" ещё", 60)
+	for _, d := range []models.Diary{
+		{UserID: 1, Title: "Пробежка", Content: "Короткая пробежка", Tags: []string{"sport"}},
+		{UserID: 1, Title: "Вечер", Content: long},
+		{UserID: 1, Title: "Книга", Content: "Читал весь день"},
+		{UserID: 2, Title: "Пробежка", Content: "Чужая запись"},
+	} {
+		if err := store.Diaries().Create(ctx, &d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	user := uint(1)
+	hits, err := store.Diaries().Search(ctx, DiaryFilter{UserID: &user}, "пробежка", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 2 || hits[0].Title != "Пробежка" {
+		t.Fatalf("unexpected hits: %+v", hits)
+	}
+	if hits[0].Headline != "<mark>Пробежка</mark>" {
+		t.Fatalf("unexpected headline %q", hits[0].Headline)
+	}
+	snippet := hits[1].Snippet
+	if !strings.HasPrefix(snippet, "…") || !strings.HasSuffix(snippet, "…") ||
+		!strings.Contains(snippet, "<mark>Пробежка</mark> по парку &lt;утром&gt;") {
+		t.Fatalf("unexpected snippet %q", snippet)
+	}
+
+	hits, _ = store.Diaries().Search(ctx, DiaryFilter{UserID: &user, Tag: "sport"}, "пробежка", 10)
+	if len(hits) != 1 {
+		t.Fatalf("tag filter ignored: %+v", hits)
+	}
+	hits, _ = store.Diaries().Search(ctx, DiaryFilter{UserID: &user}, "пробежка книга", 10)
+	if len(hits) != 0 {
+		t.Fatalf("all terms must match: %+v", hits)
+	}
+}
+
+func TestMemoryPromptDeleteUnlinksDiaries(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	prompt := models.JournalPrompt{Text: "What went well?", Category: models.PromptDaily, IsActive: true}
+	if err := store.Prompts().Create(ctx, &prompt); err != nil {
+		t.Fatal(err)
+	}
+	diary := models.Diary{UserID: 1, Title: "Answer", Content: "Everything", PromptID: &prompt.ID}
+	if err := store.Diaries().Create(ctx, &diary); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Prompts().Delete(ctx, prompt.ID); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Diaries().GetByID(ctx, diary.ID)
+	if err != nil || got.PromptID != nil {
+		t.Fatalf("diary still points at the deleted prompt: %+v, %v", got, err)
+	}
+}
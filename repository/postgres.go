@@ -0,0 +1,1405 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/encryption"
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PostgresStore — реализация Store поверх gorm.
+type PostgresStore struct {
+	db *gorm.DB
+}
+
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Users() UserRepository         { return &pgUserRepo{db: s.db} }
+func (s *PostgresStore) Habits() HabitRepository       { return &pgHabitRepo{db: s.db} }
+func (s *PostgresStore) HabitLogs() HabitLogRepository { return &pgHabitLogRepo{db: s.db} }
+func (s *PostgresStore) Diaries() DiaryRepository      { return &pgDiaryRepo{db: s.db} }
+func (s *PostgresStore) Cities() CityRepository        { return &pgCityRepo{db: s.db} }
+func (s *PostgresStore) DiaryRevisions() DiaryRevisionRepository {
+	return &pgDiaryRevisionRepo{db: s.db}
+}
+func (s *PostgresStore) Attachments() DiaryAttachmentRepository {
+	return &pgDiaryAttachmentRepo{db: s.db}
+}
+func (s *PostgresStore) Prompts() PromptRepository { return &pgPromptRepo{db: s.db} }
+func (s *PostgresStore) RateLimitOverrides() RateLimitOverrideRepository {
+	return &pgRateLimitOverrideRepo{db: s.db}
+}
+func (s *PostgresStore) Rollups() RollupRepository { return &pgRollupRepo{db: s.db} }
+func (s *PostgresStore) Achievements() AchievementRepository {
+	return &pgAchievementRepo{db: s.db}
+}
+func (s *PostgresStore) Reports() ReportRepository     { return &pgReportRepo{db: s.db} }
+func (s *PostgresStore) Reminders() ReminderRepository { return &pgReminderRepo{db: s.db} }
+func (s *PostgresStore) Notifications() NotificationRepository {
+	return &pgNotificationRepo{db: s.db}
+}
+func (s *PostgresStore) DeadLetters() DeadLetterRepository { return &pgDeadLetterRepo{db: s.db} }
+
+func (s *PostgresStore) Transaction(ctx context.Context, fn func(tx Store) error) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&PostgresStore{db: tx})
+	})
+}
+
+func (s *PostgresStore) Ping(ctx context.Context) error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// translateError приводит ошибки gorm к ошибкам пакета repository.
+func translateError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return fmt.Errorf("%w: %v", ErrDuplicate, err)
+	default:
+		return err
+	}
+}
+
+type pgUserRepo struct{ db *gorm.DB }
+
+func (r *pgUserRepo) GetByID(ctx context.Context, id uint) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).First(&user, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *pgUserRepo) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *pgUserRepo) List(ctx context.Context, filter UserFilter, page Page) ([]models.User, *Cursor, error) {
+	query := r.db.WithContext(ctx).Preload("City")
+	if filter.Role != "" {
+		query = query.Where("users.role = ?", filter.Role)
+	}
+	if filter.CityID != nil {
+		query = query.Where("users.city_id = ?", *filter.CityID)
+	}
+
+	var users []models.User
+	if err := applyPage(query, UserSorts, page, DefaultUserSort).Find(&users).Error; err != nil {
+		return nil, nil, translateError(err)
+	}
+	users, next := cutPage(users, page, DefaultUserSort, userSortValue, userID)
+	return users, next, nil
+}
+
+func (r *pgUserRepo) Create(ctx context.Context, user *models.User) error {
+	return translateError(r.db.WithContext(ctx).Create(user).Error)
+}
+
+func (r *pgUserRepo) Update(ctx context.Context, user *models.User) error {
+	return translateError(r.db.WithContext(ctx).Omit(clause.Associations).Save(user).Error)
+}
+
+type pgHabitRepo struct{ db *gorm.DB }
+
+func (r *pgHabitRepo) GetByID(ctx context.Context, id uint) (*models.Habit, error) {
+	var habit models.Habit
+	if err := r.db.WithContext(ctx).First(&habit, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &habit, nil
+}
+
+func (r *pgHabitRepo) GetForUpdate(ctx context.Context, id uint) (*models.Habit, error) {
+	var habit models.Habit
+	err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&habit, id).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &habit, nil
+}
+
+func (r *pgHabitRepo) List(ctx context.Context, filter HabitFilter, page Page) ([]models.Habit, *Cursor, error) {
+	query := r.db.WithContext(ctx)
+	if filter.WithUser {
+		query = query.Preload("User")
+	}
+	if filter.UserID != nil {
+		query = query.Where("habits.user_id = ?", *filter.UserID)
+	}
+	if filter.IsActive != nil {
+		query = query.Where("habits.is_active = ?", *filter.IsActive)
+	}
+	if filter.Frequency != "" {
+		query = query.Where("habits.frequency = ?", filter.Frequency)
+	}
+	if filter.CreatedFrom != nil {
+		query = query.Where("habits.created_at >= ?", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		query = query.Where("habits.created_at < ?", *filter.CreatedTo)
+	}
+
+	var habits []models.Habit
+	if err := applyPage(query, HabitSorts, page, DefaultHabitSort).Find(&habits).Error; err != nil {
+		return nil, nil, translateError(err)
+	}
+	habits, next := cutPage(habits, page, DefaultHabitSort, habitSortValue, habitID)
+
+	if filter.WithLogs && len(habits) > 0 {
+		if err := r.attachLogs(ctx, habits, filter.LogsLimit); err != nil {
+			return nil, nil, err
+		}
+	}
+	return habits, next, nil
+}
+
+// attachLogs подгружает логи только для привычек страницы, а при limit > 0 —
+// не больше limit последних логов на привычку.
+func (r *pgHabitRepo) attachLogs(ctx context.Context, habits []models.Habit, limit int) error {
+	ids := make([]uint, len(habits))
+	for i, habit := range habits {
+		ids[i] = habit.ID
+	}
+
+	var logs []models.HabitLog
+	var err error
+	if limit > 0 {
+		err = r.db.WithContext(ctx).Raw(`
+			SELECT id, habit_id, date, is_completed, note FROM (
+				SELECT habit_logs.*,
+					ROW_NUMBER() OVER (PARTITION BY habit_id ORDER BY date DESC, id DESC) AS rn
+				FROM habit_logs
+				WHERE habit_id IN ?
+			) recent
+			WHERE rn <= ?
+			ORDER BY id`, ids, limit).Scan(&logs).Error
+	} else {
+		err = r.db.WithContext(ctx).Where("habit_id IN ?", ids).Order("id").Find(&logs).Error
+	}
+	if err != nil {
+		return translateError(err)
+	}
+
+	byHabit := make(map[uint][]models.HabitLog, len(habits))
+	for _, log := range logs {
+		byHabit[log.HabitID] = append(byHabit[log.HabitID], log)
+	}
+	for i := range habits {
+		habits[i].Logs = byHabit[habits[i].ID]
+		if habits[i].Logs == nil {
+			habits[i].Logs = []models.HabitLog{}
+		}
+	}
+	return nil
+}
+
+func (r *pgHabitRepo) Create(ctx context.Context, habit *models.Habit) error {
+	return translateError(r.db.WithContext(ctx).Omit(clause.Associations).Create(habit).Error)
+}
+
+func (r *pgHabitRepo) Update(ctx context.Context, habit *models.Habit) error {
+	return translateError(r.db.WithContext(ctx).Omit(clause.Associations).Save(habit).Error)
+}
+
+func (r *pgHabitRepo) Delete(ctx context.Context, id uint) error {
+	result := r.db.WithContext(ctx).Delete(&models.Habit{}, id)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *pgHabitRepo) SetActive(ctx context.Context, ids []uint, isActive bool) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&models.Habit{}).
+		Where("id IN ?", ids).
+		Update("is_active", isActive)
+	return result.RowsAffected, translateError(result.Error)
+}
+
+type pgHabitLogRepo struct{ db *gorm.DB }
+
+func (r *pgHabitLogRepo) GetByID(ctx context.Context, id uint) (*models.HabitLog, error) {
+	var log models.HabitLog
+	if err := r.db.WithContext(ctx).First(&log, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &log, nil
+}
+
+func (r *pgHabitLogRepo) Create(ctx context.Context, log *models.HabitLog) error {
+	return translateError(r.db.WithContext(ctx).Omit(clause.Associations).Create(log).Error)
+}
+
+func (r *pgHabitLogRepo) UpdateNote(ctx context.Context, id uint, note string) error {
+	result := r.db.WithContext(ctx).Model(&models.HabitLog{}).Where("id = ?", id).Update("note", note)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *pgHabitLogRepo) List(ctx context.Context, filter HabitLogFilter, page Page) ([]models.HabitLog, *Cursor, error) {
+	query := r.db.WithContext(ctx).Model(&models.HabitLog{})
+	if filter.WithHabit {
+		query = query.Preload("Habit")
+	}
+	if filter.HabitID != nil {
+		query = query.Where("habit_logs.habit_id = ?", *filter.HabitID)
+	}
+	if filter.UserID != nil {
+		query = query.Joins("JOIN habits ON habits.id = habit_logs.habit_id").
+			Where("habits.user_id = ?", *filter.UserID)
+	}
+	if filter.IsCompleted != nil {
+		query = query.Where("habit_logs.is_completed = ?", *filter.IsCompleted)
+	}
+	if filter.From != nil {
+		query = query.Where("habit_logs.date >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("habit_logs.date < ?", *filter.To)
+	}
+
+	var logs []models.HabitLog
+	if err := applyPage(query, HabitLogSorts, page, DefaultHabitLogSort).Find(&logs).Error; err != nil {
+		return nil, nil, translateError(err)
+	}
+	logs, next := cutPage(logs, page, DefaultHabitLogSort, habitLogSortValue, habitLogID)
+	return logs, next, nil
+}
+
+// calendarScope возвращает условие на habit_logs и habits и именованные
+// аргументы для выборки логов по CalendarFilter.
+func calendarScope(filter CalendarFilter) (string, map[string]any) {
+	start, end := filter.bounds()
+	conds := []string{"habit_logs.date >= @start", "habit_logs.date < @end"}
+	args := map[string]any{
+		"tz":    filter.Location.String(),
+		"start": start,
+		"end":   end,
+	}
+	if filter.HabitID != nil {
+		conds = append(conds, "habit_logs.habit_id = @habit")
+		args["habit"] = *filter.HabitID
+	}
+	if filter.UserID != nil {
+		conds = append(conds, "habits.user_id = @user")
+		args["user"] = *filter.UserID
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+func (r *pgHabitLogRepo) Calendar(ctx context.Context, filter CalendarFilter) ([]DayActivity, error) {
+	scope, args := calendarScope(filter)
+	args["from"] = filter.From.Format(time.DateOnly)
+	args["to"] = filter.To.Format(time.DateOnly)
+
+	// Дни без логов дают строки с нулями благодаря LEFT JOIN к generate_series;
+	// логи агрегируются в БД и не читаются в приложение.
+	query := fmt.Sprintf(`
+		SELECT to_char(d.day, 'YYYY-MM-DD') AS date,
+			COUNT(l.id) AS total,
+			COUNT(l.id) FILTER (WHERE l.is_completed) AS completed
+		FROM generate_series(@from::date, @to::date, interval '1 day') AS d(day)
+		LEFT JOIN (
+			SELECT habit_logs.id, habit_logs.is_completed,
+				(habit_logs.date AT TIME ZONE @tz)::date AS day
+			FROM habit_logs
+			JOIN habits ON habits.id = habit_logs.habit_id
+			WHERE %s
+		) l ON l.day = d.day::date
+		GROUP BY d.day
+		ORDER BY d.day`, scope)
+
+	var days []DayActivity
+	err := r.db.WithContext(ctx).Raw(query, args).Scan(&days).Error
+	return days, translateError(err)
+}
+
+func (r *pgHabitLogRepo) Hours(ctx context.Context, filter CalendarFilter) ([]HourActivity, error) {
+	scope, args := calendarScope(filter)
+	query := fmt.Sprintf(`
+		SELECT h.hour,
+			COUNT(l.id) AS total,
+			COUNT(l.id) FILTER (WHERE l.is_completed) AS completed
+		FROM generate_series(0, 23) AS h(hour)
+		LEFT JOIN (
+			SELECT habit_logs.id, habit_logs.is_completed,
+				EXTRACT(HOUR FROM habit_logs.date AT TIME ZONE @tz)::int AS hour
+			FROM habit_logs
+			JOIN habits ON habits.id = habit_logs.habit_id
+			WHERE %s
+		) l ON l.hour = h.hour
+		GROUP BY h.hour
+		ORDER BY h.hour`, scope)
+
+	var hours []HourActivity
+	err := r.db.WithContext(ctx).Raw(query, args).Scan(&hours).Error
+	return hours, translateError(err)
+}
+
+func (r *pgHabitLogRepo) HabitDays(ctx context.Context, filter CalendarFilter) ([]HabitDay, error) {
+	scope, args := calendarScope(filter)
+	query := fmt.Sprintf(`
+		SELECT habit_logs.habit_id,
+			to_char(habit_logs.date AT TIME ZONE @tz, 'YYYY-MM-DD') AS date,
+			COUNT(*) AS total,
+			COUNT(*) FILTER (WHERE habit_logs.is_completed) AS completed
+		FROM habit_logs
+		JOIN habits ON habits.id = habit_logs.habit_id
+		WHERE %s
+		GROUP BY 1, 2
+		ORDER BY 1, 2`, scope)
+
+	var days []HabitDay
+	err := r.db.WithContext(ctx).Raw(query, args).Scan(&days).Error
+	return days, translateError(err)
+}
+
+func (r *pgHabitLogRepo) DeleteByHabit(ctx context.Context, habitID uint) error {
+	return translateError(r.db.WithContext(ctx).Where("habit_id = ?", habitID).Delete(&models.HabitLog{}).Error)
+}
+
+type pgDiaryRepo struct{ db *gorm.DB }
+
+func (r *pgDiaryRepo) GetByID(ctx context.Context, id uint) (*models.Diary, error) {
+	var diary models.Diary
+	if err := r.db.WithContext(ctx).First(&diary, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &diary, nil
+}
+
+func (r *pgDiaryRepo) GetForUpdate(ctx context.Context, id uint) (*models.Diary, error) {
+	var diary models.Diary
+	err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&diary, id).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &diary, nil
+}
+
+// diaryScope добавляет к запросу условия DiaryFilter.
+func diaryScope(query *gorm.DB, filter DiaryFilter) *gorm.DB {
+	if filter.UserID != nil {
+		query = query.Where("diaries.user_id = ?", *filter.UserID)
+	}
+	if filter.From != nil {
+		query = query.Where("diaries.created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("diaries.created_at < ?", *filter.To)
+	}
+	if filter.Tag != "" {
+		tag, _ := json.Marshal([]string{filter.Tag})
+		query = query.Where("diaries.tags @> ?::jsonb", string(tag))
+	}
+	if filter.HabitID != nil {
+		query = query.Where("diaries.habit_id = ?", *filter.HabitID)
+	}
+	if filter.PromptID != nil {
+		query = query.Where("diaries.prompt_id = ?", *filter.PromptID)
+	}
+	return query
+}
+
+func (r *pgDiaryRepo) List(ctx context.Context, filter DiaryFilter, page Page) ([]models.Diary, *Cursor, error) {
+	query := diaryScope(r.db.WithContext(ctx), filter)
+
+	var diaries []models.Diary
+	if err := applyPage(query, DiarySorts, page, DefaultDiarySort).Find(&diaries).Error; err != nil {
+		return nil, nil, translateError(err)
+	}
+	diaries, next := cutPage(diaries, page, DefaultDiarySort, diarySortValue, diaryID)
+	return diaries, next, nil
+}
+
+func (r *pgDiaryRepo) Count(ctx context.Context, filter DiaryFilter) (int64, error) {
+	query := diaryScope(r.db.WithContext(ctx).Model(&models.Diary{}), filter)
+
+	var count int64
+	err := query.Count(&count).Error
+	return count, translateError(err)
+}
+
+// headlineOptions — параметры ts_headline для фрагментов текста; совпадения
+// отмечаются маркерами и превращаются в <mark> в highlight.
+var headlineOptions = fmt.Sprintf(
+	"StartSel=%s, StopSel=%s, MaxFragments=2, MaxWords=25, MinWords=8, FragmentDelimiter=\" … \"",
+	markStart, markStop,
+)
+
+// searchVectorExpr строит поисковый индекс из открытых заголовка (вес A)
+// и текста (вес B). Конфигурация russian стеммит кириллицу русским
+// стеммером, а латиницу — английским, так что индекс покрывает оба языка.
+const searchVectorExpr = "setweight(to_tsvector('russian', ?), 'A') || setweight(to_tsvector('russian', ?), 'B')"
+
+// headlinesQuery подсвечивает совпадения в уже расшифрованных текстах:
+// в БД Content может лежать зашифрованным.
+const headlinesQuery = `
+	SELECT ts_headline('russian', x.title, q.query, @title_options) AS headline,
+		ts_headline('russian', x.content, q.query, @options) AS snippet
+	FROM unnest(@titles::text[], @contents::text[]) WITH ORDINALITY AS x(title, content, n)
+	CROSS JOIN websearch_to_tsquery('russian', @query) AS q(query)
+	ORDER BY x.n`
+
+func (r *pgDiaryRepo) Search(ctx context.Context, filter DiaryFilter, text string, limit int) ([]DiaryHit, error) {
+	query := diaryScope(r.db.WithContext(ctx).Model(&models.Diary{}), filter).
+		Joins("CROSS JOIN websearch_to_tsquery('russian', ?) AS q(query)", text).
+		Where("NOT diaries.encrypted AND diaries.search_vector @@ q.query").
+		Select("diaries.*, ts_rank_cd(diaries.search_vector, q.query) AS rank").
+		Order("rank DESC").
+		Order("diaries.created_at DESC").
+		Order("diaries.id DESC").
+		Limit(limit)
+
+	var hits []DiaryHit
+	if err := query.Scan(&hits).Error; err != nil {
+		return nil, translateError(err)
+	}
+	if len(hits) == 0 {
+		return hits, nil
+	}
+
+	titles, contents := make([]string, len(hits)), make([]string, len(hits))
+	for i, hit := range hits {
+		titles[i], contents[i] = hit.Title, hit.Content
+	}
+	var headlines []struct{ Headline, Snippet string }
+	err := r.db.WithContext(ctx).Raw(headlinesQuery, map[string]any{
+		"title_options": fmt.Sprintf("StartSel=%s, StopSel=%s, HighlightAll=true", markStart, markStop),
+		"options":       headlineOptions,
+		"titles":        titles,
+		"contents":      contents,
+		"query":         text,
+	}).Scan(&headlines).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	for i := range hits {
+		hits[i].Headline = highlight(headlines[i].Headline)
+		hits[i].Snippet = highlight(headlines[i].Snippet)
+	}
+	return hits, nil
+}
+
+// moodTimelineQuery группирует записи по дню в часовом поясе @tz; эмоции
+// дня собираются в JSON-объект «эмоция → число записей».
+const moodTimelineQuery = `
+	WITH entries AS (
+		SELECT to_char(created_at AT TIME ZONE @tz, 'YYYY-MM-DD') AS date,
+			mood, energy, emotion
+		FROM diaries
+		WHERE user_id = @user AND created_at >= @start AND created_at < @end
+	)
+	SELECT e.date,
+		COUNT(*) AS entries,
+		AVG(e.mood)::float8 AS mood,
+		AVG(e.energy)::float8 AS energy,
+		COALESCE((
+			SELECT jsonb_object_agg(x.emotion, x.n)
+			FROM (
+				SELECT emotion, COUNT(*) AS n
+				FROM entries
+				WHERE date = e.date AND emotion <> ''
+				GROUP BY emotion
+			) x
+		), '{}')::text AS emotions
+	FROM entries e
+	GROUP BY e.date
+	ORDER BY e.date`
+
+func (r *pgDiaryRepo) MoodTimeline(ctx context.Context, filter MoodFilter) ([]MoodDay, error) {
+	start, end := dayBounds(filter.From, filter.To, filter.Location)
+
+	var rows []struct {
+		Date     string
+		Entries  int
+		Mood     *float64
+		Energy   *float64
+		Emotions string
+	}
+	err := r.db.WithContext(ctx).Raw(moodTimelineQuery, map[string]any{
+		"user":  filter.UserID,
+		"tz":    filter.Location.String(),
+		"start": start,
+		"end":   end,
+	}).Scan(&rows).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	days := make([]MoodDay, len(rows))
+	for i, row := range rows {
+		days[i] = MoodDay{Date: row.Date, Entries: row.Entries, Mood: row.Mood, Energy: row.Energy}
+		if err := json.Unmarshal([]byte(row.Emotions), &days[i].Emotions); err != nil {
+			return nil, fmt.Errorf("decode emotions: %w", err)
+		}
+	}
+	return days, nil
+}
+
+func (r *pgDiaryRepo) Create(ctx context.Context, diary *models.Diary) error {
+	if err := r.db.WithContext(ctx).Create(diary).Error; err != nil {
+		return translateError(err)
+	}
+	return r.index(ctx, diary)
+}
+
+func (r *pgDiaryRepo) Update(ctx context.Context, diary *models.Diary) error {
+	if err := r.db.WithContext(ctx).Save(diary).Error; err != nil {
+		return translateError(err)
+	}
+	return r.index(ctx, diary)
+}
+
+func (r *pgDiaryRepo) UnlinkHabit(ctx context.Context, habitID uint) error {
+	err := r.db.WithContext(ctx).Model(&models.Diary{}).
+		Where("habit_id = ?", habitID).
+		Updates(map[string]any{"habit_id": nil, "habit_log_id": nil}).Error
+	return translateError(err)
+}
+
+// index обновляет поисковый индекс записи. Зашифрованные на клиенте записи
+// в поиск не попадают, а при шифровании на сервере индекс не строится
+// вовсе: он хранил бы текст записи в открытом виде.
+func (r *pgDiaryRepo) index(ctx context.Context, diary *models.Diary) error {
+	db := r.db.WithContext(ctx)
+	if diary.Encrypted || encryption.Enabled() {
+		db = db.Exec("UPDATE diaries SET search_vector = NULL WHERE id = ?", diary.ID)
+	} else {
+		db = db.Exec("UPDATE diaries SET search_vector = "+searchVectorExpr+" WHERE id = ?", diary.Title, diary.Content, diary.ID)
+	}
+	return translateError(db.Error)
+}
+
+func (r *pgDiaryRepo) Delete(ctx context.Context, id uint) error {
+	result := r.db.WithContext(ctx).Delete(&models.Diary{}, id)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type pgCityRepo struct{ db *gorm.DB }
+
+func (r *pgCityRepo) GetByID(ctx context.Context, id uint) (*models.City, error) {
+	var city models.City
+	if err := r.db.WithContext(ctx).First(&city, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &city, nil
+}
+
+func (r *pgCityRepo) List(ctx context.Context) ([]models.City, error) {
+	var cities []models.City
+	err := r.db.WithContext(ctx).Order("id").Find(&cities).Error
+	return cities, translateError(err)
+}
+
+func (r *pgCityRepo) Count(ctx context.Context) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.City{}).Count(&count).Error
+	return count, translateError(err)
+}
+
+func (r *pgCityRepo) CreateBatch(ctx context.Context, cities []models.City) error {
+	return translateError(r.db.WithContext(ctx).Create(&cities).Error)
+}
+
+type pgRateLimitOverrideRepo struct{ db *gorm.DB }
+
+func (r *pgRateLimitOverrideRepo) List(ctx context.Context) ([]models.RateLimitOverride, error) {
+	var overrides []models.RateLimitOverride
+	err := r.db.WithContext(ctx).Order("subject").Find(&overrides).Error
+	return overrides, translateError(err)
+}
+
+func (r *pgRateLimitOverrideRepo) Upsert(ctx context.Context, override *models.RateLimitOverride) error {
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "subject"}},
+		DoUpdates: clause.AssignmentColumns([]string{"multiplier", "exempt", "note", "updated_at"}),
+	}).Create(override).Error
+	return translateError(err)
+}
+
+func (r *pgRateLimitOverrideRepo) Delete(ctx context.Context, id uint) error {
+	result := r.db.WithContext(ctx).Delete(&models.RateLimitOverride{}, id)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type pgRollupRepo struct{ db *gorm.DB }
+
+// applyLogQuery добавляет лог в дневную сводку. Серия на конец дня берётся
+// из последней сводки не позже дня лога: для нового дня это предыдущий день,
+// для существующего — он сам.
+const applyLogQuery = `
+	INSERT INTO habit_daily_rollups (habit_id, day, user_id, total, completed, run_end, best_run, updated_at)
+	SELECT @habit, @day::date, @user, 1, CASE WHEN @done THEN 1 ELSE 0 END, r.run, r.run, NOW()
+	FROM (
+		SELECT CASE WHEN @done THEN COALESCE((
+			SELECT run_end FROM habit_daily_rollups
+			WHERE habit_id = @habit AND day <= @day::date
+			ORDER BY day DESC
+			LIMIT 1
+		), 0) + 1 ELSE 0 END AS run
+	) r
+	ON CONFLICT (habit_id, day) DO UPDATE SET
+		total = habit_daily_rollups.total + 1,
+		completed = habit_daily_rollups.completed + EXCLUDED.completed,
+		run_end = EXCLUDED.run_end,
+		best_run = GREATEST(habit_daily_rollups.best_run, EXCLUDED.run_end),
+		updated_at = EXCLUDED.updated_at`
+
+// rebuildDailyQuery пересчитывает дневные сводки из логов. Серии — острова
+// выполненных логов в порядке (date, id), как в HabitRepository до сводок;
+// run — номер лога внутри своего острова. Значения пишутся целиком, так что
+// уже существующая строка просто перезаписывается.
+const rebuildDailyQuery = `
+	INSERT INTO habit_daily_rollups (habit_id, day, user_id, total, completed, run_end, best_run, updated_at)
+	WITH ordered AS (
+		SELECT l.habit_id, h.user_id, l.is_completed,
+			(l.date AT TIME ZONE 'UTC')::date AS day,
+			ROW_NUMBER() OVER (PARTITION BY l.habit_id ORDER BY l.date, l.id) AS rn,
+			ROW_NUMBER() OVER (PARTITION BY l.habit_id, l.is_completed ORDER BY l.date, l.id) AS state_rn
+		FROM habit_logs l
+		JOIN habits h ON h.id = l.habit_id
+		WHERE %s
+	),
+	runs AS (
+		SELECT habit_id, user_id, day, rn, is_completed,
+			CASE WHEN is_completed
+				THEN ROW_NUMBER() OVER (PARTITION BY habit_id, is_completed, rn - state_rn ORDER BY rn)
+				ELSE 0
+			END AS run
+		FROM ordered
+	)
+	SELECT habit_id, day, user_id,
+		COUNT(*),
+		COUNT(*) FILTER (WHERE is_completed),
+		(ARRAY_AGG(run ORDER BY rn DESC))[1],
+		MAX(run),
+		NOW()
+	FROM runs
+	GROUP BY habit_id, day, user_id
+	ON CONFLICT (habit_id, day) DO UPDATE SET
+		user_id = EXCLUDED.user_id,
+		total = EXCLUDED.total,
+		completed = EXCLUDED.completed,
+		run_end = EXCLUDED.run_end,
+		best_run = EXCLUDED.best_run,
+		updated_at = EXCLUDED.updated_at`
+
+// rollupUsersQuery перечисляет пользователей, чьи сводки пересобирает
+// полный Rebuild, включая тех, у кого остались только устаревшие сводки.
+const rollupUsersQuery = `
+	SELECT user_id FROM habits
+	UNION SELECT user_id FROM habit_daily_rollups
+	UNION SELECT user_id FROM user_weekly_rollups
+	ORDER BY user_id`
+
+// lockRollups до конца транзакции блокирует сводки пользователя. ApplyLog
+// прибавляет к сводкам, а Rebuild пишет их заново; без блокировки лог,
+// сохранённый во время пересборки, учитывался бы дважды.
+func lockRollups(tx *gorm.DB, userID uint) error {
+	err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('habit_rollups'), ?::int)", userID).Error
+	return translateError(err)
+}
+
+// rebuildWeeklyQuery собирает недельные сводки из дневных. Строки
+// обновляются на месте: одновременные логи одного пользователя не
+// сталкиваются на первичном ключе.
+const rebuildWeeklyQuery = `
+	INSERT INTO user_weekly_rollups (user_id, week_start, total, completed, active_days, updated_at)
+	SELECT user_id, date_trunc('week', day)::date,
+		SUM(total), SUM(completed),
+		COUNT(DISTINCT day) FILTER (WHERE completed > 0),
+		NOW()
+	FROM habit_daily_rollups
+	WHERE %s
+	GROUP BY user_id, date_trunc('week', day)
+	ON CONFLICT (user_id, week_start) DO UPDATE SET
+		total = EXCLUDED.total,
+		completed = EXCLUDED.completed,
+		active_days = EXCLUDED.active_days,
+		updated_at = EXCLUDED.updated_at`
+
+// pruneWeeklyQuery удаляет недельные сводки, для которых не осталось
+// дневных.
+const pruneWeeklyQuery = `
+	DELETE FROM user_weekly_rollups w
+	WHERE %s AND NOT EXISTS (
+		SELECT 1 FROM habit_daily_rollups d
+		WHERE d.user_id = w.user_id AND d.day >= w.week_start AND d.day < w.week_start + 7
+	)`
+
+const rollupStatsQuery = `
+	SELECT h.id AS habit_id, h.is_active,
+		COALESCE(SUM(r.total), 0) AS total_logs,
+		COALESCE(SUM(r.completed), 0) AS completed_logs,
+		COALESCE((ARRAY_AGG(r.run_end ORDER BY r.day DESC NULLS LAST))[1], 0) AS current_streak,
+		COALESCE(MAX(r.best_run), 0) AS longest_streak
+	FROM habits h
+	LEFT JOIN habit_daily_rollups r ON r.habit_id = h.id
+	WHERE h.user_id = @user
+	GROUP BY h.id
+	ORDER BY h.id`
+
+func (r *pgRollupRepo) ApplyLog(ctx context.Context, userID uint, log models.HabitLog) error {
+	day := log.Date.UTC()
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockRollups(tx, userID); err != nil {
+			return err
+		}
+		err := tx.Exec(applyLogQuery, map[string]any{
+			"habit": log.HabitID,
+			"user":  userID,
+			"day":   day.Format(time.DateOnly),
+			"done":  log.IsCompleted,
+		}).Error
+		if err != nil {
+			return translateError(err)
+		}
+		week := weekStart(day)
+		return refreshWeeks(tx, &userID, &week)
+	})
+}
+
+func (r *pgRollupRepo) DeleteHabit(ctx context.Context, userID, habitID uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockRollups(tx, userID); err != nil {
+			return err
+		}
+		if err := tx.Where("habit_id = ?", habitID).Delete(&models.HabitDailyRollup{}).Error; err != nil {
+			return translateError(err)
+		}
+		return refreshWeeks(tx, &userID, nil)
+	})
+}
+
+// Rebuild пересобирает сводки каждого пользователя в своей транзакции
+// под lockRollups, так что запись логов ждёт только пересборки своего
+// владельца.
+func (r *pgRollupRepo) Rebuild(ctx context.Context, userID *uint) error {
+	if userID != nil {
+		return r.rebuildUser(ctx, *userID)
+	}
+
+	var users []uint
+	if err := r.db.WithContext(ctx).Raw(rollupUsersQuery).Scan(&users).Error; err != nil {
+		return translateError(err)
+	}
+	for _, id := range users {
+		if err := r.rebuildUser(ctx, id); err != nil {
+			return fmt.Errorf("user %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func (r *pgRollupRepo) rebuildUser(ctx context.Context, userID uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockRollups(tx, userID); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.HabitDailyRollup{}).Error; err != nil {
+			return translateError(err)
+		}
+		query := fmt.Sprintf(rebuildDailyQuery, "h.user_id = @user")
+		if err := tx.Exec(query, map[string]any{"user": userID}).Error; err != nil {
+			return translateError(err)
+		}
+		return refreshWeeks(tx, &userID, nil)
+	})
+}
+
+// refreshWeeks пересобирает недельные сводки пользователя (nil — всех)
+// за неделю week или за всё время.
+func refreshWeeks(tx *gorm.DB, userID *uint, week *time.Time) error {
+	conds, stale, args := []string{"TRUE"}, []string{"TRUE"}, map[string]any{}
+	if userID != nil {
+		conds = append(conds, "user_id = @user")
+		stale = append(stale, "w.user_id = @user")
+		args["user"] = *userID
+	}
+	if week != nil {
+		conds = append(conds, "day >= @week::date", "day < @week::date + 7")
+		stale = append(stale, "w.week_start = @week::date")
+		args["week"] = week.Format(time.DateOnly)
+	}
+
+	query := fmt.Sprintf(rebuildWeeklyQuery, strings.Join(conds, " AND "))
+	if err := tx.Exec(query, args).Error; err != nil {
+		return translateError(err)
+	}
+	query = fmt.Sprintf(pruneWeeklyQuery, strings.Join(stale, " AND "))
+	return translateError(tx.Exec(query, args).Error)
+}
+
+func (r *pgRollupRepo) Stats(ctx context.Context, userID uint) ([]HabitLogStats, error) {
+	var stats []HabitLogStats
+	err := r.db.WithContext(ctx).Raw(rollupStatsQuery, map[string]any{"user": userID}).Scan(&stats).Error
+	return stats, translateError(err)
+}
+
+func (r *pgRollupRepo) Daily(ctx context.Context, filter RollupFilter) ([]models.HabitDailyRollup, error) {
+	var rows []models.HabitDailyRollup
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND day BETWEEN ? AND ?", filter.UserID,
+			filter.From.Format(time.DateOnly), filter.To.Format(time.DateOnly)).
+		Order("day, habit_id").
+		Find(&rows).Error
+	return rows, translateError(err)
+}
+
+func (r *pgRollupRepo) Weekly(ctx context.Context, filter RollupFilter) ([]models.UserWeeklyRollup, error) {
+	var rows []models.UserWeeklyRollup
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND week_start BETWEEN ? AND ?", filter.UserID,
+			weekStart(filter.From).Format(time.DateOnly), filter.To.Format(time.DateOnly)).
+		Order("week_start").
+		Find(&rows).Error
+	return rows, translateError(err)
+}
+
+type pgAchievementRepo struct{ db *gorm.DB }
+
+func (r *pgAchievementRepo) List(ctx context.Context, filter AchievementFilter) ([]models.Achievement, error) {
+	query := r.db.WithContext(ctx)
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.From != nil {
+		query = query.Where("earned_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("earned_at < ?", *filter.To)
+	}
+
+	var achievements []models.Achievement
+	err := query.Order("earned_at, id").Find(&achievements).Error
+	return achievements, translateError(err)
+}
+
+func (r *pgAchievementRepo) Create(ctx context.Context, achievement *models.Achievement) error {
+	return translateError(r.db.WithContext(ctx).Create(achievement).Error)
+}
+
+type pgDiaryRevisionRepo struct{ db *gorm.DB }
+
+func (r *pgDiaryRevisionRepo) List(ctx context.Context, diaryID uint) ([]models.DiaryRevision, error) {
+	var revs []models.DiaryRevision
+	err := r.db.WithContext(ctx).Where("diary_id = ?", diaryID).Order("number").Find(&revs).Error
+	return revs, translateError(err)
+}
+
+func (r *pgDiaryRevisionRepo) Get(ctx context.Context, diaryID uint, number int) (*models.DiaryRevision, error) {
+	var rev models.DiaryRevision
+	err := r.db.WithContext(ctx).Where("diary_id = ? AND number = ?", diaryID, number).First(&rev).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &rev, nil
+}
+
+func (r *pgDiaryRevisionRepo) Latest(ctx context.Context, diaryID uint) (*models.DiaryRevision, error) {
+	var rev models.DiaryRevision
+	err := r.db.WithContext(ctx).Where("diary_id = ?", diaryID).Order("number DESC").First(&rev).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &rev, nil
+}
+
+func (r *pgDiaryRevisionRepo) Create(ctx context.Context, rev *models.DiaryRevision) error {
+	var last int
+	err := r.db.WithContext(ctx).Model(&models.DiaryRevision{}).
+		Where("diary_id = ?", rev.DiaryID).
+		Select("COALESCE(MAX(number), 0)").
+		Scan(&last).Error
+	if err != nil {
+		return translateError(err)
+	}
+	rev.Number = last + 1
+	return translateError(r.db.WithContext(ctx).Create(rev).Error)
+}
+
+func (r *pgDiaryRevisionRepo) DeleteByDiary(ctx context.Context, diaryID uint) error {
+	return translateError(r.db.WithContext(ctx).Where("diary_id = ?", diaryID).Delete(&models.DiaryRevision{}).Error)
+}
+
+type pgDiaryAttachmentRepo struct{ db *gorm.DB }
+
+func (r *pgDiaryAttachmentRepo) GetByID(ctx context.Context, id uint) (*models.DiaryAttachment, error) {
+	var attachment models.DiaryAttachment
+	if err := r.db.WithContext(ctx).First(&attachment, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &attachment, nil
+}
+
+func (r *pgDiaryAttachmentRepo) ListByDiary(ctx context.Context, diaryID uint) ([]models.DiaryAttachment, error) {
+	var attachments []models.DiaryAttachment
+	err := r.db.WithContext(ctx).Where("diary_id = ?", diaryID).Order("id").Find(&attachments).Error
+	return attachments, translateError(err)
+}
+
+func (r *pgDiaryAttachmentRepo) Usage(ctx context.Context, userID uint) (int64, error) {
+	var total int64
+	err := r.db.WithContext(ctx).Model(&models.DiaryAttachment{}).
+		Where("user_id = ?", userID).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&total).Error
+	return total, translateError(err)
+}
+
+func (r *pgDiaryAttachmentRepo) Create(ctx context.Context, attachment *models.DiaryAttachment) error {
+	return translateError(r.db.WithContext(ctx).Create(attachment).Error)
+}
+
+func (r *pgDiaryAttachmentRepo) Delete(ctx context.Context, id uint) error {
+	result := r.db.WithContext(ctx).Delete(&models.DiaryAttachment{}, id)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *pgDiaryAttachmentRepo) DeleteByDiary(ctx context.Context, diaryID uint) ([]models.DiaryAttachment, error) {
+	var deleted []models.DiaryAttachment
+	err := r.db.WithContext(ctx).
+		Clauses(clause.Returning{}).
+		Where("diary_id = ?", diaryID).
+		Delete(&deleted).Error
+	return deleted, translateError(err)
+}
+
+type pgReportRepo struct{ db *gorm.DB }
+
+func (r *pgReportRepo) GetByID(ctx context.Context, id uint) (*models.Report, error) {
+	var report models.Report
+	if err := r.db.WithContext(ctx).First(&report, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &report, nil
+}
+
+func (r *pgReportRepo) List(ctx context.Context, filter ReportFilter, page Page) ([]models.Report, *Cursor, error) {
+	query := r.db.WithContext(ctx)
+	if filter.UserID != nil {
+		query = query.Where("reports.user_id = ?", *filter.UserID)
+	}
+	if filter.Period != "" {
+		query = query.Where("reports.period = ?", filter.Period)
+	}
+
+	var reports []models.Report
+	if err := applyPage(query, ReportSorts, page, DefaultReportSort).Find(&reports).Error; err != nil {
+		return nil, nil, translateError(err)
+	}
+	reports, next := cutPage(reports, page, DefaultReportSort, reportSortValue, reportID)
+	return reports, next, nil
+}
+
+func (r *pgReportRepo) Create(ctx context.Context, report *models.Report) error {
+	// Задания на разных экземплярах могут собрать один отчёт одновременно:
+	// конфликт по периоду не ошибка БД, а признак, что отчёт уже есть.
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(report)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func (r *pgReportRepo) MarkDelivered(ctx context.Context, id uint, at time.Time) error {
+	result := r.db.WithContext(ctx).Model(&models.Report{}).Where("id = ?", id).Update("delivered_at", at)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type pgPromptRepo struct{ db *gorm.DB }
+
+func (r *pgPromptRepo) GetByID(ctx context.Context, id uint) (*models.JournalPrompt, error) {
+	var prompt models.JournalPrompt
+	if err := r.db.WithContext(ctx).First(&prompt, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &prompt, nil
+}
+
+func (r *pgPromptRepo) List(ctx context.Context, filter PromptFilter) ([]models.JournalPrompt, error) {
+	query := r.db.WithContext(ctx).Model(&models.JournalPrompt{})
+	if filter.Category != "" {
+		query = query.Where("category = ?", filter.Category)
+	}
+	if filter.IsActive != nil {
+		query = query.Where("is_active = ?", *filter.IsActive)
+	}
+
+	var prompts []models.JournalPrompt
+	err := query.Order("category").Order("id").Find(&prompts).Error
+	return prompts, translateError(err)
+}
+
+func (r *pgPromptRepo) Create(ctx context.Context, prompt *models.JournalPrompt) error {
+	return translateError(r.db.WithContext(ctx).Create(prompt).Error)
+}
+
+func (r *pgPromptRepo) Update(ctx context.Context, prompt *models.JournalPrompt) error {
+	return translateError(r.db.WithContext(ctx).Save(prompt).Error)
+}
+
+func (r *pgPromptRepo) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("prompt_id = ?", id).Delete(&models.PromptAssignment{}).Error; err != nil {
+			return translateError(err)
+		}
+		err := tx.Model(&models.Diary{}).Where("prompt_id = ?", id).UpdateColumn("prompt_id", nil).Error
+		if err != nil {
+			return translateError(err)
+		}
+		result := tx.Delete(&models.JournalPrompt{}, id)
+		if result.Error != nil {
+			return translateError(result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (r *pgPromptRepo) Assignment(ctx context.Context, userID uint, day, category string) (*models.PromptAssignment, error) {
+	var assignment models.PromptAssignment
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND day = ? AND category = ?", userID, day, category).
+		First(&assignment).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &assignment, nil
+}
+
+func (r *pgPromptRepo) Assign(ctx context.Context, assignment *models.PromptAssignment) error {
+	// Два параллельных запроса подсказки на день выбирают одновременно:
+	// побеждает первый, второй перечитывает его выбор.
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(assignment)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func (r *pgPromptRepo) LastShown(ctx context.Context, userID uint) (map[uint]string, error) {
+	var rows []struct {
+		PromptID uint
+		Day      string
+	}
+	err := r.db.WithContext(ctx).Model(&models.PromptAssignment{}).
+		Select("prompt_id, MAX(day) AS day").
+		Where("user_id = ?", userID).
+		Group("prompt_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	shown := make(map[uint]string, len(rows))
+	for _, row := range rows {
+		shown[row.PromptID] = row.Day
+	}
+	return shown, nil
+}
+
+func (r *pgPromptRepo) Stats(ctx context.Context, filter PromptStatsFilter) ([]PromptStat, error) {
+	scope := func(query *gorm.DB, column string) *gorm.DB {
+		if filter.From != nil {
+			query = query.Where(column+" >= ?", *filter.From)
+		}
+		if filter.To != nil {
+			query = query.Where(column+" < ?", *filter.To)
+		}
+		return query
+	}
+
+	var shown []PromptStat
+	err := scope(r.db.WithContext(ctx).Model(&models.PromptAssignment{}), "created_at").
+		Select("prompt_id, COUNT(*) AS shown").
+		Group("prompt_id").
+		Scan(&shown).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	var answered []PromptStat
+	err = scope(r.db.WithContext(ctx).Model(&models.Diary{}), "created_at").
+		Select("prompt_id, COUNT(*) AS answered, COUNT(DISTINCT user_id) AS users").
+		Where("prompt_id IS NOT NULL").
+		Group("prompt_id").
+		Scan(&answered).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return mergePromptStats(shown, answered), nil
+}
+
+type pgReminderRepo struct{ db *gorm.DB }
+
+func (r *pgReminderRepo) GetByID(ctx context.Context, id uint) (*models.HabitReminder, error) {
+	var reminder models.HabitReminder
+	if err := r.db.WithContext(ctx).First(&reminder, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &reminder, nil
+}
+
+func (r *pgReminderRepo) List(ctx context.Context, filter ReminderFilter) ([]models.HabitReminder, error) {
+	query := r.db.WithContext(ctx)
+	if filter.HabitID != nil {
+		query = query.Where("habit_id = ?", *filter.HabitID)
+	}
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+
+	reminders := make([]models.HabitReminder, 0)
+	if err := query.Order("remind_at, id").Find(&reminders).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return reminders, nil
+}
+
+// dueRemindersQuery выбирает наступившие напоминания в местном времени
+// владельца. Часовой пояс сверяется с pg_timezone_names: неизвестное
+// PostgreSQL имя иначе сорвало бы весь запрос.
+const dueRemindersQuery = `
+	SELECT r.*, h.title AS habit_title, u.timezone AS timezone
+	FROM habit_reminders r
+	JOIN habits h ON h.id = r.habit_id AND h.is_active
+	JOIN users u ON u.id = r.user_id
+	LEFT JOIN pg_timezone_names tz ON tz.name = NULLIF(u.timezone, '')
+	CROSS JOIN LATERAL (
+		SELECT @now::timestamptz AT TIME ZONE COALESCE(tz.name, 'UTC') AS at
+	) l
+	WHERE l.at::time >= r.remind_at::time
+		AND l.at::time - r.remind_at::time < make_interval(secs => @window)
+		AND (r.days IS NULL OR jsonb_typeof(r.days) <> 'array' OR jsonb_array_length(r.days) = 0
+			OR r.days @> to_jsonb(EXTRACT(ISODOW FROM l.at)::int))
+		AND COALESCE(r.last_sent_on, '') <> to_char(l.at, 'YYYY-MM-DD')
+	ORDER BY r.id`
+
+func (r *pgReminderRepo) Due(ctx context.Context, now time.Time, window time.Duration) ([]ScheduledReminder, error) {
+	var reminders []ScheduledReminder
+	err := r.db.WithContext(ctx).Raw(dueRemindersQuery, map[string]any{
+		"now":    now,
+		"window": window.Seconds(),
+	}).Scan(&reminders).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return reminders, nil
+}
+
+func (r *pgReminderRepo) Create(ctx context.Context, reminder *models.HabitReminder) error {
+	return translateError(r.db.WithContext(ctx).Create(reminder).Error)
+}
+
+func (r *pgReminderRepo) Update(ctx context.Context, reminder *models.HabitReminder) error {
+	result := r.db.WithContext(ctx).Model(reminder).Select("remind_at", "days", "updated_at").Updates(reminder)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *pgReminderRepo) Delete(ctx context.Context, id uint) error {
+	result := r.db.WithContext(ctx).Delete(&models.HabitReminder{}, id)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *pgReminderRepo) DeleteByHabit(ctx context.Context, habitID uint) error {
+	return translateError(r.db.WithContext(ctx).Where("habit_id = ?", habitID).Delete(&models.HabitReminder{}).Error)
+}
+
+// MarkSent — условное обновление: из нескольких экземпляров, отправляющих
+// одно напоминание, строку обновит только один.
+func (r *pgReminderRepo) MarkSent(ctx context.Context, id uint, day string) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.HabitReminder{}).
+		Where("id = ? AND (last_sent_on IS NULL OR last_sent_on <> ?)", id, day).
+		UpdateColumn("last_sent_on", day)
+	if result.Error != nil {
+		return false, translateError(result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+type pgNotificationRepo struct{ db *gorm.DB }
+
+func (r *pgNotificationRepo) GetByID(ctx context.Context, id uint) (*models.Notification, error) {
+	var notification models.Notification
+	if err := r.db.WithContext(ctx).First(&notification, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &notification, nil
+}
+
+func (r *pgNotificationRepo) List(ctx context.Context, filter NotificationFilter, page Page) ([]models.Notification, *Cursor, error) {
+	query := r.db.WithContext(ctx).Where("notifications.user_id = ?", filter.UserID)
+	if filter.Unread {
+		query = query.Where("notifications.read_at IS NULL")
+	}
+
+	var notifications []models.Notification
+	if err := applyPage(query, NotificationSorts, page, DefaultNotificationSort).Find(&notifications).Error; err != nil {
+		return nil, nil, translateError(err)
+	}
+	notifications, next := cutPage(notifications, page, DefaultNotificationSort, notificationSortValue, notificationID)
+	return notifications, next, nil
+}
+
+func (r *pgNotificationRepo) Create(ctx context.Context, notification *models.Notification) error {
+	return translateError(r.db.WithContext(ctx).Create(notification).Error)
+}
+
+func (r *pgNotificationRepo) MarkRead(ctx context.Context, id uint, at time.Time) error {
+	result := r.db.WithContext(ctx).Model(&models.Notification{}).
+		Where("id = ?", id).
+		Update("read_at", gorm.Expr("COALESCE(read_at, ?)", at))
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *pgNotificationRepo) MarkAllRead(ctx context.Context, userID uint, at time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Update("read_at", at)
+	return result.RowsAffected, translateError(result.Error)
+}
+
+func (r *pgNotificationRepo) UnreadCount(ctx context.Context, userID uint) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Count(&count).Error
+	return count, translateError(err)
+}
+
+type pgDeadLetterRepo struct{ db *gorm.DB }
+
+func (r *pgDeadLetterRepo) GetByID(ctx context.Context, id uint) (*models.NotificationDeadLetter, error) {
+	var letter models.NotificationDeadLetter
+	if err := r.db.WithContext(ctx).First(&letter, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &letter, nil
+}
+
+func (r *pgDeadLetterRepo) List(ctx context.Context, filter DeadLetterFilter, page Page) ([]models.NotificationDeadLetter, *Cursor, error) {
+	query := r.db.WithContext(ctx)
+	if filter.UserID != nil {
+		query = query.Where("notification_dead_letters.user_id = ?", *filter.UserID)
+	}
+	if filter.Channel != "" {
+		query = query.Where("notification_dead_letters.channel = ?", filter.Channel)
+	}
+
+	var letters []models.NotificationDeadLetter
+	if err := applyPage(query, DeadLetterSorts, page, DefaultDeadLetterSort).Find(&letters).Error; err != nil {
+		return nil, nil, translateError(err)
+	}
+	letters, next := cutPage(letters, page, DefaultDeadLetterSort, deadLetterSortValue, deadLetterID)
+	return letters, next, nil
+}
+
+func (r *pgDeadLetterRepo) Create(ctx context.Context, letter *models.NotificationDeadLetter) error {
+	return translateError(r.db.WithContext(ctx).Create(letter).Error)
+}
+
+func (r *pgDeadLetterRepo) Update(ctx context.Context, letter *models.NotificationDeadLetter) error {
+	result := r.db.WithContext(ctx).Model(letter).Select("attempts", "last_error", "updated_at").Updates(letter)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *pgDeadLetterRepo) Delete(ctx context.Context, id uint) error {
+	result := r.db.WithContext(ctx).Delete(&models.NotificationDeadLetter{}, id)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,358 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCursor — курсор повреждён или выдан для другой сортировки.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// SortFields — поля, по которым разрешено сортировать ресурс, и их колонки в БД.
+// Сортировка по произвольной колонке не допускается: поле из запроса
+// попадает в ORDER BY только через этот список.
+type SortFields map[string]string
+
+var (
+	HabitSorts = SortFields{
+		"id":         "habits.id",
+		"title":      "habits.title",
+		"created_at": "habits.created_at",
+		"updated_at": "habits.updated_at",
+	}
+	HabitLogSorts = SortFields{
+		"id":   "habit_logs.id",
+		"date": "habit_logs.date",
+	}
+	DiarySorts = SortFields{
+		"id":         "diaries.id",
+		"title":      "diaries.title",
+		"created_at": "diaries.created_at",
+		"updated_at": "diaries.updated_at",
+	}
+	UserSorts = SortFields{
+		"id":         "users.id",
+		"username":   "users.username",
+		"created_at": "users.created_at",
+	}
+	ReportSorts = SortFields{
+		"id":           "reports.id",
+		"period_start": "reports.period_start",
+	}
+	DeadLetterSorts = SortFields{
+		"id":         "notification_dead_letters.id",
+		"created_at": "notification_dead_letters.created_at",
+	}
+	NotificationSorts = SortFields{
+		"id":         "notifications.id",
+		"created_at": "notifications.created_at",
+	}
+)
+
+// Сортировка по умолчанию совпадает с порядком, который списки отдавали
+// до появления пагинации.
+var (
+	DefaultHabitSort        = Sort{Field: "id"}
+	DefaultHabitLogSort     = Sort{Field: "date", Desc: true}
+	DefaultDiarySort        = Sort{Field: "created_at", Desc: true}
+	DefaultUserSort         = Sort{Field: "id"}
+	DefaultReportSort       = Sort{Field: "period_start", Desc: true}
+	DefaultDeadLetterSort   = Sort{Field: "created_at", Desc: true}
+	DefaultNotificationSort = Sort{Field: "created_at", Desc: true}
+)
+
+// Sort — поле сортировки и направление. В запросе записывается как
+// "field" или "-field" для обратного порядка.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+func (s Sort) String() string {
+	if s.Desc {
+		return "-" + s.Field
+	}
+	return s.Field
+}
+
+// Parse разбирает сортировку из запроса; пустая строка даёт def.
+func (f SortFields) Parse(raw string, def Sort) (Sort, error) {
+	if raw == "" {
+		return def, nil
+	}
+	s := Sort{Field: strings.TrimPrefix(raw, "-"), Desc: strings.HasPrefix(raw, "-")}
+	if _, ok := f[s.Field]; !ok {
+		return Sort{}, fmt.Errorf("sort by %q is not allowed", s.Field)
+	}
+	return s, nil
+}
+
+// Page — окно keyset-пагинации. Нулевое значение — вся выборка в порядке
+// по умолчанию, так что внутренние вызовы могут не думать о страницах.
+type Page struct {
+	// Limit — размер страницы; 0 — без ограничения.
+	Limit int
+	// Sort — пустое поле означает сортировку ресурса по умолчанию.
+	Sort Sort
+	// After — позиция последней записи предыдущей страницы.
+	After *Cursor
+}
+
+func (p Page) sort(def Sort) Sort {
+	if p.Sort.Field == "" {
+		return def
+	}
+	return p.Sort
+}
+
+// Cursor указывает на последнюю отданную запись: значение поля сортировки
+// и id, который разрешает совпадения значений. В отличие от OFFSET, курсор
+// не пропускает и не повторяет записи при вставках между запросами.
+type Cursor struct {
+	Sort  Sort
+	Value any // time.Time, string или int64
+	ID    uint
+}
+
+type cursorJSON struct {
+	Sort  string `json:"s"`
+	Kind  string `json:"k"`
+	Value string `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+// Encode возвращает непрозрачную строку для параметра cursor.
+func (c Cursor) Encode() string {
+	raw := cursorJSON{Sort: c.Sort.String(), ID: c.ID}
+	switch v := c.Value.(type) {
+	case time.Time:
+		raw.Kind, raw.Value = "t", v.UTC().Format(time.RFC3339Nano)
+	case string:
+		raw.Kind, raw.Value = "s", v
+	case int64:
+		raw.Kind, raw.Value = "i", strconv.FormatInt(v, 10)
+	}
+	data, _ := json.Marshal(raw)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor разбирает курсор и проверяет, что его поле есть в fields.
+func DecodeCursor(s string, fields SortFields) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var raw cursorJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	sort, err := fields.Parse(raw.Sort, Sort{})
+	if err != nil || sort.Field == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	c := &Cursor{Sort: sort, ID: raw.ID}
+	switch raw.Kind {
+	case "t":
+		c.Value, err = time.Parse(time.RFC3339Nano, raw.Value)
+	case "s":
+		c.Value = raw.Value
+	case "i":
+		c.Value, err = strconv.ParseInt(raw.Value, 10, 64)
+	default:
+		err = ErrInvalidCursor
+	}
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// sortValue возвращает значение поля сортировки записи. Поля совпадают
+// с ключами SortFields соответствующего ресурса.
+type sortValue[T any] func(item T, field string) any
+
+func habitSortValue(h models.Habit, field string) any {
+	switch field {
+	case "title":
+		return h.Title
+	case "created_at":
+		return h.CreatedAt
+	case "updated_at":
+		return h.UpdatedAt
+	default:
+		return int64(h.ID)
+	}
+}
+
+func habitLogSortValue(l models.HabitLog, field string) any {
+	if field == "date" {
+		return l.Date
+	}
+	return int64(l.ID)
+}
+
+func diarySortValue(d models.Diary, field string) any {
+	switch field {
+	case "title":
+		return d.Title
+	case "created_at":
+		return d.CreatedAt
+	case "updated_at":
+		return d.UpdatedAt
+	default:
+		return int64(d.ID)
+	}
+}
+
+func userSortValue(u models.User, field string) any {
+	switch field {
+	case "username":
+		return u.Username
+	case "created_at":
+		return u.CreatedAt
+	default:
+		return int64(u.ID)
+	}
+}
+
+func reportSortValue(r models.Report, field string) any {
+	if field == "period_start" {
+		return r.PeriodStart
+	}
+	return int64(r.ID)
+}
+
+func deadLetterSortValue(l models.NotificationDeadLetter, field string) any {
+	if field == "created_at" {
+		return l.CreatedAt
+	}
+	return int64(l.ID)
+}
+
+func notificationSortValue(n models.Notification, field string) any {
+	if field == "created_at" {
+		return n.CreatedAt
+	}
+	return int64(n.ID)
+}
+
+// applyPage добавляет к запросу условие курсора, порядок и лимит.
+// Запрашивается на одну запись больше лимита, чтобы узнать, есть ли
+// следующая страница (см. cutPage).
+func applyPage(query *gorm.DB, fields SortFields, p Page, def Sort) *gorm.DB {
+	s := p.sort(def)
+	column, idColumn := fields[s.Field], fields["id"]
+
+	op, dir := ">", "ASC"
+	if s.Desc {
+		op, dir = "<", "DESC"
+	}
+
+	if p.After != nil {
+		if s.Field == "id" {
+			query = query.Where(fmt.Sprintf("%s %s ?", idColumn, op), p.After.ID)
+		} else {
+			query = query.Where(fmt.Sprintf("(%s, %s) %s (?, ?)", column, idColumn, op), p.After.Value, p.After.ID)
+		}
+	}
+
+	query = query.Order(column + " " + dir)
+	if s.Field != "id" {
+		query = query.Order(idColumn + " " + dir)
+	}
+	if p.Limit > 0 {
+		query = query.Limit(p.Limit + 1)
+	}
+	return query
+}
+
+// pageSlice — то же, что applyPage, для данных в памяти.
+func pageSlice[T any](items []T, p Page, def Sort, value sortValue[T], id func(T) uint) []T {
+	s := p.sort(def)
+	less := func(a, b T) bool {
+		c := compareValues(value(a, s.Field), value(b, s.Field))
+		if c == 0 {
+			c = compareValues(int64(id(a)), int64(id(b)))
+		}
+		if s.Desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	sort.Slice(items, func(i, j int) bool { return less(items[i], items[j]) })
+
+	if p.After != nil {
+		start := sort.Search(len(items), func(i int) bool {
+			c := compareValues(value(items[i], s.Field), p.After.Value)
+			if s.Field == "id" || c == 0 {
+				c = compareValues(int64(id(items[i])), int64(p.After.ID))
+			}
+			if s.Desc {
+				return c < 0
+			}
+			return c > 0
+		})
+		items = items[start:]
+	}
+
+	if p.Limit > 0 && len(items) > p.Limit+1 {
+		items = items[:p.Limit+1]
+	}
+	return items
+}
+
+// cutPage отрезает лишнюю запись, запрошенную applyPage или pageSlice,
+// и возвращает курсор следующей страницы; nil — страница последняя.
+func cutPage[T any](items []T, p Page, def Sort, value sortValue[T], id func(T) uint) ([]T, *Cursor) {
+	if p.Limit <= 0 || len(items) <= p.Limit {
+		return items, nil
+	}
+
+	items = items[:p.Limit]
+	last := items[len(items)-1]
+	s := p.sort(def)
+	return items, &Cursor{Sort: s, Value: value(last, s.Field), ID: id(last)}
+}
+
+func compareValues(a, b any) int {
+	switch x := a.(type) {
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y)
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y)
+		}
+	case int64:
+		if y, ok := b.(int64); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+func habitID(h models.Habit) uint                       { return h.ID }
+func habitLogID(l models.HabitLog) uint                 { return l.ID }
+func diaryID(d models.Diary) uint                       { return d.ID }
+func userID(u models.User) uint                         { return u.ID }
+func reportID(r models.Report) uint                     { return r.ID }
+func deadLetterID(l models.NotificationDeadLetter) uint { return l.ID }
+func notificationID(n models.Notification) uint         { return n.ID }
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+)
+
+func TestMemoryStorePaginatesWithTies(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	// Одинаковые created_at: порядок внутри группы задаёт id.
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 7; i++ {
+		diary := models.Diary{UserID: 1, Title: "entry", CreatedAt: day.AddDate(0, 0, i/3)}
+		if err := store.Diaries().Create(ctx, &diary); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		seen  []uint
+		page  = Page{Limit: 3}
+		pages int
+	)
+	for {
+		diaries, next, err := store.Diaries().List(ctx, DiaryFilter{}, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range diaries {
+			seen = append(seen, d.ID)
+		}
+		pages++
+		if next == nil {
+			break
+		}
+
+		// Курсор переживает кодирование в строку запроса.
+		page.After, err = DecodeCursor(next.Encode(), DiarySorts)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if pages != 3 || len(seen) != 7 {
+		t.Fatalf("pages = %d, seen = %v", pages, seen)
+	}
+	want := []uint{7, 6, 5, 4, 3, 2, 1}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Fatalf("order = %v, want %v", seen, want)
+		}
+	}
+}
+
+func TestMemoryStoreHabitFiltersAndLogsLimit(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	for _, title := range []string{"b", "a", "c"} {
+		habit := models.Habit{UserID: 1, Title: title, Frequency: "daily", IsActive: title != "c"}
+		if err := store.Habits().Create(ctx, &habit); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 5; i++ {
+			log := models.HabitLog{HabitID: habit.ID, Date: time.Now().AddDate(0, 0, -i)}
+			if err := store.HabitLogs().Create(ctx, &log); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	active := true
+	habits, next, err := store.Habits().List(ctx,
+		HabitFilter{IsActive: &active, WithLogs: true, LogsLimit: 2},
+		Page{Limit: 10, Sort: Sort{Field: "title"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != nil || len(habits) != 2 || habits[0].Title != "a" || habits[1].Title != "b" {
+		t.Fatalf("unexpected page: %+v, next = %+v", habits, next)
+	}
+	for _, habit := range habits {
+		if len(habit.Logs) != 2 {
+			t.Fatalf("habit %q has %d logs, want 2", habit.Title, len(habit.Logs))
+		}
+		if time.Since(habit.Logs[0].Date) > 49*time.Hour {
+			t.Fatalf("kept an old log: %+v", habit.Logs)
+		}
+	}
+}
+
+func TestDecodeCursorRejectsUnknownSort(t *testing.T) {
+	cursor := Cursor{Sort: Sort{Field: "password_hash"}, Value: "x", ID: 1}.Encode()
+	if _, err := DecodeCursor(cursor, UserSorts); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("err = %v, want ErrInvalidCursor", err)
+	}
+	if _, err := DecodeCursor("not-a-cursor", UserSorts); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("err = %v, want ErrInvalidCursor", err)
+	}
+}
@@ -0,0 +1,500 @@
+// Package repository описывает доступ к данным приложения.
+// Хендлеры и сервисы получают Store через конструкторы и не обращаются
+// к глобальному db.DB, поэтому Postgres можно заменить in-memory реализацией.
+package repository
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"html"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+)
+
+var (
+	ErrNotFound  = errors.New("record not found")
+	ErrDuplicate = errors.New("duplicate record")
+)
+
+// UserFilter ограничивает выборку пользователей. Нулевое значение — все.
+type UserFilter struct {
+	Role   string
+	CityID *uint
+}
+
+type UserRepository interface {
+	GetByID(ctx context.Context, id uint) (*models.User, error)
+	GetByUsername(ctx context.Context, username string) (*models.User, error)
+	// List возвращает пользователей с подгруженным City.
+	List(ctx context.Context, filter UserFilter, page Page) ([]models.User, *Cursor, error)
+	Create(ctx context.Context, user *models.User) error
+	Update(ctx context.Context, user *models.User) error
+}
+
+// HabitFilter ограничивает выборку привычек. Нулевое значение — все привычки.
+type HabitFilter struct {
+	UserID    *uint
+	IsActive  *bool
+	Frequency string
+	// CreatedFrom и CreatedTo ограничивают created_at: [from, to).
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+
+	WithLogs bool
+	// LogsLimit оставляет у каждой привычки только столько последних логов;
+	// 0 — все логи.
+	LogsLimit int
+	WithUser  bool
+}
+
+type HabitRepository interface {
+	GetByID(ctx context.Context, id uint) (*models.Habit, error)
+	// GetForUpdate читает привычку с блокировкой строки до конца транзакции.
+	GetForUpdate(ctx context.Context, id uint) (*models.Habit, error)
+	List(ctx context.Context, filter HabitFilter, page Page) ([]models.Habit, *Cursor, error)
+	Create(ctx context.Context, habit *models.Habit) error
+	Update(ctx context.Context, habit *models.Habit) error
+	Delete(ctx context.Context, id uint) error
+	// SetActive возвращает количество обновлённых привычек.
+	SetActive(ctx context.Context, ids []uint, isActive bool) (int64, error)
+}
+
+// HabitLogStats — агрегаты по логам одной привычки. Серия — подряд идущие
+// выполненные логи в порядке дат; текущая серия начинается с последнего лога.
+type HabitLogStats struct {
+	HabitID       uint
+	IsActive      bool
+	TotalLogs     int
+	CompletedLogs int
+	CurrentStreak int
+	LongestStreak int
+}
+
+// HabitLogFilter ограничивает выборку логов. UserID фильтрует по владельцу привычки.
+type HabitLogFilter struct {
+	HabitID     *uint
+	UserID      *uint
+	IsCompleted *bool
+	// From и To ограничивают дату лога: [from, to).
+	From *time.Time
+	To   *time.Time
+
+	WithHabit bool
+}
+
+// CalendarFilter задаёт диапазон календаря. From и To — первый и последний
+// день включительно; границы дней считаются в Location.
+type CalendarFilter struct {
+	HabitID  *uint
+	UserID   *uint
+	From     time.Time
+	To       time.Time
+	Location *time.Location
+}
+
+// bounds переводит дни календаря в полуинтервал моментов времени [start, end).
+func (f CalendarFilter) bounds() (time.Time, time.Time) {
+	return dayBounds(f.From, f.To, f.Location)
+}
+
+// dayBounds возвращает начало дня from и конец дня to в часовом поясе loc.
+func dayBounds(from, to time.Time, loc *time.Location) (time.Time, time.Time) {
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	end := time.Date(to.Year(), to.Month(), to.Day()+1, 0, 0, 0, 0, loc)
+	return start, end
+}
+
+// DayActivity — отметки за один день календаря.
+type DayActivity struct {
+	Date      string `json:"date"` // YYYY-MM-DD
+	Total     int    `json:"total"`
+	Completed int    `json:"completed"`
+}
+
+// HourActivity — отметки, сделанные в один час суток.
+type HourActivity struct {
+	Hour      int `json:"hour"`
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+}
+
+// HabitDay — отметки одной привычки за день календаря.
+type HabitDay struct {
+	HabitID   uint   `json:"habit_id"`
+	Date      string `json:"date"` // YYYY-MM-DD
+	Total     int    `json:"total"`
+	Completed int    `json:"completed"`
+}
+
+type HabitLogRepository interface {
+	GetByID(ctx context.Context, id uint) (*models.HabitLog, error)
+	Create(ctx context.Context, log *models.HabitLog) error
+	// UpdateNote меняет только заметку: дата и статус отметки входят
+	// в сводки и после создания не меняются.
+	UpdateNote(ctx context.Context, id uint, note string) error
+	// List по умолчанию сортирует логи по дате от новых к старым.
+	List(ctx context.Context, filter HabitLogFilter, page Page) ([]models.HabitLog, *Cursor, error)
+	// Calendar считает отметки по дням диапазона; дни без отметок тоже
+	// попадают в результат.
+	Calendar(ctx context.Context, filter CalendarFilter) ([]DayActivity, error)
+	// Hours раскладывает отметки диапазона по часу суток в filter.Location;
+	// всегда возвращает 24 строки.
+	Hours(ctx context.Context, filter CalendarFilter) ([]HourActivity, error)
+	// HabitDays считает отметки по привычкам и дням в filter.Location;
+	// возвращаются только пары с отметками, по привычке и дате.
+	HabitDays(ctx context.Context, filter CalendarFilter) ([]HabitDay, error)
+	DeleteByHabit(ctx context.Context, habitID uint) error
+}
+
+type DiaryFilter struct {
+	UserID *uint
+	// From и To ограничивают created_at: [from, to).
+	From *time.Time
+	To   *time.Time
+	// Tag оставляет записи с этим тегом.
+	Tag string
+	// HabitID оставляет записи, связанные с привычкой.
+	HabitID *uint
+	// PromptID оставляет записи, отвечающие на подсказку.
+	PromptID *uint
+}
+
+// DiaryHit — запись, найденная полнотекстовым поиском. Headline и Snippet —
+// заголовок и фрагменты текста, экранированные для HTML, с совпадениями
+// в <mark>.
+type DiaryHit struct {
+	models.Diary
+	Rank     float64 `json:"rank"`
+	Headline string  `json:"headline"`
+	Snippet  string  `json:"snippet"`
+}
+
+// MoodFilter — записи пользователя за дни From..To включительно; границы
+// дней считаются в Location.
+type MoodFilter struct {
+	UserID   uint
+	From     time.Time
+	To       time.Time
+	Location *time.Location
+}
+
+// MoodDay — средние настроение и энергия записей за день. Среднее nil,
+// если ни в одной записи дня оценка не указана.
+type MoodDay struct {
+	Date     string         `json:"date"` // YYYY-MM-DD
+	Entries  int            `json:"entries"`
+	Mood     *float64       `json:"mood"`
+	Energy   *float64       `json:"energy"`
+	Emotions map[string]int `json:"emotions"`
+}
+
+type DiaryRepository interface {
+	GetByID(ctx context.Context, id uint) (*models.Diary, error)
+	// GetForUpdate блокирует строку до конца транзакции.
+	GetForUpdate(ctx context.Context, id uint) (*models.Diary, error)
+	// List по умолчанию сортирует записи по created_at от новых к старым.
+	List(ctx context.Context, filter DiaryFilter, page Page) ([]models.Diary, *Cursor, error)
+	Count(ctx context.Context, filter DiaryFilter) (int64, error)
+	// MoodTimeline возвращает только дни, в которые есть записи, по порядку.
+	MoodTimeline(ctx context.Context, filter MoodFilter) ([]MoodDay, error)
+	// Search ищет записи по запросу в синтаксисе websearch и возвращает не
+	// больше limit лучших по релевантности; при равной — более новые.
+	Search(ctx context.Context, filter DiaryFilter, query string, limit int) ([]DiaryHit, error)
+	Create(ctx context.Context, diary *models.Diary) error
+	Update(ctx context.Context, diary *models.Diary) error
+	// UnlinkHabit снимает связь записей с привычкой и её отметками.
+	UnlinkHabit(ctx context.Context, habitID uint) error
+	Delete(ctx context.Context, id uint) error
+}
+
+// DiaryRevisionRepository хранит ревизии записей дневника. Create присваивает
+// следующий номер; вызывающий держит блокировку записи, чтобы номера
+// не пересеклись.
+type DiaryRevisionRepository interface {
+	// List возвращает ревизии записи по возрастанию номера.
+	List(ctx context.Context, diaryID uint) ([]models.DiaryRevision, error)
+	Get(ctx context.Context, diaryID uint, number int) (*models.DiaryRevision, error)
+	// Latest возвращает последнюю ревизию или ErrNotFound, если их нет.
+	Latest(ctx context.Context, diaryID uint) (*models.DiaryRevision, error)
+	Create(ctx context.Context, rev *models.DiaryRevision) error
+	DeleteByDiary(ctx context.Context, diaryID uint) error
+}
+
+type DiaryAttachmentRepository interface {
+	GetByID(ctx context.Context, id uint) (*models.DiaryAttachment, error)
+	// ListByDiary возвращает вложения записи в порядке загрузки.
+	ListByDiary(ctx context.Context, diaryID uint) ([]models.DiaryAttachment, error)
+	// Usage — суммарный размер вложений пользователя в байтах.
+	Usage(ctx context.Context, userID uint) (int64, error)
+	Create(ctx context.Context, attachment *models.DiaryAttachment) error
+	Delete(ctx context.Context, id uint) error
+	// DeleteByDiary удаляет вложения записи и возвращает их, чтобы
+	// вызывающий мог убрать файлы из хранилища.
+	DeleteByDiary(ctx context.Context, diaryID uint) ([]models.DiaryAttachment, error)
+}
+
+// PromptFilter ограничивает выборку подсказок. Нулевое значение — все.
+type PromptFilter struct {
+	Category string
+	IsActive *bool
+}
+
+// PromptStatsFilter ограничивает время выдачи подсказок и создания
+// записей: [From, To).
+type PromptStatsFilter struct {
+	From *time.Time
+	To   *time.Time
+}
+
+// PromptStat — сколько раз подсказку выдавали, сколько записей на неё
+// ответили и сколько разных пользователей.
+type PromptStat struct {
+	PromptID uint
+	Shown    int
+	Answered int
+	Users    int
+}
+
+type PromptRepository interface {
+	GetByID(ctx context.Context, id uint) (*models.JournalPrompt, error)
+	// List сортирует подсказки по категории и id.
+	List(ctx context.Context, filter PromptFilter) ([]models.JournalPrompt, error)
+	Create(ctx context.Context, prompt *models.JournalPrompt) error
+	Update(ctx context.Context, prompt *models.JournalPrompt) error
+	// Delete удаляет подсказку вместе с историей её выдачи и отвязывает от
+	// неё записи дневника.
+	Delete(ctx context.Context, id uint) error
+	// Assignment возвращает подсказку, выданную пользователю на день, или
+	// ErrNotFound.
+	Assignment(ctx context.Context, userID uint, day, category string) (*models.PromptAssignment, error)
+	// Assign сохраняет выдачу; если на этот день и категорию подсказка уже
+	// выдана, возвращает ErrDuplicate.
+	Assign(ctx context.Context, assignment *models.PromptAssignment) error
+	// LastShown возвращает последний день выдачи каждой подсказки пользователю.
+	LastShown(ctx context.Context, userID uint) (map[uint]string, error)
+	// Stats возвращает строки только для подсказок с выдачами или ответами,
+	// по id подсказки.
+	Stats(ctx context.Context, filter PromptStatsFilter) ([]PromptStat, error)
+}
+
+// AchievementFilter ограничивает выборку достижений. Нулевое значение — все.
+type AchievementFilter struct {
+	UserID *uint
+	// From и To ограничивают earned_at: [from, to).
+	From *time.Time
+	To   *time.Time
+}
+
+type AchievementRepository interface {
+	// List сортирует достижения по времени получения.
+	List(ctx context.Context, filter AchievementFilter) ([]models.Achievement, error)
+	Create(ctx context.Context, achievement *models.Achievement) error
+}
+
+// ReportFilter ограничивает выборку отчётов. Нулевое значение — все.
+type ReportFilter struct {
+	UserID *uint
+	Period string
+}
+
+type ReportRepository interface {
+	GetByID(ctx context.Context, id uint) (*models.Report, error)
+	// List по умолчанию сортирует отчёты от новых периодов к старым.
+	List(ctx context.Context, filter ReportFilter, page Page) ([]models.Report, *Cursor, error)
+	// Create возвращает ErrDuplicate, если отчёт пользователя за этот период уже есть.
+	Create(ctx context.Context, report *models.Report) error
+	MarkDelivered(ctx context.Context, id uint, at time.Time) error
+}
+
+// ReminderFilter ограничивает выборку напоминаний. Нулевое значение — все.
+type ReminderFilter struct {
+	HabitID *uint
+	UserID  *uint
+}
+
+// ScheduledReminder — наступившее напоминание активной привычки вместе с тем,
+// что нужно планировщику: названием привычки и часовым поясом владельца.
+type ScheduledReminder struct {
+	models.HabitReminder
+	HabitTitle string
+	Timezone   string
+}
+
+type ReminderRepository interface {
+	GetByID(ctx context.Context, id uint) (*models.HabitReminder, error)
+	// List сортирует напоминания по времени, затем по id.
+	List(ctx context.Context, filter ReminderFilter) ([]models.HabitReminder, error)
+	// Due возвращает по id напоминания активных привычек, время которых
+	// наступило к now в часовом поясе владельца не раньше чем window назад
+	// и которые в этот местный день ещё не отправлялись. Пустой или
+	// неизвестный часовой пояс считается UTC.
+	Due(ctx context.Context, now time.Time, window time.Duration) ([]ScheduledReminder, error)
+	Create(ctx context.Context, reminder *models.HabitReminder) error
+	// Update меняет только время и дни: отметку об отправке ведёт MarkSent.
+	Update(ctx context.Context, reminder *models.HabitReminder) error
+	Delete(ctx context.Context, id uint) error
+	DeleteByHabit(ctx context.Context, habitID uint) error
+	// MarkSent отмечает отправку за местный день day. false — напоминание
+	// в этот день уже отправлено, например другим экземпляром сервера.
+	MarkSent(ctx context.Context, id uint, day string) (bool, error)
+}
+
+// NotificationFilter — входящие пользователя UserID; Unread оставляет
+// только непрочитанные.
+type NotificationFilter struct {
+	UserID uint
+	Unread bool
+}
+
+type NotificationRepository interface {
+	GetByID(ctx context.Context, id uint) (*models.Notification, error)
+	// List по умолчанию сортирует от новых к старым.
+	List(ctx context.Context, filter NotificationFilter, page Page) ([]models.Notification, *Cursor, error)
+	Create(ctx context.Context, notification *models.Notification) error
+	// MarkRead отмечает уведомление прочитанным в at; у прочитанного
+	// раньше время не меняется.
+	MarkRead(ctx context.Context, id uint, at time.Time) error
+	// MarkAllRead отмечает прочитанными все уведомления пользователя
+	// и возвращает, сколько из них были непрочитанными.
+	MarkAllRead(ctx context.Context, userID uint, at time.Time) (int64, error)
+	UnreadCount(ctx context.Context, userID uint) (int64, error)
+}
+
+// DeadLetterFilter ограничивает выборку недоставленных уведомлений.
+// Нулевое значение — все.
+type DeadLetterFilter struct {
+	UserID  *uint
+	Channel string
+}
+
+type DeadLetterRepository interface {
+	GetByID(ctx context.Context, id uint) (*models.NotificationDeadLetter, error)
+	// List по умолчанию сортирует от новых к старым.
+	List(ctx context.Context, filter DeadLetterFilter, page Page) ([]models.NotificationDeadLetter, *Cursor, error)
+	Create(ctx context.Context, letter *models.NotificationDeadLetter) error
+	// Update сохраняет число попыток и последнюю ошибку.
+	Update(ctx context.Context, letter *models.NotificationDeadLetter) error
+	Delete(ctx context.Context, id uint) error
+}
+
+type CityRepository interface {
+	GetByID(ctx context.Context, id uint) (*models.City, error)
+	List(ctx context.Context) ([]models.City, error)
+	Count(ctx context.Context) (int64, error)
+	CreateBatch(ctx context.Context, cities []models.City) error
+}
+
+type RateLimitOverrideRepository interface {
+	List(ctx context.Context) ([]models.RateLimitOverride, error)
+	// Upsert создаёт или обновляет запись по Subject.
+	Upsert(ctx context.Context, override *models.RateLimitOverride) error
+	Delete(ctx context.Context, id uint) error
+}
+
+// RollupRepository ведёт сводки по логам: по привычке за день и по
+// пользователю за неделю. Дни считаются в UTC, неделя начинается в понедельник.
+type RollupRepository interface {
+	// ApplyLog учитывает новый лог привычки пользователя userID. Лог должен
+	// быть самым поздним у своей привычки, как в LogHabit; иначе серии
+	// окажутся неточными до следующего Rebuild.
+	ApplyLog(ctx context.Context, userID uint, log models.HabitLog) error
+	// DeleteHabit убирает сводки удалённой привычки.
+	DeleteHabit(ctx context.Context, userID, habitID uint) error
+	// Rebuild пересчитывает сводки из логов; userID == nil — для всех
+	// пользователей. Транзакциями управляет сам: полная пересборка идёт
+	// отдельной транзакцией на каждого пользователя.
+	Rebuild(ctx context.Context, userID *uint) error
+	// Stats возвращает итоги и серии по всем привычкам пользователя.
+	// Привычки без логов тоже попадают в результат; порядок — по id.
+	Stats(ctx context.Context, userID uint) ([]HabitLogStats, error)
+	// Daily возвращает дневные сводки в порядке дня и id привычки.
+	Daily(ctx context.Context, filter RollupFilter) ([]models.HabitDailyRollup, error)
+	// Weekly возвращает недельные сводки недель, пересекающих диапазон, по порядку.
+	Weekly(ctx context.Context, filter RollupFilter) ([]models.UserWeeklyRollup, error)
+}
+
+// RollupFilter — сводки пользователя за дни From..To включительно (UTC).
+type RollupFilter struct {
+	UserID uint
+	From   time.Time
+	To     time.Time
+}
+
+// dayStart возвращает полночь дня t в UTC.
+func dayStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// weekStart возвращает понедельник недели t, как date_trunc('week') в Postgres.
+func weekStart(t time.Time) time.Time {
+	day := dayStart(t)
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+type Store interface {
+	Users() UserRepository
+	Habits() HabitRepository
+	HabitLogs() HabitLogRepository
+	Diaries() DiaryRepository
+	DiaryRevisions() DiaryRevisionRepository
+	Attachments() DiaryAttachmentRepository
+	Prompts() PromptRepository
+	Cities() CityRepository
+	RateLimitOverrides() RateLimitOverrideRepository
+	Rollups() RollupRepository
+	Achievements() AchievementRepository
+	Reports() ReportRepository
+	Reminders() ReminderRepository
+	Notifications() NotificationRepository
+	DeadLetters() DeadLetterRepository
+
+	// Transaction выполняет fn атомарно: репозитории переданного tx
+	// работают внутри транзакции, ошибка из fn откатывает все изменения.
+	Transaction(ctx context.Context, fn func(tx Store) error) error
+	Ping(ctx context.Context) error
+}
+
+// Маркеры совпадений в Headline и Snippet до экранирования. Управляющие
+// символы не встречаются в тексте записей, поэтому не путаются с ним.
+const (
+	markStart     = "\x01"
+	markStop      = "\x02"
+	markStartRune = '\x01'
+	markStopRune  = '\x02'
+)
+
+var markReplacer = strings.NewReplacer(markStart, "<mark>", markStop, "</mark>")
+
+// highlight экранирует текст с маркерами и заменяет маркеры на <mark>.
+func highlight(s string) string {
+	return markReplacer.Replace(html.EscapeString(s))
+}
+
+// mergePromptStats объединяет выдачи и ответы по id подсказки.
+func mergePromptStats(shown, answered []PromptStat) []PromptStat {
+	byPrompt := make(map[uint]*PromptStat, len(shown)+len(answered))
+	for _, rows := range [][]PromptStat{shown, answered} {
+		for _, row := range rows {
+			stat, ok := byPrompt[row.PromptID]
+			if !ok {
+				stat = &PromptStat{PromptID: row.PromptID}
+				byPrompt[row.PromptID] = stat
+			}
+			stat.Shown += row.Shown
+			stat.Answered += row.Answered
+			stat.Users += row.Users
+		}
+	}
+
+	stats := make([]PromptStat, 0, len(byPrompt))
+	for _, stat := range byPrompt {
+		stats = append(stats, *stat)
+	}
+	slices.SortFunc(stats, func(a, b PromptStat) int { return cmp.Compare(a.PromptID, b.PromptID) })
+	return stats
+}
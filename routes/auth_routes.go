@@ -1,13 +1,16 @@
 package routes
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"net/mail"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/Bekzhanizb/HabitTrackerBackend/db"
 	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
 	"github.com/Bekzhanizb/HabitTrackerBackend/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -24,7 +27,17 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
-func Login(c *gin.Context) {
+// AccountHandler обслуживает вход и профиль текущего пользователя.
+type AccountHandler struct {
+	users  repository.UserRepository
+	cities repository.CityRepository
+}
+
+func NewAccountHandler(users repository.UserRepository, cities repository.CityRepository) *AccountHandler {
+	return &AccountHandler{users: users, cities: cities}
+}
+
+func (h *AccountHandler) Login(c *gin.Context) {
 	var input struct {
 		Username string `json:"username" binding:"required"`
 		Password string `json:"password" binding:"required"`
@@ -36,9 +49,8 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	result := db.DB.Where("username = ?", input.Username).First(&user)
-	if result.Error != nil {
+	user, err := h.users.GetByUsername(c.Request.Context(), input.Username)
+	if err != nil {
 		utils.Logger.Warn("login_user_not_found", zap.String("username", input.Username))
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
@@ -77,7 +89,7 @@ func Login(c *gin.Context) {
 	})
 }
 
-func UpdateProfile(c *gin.Context) {
+func (h *AccountHandler) UpdateProfile(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
@@ -101,19 +113,51 @@ func UpdateProfile(c *gin.Context) {
 	if username != "" && username != currentUser.Username {
 		currentUser.Username = username
 	}
+	// email — адрес для уведомлений; пустое значение удаляет его.
+	if email, ok := c.GetPostForm("email"); ok {
+		email = strings.TrimSpace(email)
+		if email != "" {
+			addr, err := mail.ParseAddress(email)
+			if err != nil || addr.Address != email || len(email) > 254 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email"})
+				return
+			}
+		}
+		currentUser.Email = email
+	}
+	// timezone — часовой пояс IANA для напоминаний; пустое значение — UTC.
+	if tz, ok := c.GetPostForm("timezone"); ok {
+		tz = strings.TrimSpace(tz)
+		if tz != "" {
+			if _, err := time.LoadLocation(tz); err != nil || tz == "Local" || len(tz) > 64 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+				return
+			}
+		}
+		currentUser.Timezone = tz
+	}
 	if cityID != "" {
-		var city models.City
-		if err := db.DB.First(&city, cityID).Error; err == nil {
-			currentUser.CityID = &city.ID
+		if id, err := strconv.ParseUint(cityID, 10, 64); err == nil {
+			if city, err := h.cities.GetByID(c.Request.Context(), uint(id)); err == nil {
+				currentUser.CityID = &city.ID
+			}
 		}
 	}
 
-	db.DB.Save(&currentUser)
+	if err := h.users.Update(c.Request.Context(), &currentUser); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Username already taken"})
+			return
+		}
+		utils.Logger.Error("profile_update_failed", zap.Error(err), zap.Uint("user_id", currentUser.ID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
 	utils.Logger.Info("profile_updated", zap.Uint("user_id", currentUser.ID))
 	c.JSON(http.StatusOK, gin.H{"message": "Profile updated", "user": currentUser})
 }
 
-func Profile(c *gin.Context) {
+func (h *AccountHandler) Profile(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
@@ -0,0 +1,302 @@
+package routes
+
+import (
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/cache"
+	"github.com/Bekzhanizb/HabitTrackerBackend/handlers"
+	"github.com/Bekzhanizb/HabitTrackerBackend/middleware"
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/notify"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+	"github.com/Bekzhanizb/HabitTrackerBackend/services"
+	"github.com/Bekzhanizb/HabitTrackerBackend/storage"
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+// Dependencies — всё, что нужно роутеру. Store подставляется извне:
+// в main это PostgresStore, в тестах — MemoryStore.
+type Dependencies struct {
+	Store   repository.Store
+	Cache   cache.Cache
+	Logger  *zap.Logger
+	CSRFKey []byte
+	Version string
+	// Rollups — сервис пересборки сводок; если nil, роутер создаёт свой.
+	Rollups *services.RollupService
+	// Reports — сервис отчётов; если nil, роутер создаёт свой без доставки.
+	Reports *services.ReportService
+	// Notifications — рассылка уведомлений; если nil, роутер создаёт свою
+	// только со входящими в приложении.
+	Notifications *services.NotificationService
+	// Reminders — напоминания о привычках; если nil, роутер создаёт свой
+	// сервис, рассылающий через Notifications.
+	Reminders *services.ReminderService
+	// Attachments — хранилище вложений дневника; если nil, файлы хранятся
+	// в памяти процесса.
+	Attachments storage.BlobStore
+	// AttachmentLimits — лимиты вложений; нулевые поля берутся
+	// из services.DefaultAttachmentLimits.
+	AttachmentLimits services.AttachmentLimits
+}
+
+func NewRouter(deps Dependencies) *gin.Engine {
+	store := deps.Store
+	appCache := deps.Cache
+
+	habitHandler := handlers.NewHabitHandler(
+		services.NewHabitService(store, appCache, deps.Logger),
+		services.NewStatsService(store, appCache, deps.Logger),
+	)
+	blobs := deps.Attachments
+	if blobs == nil {
+		blobs = storage.NewMemoryStore()
+	}
+	diaryHandler := handlers.NewDiaryHandler(services.NewDiaryService(store, blobs, appCache, deps.Logger))
+	attachmentHandler := handlers.NewAttachmentHandler(
+		services.NewAttachmentService(store, blobs, deps.Logger, deps.AttachmentLimits),
+	)
+	promptHandler := handlers.NewPromptHandler(services.NewPromptService(store))
+	userHandler := handlers.NewUserHandler(store.Users(), store.Cities(), appCache)
+	accountHandler := NewAccountHandler(store.Users(), store.Cities())
+	systemHandler := handlers.NewSystemHandler(store, appCache, deps.Version)
+	authMiddleware := handlers.AuthMiddleware(store.Users())
+
+	rollups := deps.Rollups
+	if rollups == nil {
+		rollups = services.NewRollupService(store, appCache, deps.Logger)
+	}
+	rollupHandler := handlers.NewRollupHandler(rollups)
+
+	reports := deps.Reports
+	if reports == nil {
+		reports = services.NewReportService(store, appCache, deps.Logger, nil)
+	}
+	reportHandler := handlers.NewReportHandler(reports)
+
+	notifications := deps.Notifications
+	if notifications == nil {
+		notifications = services.NewNotificationService(store, deps.Logger, services.DefaultRetryPolicy,
+			notify.NewInboxNotifier(store.Notifications()))
+	}
+	notificationHandler := handlers.NewNotificationHandler(notifications)
+
+	reminders := deps.Reminders
+	if reminders == nil {
+		reminders = services.NewReminderService(store, appCache, deps.Logger, notifications.Process)
+	}
+	reminderHandler := handlers.NewReminderHandler(reminders)
+	achievementHandler := handlers.NewAchievementHandler(
+		services.NewAchievementService(store, deps.Logger, notifications.Process),
+	)
+
+	limiter := middleware.NewRateLimiter(appCache, store.RateLimitOverrides())
+	rateLimitHandler := handlers.NewRateLimitHandler(store.RateLimitOverrides(), limiter)
+
+	r := gin.New()
+
+	r.Use(cors.New(cors.Config{
+		AllowOrigins: []string{
+			"http://localhost:3000",
+		},
+		AllowMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders: []string{
+			"Origin",
+			"Content-Type",
+			"Accept",
+			"Authorization",
+			"X-CSRF-Token",
+			"X-Requested-With",
+			"If-Match",
+			"If-None-Match",
+			"If-Modified-Since",
+		},
+		ExposeHeaders: []string{
+			"Content-Length",
+			"X-CSRF-Token",
+			"ETag",
+			"Last-Modified",
+			"Link",
+			"X-Next-Cursor",
+		},
+		AllowCredentials: true,
+		MaxAge:           12 * time.Hour,
+	}))
+
+	r.Use(middleware.Recovery())
+	r.Use(middleware.RequestLogger())
+	r.Use(middleware.SecurityHeaders())
+
+	// Общий лимит по IP срезает флуд до разбора токена; у авторизованных
+	// маршрутов ниже есть свой лимит на пользователя.
+	r.Use(limiter.Middleware(middleware.RateLimitPolicy{
+		Name: "global", Limit: 300, Period: time.Minute, Key: middleware.KeyByIP,
+	}))
+
+	csrfMiddleware := middleware.CSRFMiddleware(
+		deps.CSRFKey,
+		"/health",
+		"/metrics",
+		"/api/login",
+		"/api/register",
+		"/api/cities",
+		"/api/habits",
+		"/api/habits/log",
+		"/api/diary",
+	)
+
+	r.Use(csrfMiddleware)
+
+	r.Static("/uploads", "./uploads")
+
+	r.GET("/health", systemHandler.Health)
+
+	r.GET("/api/csrf", middleware.GetCSRFToken())
+
+	public := r.Group("/api")
+	{
+		// Вход и регистрация ограничены строже: это цели подбора паролей
+		// и массовой регистрации.
+		public.POST("/register", limiter.Middleware(middleware.RateLimitPolicy{
+			Name: "register", Limit: 5, Period: time.Hour, Key: middleware.KeyByIP,
+		}), userHandler.Register)
+		public.POST("/login", limiter.Middleware(middleware.RateLimitPolicy{
+			Name: "login", Limit: 10, Period: time.Minute, Key: middleware.KeyByIP,
+		}), accountHandler.Login)
+		public.GET("/cities", userHandler.GetCities)
+	}
+
+	api := r.Group("/api")
+	api.Use(authMiddleware)
+	// Каждый токен (устройство) ограничен отдельно, а все токены
+	// пользователя вместе — общим лимитом api. Лимит токена проверяется
+	// первым, чтобы отказ по нему не тратил общий бюджет.
+	api.Use(limiter.Middleware(middleware.RateLimitPolicy{
+		Name: "api_token", Limit: 60, Period: time.Minute, Key: middleware.KeyByToken,
+	}))
+	api.Use(limiter.Middleware(middleware.RateLimitPolicy{
+		Name: "api", Limit: 100, Period: time.Minute, Key: middleware.KeyByUser,
+	}))
+	{
+		api.GET("/profile", accountHandler.Profile)
+		api.PUT("/profile", accountHandler.UpdateProfile)
+
+		habits := api.Group("/habits")
+		{
+			habits.GET("", middleware.CacheMiddleware(appCache, 2*time.Minute, cache.ResourceHabits), habitHandler.GetHabits)
+			habits.POST("", habitHandler.CreateHabit)
+			habits.POST("/log", habitHandler.LogHabit)
+			habits.GET("/:id", habitHandler.GetHabit)
+			habits.PUT("/:id", habitHandler.UpdateHabit)
+			habits.DELETE("/:id", habitHandler.DeleteHabit)
+			habits.GET("/stats", habitHandler.GetStats)
+			habits.GET("/stats/trends", middleware.CacheMiddleware(appCache, 2*time.Minute, cache.ResourceHabits), habitHandler.GetTrends)
+			habits.GET("/stats/mood", habitHandler.GetMoodCorrelations)
+			habits.GET("/calendar", habitHandler.GetCalendar)
+			habits.GET("/:id/calendar", habitHandler.GetHabitCalendar)
+			habits.GET("/:id/timeline", habitHandler.GetHabitTimeline)
+			habits.PATCH("/logs/:id", habitHandler.UpdateLogNote)
+			habits.GET("/:id/reminders", reminderHandler.GetReminders)
+			habits.POST("/:id/reminders", reminderHandler.CreateReminder)
+			habits.PUT("/reminders/:id", reminderHandler.UpdateReminder)
+			habits.DELETE("/reminders/:id", reminderHandler.DeleteReminder)
+			habits.GET("/logs",
+				handlers.RoleMiddleware(models.RoleAdmin),
+				middleware.CacheMiddleware(appCache, 5*time.Minute, cache.ResourceHabits),
+				habitHandler.GetHabitLogs,
+			)
+			habits.POST("/bulk/activate",
+				handlers.RoleMiddleware(models.RoleAdmin),
+				habitHandler.BulkActivate,
+			)
+		}
+
+		diary := api.Group("/diary")
+		{
+			diary.GET("", middleware.CacheMiddleware(appCache, 2*time.Minute, cache.ResourceDiary), diaryHandler.GetDiary)
+			diary.POST("", diaryHandler.CreateDiary)
+			diary.GET("/search", middleware.CacheMiddleware(appCache, time.Minute, cache.ResourceDiary), diaryHandler.SearchDiary)
+			diary.GET("/mood", middleware.CacheMiddleware(appCache, 2*time.Minute, cache.ResourceDiary), diaryHandler.GetMoodTimeline)
+			diary.GET("/prompts", promptHandler.GetActivePrompts)
+			diary.GET("/prompt/today", promptHandler.GetTodayPrompt)
+			diary.GET("/:id", diaryHandler.GetDiaryByID)
+			diary.PUT("/:id", diaryHandler.UpdateDiary)
+			diary.DELETE("/:id", diaryHandler.DeleteDiary)
+			diary.GET("/:id/revisions", diaryHandler.GetRevisions)
+			diary.GET("/:id/revisions/diff", diaryHandler.DiffRevisions)
+			diary.POST("/:id/revisions/:rev/restore", diaryHandler.RestoreRevision)
+			diary.GET("/attachments/usage", attachmentHandler.GetAttachmentUsage)
+			diary.GET("/:id/attachments", attachmentHandler.GetAttachments)
+			diary.POST("/:id/attachments", attachmentHandler.UploadAttachment)
+			diary.GET("/:id/attachments/:attachmentID", attachmentHandler.DownloadAttachment)
+			diary.GET("/:id/attachments/:attachmentID/thumbnail", attachmentHandler.GetThumbnail)
+			diary.DELETE("/:id/attachments/:attachmentID", attachmentHandler.DeleteAttachment)
+		}
+
+		cacheAPI := api.Group("/cache")
+		cacheAPI.Use(handlers.RoleMiddleware(models.RoleAdmin))
+		{
+			cacheAPI.DELETE("/clear", systemHandler.ClearCache)
+			cacheAPI.DELETE("/user/:id", systemHandler.ClearUserCache)
+		}
+
+		rateLimits := api.Group("/admin/rate-limits")
+		rateLimits.Use(handlers.RoleMiddleware(models.RoleAdmin))
+		{
+			rateLimits.GET("", rateLimitHandler.List)
+			rateLimits.PUT("", rateLimitHandler.Upsert)
+			rateLimits.DELETE("/:id", rateLimitHandler.Delete)
+		}
+
+		reportsAPI := api.Group("/reports")
+		{
+			reportsAPI.GET("", reportHandler.GetReports)
+			reportsAPI.GET("/:id", reportHandler.GetReport)
+		}
+		api.POST("/admin/reports/generate", handlers.RoleMiddleware(models.RoleAdmin), reportHandler.GenerateReports)
+
+		promptsAPI := api.Group("/admin/prompts")
+		promptsAPI.Use(handlers.RoleMiddleware(models.RoleAdmin))
+		{
+			promptsAPI.GET("", promptHandler.GetPrompts)
+			promptsAPI.POST("", promptHandler.CreatePrompt)
+			promptsAPI.GET("/stats", promptHandler.GetPromptEngagement)
+			promptsAPI.PUT("/:id", promptHandler.UpdatePrompt)
+			promptsAPI.DELETE("/:id", promptHandler.DeletePrompt)
+		}
+
+		notificationsAPI := api.Group("/notifications")
+		{
+			notificationsAPI.GET("", notificationHandler.GetNotifications)
+			notificationsAPI.GET("/unread-count", notificationHandler.GetUnreadCount)
+			notificationsAPI.POST("/read-all", notificationHandler.MarkAllNotificationsRead)
+			notificationsAPI.POST("/:id/read", notificationHandler.MarkNotificationRead)
+		}
+		api.POST("/admin/users/:id/achievements", handlers.RoleMiddleware(models.RoleAdmin), achievementHandler.AwardAchievement)
+
+		deadLetters := api.Group("/admin/notifications/dead-letters")
+		deadLetters.Use(handlers.RoleMiddleware(models.RoleAdmin))
+		{
+			deadLetters.GET("", notificationHandler.GetDeadLetters)
+			deadLetters.POST("/:id/retry", notificationHandler.RetryDeadLetter)
+		}
+
+		rollupsAPI := api.Group("/admin/rollups")
+		rollupsAPI.Use(handlers.RoleMiddleware(models.RoleAdmin))
+		{
+			rollupsAPI.POST("/rebuild", rollupHandler.Rebuild)
+		}
+	}
+
+	r.GET("/api/users", userHandler.GetUsers)
+
+	r.Use(middleware.RequestLogger())
+	r.GET("/debug/context", authMiddleware, systemHandler.DebugContext)
+
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	return r
+}
@@ -0,0 +1,2356 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	pngenc "image/png"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/cache"
+	"github.com/Bekzhanizb/HabitTrackerBackend/encryption"
+	"github.com/Bekzhanizb/HabitTrackerBackend/handlers"
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/notify"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+	"github.com/Bekzhanizb/HabitTrackerBackend/services"
+	"github.com/Bekzhanizb/HabitTrackerBackend/utils"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testPassword = "secret-password"
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	utils.Logger = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+type testEnv struct {
+	t      *testing.T
+	router *gin.Engine
+	store  *repository.MemoryStore
+
+	csrfToken   string
+	csrfCookies []*http.Cookie
+
+	user      models.User
+	other     models.User
+	admin     models.User
+	userToken string
+	adminTok  string
+	otherTok  string
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	appCache := cache.NewFallbackCache(
+		cache.NewRedisCache(redis.NewClient(&redis.Options{Addr: mr.Addr()})),
+		cache.NewLocalCache(100),
+		zap.NewNop(),
+		time.Second,
+	)
+	t.Cleanup(func() { appCache.Close() })
+
+	store := repository.NewMemoryStore()
+	ctx := context.Background()
+	if err := store.Cities().CreateBatch(ctx, []models.City{{Name: "Almaty"}, {Name: "Astana"}}); err != nil {
+		t.Fatalf("seed cities: %v", err)
+	}
+
+	env := &testEnv{
+		t:     t,
+		store: store,
+		router: NewRouter(Dependencies{
+			Store:   store,
+			Cache:   appCache,
+			Logger:  zap.NewNop(),
+			CSRFKey: []byte("32-byte-long-test-csrf-key-12345"),
+			Version: "test",
+			// Маленькие лимиты, чтобы тесты упирались в них без больших файлов.
+			AttachmentLimits: services.AttachmentLimits{MaxFileSize: 64 << 10, UserQuota: 160 << 10},
+		}),
+	}
+
+	env.user = env.createUser("alice", models.RoleUser)
+	env.other = env.createUser("bob", models.RoleUser)
+	env.admin = env.createUser("root", models.RoleAdmin)
+	env.userToken = env.login("alice")
+	env.otherTok = env.login("bob")
+	env.adminTok = env.login("root")
+
+	return env
+}
+
+func (e *testEnv) createUser(username, role string) models.User {
+	e.t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		e.t.Fatalf("hash password: %v", err)
+	}
+	cityID := uint(1)
+	user := models.User{Username: username, PasswordHash: string(hash), Role: role, CityID: &cityID}
+	if err := e.store.Users().Create(context.Background(), &user); err != nil {
+		e.t.Fatalf("create user %s: %v", username, err)
+	}
+	return user
+}
+
+func (e *testEnv) login(username string) string {
+	e.t.Helper()
+
+	w := e.request(http.MethodPost, "/api/login", "", map[string]string{
+		"username": username,
+		"password": testPassword,
+	})
+	if w.Code != http.StatusOK {
+		e.t.Fatalf("login %s: status %d, body %s", username, w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+	decode(e.t, w, &resp)
+	return resp.Token
+}
+
+// ensureCSRF получает CSRF-токен и cookie так же, как это делает фронтенд.
+func (e *testEnv) ensureCSRF() {
+	if e.csrfToken != "" {
+		return
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/csrf", nil)
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		e.t.Fatalf("csrf: status %d", w.Code)
+	}
+
+	e.csrfToken = w.Header().Get("X-CSRF-Token")
+	e.csrfCookies = w.Result().Cookies()
+}
+
+func (e *testEnv) send(req *http.Request, token string) *httptest.ResponseRecorder {
+	e.t.Helper()
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		e.ensureCSRF()
+		req.Header.Set("X-CSRF-Token", e.csrfToken)
+		req.Header.Set("Origin", "https://"+req.Host)
+		for _, cookie := range e.csrfCookies {
+			req.AddCookie(cookie)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, req)
+	return w
+}
+
+func (e *testEnv) request(method, path, token string, body any) *httptest.ResponseRecorder {
+	e.t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			e.t.Fatalf("marshal body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return e.send(req, token)
+}
+
+func (e *testEnv) form(method, path, token string, fields map[string]string) *httptest.ResponseRecorder {
+	e.t.Helper()
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		if err := mw.WriteField(k, v); err != nil {
+			e.t.Fatalf("write field: %v", err)
+		}
+	}
+	mw.Close()
+
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return e.send(req, token)
+}
+
+func (e *testEnv) createHabit(token string, userID uint, title string) models.Habit {
+	e.t.Helper()
+
+	w := e.request(http.MethodPost, "/api/habits", token, map[string]any{
+		"title":     title,
+		"frequency": "daily",
+		"user_id":   userID,
+	})
+	expectStatus(e.t, w, http.StatusOK)
+
+	var resp struct {
+		Habit models.Habit `json:"habit"`
+	}
+	decode(e.t, w, &resp)
+	return resp.Habit
+}
+
+func (e *testEnv) createDiary(token string, userID uint, title string) models.Diary {
+	e.t.Helper()
+
+	w := e.request(http.MethodPost, "/api/diary", token, map[string]any{
+		"title":   title,
+		"content": "content of " + title,
+		"user_id": userID,
+	})
+	expectStatus(e.t, w, http.StatusOK)
+
+	var resp struct {
+		Diary models.Diary `json:"diary"`
+	}
+	decode(e.t, w, &resp)
+	return resp.Diary
+}
+
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if w.Code != want {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, want, w.Body.String())
+	}
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder, dest any) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), dest); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+}
+
+func TestHealthAndMetrics(t *testing.T) {
+	env := newTestEnv(t)
+
+	w := env.request(http.MethodGet, "/health", "", nil)
+	expectStatus(t, w, http.StatusOK)
+
+	var health map[string]any
+	decode(t, w, &health)
+	if health["database"] != "connected" || health["redis"] != "connected" {
+		t.Fatalf("unexpected health: %v", health)
+	}
+
+	w = env.request(http.MethodGet, "/metrics", "", nil)
+	expectStatus(t, w, http.StatusOK)
+}
+
+func TestCSRFToken(t *testing.T) {
+	env := newTestEnv(t)
+
+	w := env.request(http.MethodGet, "/api/csrf", "", nil)
+	expectStatus(t, w, http.StatusOK)
+	if w.Header().Get("X-CSRF-Token") == "" {
+		t.Fatal("expected X-CSRF-Token header")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	env := newTestEnv(t)
+
+	w := env.form(http.MethodPost, "/api/register", "", map[string]string{
+		"username": "newcomer",
+		"password": "pass1234",
+		"city_id":  "1",
+	})
+	expectStatus(t, w, http.StatusCreated)
+
+	if _, err := env.store.Users().GetByUsername(context.Background(), "newcomer"); err != nil {
+		t.Fatalf("user not stored: %v", err)
+	}
+
+	w = env.form(http.MethodPost, "/api/register", "", map[string]string{
+		"username": "alice",
+		"password": "pass1234",
+		"city_id":  "1",
+	})
+	expectStatus(t, w, http.StatusConflict)
+
+	w = env.form(http.MethodPost, "/api/register", "", map[string]string{
+		"username": "stranger",
+		"password": "pass1234",
+		"city_id":  "999",
+	})
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestLogin(t *testing.T) {
+	env := newTestEnv(t)
+
+	w := env.request(http.MethodPost, "/api/login", "", map[string]string{
+		"username": "alice",
+		"password": "wrong",
+	})
+	expectStatus(t, w, http.StatusUnauthorized)
+
+	w = env.request(http.MethodPost, "/api/login", "", map[string]string{
+		"username": "nobody",
+		"password": testPassword,
+	})
+	expectStatus(t, w, http.StatusUnauthorized)
+}
+
+func TestCities(t *testing.T) {
+	env := newTestEnv(t)
+
+	w := env.request(http.MethodGet, "/api/cities", "", nil)
+	expectStatus(t, w, http.StatusOK)
+	if w.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("first request X-Cache = %q, want MISS", w.Header().Get("X-Cache"))
+	}
+
+	var cities []models.City
+	decode(t, w, &cities)
+	if len(cities) != 2 {
+		t.Fatalf("got %d cities, want 2", len(cities))
+	}
+
+	w = env.request(http.MethodGet, "/api/cities", "", nil)
+	expectStatus(t, w, http.StatusOK)
+	if w.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("second request X-Cache = %q, want HIT", w.Header().Get("X-Cache"))
+	}
+}
+
+func TestCachedResponseKeepsRateLimitHeaders(t *testing.T) {
+	env := newTestEnv(t)
+
+	first := env.request(http.MethodGet, "/api/habits", env.userToken, nil)
+	expectStatus(t, first, http.StatusOK)
+	second := env.request(http.MethodGet, "/api/habits", env.userToken, nil)
+	expectStatus(t, second, http.StatusOK)
+	if second.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("second request X-Cache = %q, want HIT", second.Header().Get("X-Cache"))
+	}
+
+	before, _ := strconv.Atoi(first.Header().Get("RateLimit-Remaining"))
+	after, _ := strconv.Atoi(second.Header().Get("RateLimit-Remaining"))
+	if after != before-1 {
+		t.Fatalf("RateLimit-Remaining on hit = %d, want %d", after, before-1)
+	}
+	if second.Header().Get("ETag") == "" || second.Header().Get("ETag") != first.Header().Get("ETag") {
+		t.Fatalf("ETag not replayed: %q vs %q", second.Header().Get("ETag"), first.Header().Get("ETag"))
+	}
+}
+
+func TestProfile(t *testing.T) {
+	env := newTestEnv(t)
+
+	w := env.request(http.MethodGet, "/api/profile", "", nil)
+	expectStatus(t, w, http.StatusUnauthorized)
+
+	w = env.request(http.MethodGet, "/api/profile", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+
+	var profile models.User
+	decode(t, w, &profile)
+	if profile.Username != "alice" {
+		t.Fatalf("profile username = %q", profile.Username)
+	}
+
+	w = env.form(http.MethodPut, "/api/profile", env.userToken, map[string]string{
+		"username": "alice2",
+		"city_id":  "2",
+	})
+	expectStatus(t, w, http.StatusOK)
+
+	stored, err := env.store.Users().GetByID(context.Background(), env.user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Username != "alice2" || stored.CityID == nil || *stored.CityID != 2 {
+		t.Fatalf("profile not updated: %+v", stored)
+	}
+
+	w = env.form(http.MethodPut, "/api/profile", env.userToken, map[string]string{
+		"username": "bob",
+	})
+	expectStatus(t, w, http.StatusConflict)
+
+	for email, status := range map[string]int{
+		"Alice <alice@example.com>": http.StatusBadRequest,
+		"not-an-email":              http.StatusBadRequest,
+		"alice@example.com":         http.StatusOK,
+	} {
+		w = env.form(http.MethodPut, "/api/profile", env.userToken, map[string]string{"email": email})
+		expectStatus(t, w, status)
+	}
+	stored, _ = env.store.Users().GetByID(context.Background(), env.user.ID)
+	if stored.Email != "alice@example.com" {
+		t.Fatalf("email not saved: %q", stored.Email)
+	}
+
+	for tz, status := range map[string]int{
+		"Mars/Olympus": http.StatusBadRequest,
+		"Local":        http.StatusBadRequest,
+		"Asia/Tokyo":   http.StatusOK,
+	} {
+		w = env.form(http.MethodPut, "/api/profile", env.userToken, map[string]string{"timezone": tz})
+		expectStatus(t, w, status)
+	}
+	stored, _ = env.store.Users().GetByID(context.Background(), env.user.ID)
+	if stored.Timezone != "Asia/Tokyo" {
+		t.Fatalf("timezone not saved: %q", stored.Timezone)
+	}
+}
+
+func TestHabitLifecycle(t *testing.T) {
+	env := newTestEnv(t)
+
+	habit := env.createHabit(env.userToken, env.user.ID, "Read")
+	if habit.ID == 0 || !habit.IsActive {
+		t.Fatalf("unexpected habit: %+v", habit)
+	}
+
+	w := env.request(http.MethodGet, "/api/habits", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var habits []models.Habit
+	decode(t, w, &habits)
+	if len(habits) != 1 || len(habits[0].Logs) != 1 {
+		t.Fatalf("expected one habit with its seed log, got %+v", habits)
+	}
+
+	w = env.request(http.MethodPost, "/api/habits/log", env.userToken, map[string]any{"habit_id": habit.ID})
+	expectStatus(t, w, http.StatusOK)
+
+	newTitle := "Read books"
+	w = env.request(http.MethodPut, fmt.Sprintf("/api/habits/%d", habit.ID), env.userToken, map[string]any{
+		"title": newTitle,
+	})
+	expectStatus(t, w, http.StatusOK)
+
+	stored, err := env.store.Habits().GetByID(context.Background(), habit.ID)
+	if err != nil || stored.Title != newTitle {
+		t.Fatalf("habit not updated: %+v, %v", stored, err)
+	}
+
+	w = env.request(http.MethodGet, "/api/habits/stats", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var stats struct {
+		TotalHabits int `json:"total_habits"`
+		HabitStats  []struct {
+			TotalLogs     int `json:"total_logs"`
+			CompletedLogs int `json:"completed_logs"`
+		} `json:"habit_stats"`
+	}
+	decode(t, w, &stats)
+	if stats.TotalHabits != 1 || len(stats.HabitStats) != 1 ||
+		stats.HabitStats[0].TotalLogs != 2 || stats.HabitStats[0].CompletedLogs != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	w = env.request(http.MethodDelete, fmt.Sprintf("/api/habits/%d", habit.ID), env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+
+	if _, err := env.store.Habits().GetByID(context.Background(), habit.ID); err != repository.ErrNotFound {
+		t.Fatalf("habit still present: %v", err)
+	}
+	logs, _, _ := env.store.HabitLogs().List(context.Background(), repository.HabitLogFilter{HabitID: &habit.ID}, repository.Page{})
+	if len(logs) != 0 {
+		t.Fatalf("habit logs were not deleted: %d left", len(logs))
+	}
+}
+
+func TestRollupRebuild(t *testing.T) {
+	env := newTestEnv(t)
+	habit := env.createHabit(env.userToken, env.user.ID, "Read")
+
+	userStats := func() (total, completed int) {
+		t.Helper()
+		w := env.request(http.MethodGet, "/api/habits/stats", env.userToken, nil)
+		expectStatus(t, w, http.StatusOK)
+		var stats struct {
+			HabitStats []struct {
+				TotalLogs     int `json:"total_logs"`
+				CompletedLogs int `json:"completed_logs"`
+			} `json:"habit_stats"`
+		}
+		decode(t, w, &stats)
+		if len(stats.HabitStats) != 1 {
+			t.Fatalf("unexpected stats: %+v", stats)
+		}
+		return stats.HabitStats[0].TotalLogs, stats.HabitStats[0].CompletedLogs
+	}
+
+	// Лог задним числом в обход сервиса сводки не видят до пересборки.
+	log := models.HabitLog{HabitID: habit.ID, Date: time.Now().AddDate(0, 0, -3), IsCompleted: true}
+	if err := env.store.HabitLogs().Create(context.Background(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if total, _ := userStats(); total != 1 {
+		t.Fatalf("total logs = %d before rebuild, want 1", total)
+	}
+
+	path := fmt.Sprintf("/api/admin/rollups/rebuild?user_id=%d", env.user.ID)
+	w := env.request(http.MethodPost, path, env.userToken, nil)
+	expectStatus(t, w, http.StatusForbidden)
+	w = env.request(http.MethodPost, "/api/admin/rollups/rebuild?user_id=abc", env.adminTok, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+
+	w = env.request(http.MethodPost, path, env.adminTok, nil)
+	expectStatus(t, w, http.StatusOK)
+	if total, completed := userStats(); total != 2 || completed != 1 {
+		t.Fatalf("stats after rebuild = %d/%d, want 2/1", completed, total)
+	}
+
+	w = env.request(http.MethodPost, "/api/admin/rollups/rebuild", env.adminTok, nil)
+	expectStatus(t, w, http.StatusAccepted)
+}
+
+func TestHabitAccessRules(t *testing.T) {
+	env := newTestEnv(t)
+
+	habit := env.createHabit(env.userToken, env.user.ID, "Run")
+
+	w := env.request(http.MethodPost, "/api/habits", env.userToken, map[string]any{
+		"title":     "Sneaky",
+		"frequency": "daily",
+		"user_id":   env.other.ID,
+	})
+	expectStatus(t, w, http.StatusForbidden)
+
+	w = env.request(http.MethodPost, "/api/habits", env.userToken, map[string]any{
+		"title":     "Bad frequency",
+		"frequency": "hourly",
+		"user_id":   env.user.ID,
+	})
+	expectStatus(t, w, http.StatusBadRequest)
+
+	w = env.request(http.MethodPost, "/api/habits/log", env.otherTok, map[string]any{"habit_id": habit.ID})
+	expectStatus(t, w, http.StatusForbidden)
+
+	w = env.request(http.MethodPut, fmt.Sprintf("/api/habits/%d", habit.ID), env.otherTok, map[string]any{"title": "Mine"})
+	expectStatus(t, w, http.StatusForbidden)
+
+	w = env.request(http.MethodDelete, fmt.Sprintf("/api/habits/%d", habit.ID), env.otherTok, nil)
+	expectStatus(t, w, http.StatusForbidden)
+
+	w = env.request(http.MethodPut, "/api/habits/9999", env.userToken, map[string]any{"title": "Ghost"})
+	expectStatus(t, w, http.StatusNotFound)
+
+	w = env.request(http.MethodDelete, "/api/habits/abc", env.userToken, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+
+	w = env.request(http.MethodGet, "/api/habits", env.otherTok, nil)
+	expectStatus(t, w, http.StatusOK)
+	var habits []models.Habit
+	decode(t, w, &habits)
+	if len(habits) != 0 {
+		t.Fatalf("other user sees %d habits", len(habits))
+	}
+
+	w = env.request(http.MethodGet, fmt.Sprintf("/api/habits?user_id=%d", env.user.ID), env.adminTok, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &habits)
+	if len(habits) != 1 {
+		t.Fatalf("admin sees %d habits of user, want 1", len(habits))
+	}
+
+	w = env.request(http.MethodPut, fmt.Sprintf("/api/habits/%d", habit.ID), env.adminTok, map[string]any{"is_active": false})
+	expectStatus(t, w, http.StatusOK)
+}
+
+func TestHabitLogsAdminOnly(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.createHabit(env.userToken, env.user.ID, "Meditate")
+	env.createHabit(env.otherTok, env.other.ID, "Swim")
+
+	w := env.request(http.MethodGet, "/api/habits/logs", env.userToken, nil)
+	expectStatus(t, w, http.StatusForbidden)
+
+	w = env.request(http.MethodGet, "/api/habits/logs", env.adminTok, nil)
+	expectStatus(t, w, http.StatusOK)
+	var logs []models.HabitLog
+	decode(t, w, &logs)
+	if len(logs) != 2 {
+		t.Fatalf("admin sees %d logs, want 2", len(logs))
+	}
+
+	w = env.request(http.MethodGet, fmt.Sprintf("/api/habits/logs?user_id=%d", env.other.ID), env.adminTok, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &logs)
+	if len(logs) != 1 || logs[0].Habit.UserID != env.other.ID {
+		t.Fatalf("filtered logs = %+v", logs)
+	}
+}
+
+func TestBulkActivate(t *testing.T) {
+	env := newTestEnv(t)
+
+	first := env.createHabit(env.userToken, env.user.ID, "One")
+	second := env.createHabit(env.userToken, env.user.ID, "Two")
+
+	body := map[string]any{"habit_ids": []uint{first.ID, second.ID}, "is_active": false}
+
+	w := env.request(http.MethodPost, "/api/habits/bulk/activate", env.userToken, body)
+	expectStatus(t, w, http.StatusForbidden)
+
+	w = env.request(http.MethodPost, "/api/habits/bulk/activate", env.adminTok, body)
+	expectStatus(t, w, http.StatusOK)
+
+	for _, id := range []uint{first.ID, second.ID} {
+		habit, err := env.store.Habits().GetByID(context.Background(), id)
+		if err != nil || habit.IsActive {
+			t.Fatalf("habit %d not deactivated: %+v, %v", id, habit, err)
+		}
+	}
+
+	// Несуществующая привычка откатывает всю пачку.
+	w = env.request(http.MethodPost, "/api/habits/bulk/activate", env.adminTok, map[string]any{
+		"habit_ids": []uint{first.ID, 9999},
+		"is_active": true,
+	})
+	expectStatus(t, w, http.StatusNotFound)
+
+	habit, _ := env.store.Habits().GetByID(context.Background(), first.ID)
+	if habit.IsActive {
+		t.Fatal("bulk update was not rolled back")
+	}
+}
+
+func TestDiaryLifecycle(t *testing.T) {
+	env := newTestEnv(t)
+
+	diary := env.createDiary(env.userToken, env.user.ID, "Day one")
+
+	w := env.request(http.MethodGet, "/api/diary", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var diaries []models.Diary
+	decode(t, w, &diaries)
+	if len(diaries) != 1 || diaries[0].ID != diary.ID {
+		t.Fatalf("unexpected diaries: %+v", diaries)
+	}
+
+	w = env.request(http.MethodPut, fmt.Sprintf("/api/diary/%d", diary.ID), env.userToken, map[string]any{
+		"content": "updated",
+	})
+	expectStatus(t, w, http.StatusOK)
+
+	stored, err := env.store.Diaries().GetByID(context.Background(), diary.ID)
+	if err != nil || stored.Content != "updated" || stored.Title != "Day one" {
+		t.Fatalf("diary not updated: %+v, %v", stored, err)
+	}
+
+	w = env.request(http.MethodPut, fmt.Sprintf("/api/diary/%d", diary.ID), env.otherTok, map[string]any{"content": "x"})
+	expectStatus(t, w, http.StatusForbidden)
+
+	w = env.request(http.MethodDelete, fmt.Sprintf("/api/diary/%d", diary.ID), env.otherTok, nil)
+	expectStatus(t, w, http.StatusForbidden)
+
+	w = env.request(http.MethodDelete, fmt.Sprintf("/api/diary/%d", diary.ID), env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+
+	w = env.request(http.MethodDelete, fmt.Sprintf("/api/diary/%d", diary.ID), env.userToken, nil)
+	expectStatus(t, w, http.StatusNotFound)
+}
+
+func TestDiaryAccessRules(t *testing.T) {
+	env := newTestEnv(t)
+
+	w := env.request(http.MethodPost, "/api/diary", env.userToken, map[string]any{
+		"title":   "Not mine",
+		"content": "text",
+		"user_id": env.other.ID,
+	})
+	expectStatus(t, w, http.StatusForbidden)
+
+	w = env.request(http.MethodPost, "/api/diary", env.userToken, map[string]any{
+		"title":   "",
+		"content": "text",
+		"user_id": env.user.ID,
+	})
+	expectStatus(t, w, http.StatusBadRequest)
+
+	env.createDiary(env.adminTok, env.other.ID, "Written by admin")
+
+	w = env.request(http.MethodGet, "/api/diary", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var diaries []models.Diary
+	decode(t, w, &diaries)
+	if len(diaries) != 0 {
+		t.Fatalf("user sees foreign diaries: %+v", diaries)
+	}
+
+	w = env.request(http.MethodGet, fmt.Sprintf("/api/diary?user_id=%d", env.other.ID), env.adminTok, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &diaries)
+	if len(diaries) != 1 {
+		t.Fatalf("admin sees %d diaries of user, want 1", len(diaries))
+	}
+}
+
+func TestDiaryMood(t *testing.T) {
+	env := newTestEnv(t)
+
+	for _, body := range []map[string]any{
+		{"mood": 6},
+		{"energy": 0},
+		{"emotion": "bored"},
+		{"tags": []string{""}},
+	} {
+		body["title"], body["content"], body["user_id"] = "Day", "Text", env.user.ID
+		w := env.request(http.MethodPost, "/api/diary", env.userToken, body)
+		expectStatus(t, w, http.StatusBadRequest)
+	}
+
+	w := env.request(http.MethodPost, "/api/diary", env.userToken, map[string]any{
+		"title": "Day", "content": "Text", "user_id": env.user.ID,
+		"emotion": "calm", "energy": 2, "tags": []string{" Work ", "work", "sleep"},
+	})
+	expectStatus(t, w, http.StatusOK)
+	var created struct {
+		Diary models.Diary `json:"diary"`
+	}
+	decode(t, w, &created)
+	if d := created.Diary; d.Mood == nil || *d.Mood != 4 || d.Emotion != "calm" || !slices.Equal(d.Tags, []string{"work", "sleep"}) {
+		t.Fatalf("unexpected diary: %+v", d)
+	}
+
+	w = env.request(http.MethodGet, "/api/diary?tag=Sleep", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var tagged []models.Diary
+	decode(t, w, &tagged)
+	if len(tagged) != 1 || tagged[0].ID != created.Diary.ID {
+		t.Fatalf("tag filter returned %+v", tagged)
+	}
+
+	w = env.request(http.MethodPut, fmt.Sprintf("/api/diary/%d", created.Diary.ID), env.userToken, map[string]any{
+		"mood": 0, "emotion": "", "tags": []string{},
+	})
+	expectStatus(t, w, http.StatusOK)
+	stored, _ := env.store.Diaries().GetByID(context.Background(), created.Diary.ID)
+	if stored.Mood != nil || stored.Emotion != "" || len(stored.Tags) != 0 || stored.Energy == nil {
+		t.Fatalf("mood not cleared: %+v", stored)
+	}
+
+	ctx := context.Background()
+	for _, e := range []struct {
+		at      string
+		mood    int
+		emotion string
+	}{
+		{"2024-03-01T10:00:00Z", 2, "sad"},
+		{"2024-03-01T18:00:00Z", 4, "calm"},
+		// В Москве это уже 3 марта.
+		{"2024-03-02T22:00:00Z", 5, "joy"},
+	} {
+		at, _ := time.Parse(time.RFC3339, e.at)
+		mood := e.mood
+		diary := models.Diary{UserID: env.user.ID, Title: "T", Content: "C", Mood: &mood, Emotion: e.emotion, CreatedAt: at}
+		if err := env.store.Diaries().Create(ctx, &diary); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w = env.request(http.MethodGet, "/api/diary/mood?from=2024-03-01&to=2024-03-05&tz=Europe/Moscow", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var timeline struct {
+		Entries     int            `json:"entries"`
+		AverageMood *float64       `json:"average_mood"`
+		Emotions    map[string]int `json:"emotions"`
+		Days        []struct {
+			Date    string   `json:"date"`
+			Entries int      `json:"entries"`
+			Mood    *float64 `json:"mood"`
+			Energy  *float64 `json:"energy"`
+		} `json:"days"`
+	}
+	decode(t, w, &timeline)
+	if len(timeline.Days) != 2 || timeline.Days[0].Date != "2024-03-01" || timeline.Days[1].Date != "2024-03-03" {
+		t.Fatalf("unexpected days: %+v", timeline.Days)
+	}
+	if d := timeline.Days[0]; d.Entries != 2 || d.Mood == nil || *d.Mood != 3 || d.Energy != nil {
+		t.Fatalf("unexpected first day: %+v", d)
+	}
+	if timeline.Entries != 3 || timeline.AverageMood == nil || *timeline.AverageMood != 4 || timeline.Emotions["calm"] != 1 {
+		t.Fatalf("unexpected totals: %+v", timeline)
+	}
+
+	w = env.request(http.MethodGet, "/api/diary/mood?tz=Mars/Base", env.userToken, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestDiarySearch(t *testing.T) {
+	env := newTestEnv(t)
+	mine := env.createDiary(env.userToken, env.user.ID, "Morning run")
+	env.createDiary(env.otherTok, env.other.ID, "Morning run")
+
+	w := env.request(http.MethodGet, "/api/diary/search", env.userToken, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+	w = env.request(http.MethodGet, "/api/diary/search?q=run&limit=0", env.userToken, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+
+	w = env.request(http.MethodGet, "/api/diary/search?q=RUN", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var hits []repository.DiaryHit
+	decode(t, w, &hits)
+	if len(hits) != 1 || hits[0].ID != mine.ID || hits[0].Headline != "Morning <mark>run</mark>" {
+		t.Fatalf("unexpected hits: %+v", hits)
+	}
+
+	w = env.request(http.MethodGet, "/api/diary/search?q=run&tag=travel", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &hits)
+	if len(hits) != 0 {
+		t.Fatalf("tag filter ignored: %+v", hits)
+	}
+
+	w = env.request(http.MethodGet, "/api/diary/search?q=run", env.adminTok, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &hits)
+	if len(hits) != 2 {
+		t.Fatalf("admin should see all entries: %+v", hits)
+	}
+}
+
+func TestDiaryRevisions(t *testing.T) {
+	env := newTestEnv(t)
+	diary := env.createDiary(env.userToken, env.user.ID, "Draft")
+	path := fmt.Sprintf("/api/diary/%d", diary.ID)
+
+	for _, body := range []map[string]any{
+		{"content": "line one\nline two\nline three"},
+		{"mood": 3}, // без изменения текста ревизия не нужна
+		{"title": "Final", "content": "line one\nline 2\nline three\nline four"},
+	} {
+		w := env.request(http.MethodPut, path, env.userToken, body)
+		expectStatus(t, w, http.StatusOK)
+	}
+
+	w := env.request(http.MethodGet, path+"/revisions", env.otherTok, nil)
+	expectStatus(t, w, http.StatusForbidden)
+
+	w = env.request(http.MethodGet, path+"/revisions", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var revs []models.DiaryRevision
+	decode(t, w, &revs)
+	if len(revs) != 3 || revs[0].Title != "Draft" || revs[2].Number != 3 || revs[2].Title != "Final" {
+		t.Fatalf("unexpected revisions: %+v", revs)
+	}
+
+	w = env.request(http.MethodGet, path+"/revisions/diff?from=2", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var diff services.RevisionDiff
+	decode(t, w, &diff)
+	want := []services.DiffLine{
+		{Op: services.DiffEqual, Text: "line one"},
+		{Op: services.DiffDelete, Text: "line two"},
+		{Op: services.DiffInsert, Text: "line 2"},
+		{Op: services.DiffEqual, Text: "line three"},
+		{Op: services.DiffInsert, Text: "line four"},
+	}
+	if diff.To != 3 || !slices.Equal(diff.Content, want) || diff.Added != 3 || diff.Removed != 2 {
+		t.Fatalf("unexpected diff: %+v", diff)
+	}
+	w = env.request(http.MethodGet, path+"/revisions/diff?from=9", env.userToken, nil)
+	expectStatus(t, w, http.StatusNotFound)
+	w = env.request(http.MethodGet, path+"/revisions/diff", env.userToken, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+
+	w = env.request(http.MethodPost, path+"/revisions/1/restore", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	stored, _ := env.store.Diaries().GetByID(context.Background(), diary.ID)
+	if stored.Title != "Draft" || stored.Content != revs[0].Content {
+		t.Fatalf("diary not restored: %+v", stored)
+	}
+	latest, _ := env.store.DiaryRevisions().Latest(context.Background(), diary.ID)
+	if latest.Number != 4 || latest.RestoredFrom == nil || *latest.RestoredFrom != 1 {
+		t.Fatalf("restore not recorded: %+v", latest)
+	}
+
+	w = env.request(http.MethodDelete, path, env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	if revs, _ := env.store.DiaryRevisions().List(context.Background(), diary.ID); len(revs) != 0 {
+		t.Fatalf("revisions left after delete: %+v", revs)
+	}
+}
+
+func TestDiaryClientEncryption(t *testing.T) {
+	env := newTestEnv(t)
+	enc := map[string]any{
+		"algorithm": "AES-GCM", "kdf": "PBKDF2-SHA256", "iterations": 600000,
+		"salt": "c2FsdHNhbHQ=", "nonce": "bm9uY2Vub25jZQ==",
+	}
+
+	w := env.request(http.MethodPost, "/api/diary", env.userToken, map[string]any{
+		"title": "Secret plans", "content": "not base64!", "user_id": env.user.ID, "encryption": enc,
+	})
+	expectStatus(t, w, http.StatusBadRequest)
+	w = env.request(http.MethodPost, "/api/diary", env.userToken, map[string]any{
+		"title": "Secret plans", "content": "Y2lwaGVy", "user_id": env.user.ID,
+		"encryption": map[string]any{"algorithm": "ROT13", "kdf": "argon2id", "salt": "c2FsdA==", "nonce": "bm9uY2U="},
+	})
+	expectStatus(t, w, http.StatusBadRequest)
+
+	w = env.request(http.MethodPost, "/api/diary", env.userToken, map[string]any{
+		"title": "Secret plans", "content": "Y2lwaGVy", "user_id": env.user.ID, "encryption": enc, "mood": 4,
+	})
+	expectStatus(t, w, http.StatusOK)
+	var created struct {
+		Diary models.Diary `json:"diary"`
+	}
+	decode(t, w, &created)
+	if !created.Diary.Encrypted || created.Diary.Encryption == nil || created.Diary.Encryption.Iterations != 600000 {
+		t.Fatalf("encryption not stored: %+v", created.Diary)
+	}
+	path := fmt.Sprintf("/api/diary/%d", created.Diary.ID)
+
+	for i := 0; i < 2; i++ {
+		w = env.request(http.MethodGet, "/api/diary", env.userToken, nil)
+		expectStatus(t, w, http.StatusOK)
+		if w.Header().Get("Cache-Control") != "no-store" || w.Header().Get("X-Cache") != "MISS" {
+			t.Fatalf("encrypted list must not be cached: %v", w.Header())
+		}
+	}
+
+	w = env.request(http.MethodGet, "/api/diary/search?q=plans", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var hits []repository.DiaryHit
+	decode(t, w, &hits)
+	if len(hits) != 0 {
+		t.Fatalf("encrypted entries must not be searchable: %+v", hits)
+	}
+
+	w = env.request(http.MethodPut, path, env.userToken, map[string]any{"content": "plain text"})
+	expectStatus(t, w, http.StatusBadRequest)
+	w = env.request(http.MethodPut, path, env.userToken, map[string]any{"encryption": enc})
+	expectStatus(t, w, http.StatusBadRequest)
+	w = env.request(http.MethodPut, path, env.userToken, map[string]any{"content": "bmV3IGNpcGhlcg==", "encryption": enc})
+	expectStatus(t, w, http.StatusOK)
+
+	w = env.request(http.MethodGet, path+"/revisions/diff?from=1", env.userToken, nil)
+	expectStatus(t, w, http.StatusConflict)
+
+	// Шифротекст длиннее исходного текста, и лимит для него выше.
+	w = env.request(http.MethodPut, path, env.userToken, map[string]any{"content": strings.Repeat("QUJD", 3000), "encryption": enc})
+	expectStatus(t, w, http.StatusOK)
+	plain := env.createDiary(env.userToken, env.user.ID, "Open notes")
+	plainPath := fmt.Sprintf("/api/diary/%d", plain.ID)
+	w = env.request(http.MethodPut, plainPath, env.userToken, map[string]any{"content": strings.Repeat("a", 10001)})
+	expectStatus(t, w, http.StatusBadRequest)
+
+	// При переходе в зашифрованный режим открытые ревизии удаляются.
+	w = env.request(http.MethodPut, plainPath, env.userToken, map[string]any{"content": "second draft"})
+	expectStatus(t, w, http.StatusOK)
+	w = env.request(http.MethodPut, plainPath, env.userToken, map[string]any{"content": "Y2lwaGVy", "encryption": enc})
+	expectStatus(t, w, http.StatusOK)
+	revs, err := env.store.DiaryRevisions().List(context.Background(), plain.ID)
+	if err != nil || len(revs) != 1 || revs[0].Encryption == nil || revs[0].Content != "Y2lwaGVy" {
+		t.Fatalf("plaintext revisions kept: %+v, %v", revs, err)
+	}
+
+	// Открытая ревизия не превращает зашифрованную запись обратно в открытую.
+	leaked := models.DiaryRevision{DiaryID: plain.ID, Title: "Open notes", Content: "second draft", EditedBy: env.user.ID}
+	if err := env.store.DiaryRevisions().Create(context.Background(), &leaked); err != nil {
+		t.Fatal(err)
+	}
+	w = env.request(http.MethodPost, fmt.Sprintf("%s/revisions/%d/restore", plainPath, leaked.Number), env.userToken, nil)
+	expectStatus(t, w, http.StatusConflict)
+}
+
+func (e *testEnv) upload(path, token, name string, data []byte) *httptest.ResponseRecorder {
+	e.t.Helper()
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		e.t.Fatalf("create form file: %v", err)
+	}
+	part.Write(data)
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, path, &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return e.send(req, token)
+}
+
+func TestDiaryAtRestEncryption(t *testing.T) {
+	env := newTestEnv(t)
+	envelope, err := encryption.NewEnvelope("k1", map[string][]byte{"k1": bytes.Repeat([]byte{7}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryption.Enable(envelope)
+	t.Cleanup(func() { encryption.Enable(nil) })
+
+	env.createDiary(env.userToken, env.user.ID, "Morning pages")
+	for i := 0; i < 2; i++ {
+		w := env.request(http.MethodGet, "/api/diary", env.userToken, nil)
+		expectStatus(t, w, http.StatusOK)
+		if w.Header().Get("Cache-Control") != "no-store" || w.Header().Get("X-Cache") != "MISS" {
+			t.Fatalf("plaintext list must not be cached: %v", w.Header())
+		}
+	}
+
+	w := env.request(http.MethodGet, "/api/diary/search?q=morning", env.userToken, nil)
+	expectStatus(t, w, http.StatusNotImplemented)
+}
+
+func TestDiaryAttachments(t *testing.T) {
+	env := newTestEnv(t)
+	diary := env.createDiary(env.userToken, env.user.ID, "Trip")
+	path := fmt.Sprintf("/api/diary/%d/attachments", diary.ID)
+
+	photo := image.NewRGBA(image.Rect(0, 0, 800, 400))
+	draw.Draw(photo, photo.Bounds(), image.NewUniform(color.RGBA{R: 200, A: 255}), image.Point{}, draw.Src)
+	var png bytes.Buffer
+	if err := pngenc.Encode(&png, photo); err != nil {
+		t.Fatal(err)
+	}
+
+	w := env.upload(path, env.userToken, "photo.png", png.Bytes())
+	expectStatus(t, w, http.StatusCreated)
+	var pic handlers.AttachmentResponse
+	decode(t, w, &pic)
+	if pic.ContentType != "image/png" || pic.Width != 800 || pic.ThumbnailURL == "" {
+		t.Fatalf("unexpected attachment: %+v", pic)
+	}
+
+	w = env.upload(path, env.userToken, `..\..\notes.txt`, []byte("packing list"))
+	expectStatus(t, w, http.StatusCreated)
+	var notes handlers.AttachmentResponse
+	decode(t, w, &notes)
+	if notes.FileName != "notes.txt" || notes.ContentType != "text/plain" || notes.ThumbnailURL != "" {
+		t.Fatalf("unexpected attachment: %+v", notes)
+	}
+
+	// Тип определяется по содержимому, а не по расширению.
+	w = env.upload(path, env.userToken, "page.txt", []byte("<html><script>alert(1)</script></html>"))
+	expectStatus(t, w, http.StatusUnsupportedMediaType)
+	w = env.upload(path, env.userToken, "big.txt", bytes.Repeat([]byte("a"), 64<<10+1))
+	expectStatus(t, w, http.StatusRequestEntityTooLarge)
+	w = env.upload(path, env.otherTok, "notes.txt", []byte("hi"))
+	expectStatus(t, w, http.StatusForbidden)
+
+	// Скачивание требует авторизации и прав на запись.
+	w = env.request(http.MethodGet, pic.URL, "", nil)
+	expectStatus(t, w, http.StatusUnauthorized)
+	w = env.request(http.MethodGet, pic.URL, env.otherTok, nil)
+	expectStatus(t, w, http.StatusForbidden)
+	w = env.request(http.MethodGet, pic.URL, env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	if !bytes.Equal(w.Body.Bytes(), png.Bytes()) || !strings.HasPrefix(w.Header().Get("Content-Disposition"), "inline") {
+		t.Fatalf("unexpected download: %d bytes, %v", w.Body.Len(), w.Header())
+	}
+	w = env.request(http.MethodGet, notes.URL, env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	if w.Body.String() != "packing list" || w.Header().Get("Content-Disposition") != `attachment; filename=notes.txt` {
+		t.Fatalf("unexpected download: %q, %v", w.Body.String(), w.Header())
+	}
+
+	w = env.request(http.MethodGet, pic.ThumbnailURL, env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	thumb, format, err := image.DecodeConfig(bytes.NewReader(w.Body.Bytes()))
+	if err != nil || format != "jpeg" || thumb.Width != 320 || thumb.Height != 160 {
+		t.Fatalf("unexpected thumbnail: %+v %s %v", thumb, format, err)
+	}
+	w = env.request(http.MethodGet, notes.URL+"/thumbnail", env.userToken, nil)
+	expectStatus(t, w, http.StatusNotFound)
+
+	// Квота в тестах — 160 КиБ на пользователя.
+	chunk := bytes.Repeat([]byte("b"), 60<<10)
+	for i, want := range []int{http.StatusCreated, http.StatusCreated, http.StatusRequestEntityTooLarge} {
+		w = env.upload(path, env.userToken, fmt.Sprintf("chunk%d.txt", i), chunk)
+		expectStatus(t, w, want)
+	}
+	w = env.request(http.MethodGet, "/api/diary/attachments/usage", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var usage services.AttachmentUsage
+	decode(t, w, &usage)
+	if want := int64(png.Len() + len("packing list") + 2*len(chunk)); usage.Used != want || usage.Quota != 160<<10 {
+		t.Fatalf("usage %+v, want %d used", usage, want)
+	}
+
+	w = env.request(http.MethodGet, path, env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var list []handlers.AttachmentResponse
+	decode(t, w, &list)
+	if len(list) != 4 || list[0].ID != pic.ID {
+		t.Fatalf("unexpected attachments: %+v", list)
+	}
+
+	w = env.request(http.MethodDelete, notes.URL, env.otherTok, nil)
+	expectStatus(t, w, http.StatusForbidden)
+	w = env.request(http.MethodDelete, notes.URL, env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	w = env.request(http.MethodGet, notes.URL, env.userToken, nil)
+	expectStatus(t, w, http.StatusNotFound)
+
+	w = env.request(http.MethodDelete, fmt.Sprintf("/api/diary/%d", diary.ID), env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	if left, _ := env.store.Attachments().ListByDiary(context.Background(), diary.ID); len(left) != 0 {
+		t.Fatalf("attachments left after delete: %+v", left)
+	}
+	if used, _ := env.store.Attachments().Usage(context.Background(), env.user.ID); used != 0 {
+		t.Fatalf("usage after delete: %d", used)
+	}
+}
+
+func TestHabitTimeline(t *testing.T) {
+	env := newTestEnv(t)
+	habit := env.createHabit(env.userToken, env.user.ID, "Run")
+	other := env.createHabit(env.userToken, env.user.ID, "Read")
+	foreign := env.createHabit(env.otherTok, env.other.ID, "Swim")
+
+	w := env.request(http.MethodPost, "/api/habits/log", env.userToken, map[string]any{
+		"habit_id": habit.ID, "is_completed": false, "note": "  rained all day ",
+	})
+	expectStatus(t, w, http.StatusOK)
+	var logged struct {
+		Log models.HabitLog `json:"log"`
+	}
+	decode(t, w, &logged)
+	if logged.Log.Note != "rained all day" {
+		t.Fatalf("unexpected note %q", logged.Log.Note)
+	}
+
+	w = env.request(http.MethodPost, "/api/diary", env.userToken, map[string]any{
+		"title": "Missed run", "content": "Too wet outside", "user_id": env.user.ID, "habit_log_id": logged.Log.ID,
+	})
+	expectStatus(t, w, http.StatusOK)
+	var created struct {
+		Diary models.Diary `json:"diary"`
+	}
+	decode(t, w, &created)
+	if created.Diary.HabitID == nil || *created.Diary.HabitID != habit.ID || *created.Diary.HabitLogID != logged.Log.ID {
+		t.Fatalf("diary not linked: %+v", created.Diary)
+	}
+
+	for _, body := range []map[string]any{
+		{"habit_id": foreign.ID},
+		{"habit_id": other.ID, "habit_log_id": logged.Log.ID},
+		{"habit_log_id": 999},
+	} {
+		body["title"], body["content"], body["user_id"] = "Bad link", "text", env.user.ID
+		w = env.request(http.MethodPost, "/api/diary", env.userToken, body)
+		expectStatus(t, w, http.StatusBadRequest)
+	}
+
+	note := env.createDiary(env.userToken, env.user.ID, "Plan")
+	w = env.request(http.MethodPut, fmt.Sprintf("/api/diary/%d", note.ID), env.userToken, map[string]any{"habit_id": habit.ID})
+	expectStatus(t, w, http.StatusOK)
+	w = env.request(http.MethodGet, fmt.Sprintf("/api/diary?habit_id=%d", habit.ID), env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var linked []models.Diary
+	decode(t, w, &linked)
+	if len(linked) != 2 {
+		t.Fatalf("expected 2 linked entries, got %+v", linked)
+	}
+
+	logPath := fmt.Sprintf("/api/habits/logs/%d", logged.Log.ID)
+	w = env.request(http.MethodPatch, logPath, env.otherTok, map[string]any{"note": "mine"})
+	expectStatus(t, w, http.StatusForbidden)
+	w = env.request(http.MethodPatch, logPath, env.userToken, map[string]any{"note": strings.Repeat("x", 281)})
+	expectStatus(t, w, http.StatusBadRequest)
+	w = env.request(http.MethodPatch, logPath, env.userToken, map[string]any{"note": "storm warning"})
+	expectStatus(t, w, http.StatusOK)
+
+	path := fmt.Sprintf("/api/habits/%d/timeline", habit.ID)
+	w = env.request(http.MethodGet, path, env.otherTok, nil)
+	expectStatus(t, w, http.StatusForbidden)
+	w = env.request(http.MethodGet, path, env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var timeline services.HabitTimeline
+	decode(t, w, &timeline)
+	kinds := map[string]int{}
+	var notes []string
+	for i, item := range timeline.Items {
+		kinds[item.Type]++
+		if i > 0 && item.At.After(timeline.Items[i-1].At) {
+			t.Fatalf("timeline not sorted: %+v", timeline.Items)
+		}
+		if item.Log != nil && item.Log.Note != "" {
+			notes = append(notes, item.Log.Note)
+		}
+	}
+	// Начальная отметка при создании привычки, отметка с заметкой и две записи.
+	if kinds[services.TimelineLog] != 2 || kinds[services.TimelineDiary] != 2 || !slices.Equal(notes, []string{"storm warning"}) {
+		t.Fatalf("unexpected timeline: %+v", timeline.Items)
+	}
+
+	// Список привычек отдаёт последние отметки вместе с заметками.
+	w = env.request(http.MethodGet, "/api/habits?logs=1", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var habits []models.Habit
+	decode(t, w, &habits)
+	i := slices.IndexFunc(habits, func(h models.Habit) bool { return h.ID == habit.ID })
+	if i < 0 || len(habits[i].Logs) != 1 || habits[i].Logs[0].Note != "storm warning" {
+		t.Fatalf("list lost log notes: %+v", habits)
+	}
+
+	w = env.request(http.MethodPut, fmt.Sprintf("/api/diary/%d", note.ID), env.userToken, map[string]any{"habit_id": 0})
+	expectStatus(t, w, http.StatusOK)
+	w = env.request(http.MethodDelete, fmt.Sprintf("/api/habits/%d", habit.ID), env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	stored, _ := env.store.Diaries().GetByID(context.Background(), created.Diary.ID)
+	if stored.HabitID != nil || stored.HabitLogID != nil {
+		t.Fatalf("link kept after habit delete: %+v", stored)
+	}
+}
+
+func TestHabitCalendar(t *testing.T) {
+	env := newTestEnv(t)
+
+	read := env.createHabit(env.userToken, env.user.ID, "Read")
+	run := env.createHabit(env.userToken, env.user.ID, "Run")
+	for _, id := range []uint{read.ID, read.ID, run.ID} {
+		w := env.request(http.MethodPost, "/api/habits/log", env.userToken, map[string]any{"habit_id": id, "is_completed": true})
+		expectStatus(t, w, http.StatusOK)
+	}
+
+	type calendar struct {
+		TotalCompleted int `json:"total_completed"`
+		Days           []struct {
+			Date      string `json:"date"`
+			Total     int    `json:"total"`
+			Completed int    `json:"completed"`
+			State     string `json:"state"`
+			Level     int    `json:"level"`
+		} `json:"days"`
+	}
+
+	today := time.Now().UTC().Format(time.DateOnly)
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format(time.DateOnly)
+
+	var cal calendar
+	w := env.request(http.MethodGet, fmt.Sprintf("/api/habits/%d/calendar?from=%s&to=%s", read.ID, yesterday, today), env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &cal)
+	if len(cal.Days) != 2 || cal.TotalCompleted != 2 {
+		t.Fatalf("unexpected calendar: %+v", cal)
+	}
+	if d := cal.Days[0]; d.Date != yesterday || d.State != "none" || d.Level != 0 {
+		t.Fatalf("yesterday = %+v", d)
+	}
+	// Начальный лог привычки не выполнен, поэтому день выполнен частично.
+	if d := cal.Days[1]; d.Total != 3 || d.Completed != 2 || d.State != "partial" || d.Level != 4 {
+		t.Fatalf("today = %+v", d)
+	}
+
+	w = env.request(http.MethodGet, "/api/habits/calendar", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &cal)
+	if len(cal.Days) != 365 || cal.TotalCompleted != 3 || cal.Days[364].Date != today {
+		t.Fatalf("user calendar: %d days, %d completed", len(cal.Days), cal.TotalCompleted)
+	}
+
+	w = env.request(http.MethodGet, fmt.Sprintf("/api/habits/%d/calendar", read.ID), env.otherTok, nil)
+	expectStatus(t, w, http.StatusForbidden)
+	w = env.request(http.MethodGet, "/api/habits/calendar?from=2020-01-01&to=2024-01-01", env.userToken, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+	w = env.request(http.MethodGet, "/api/habits/calendar?tz=Mars/Olympus", env.userToken, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestHabitTrends(t *testing.T) {
+	env := newTestEnv(t)
+	habit := env.createHabit(env.userToken, env.user.ID, "Read")
+
+	ctx := context.Background()
+	for _, l := range []struct {
+		at   string
+		done bool
+	}{
+		{"2024-02-12T08:00:00Z", false},
+		{"2024-03-01T08:00:00Z", true},
+		{"2024-03-04T08:00:00Z", true},
+		{"2024-03-05T08:00:00Z", true},
+		{"2024-03-11T08:00:00Z", true},
+		{"2024-03-12T20:00:00Z", false},
+	} {
+		at, _ := time.Parse(time.RFC3339, l.at)
+		log := models.HabitLog{HabitID: habit.ID, Date: at, IsCompleted: l.done}
+		if err := env.store.HabitLogs().Create(ctx, &log); err != nil {
+			t.Fatal(err)
+		}
+		if err := env.store.Rollups().ApplyLog(ctx, env.user.ID, log); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type ratePeriod struct {
+		Total     int     `json:"total"`
+		Completed int     `json:"completed"`
+		Rate      float64 `json:"rate"`
+	}
+	type comparison struct {
+		Current  ratePeriod `json:"current"`
+		Previous ratePeriod `json:"previous"`
+		Delta    float64    `json:"delta"`
+	}
+	var trends struct {
+		Rolling []struct {
+			Days int `json:"days"`
+			ratePeriod
+		} `json:"rolling"`
+		WeekOverWeek   comparison `json:"week_over_week"`
+		MonthOverMonth comparison `json:"month_over_month"`
+		Weeks          []struct {
+			WeekStart string `json:"week_start"`
+		} `json:"weeks"`
+		Habits []struct {
+			HabitID      uint    `json:"habit_id"`
+			Rate         float64 `json:"rate"`
+			BestWeekday  string  `json:"best_weekday"`
+			WorstWeekday string  `json:"worst_weekday"`
+		} `json:"habits"`
+		Hours []struct {
+			Hour      int `json:"hour"`
+			Total     int `json:"total"`
+			Completed int `json:"completed"`
+		} `json:"hours"`
+	}
+
+	// 13 марта 2024 — среда.
+	w := env.request(http.MethodGet, "/api/habits/stats/trends?from=2024-03-01&to=2024-03-13&tz=Europe/Moscow", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &trends)
+
+	if len(trends.Rolling) != 3 || trends.Rolling[0].Days != 7 || trends.Rolling[0].Total != 2 || trends.Rolling[0].Rate != 50 {
+		t.Fatalf("rolling = %+v", trends.Rolling)
+	}
+	if wow := trends.WeekOverWeek; wow.Current.Rate != 50 || wow.Previous.Rate != 100 || wow.Delta != -50 {
+		t.Fatalf("week over week = %+v", wow)
+	}
+	if mom := trends.MonthOverMonth; mom.Current.Total != 5 || mom.Current.Rate != 80 || mom.Previous.Total != 1 || mom.Delta != 80 {
+		t.Fatalf("month over month = %+v", mom)
+	}
+	if len(trends.Weeks) != 3 || trends.Weeks[0].WeekStart != "2024-02-26" {
+		t.Fatalf("weeks = %+v", trends.Weeks)
+	}
+	if len(trends.Habits) != 1 || trends.Habits[0].BestWeekday != "monday" || trends.Habits[0].WorstWeekday != "tuesday" || trends.Habits[0].Rate != 80 {
+		t.Fatalf("habits = %+v", trends.Habits)
+	}
+	// 08:00 UTC — 11:00 по Москве.
+	if len(trends.Hours) != 24 || trends.Hours[11].Completed != 4 || trends.Hours[23].Total != 1 {
+		t.Fatalf("hours = %+v", trends.Hours)
+	}
+
+	w = env.request(http.MethodGet, "/api/habits/stats/trends?to=13-03-2024", env.userToken, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestHabitMoodCorrelations(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	day := func(n int) time.Time { return time.Date(2024, 3, n, 9, 0, 0, 0, time.UTC) }
+	habits := make(map[string]uint)
+	for title, created := range map[string]time.Time{"Run": day(1), "Read": day(1), "New": day(6)} {
+		habit := models.Habit{UserID: env.user.ID, Title: title, Frequency: "daily", IsActive: true, CreatedAt: created}
+		if err := env.store.Habits().Create(ctx, &habit); err != nil {
+			t.Fatal(err)
+		}
+		habits[title] = habit.ID
+	}
+
+	// Бег — в первые четыре дня, на пятый отметка без выполнения.
+	for n := 1; n <= 5; n++ {
+		log := models.HabitLog{HabitID: habits["Run"], Date: day(n), IsCompleted: n <= 4}
+		if err := env.store.HabitLogs().Create(ctx, &log); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for n, mood := range []int{5, 4, 5, 4, 2, 3, 2, 3} {
+		mood := mood
+		diary := models.Diary{UserID: env.user.ID, Title: "T", Content: "C", Mood: &mood, CreatedAt: day(n + 1)}
+		if err := env.store.Diaries().Create(ctx, &diary); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := env.request(http.MethodGet, "/api/habits/stats/mood?from=2024-03-01&to=2024-03-10", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var result struct {
+		Days   int `json:"days"`
+		Habits []struct {
+			HabitID uint                `json:"habit_id"`
+			Mood    services.MoodEffect `json:"mood"`
+			Energy  services.MoodEffect `json:"energy"`
+		} `json:"habits"`
+	}
+	decode(t, w, &result)
+	if result.Days != 8 || len(result.Habits) != 3 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	run := result.Habits[0]
+	if run.HabitID != habits["Run"] || run.Mood.DaysWith != 4 || run.Mood.DaysWithout != 4 {
+		t.Fatalf("unexpected run samples: %+v", run)
+	}
+	if run.Mood.Difference == nil || *run.Mood.Difference != 2 || run.Mood.Correlation == nil || math.Abs(*run.Mood.Correlation-0.894) > 0.001 {
+		t.Fatalf("unexpected run effect: %+v", run.Mood)
+	}
+	if run.Energy.DaysWith != 0 || run.Energy.Correlation != nil {
+		t.Fatalf("energy without data: %+v", run.Energy)
+	}
+	for _, h := range result.Habits[1:] {
+		if h.Mood.Correlation != nil || h.Mood.Difference != nil || h.Mood.DaysWith != 0 {
+			t.Fatalf("habit %d without completions: %+v", h.HabitID, h.Mood)
+		}
+		if h.HabitID == habits["New"] && h.Mood.DaysWithout != 3 {
+			t.Fatalf("days before creation counted: %+v", h.Mood)
+		}
+	}
+}
+
+func TestReports(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	habit := models.Habit{UserID: env.user.ID, Title: "Read <b>books</b>", Frequency: "daily", IsActive: true,
+		CreatedAt: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)}
+	if err := env.store.Habits().Create(ctx, &habit); err != nil {
+		t.Fatal(err)
+	}
+	// Неделя 4–10 марта 2024: серия 1 на начало и 2 к концу, 4 из 7 дней.
+	for _, l := range []struct {
+		day  int
+		done bool
+	}{{1, true}, {4, true}, {5, true}, {8, false}, {9, true}, {10, true}} {
+		log := models.HabitLog{HabitID: habit.ID, Date: time.Date(2024, 3, l.day, 9, 0, 0, 0, time.UTC), IsCompleted: l.done}
+		if err := env.store.HabitLogs().Create(ctx, &log); err != nil {
+			t.Fatal(err)
+		}
+		if err := env.store.Rollups().ApplyLog(ctx, env.user.ID, log); err != nil {
+			t.Fatal(err)
+		}
+	}
+	award := models.Achievement{UserID: env.user.ID, Title: "Первая неделя", EarnedAt: time.Date(2024, 3, 6, 0, 0, 0, 0, time.UTC)}
+	if err := env.store.Achievements().Create(ctx, &award); err != nil {
+		t.Fatal(err)
+	}
+
+	generate := map[string]any{"period": "weekly", "date": "2024-03-06", "user_id": env.user.ID}
+	w := env.request(http.MethodPost, "/api/admin/reports/generate", env.userToken, generate)
+	expectStatus(t, w, http.StatusForbidden)
+	w = env.request(http.MethodPost, "/api/admin/reports/generate", env.adminTok, generate)
+	expectStatus(t, w, http.StatusCreated)
+	var report models.Report
+	decode(t, w, &report)
+	w = env.request(http.MethodPost, "/api/admin/reports/generate", env.adminTok, generate)
+	expectStatus(t, w, http.StatusConflict)
+
+	var data services.ReportData
+	if err := json.Unmarshal(report.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.From != "2024-03-04" || data.To != "2024-03-10" || data.Scheduled != 7 || data.Completed != 4 {
+		t.Fatalf("report data = %+v", data)
+	}
+	if h := data.Habits[0]; h.StreakBefore != 1 || h.StreakAfter != 2 || h.StreakChange != 1 {
+		t.Fatalf("habit = %+v", h)
+	}
+	if len(data.Achievements) != 1 {
+		t.Fatalf("achievements = %+v", data.Achievements)
+	}
+
+	// Остальным пользователям отчёт собирается, повторно alice — нет.
+	w = env.request(http.MethodPost, "/api/admin/reports/generate", env.adminTok, map[string]any{"period": "weekly", "date": "2024-03-06"})
+	expectStatus(t, w, http.StatusOK)
+	var generated struct {
+		Created int `json:"created"`
+	}
+	decode(t, w, &generated)
+	if generated.Created != 2 {
+		t.Fatalf("created = %d, want 2", generated.Created)
+	}
+
+	w = env.request(http.MethodGet, "/api/reports?period=weekly", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var reports []models.Report
+	decode(t, w, &reports)
+	if len(reports) != 1 || reports[0].ID != report.ID {
+		t.Fatalf("reports = %+v", reports)
+	}
+	w = env.request(http.MethodGet, "/api/reports?period=daily", env.userToken, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+
+	path := fmt.Sprintf("/api/reports/%d", report.ID)
+	w = env.request(http.MethodGet, path, env.otherTok, nil)
+	expectStatus(t, w, http.StatusForbidden)
+
+	w = env.request(http.MethodGet, path+"?format=markdown", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	if body := w.Body.String(); !strings.Contains(body, "Выполнено 4 из 7") || !strings.Contains(body, "**Первая неделя**") {
+		t.Fatalf("markdown:\n%s", body)
+	}
+	w = env.request(http.MethodGet, path+"?format=html", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	if body := w.Body.String(); !strings.Contains(body, "Read &lt;b&gt;books&lt;/b&gt;") {
+		t.Fatalf("html is not escaped:\n%s", body)
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	env := newTestEnv(t)
+
+	for _, title := range []string{"Run", "Read", "Swim", "Cook", "Walk"} {
+		env.createHabit(env.userToken, env.user.ID, title)
+	}
+
+	// Проходим страницы по ссылкам из Link, как это делал бы клиент.
+	var titles []string
+	path := "/api/habits?limit=2&sort=-title"
+	for pages := 0; path != ""; pages++ {
+		if pages > 3 {
+			t.Fatal("pagination does not terminate")
+		}
+		w := env.request(http.MethodGet, path, env.userToken, nil)
+		expectStatus(t, w, http.StatusOK)
+		var habits []models.Habit
+		decode(t, w, &habits)
+		for _, habit := range habits {
+			titles = append(titles, habit.Title)
+		}
+
+		path = ""
+		if link := w.Header().Get("Link"); link != "" {
+			path = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+			if w.Header().Get("X-Next-Cursor") == "" {
+				t.Fatal("Link without X-Next-Cursor")
+			}
+		}
+	}
+	if got := strings.Join(titles, ","); got != "Walk,Swim,Run,Read,Cook" {
+		t.Fatalf("titles = %s", got)
+	}
+
+	w := env.request(http.MethodGet, "/api/habits?sort=password_hash", env.userToken, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+	w = env.request(http.MethodGet, "/api/habits?limit=1000", env.userToken, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+	w = env.request(http.MethodGet, "/api/habits?cursor=garbage", env.userToken, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestListFilters(t *testing.T) {
+	env := newTestEnv(t)
+
+	habit := env.createHabit(env.userToken, env.user.ID, "Read")
+	env.createHabit(env.userToken, env.user.ID, "Run")
+	w := env.request(http.MethodPut, fmt.Sprintf("/api/habits/%d", habit.ID), env.userToken, map[string]any{"is_active": false})
+	expectStatus(t, w, http.StatusOK)
+
+	w = env.request(http.MethodGet, "/api/habits?is_active=false&logs=0", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var habits []models.Habit
+	decode(t, w, &habits)
+	if len(habits) != 1 || habits[0].ID != habit.ID || len(habits[0].Logs) != 0 {
+		t.Fatalf("unexpected habits: %+v", habits)
+	}
+
+	w = env.request(http.MethodGet, "/api/habits?frequency=hourly", env.userToken, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+
+	// Диапазон дат: to в виде даты включает весь день.
+	env.createDiary(env.userToken, env.user.ID, "Today")
+	today := time.Now().UTC().Format(time.DateOnly)
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format(time.DateOnly)
+
+	var diaries []models.Diary
+	w = env.request(http.MethodGet, "/api/diary?from="+today+"&to="+today, env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &diaries)
+	if len(diaries) != 1 {
+		t.Fatalf("got %d diaries for today, want 1", len(diaries))
+	}
+	w = env.request(http.MethodGet, "/api/diary?to="+yesterday, env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &diaries)
+	if len(diaries) != 0 {
+		t.Fatalf("got %d diaries before today, want 0", len(diaries))
+	}
+	w = env.request(http.MethodGet, "/api/diary?from="+today+"&to="+yesterday, env.userToken, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+
+	w = env.request(http.MethodGet, "/api/habits/logs?is_completed=false&habit_id="+fmt.Sprint(habit.ID), env.adminTok, nil)
+	expectStatus(t, w, http.StatusOK)
+	var logs []models.HabitLog
+	decode(t, w, &logs)
+	if len(logs) != 1 || logs[0].HabitID != habit.ID {
+		t.Fatalf("unexpected logs: %+v", logs)
+	}
+
+	var users []models.User
+	w = env.request(http.MethodGet, "/api/users?role=admin", "", nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &users)
+	if len(users) != 1 || users[0].Username != "root" {
+		t.Fatalf("unexpected users: %+v", users)
+	}
+}
+
+func TestCacheAdmin(t *testing.T) {
+	env := newTestEnv(t)
+
+	w := env.request(http.MethodDelete, "/api/cache/clear", env.userToken, nil)
+	expectStatus(t, w, http.StatusForbidden)
+
+	w = env.request(http.MethodDelete, "/api/cache/clear", env.adminTok, nil)
+	expectStatus(t, w, http.StatusOK)
+
+	w = env.request(http.MethodDelete, fmt.Sprintf("/api/cache/user/%d", env.user.ID), env.adminTok, nil)
+	expectStatus(t, w, http.StatusOK)
+
+	w = env.request(http.MethodDelete, "/api/cache/user/abc", env.adminTok, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestLoginRateLimited(t *testing.T) {
+	env := newTestEnv(t)
+
+	// Вход в следующую секунду выдаёт другой токен — как на втором
+	// устройстве. Вместе с newTestEnv это четыре попытки входа из десяти.
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	device := env.login("alice")
+	if device == env.userToken {
+		t.Fatal("second login returned the same token")
+	}
+
+	wrong := map[string]string{"username": "alice", "password": "wrong"}
+	for i := 0; i < 6; i++ {
+		w := env.request(http.MethodPost, "/api/login", "", wrong)
+		expectStatus(t, w, http.StatusUnauthorized)
+	}
+
+	w := env.request(http.MethodPost, "/api/login", "", wrong)
+	expectStatus(t, w, http.StatusTooManyRequests)
+	if w.Header().Get("Retry-After") == "" {
+		t.Fatal("429 without Retry-After")
+	}
+	if got := w.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Fatalf("RateLimit-Remaining = %q, want 0", got)
+	}
+	if got := w.Header().Get("RateLimit-Policy"); got != "10;w=60" {
+		t.Fatalf("RateLimit-Policy = %q", got)
+	}
+
+	// Лимит входа не затрагивает остальные маршруты.
+	w = env.request(http.MethodGet, "/api/profile", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	if got := w.Header().Get("RateLimit-Limit"); got != "100" {
+		t.Fatalf("RateLimit-Limit = %q, want 100", got)
+	}
+
+	// Лимит токена исчерпывается раньше общего лимита пользователя и не
+	// мешает его другому устройству.
+	for i := 1; i < 60; i++ {
+		w = env.request(http.MethodGet, "/api/profile", env.userToken, nil)
+		expectStatus(t, w, http.StatusOK)
+	}
+	w = env.request(http.MethodGet, "/api/profile", env.userToken, nil)
+	expectStatus(t, w, http.StatusTooManyRequests)
+	if got := w.Header().Get("RateLimit-Policy"); got != "60;w=60" {
+		t.Fatalf("RateLimit-Policy = %q, want the token policy", got)
+	}
+	w = env.request(http.MethodGet, "/api/profile", device, nil)
+	expectStatus(t, w, http.StatusOK)
+	if got := w.Header().Get("RateLimit-Remaining"); got != "39" {
+		t.Fatalf("user RateLimit-Remaining = %q, want 39", got)
+	}
+}
+
+func TestRateLimitOverrides(t *testing.T) {
+	env := newTestEnv(t)
+
+	override := map[string]any{"subject": "ip:192.0.2.1", "exempt": true, "note": "office"}
+	w := env.request(http.MethodPut, "/api/admin/rate-limits", env.userToken, override)
+	expectStatus(t, w, http.StatusForbidden)
+
+	w = env.request(http.MethodPut, "/api/admin/rate-limits", env.adminTok, map[string]any{"subject": "alice"})
+	expectStatus(t, w, http.StatusBadRequest)
+
+	w = env.request(http.MethodPut, "/api/admin/rate-limits", env.adminTok, override)
+	expectStatus(t, w, http.StatusOK)
+	var saved models.RateLimitOverride
+	decode(t, w, &saved)
+
+	// Для адреса из списка исключений лимит входа не действует.
+	for i := 0; i < 12; i++ {
+		w = env.request(http.MethodPost, "/api/login", "", map[string]string{"username": "alice", "password": "wrong"})
+		expectStatus(t, w, http.StatusUnauthorized)
+	}
+
+	// Множитель поднимает лимит пользователя.
+	w = env.request(http.MethodPut, "/api/admin/rate-limits", env.adminTok, map[string]any{
+		"subject":    fmt.Sprintf("user:%d", env.user.ID),
+		"multiplier": 2.5,
+	})
+	expectStatus(t, w, http.StatusOK)
+	w = env.request(http.MethodGet, "/api/profile", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	if got := w.Header().Get("RateLimit-Limit"); got != "250" {
+		t.Fatalf("RateLimit-Limit = %q, want 250", got)
+	}
+
+	w = env.request(http.MethodGet, "/api/admin/rate-limits", env.adminTok, nil)
+	expectStatus(t, w, http.StatusOK)
+	var list []models.RateLimitOverride
+	decode(t, w, &list)
+	if len(list) != 2 {
+		t.Fatalf("got %d overrides, want 2", len(list))
+	}
+
+	w = env.request(http.MethodDelete, fmt.Sprintf("/api/admin/rate-limits/%d", saved.ID), env.adminTok, nil)
+	expectStatus(t, w, http.StatusOK)
+	w = env.request(http.MethodDelete, fmt.Sprintf("/api/admin/rate-limits/%d", saved.ID), env.adminTok, nil)
+	expectStatus(t, w, http.StatusNotFound)
+
+	// Запросы под исключением бюджет не тратили: после его снятия
+	// остаются те же семь попыток.
+	for i := 0; i < 7; i++ {
+		w = env.request(http.MethodPost, "/api/login", "", map[string]string{"username": "alice", "password": "wrong"})
+		expectStatus(t, w, http.StatusUnauthorized)
+	}
+	w = env.request(http.MethodPost, "/api/login", "", map[string]string{"username": "alice", "password": "wrong"})
+	expectStatus(t, w, http.StatusTooManyRequests)
+}
+
+func TestCacheInvalidatedOnWrites(t *testing.T) {
+	env := newTestEnv(t)
+
+	listDiaries := func(token string) ([]models.Diary, string) {
+		t.Helper()
+		w := env.request(http.MethodGet, "/api/diary", token, nil)
+		expectStatus(t, w, http.StatusOK)
+		var diaries []models.Diary
+		decode(t, w, &diaries)
+		return diaries, w.Header().Get("X-Cache")
+	}
+
+	listDiaries(env.userToken)
+	listDiaries(env.otherTok)
+	listDiaries(env.adminTok)
+	if _, hit := listDiaries(env.userToken); hit != "HIT" {
+		t.Fatalf("second list X-Cache = %q, want HIT", hit)
+	}
+
+	diary := env.createDiary(env.userToken, env.user.ID, "Fresh")
+	diaries, hit := listDiaries(env.userToken)
+	if hit != "MISS" || len(diaries) != 1 {
+		t.Fatalf("after create: X-Cache = %q, diaries = %+v", hit, diaries)
+	}
+	// Запись alice не трогает кэш bob, но сбрасывает админскую выборку.
+	if _, hit := listDiaries(env.otherTok); hit != "HIT" {
+		t.Fatalf("foreign cache was purged: X-Cache = %q", hit)
+	}
+	if diaries, hit := listDiaries(env.adminTok); hit != "MISS" || len(diaries) != 1 {
+		t.Fatalf("admin list: X-Cache = %q, diaries = %+v", hit, diaries)
+	}
+
+	w := env.request(http.MethodPut, fmt.Sprintf("/api/diary/%d", diary.ID), env.userToken, map[string]any{"title": "Renamed"})
+	expectStatus(t, w, http.StatusOK)
+	if diaries, _ := listDiaries(env.userToken); len(diaries) != 1 || diaries[0].Title != "Renamed" {
+		t.Fatalf("stale diary after update: %+v", diaries)
+	}
+
+	habit := env.createHabit(env.userToken, env.user.ID, "Run")
+	statsLogs := func() int {
+		t.Helper()
+		w := env.request(http.MethodGet, "/api/habits/stats", env.userToken, nil)
+		expectStatus(t, w, http.StatusOK)
+		var stats struct {
+			HabitStats []struct {
+				TotalLogs int `json:"total_logs"`
+			} `json:"habit_stats"`
+		}
+		decode(t, w, &stats)
+		if len(stats.HabitStats) != 1 {
+			t.Fatalf("unexpected stats: %+v", stats)
+		}
+		return stats.HabitStats[0].TotalLogs
+	}
+
+	if n := statsLogs(); n != 1 {
+		t.Fatalf("total logs = %d, want 1", n)
+	}
+	w = env.request(http.MethodPost, "/api/habits/log", env.userToken, map[string]any{"habit_id": habit.ID})
+	expectStatus(t, w, http.StatusOK)
+	if n := statsLogs(); n != 2 {
+		t.Fatalf("stats were not invalidated after log: total logs = %d", n)
+	}
+}
+
+func TestConditionalGetWithETag(t *testing.T) {
+	env := newTestEnv(t)
+	env.createDiary(env.userToken, env.user.ID, "Cached")
+
+	get := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/diary", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		return env.send(req, env.userToken)
+	}
+
+	w := get("", "")
+	expectStatus(t, w, http.StatusOK)
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("ETag header is missing")
+	}
+
+	// Совпадение проверяется и на свежем ответе, и на ответе из кэша.
+	for i := 0; i < 2; i++ {
+		w = get("If-None-Match", etag)
+		expectStatus(t, w, http.StatusNotModified)
+		if w.Body.Len() != 0 {
+			t.Fatalf("304 with body: %s", w.Body.String())
+		}
+		if w.Header().Get("ETag") != etag {
+			t.Fatalf("304 ETag = %q, want %q", w.Header().Get("ETag"), etag)
+		}
+	}
+	w = get("If-None-Match", `"other", W/`+etag)
+	expectStatus(t, w, http.StatusNotModified)
+
+	env.createDiary(env.userToken, env.user.ID, "Second")
+	w = get("If-None-Match", etag)
+	expectStatus(t, w, http.StatusOK)
+	if w.Header().Get("ETag") == etag {
+		t.Fatal("ETag did not change after write")
+	}
+
+	w = env.request(http.MethodGet, "/api/habits", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	if w.Header().Get("ETag") == "" {
+		t.Fatal("habits list has no ETag")
+	}
+}
+
+func TestConditionalGetWithLastModified(t *testing.T) {
+	env := newTestEnv(t)
+	diary := env.createDiary(env.userToken, env.user.ID, "Dated")
+
+	// Last-Modified отдаётся только для меток старше текущей секунды.
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+	path := fmt.Sprintf("/api/diary/%d", diary.ID)
+	w := env.request(http.MethodGet, path, env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	lastModified := w.Header().Get("Last-Modified")
+	if lastModified == "" {
+		t.Fatal("Last-Modified header is missing")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("If-Modified-Since", lastModified)
+	expectStatus(t, env.send(req, env.userToken), http.StatusNotModified)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/diary", nil)
+	req.Header.Set("If-Modified-Since", lastModified)
+	expectStatus(t, env.send(req, env.userToken), http.StatusNotModified)
+
+	// Удаление не оставляет updated_at, но всё равно сдвигает Last-Modified выборки.
+	w = env.request(http.MethodDelete, path, env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	req = httptest.NewRequest(http.MethodGet, "/api/diary", nil)
+	req.Header.Set("If-Modified-Since", lastModified)
+	w = env.send(req, env.userToken)
+	expectStatus(t, w, http.StatusOK)
+	if w.Body.String() != "[]" {
+		t.Fatalf("stale list after delete: %s", w.Body.String())
+	}
+}
+
+func TestIfMatchPreventsLostUpdates(t *testing.T) {
+	env := newTestEnv(t)
+	diary := env.createDiary(env.userToken, env.user.ID, "Shared")
+	path := fmt.Sprintf("/api/diary/%d", diary.ID)
+
+	w := env.request(http.MethodGet, path, env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	etag := w.Header().Get("ETag")
+
+	put := func(ifMatch, content string) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(map[string]any{"content": content})
+		req := httptest.NewRequest(http.MethodPut, path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		return env.send(req, env.userToken)
+	}
+
+	w = put(`"stale"`, "lost")
+	expectStatus(t, w, http.StatusPreconditionFailed)
+
+	w = put(etag, "first")
+	expectStatus(t, w, http.StatusOK)
+	newETag := w.Header().Get("ETag")
+	if newETag == "" || newETag == etag {
+		t.Fatalf("update returned ETag %q, old %q", newETag, etag)
+	}
+
+	// Второй клиент с устаревшей версией не затирает первое изменение.
+	w = put(etag, "second")
+	expectStatus(t, w, http.StatusPreconditionFailed)
+	stored, _ := env.store.Diaries().GetByID(context.Background(), diary.ID)
+	if stored.Content != "first" {
+		t.Fatalf("content = %q, want first", stored.Content)
+	}
+
+	expectStatus(t, put("W/"+newETag, "weak"), http.StatusPreconditionFailed)
+	expectStatus(t, put("*", "any"), http.StatusOK)
+
+	habit := env.createHabit(env.userToken, env.user.ID, "Stretch")
+	w = env.request(http.MethodGet, fmt.Sprintf("/api/habits/%d", habit.ID), env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	habitETag := w.Header().Get("ETag")
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/habits/%d", habit.ID), nil)
+	req.Header.Set("If-None-Match", habitETag)
+	expectStatus(t, env.send(req, env.userToken), http.StatusNotModified)
+
+	data, _ := json.Marshal(map[string]any{"frequency": "weekly"})
+	req = httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/habits/%d", habit.ID), bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"habit-0-0"`)
+	expectStatus(t, env.send(req, env.userToken), http.StatusPreconditionFailed)
+}
+
+func TestUsersAndDebugContext(t *testing.T) {
+	env := newTestEnv(t)
+
+	w := env.request(http.MethodGet, "/api/users", "", nil)
+	expectStatus(t, w, http.StatusOK)
+	var users []models.User
+	decode(t, w, &users)
+	if len(users) != 3 || users[0].City.Name != "Almaty" {
+		t.Fatalf("unexpected users: %+v", users)
+	}
+
+	w = env.request(http.MethodGet, "/debug/context", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	if !strings.Contains(w.Body.String(), `"user_exists":true`) {
+		t.Fatalf("unexpected debug body: %s", w.Body.String())
+	}
+}
+
+func TestCSRFRequiredForUnsafeMethods(t *testing.T) {
+	env := newTestEnv(t)
+	habit := env.createHabit(env.userToken, env.user.ID, "Walk")
+
+	req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/habits/%d", habit.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+env.userToken)
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403 without CSRF token", w.Code)
+	}
+}
+
+func TestJournalPrompts(t *testing.T) {
+	env := newTestEnv(t)
+
+	w := env.request(http.MethodPost, "/api/admin/prompts", env.userToken, map[string]any{"category": "daily", "text": "Nope"})
+	expectStatus(t, w, http.StatusForbidden)
+	w = env.request(http.MethodPost, "/api/admin/prompts", env.adminTok, map[string]any{"category": "monthly", "text": "Nope"})
+	expectStatus(t, w, http.StatusBadRequest)
+
+	var prompts []models.JournalPrompt
+	for _, body := range []map[string]any{
+		{"category": "daily", "text": "What went well?"},
+		{"category": "daily", "text": "What drained you?"},
+		{"category": "daily", "text": "Retired", "is_active": false},
+	} {
+		w = env.request(http.MethodPost, "/api/admin/prompts", env.adminTok, body)
+		expectStatus(t, w, http.StatusCreated)
+		var prompt models.JournalPrompt
+		decode(t, w, &prompt)
+		prompts = append(prompts, prompt)
+	}
+	if !prompts[0].IsActive || prompts[2].IsActive {
+		t.Fatalf("unexpected active flags: %+v", prompts)
+	}
+
+	w = env.request(http.MethodGet, "/api/diary/prompts?category=daily", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var active []models.JournalPrompt
+	decode(t, w, &active)
+	if len(active) != 2 {
+		t.Fatalf("expected 2 active prompts, got %+v", active)
+	}
+	w = env.request(http.MethodGet, "/api/admin/prompts?active=false", env.adminTok, nil)
+	expectStatus(t, w, http.StatusOK)
+	var inactive []models.JournalPrompt
+	decode(t, w, &inactive)
+	if len(inactive) != 1 || inactive[0].ID != prompts[2].ID {
+		t.Fatalf("unexpected inactive prompts: %+v", inactive)
+	}
+
+	// Вчерашняя подсказка не должна повториться сегодня.
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format(time.DateOnly)
+	if err := env.store.Prompts().Assign(context.Background(), &models.PromptAssignment{
+		UserID: env.user.ID, Day: yesterday, Category: models.PromptDaily, PromptID: prompts[0].ID,
+	}); err != nil {
+		t.Fatalf("assign: %v", err)
+	}
+
+	var today services.TodayPrompt
+	for range 2 {
+		w = env.request(http.MethodGet, "/api/diary/prompt/today?category=daily&tz=UTC", env.userToken, nil)
+		expectStatus(t, w, http.StatusOK)
+		decode(t, w, &today)
+		if today.Prompt.ID != prompts[1].ID || today.Answered {
+			t.Fatalf("unexpected prompt of the day: %+v", today)
+		}
+	}
+	for _, query := range []string{"category=monthly", "tz=Mars/Olympus"} {
+		w = env.request(http.MethodGet, "/api/diary/prompt/today?"+query, env.userToken, nil)
+		expectStatus(t, w, http.StatusBadRequest)
+	}
+
+	w = env.request(http.MethodPost, "/api/diary", env.userToken, map[string]any{
+		"title": "Answer", "content": "Traffic", "user_id": env.user.ID, "prompt_id": 999,
+	})
+	expectStatus(t, w, http.StatusBadRequest)
+	w = env.request(http.MethodPost, "/api/diary", env.userToken, map[string]any{
+		"title": "Answer", "content": "Traffic", "user_id": env.user.ID, "prompt_id": today.Prompt.ID,
+	})
+	expectStatus(t, w, http.StatusOK)
+
+	w = env.request(http.MethodGet, "/api/diary/prompt/today?category=daily", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &today)
+	if !today.Answered {
+		t.Fatalf("prompt not marked answered: %+v", today)
+	}
+	w = env.request(http.MethodGet, fmt.Sprintf("/api/diary?prompt_id=%d", today.Prompt.ID), env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var answers []models.Diary
+	decode(t, w, &answers)
+	if len(answers) != 1 {
+		t.Fatalf("expected 1 answer, got %+v", answers)
+	}
+
+	w = env.request(http.MethodGet, "/api/admin/prompts/stats", env.userToken, nil)
+	expectStatus(t, w, http.StatusForbidden)
+	w = env.request(http.MethodGet, "/api/admin/prompts/stats", env.adminTok, nil)
+	expectStatus(t, w, http.StatusOK)
+	var stats []services.PromptEngagement
+	decode(t, w, &stats)
+	byID := map[uint]services.PromptEngagement{}
+	for _, s := range stats {
+		byID[s.Prompt.ID] = s
+	}
+	if s := byID[prompts[1].ID]; s.Shown != 1 || s.Answered != 1 || s.Users != 1 || s.ResponseRate == nil || *s.ResponseRate != 1 {
+		t.Fatalf("unexpected stats for answered prompt: %+v", s)
+	}
+	if s := byID[prompts[0].ID]; s.Shown != 1 || s.Answered != 0 {
+		t.Fatalf("unexpected stats for unanswered prompt: %+v", s)
+	}
+	if s := byID[prompts[2].ID]; s.Shown != 0 || s.ResponseRate != nil {
+		t.Fatalf("unexpected stats for unused prompt: %+v", s)
+	}
+
+	w = env.request(http.MethodDelete, fmt.Sprintf("/api/admin/prompts/%d", prompts[1].ID), env.adminTok, nil)
+	expectStatus(t, w, http.StatusConflict)
+	w = env.request(http.MethodPut, fmt.Sprintf("/api/admin/prompts/%d", prompts[1].ID), env.adminTok, map[string]any{"is_active": false})
+	expectStatus(t, w, http.StatusOK)
+	w = env.request(http.MethodDelete, fmt.Sprintf("/api/admin/prompts/%d", prompts[0].ID), env.adminTok, nil)
+	expectStatus(t, w, http.StatusOK)
+	w = env.request(http.MethodPut, fmt.Sprintf("/api/admin/prompts/%d", prompts[0].ID), env.adminTok, map[string]any{"text": "Gone"})
+	expectStatus(t, w, http.StatusNotFound)
+}
+
+func TestDiaryMarkdown(t *testing.T) {
+	env := newTestEnv(t)
+
+	w := env.request(http.MethodPost, "/api/diary", env.userToken, map[string]any{
+		"title": "XSS", "content": "<script>alert(1)</script><!-- x -->", "user_id": env.user.ID,
+	})
+	expectStatus(t, w, http.StatusBadRequest)
+
+	w = env.request(http.MethodPost, "/api/diary", env.userToken, map[string]any{
+		"title": "Day", "content": "**Good** day<img src=x onerror=alert(1)>\n\n[more](javascript:alert(1))", "user_id": env.user.ID,
+	})
+	expectStatus(t, w, http.StatusOK)
+	var created struct {
+		Diary models.Diary `json:"diary"`
+	}
+	decode(t, w, &created)
+	if created.Diary.Content != "**Good** day\n\n[more](javascript:alert(1))" {
+		t.Fatalf("content not sanitized: %q", created.Diary.Content)
+	}
+	wantHTML := "<p><strong>Good</strong> day</p>\n<p>more</p>"
+	if created.Diary.ContentHTML != wantHTML {
+		t.Fatalf("unexpected html %q", created.Diary.ContentHTML)
+	}
+
+	w = env.request(http.MethodGet, "/api/diary", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var listed []models.Diary
+	decode(t, w, &listed)
+	if len(listed) != 1 || listed[0].ContentHTML != wantHTML {
+		t.Fatalf("list without rendered content: %+v", listed)
+	}
+
+	path := fmt.Sprintf("/api/diary/%d", created.Diary.ID)
+	w = env.request(http.MethodPut, path, env.userToken, map[string]any{"content": "- <b>one</b>\n- two"})
+	expectStatus(t, w, http.StatusOK)
+	w = env.request(http.MethodGet, path, env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var fetched models.Diary
+	decode(t, w, &fetched)
+	if fetched.Content != "- one\n- two" || fetched.ContentHTML != "<ul>\n<li>one</li>\n<li>two</li>\n</ul>" {
+		t.Fatalf("unexpected diary after update: %q / %q", fetched.Content, fetched.ContentHTML)
+	}
+}
+
+func TestNotificationDeadLetters(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	inapp := models.NotificationDeadLetter{UserID: env.user.ID, Channel: models.ChannelInApp, Type: "report", Subject: "Ready", Body: "Done", Attempts: 5, LastError: "db down"}
+	email := models.NotificationDeadLetter{UserID: env.user.ID, Channel: models.ChannelEmail, Type: "report", Attempts: 1, LastError: "550"}
+	for _, letter := range []*models.NotificationDeadLetter{&inapp, &email} {
+		if err := env.store.DeadLetters().Create(ctx, letter); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := env.request(http.MethodGet, "/api/admin/notifications/dead-letters", env.userToken, nil)
+	expectStatus(t, w, http.StatusForbidden)
+	w = env.request(http.MethodGet, "/api/admin/notifications/dead-letters?channel=email", env.adminTok, nil)
+	expectStatus(t, w, http.StatusOK)
+	var letters []models.NotificationDeadLetter
+	decode(t, w, &letters)
+	if len(letters) != 1 || letters[0].ID != email.ID {
+		t.Fatalf("unexpected dead letters: %+v", letters)
+	}
+
+	// Почта в тестовом окружении не настроена.
+	w = env.request(http.MethodPost, fmt.Sprintf("/api/admin/notifications/dead-letters/%d/retry", email.ID), env.adminTok, nil)
+	expectStatus(t, w, http.StatusConflict)
+
+	w = env.request(http.MethodPost, fmt.Sprintf("/api/admin/notifications/dead-letters/%d/retry", inapp.ID), env.adminTok, nil)
+	expectStatus(t, w, http.StatusOK)
+	var retried struct {
+		Delivered bool `json:"delivered"`
+	}
+	decode(t, w, &retried)
+	if !retried.Delivered {
+		t.Fatalf("retry not delivered: %s", w.Body.String())
+	}
+	if _, err := env.store.DeadLetters().GetByID(ctx, inapp.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("delivered dead letter kept: %v", err)
+	}
+
+	w = env.request(http.MethodPost, "/api/admin/notifications/dead-letters/999/retry", env.adminTok, nil)
+	expectStatus(t, w, http.StatusNotFound)
+}
+
+func TestHabitReminders(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	habit := env.createHabit(env.userToken, env.user.ID, "Stretch")
+	path := fmt.Sprintf("/api/habits/%d/reminders", habit.ID)
+
+	w := env.request(http.MethodPost, path, env.userToken, map[string]any{"time": "20:15", "days": []int{5, 1, 1}})
+	expectStatus(t, w, http.StatusCreated)
+	var evening models.HabitReminder
+	decode(t, w, &evening)
+	if evening.Time != "20:15" || !slices.Equal(evening.Days, []int{1, 5}) || evening.UserID != env.user.ID {
+		t.Fatalf("unexpected reminder: %+v", evening)
+	}
+	w = env.request(http.MethodPost, path, env.userToken, map[string]any{"time": "07:00"})
+	expectStatus(t, w, http.StatusCreated)
+
+	for _, body := range []map[string]any{
+		{"time": "25:00"},
+		{"time": "7:00"},
+		{"time": "08:00", "days": []int{0}},
+		{"days": []int{1}},
+	} {
+		w = env.request(http.MethodPost, path, env.userToken, body)
+		expectStatus(t, w, http.StatusBadRequest)
+	}
+	w = env.request(http.MethodPost, path, env.userToken, map[string]any{"time": "07:00"})
+	expectStatus(t, w, http.StatusConflict)
+	w = env.request(http.MethodPost, path, env.otherTok, map[string]any{"time": "09:00"})
+	expectStatus(t, w, http.StatusForbidden)
+	w = env.request(http.MethodGet, path, env.otherTok, nil)
+	expectStatus(t, w, http.StatusForbidden)
+
+	w = env.request(http.MethodGet, path, env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var reminders []models.HabitReminder
+	decode(t, w, &reminders)
+	if len(reminders) != 2 || reminders[0].Time != "07:00" || reminders[1].ID != evening.ID {
+		t.Fatalf("unexpected reminders: %+v", reminders)
+	}
+
+	reminderPath := fmt.Sprintf("/api/habits/reminders/%d", evening.ID)
+	w = env.request(http.MethodPut, reminderPath, env.userToken, map[string]any{"time": "07:00"})
+	expectStatus(t, w, http.StatusConflict)
+	w = env.request(http.MethodPut, reminderPath, env.otherTok, map[string]any{"time": "21:00"})
+	expectStatus(t, w, http.StatusForbidden)
+	w = env.request(http.MethodPut, reminderPath, env.userToken, map[string]any{"time": "21:00"})
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &evening)
+	if evening.Time != "21:00" || len(evening.Days) != 0 {
+		t.Fatalf("reminder not updated: %+v", evening)
+	}
+
+	w = env.request(http.MethodDelete, reminderPath, env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	w = env.request(http.MethodDelete, reminderPath, env.userToken, nil)
+	expectStatus(t, w, http.StatusNotFound)
+
+	// Напоминания удаляются вместе с привычкой.
+	w = env.request(http.MethodDelete, fmt.Sprintf("/api/habits/%d", habit.ID), env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	left, err := env.store.Reminders().List(ctx, repository.ReminderFilter{HabitID: &habit.ID})
+	if err != nil || len(left) != 0 {
+		t.Fatalf("reminders left after habit delete: %+v, %v", left, err)
+	}
+}
+
+func TestNotificationInbox(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	award := fmt.Sprintf("/api/admin/users/%d/achievements", env.user.ID)
+	w := env.request(http.MethodPost, award, env.userToken, map[string]string{"title": "Self-made"})
+	expectStatus(t, w, http.StatusForbidden)
+	w = env.request(http.MethodPost, award, env.adminTok, map[string]string{"description": "no title"})
+	expectStatus(t, w, http.StatusBadRequest)
+	w = env.request(http.MethodPost, "/api/admin/users/999/achievements", env.adminTok, map[string]string{"title": "Ghost"})
+	expectStatus(t, w, http.StatusNotFound)
+	w = env.request(http.MethodPost, award, env.adminTok, map[string]string{"title": "First week", "description": "7 days in a row"})
+	expectStatus(t, w, http.StatusCreated)
+	// Уведомление о достижении доставляется в фоне.
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		if n, err := env.store.Notifications().UnreadCount(ctx, env.user.ID); err == nil && n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("achievement notification not delivered")
+		}
+	}
+
+	// Напоминания попадают во входящие тем же путём, что и достижения.
+	habit := env.createHabit(env.userToken, env.user.ID, "Walk")
+	w = env.request(http.MethodPost, fmt.Sprintf("/api/habits/%d/reminders", habit.ID), env.userToken, map[string]any{"time": "09:00"})
+	expectStatus(t, w, http.StatusCreated)
+	notifications := services.NewNotificationService(env.store, zap.NewNop(), services.DefaultRetryPolicy,
+		notify.NewInboxNotifier(env.store.Notifications()))
+	reminders := services.NewReminderService(env.store, nil, zap.NewNop(), notifications.Process)
+	if n, err := reminders.SendDue(ctx, time.Date(2026, 10, 19, 9, 5, 0, 0, time.UTC)); err != nil || n != 1 {
+		t.Fatalf("reminders sent: %d, %v", n, err)
+	}
+	reminders.Wait()
+
+	w = env.request(http.MethodGet, "/api/notifications/unread-count", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var count struct {
+		Unread int `json:"unread"`
+	}
+	decode(t, w, &count)
+	if count.Unread != 2 {
+		t.Fatalf("unread = %d, want 2", count.Unread)
+	}
+
+	w = env.request(http.MethodGet, "/api/notifications?limit=1", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var page []models.Notification
+	decode(t, w, &page)
+	if len(page) != 1 || page[0].Type != "reminder" || w.Header().Get("X-Next-Cursor") == "" {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+	reminder := page[0]
+	w = env.request(http.MethodGet, "/api/notifications?limit=1&cursor="+w.Header().Get("X-Next-Cursor"), env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &page)
+	if len(page) != 1 || page[0].Type != "achievement" || !strings.Contains(page[0].Subject, "First week") {
+		t.Fatalf("unexpected second page: %+v", page)
+	}
+
+	w = env.request(http.MethodGet, "/api/notifications", env.otherTok, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &page)
+	if len(page) != 0 {
+		t.Fatalf("other user sees notifications: %+v", page)
+	}
+
+	readPath := fmt.Sprintf("/api/notifications/%d/read", reminder.ID)
+	w = env.request(http.MethodPost, readPath, env.otherTok, nil)
+	expectStatus(t, w, http.StatusForbidden)
+	w = env.request(http.MethodPost, readPath, env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var read models.Notification
+	decode(t, w, &read)
+	if read.ReadAt == nil {
+		t.Fatalf("notification not read: %+v", read)
+	}
+	w = env.request(http.MethodPost, "/api/notifications/999/read", env.userToken, nil)
+	expectStatus(t, w, http.StatusNotFound)
+
+	w = env.request(http.MethodGet, "/api/notifications?unread=true", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &page)
+	if len(page) != 1 || page[0].Type != "achievement" {
+		t.Fatalf("unexpected unread: %+v", page)
+	}
+	w = env.request(http.MethodGet, "/api/notifications?unread=maybe", env.userToken, nil)
+	expectStatus(t, w, http.StatusBadRequest)
+
+	w = env.request(http.MethodPost, "/api/notifications/read-all", env.userToken, nil)
+	expectStatus(t, w, http.StatusOK)
+	var updated struct {
+		Updated int `json:"updated"`
+	}
+	decode(t, w, &updated)
+	if updated.Updated != 1 {
+		t.Fatalf("read-all updated %d, want 1", updated.Updated)
+	}
+	w = env.request(http.MethodGet, "/api/notifications/unread-count", env.userToken, nil)
+	decode(t, w, &count)
+	if count.Unread != 0 {
+		t.Fatalf("unread after read-all = %d", count.Unread)
+	}
+}
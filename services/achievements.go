@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+	"go.uber.org/zap"
+)
+
+// AchievementService выдаёт достижения и уведомляет о них пользователя.
+type AchievementService struct {
+	store  repository.Store
+	logger *zap.Logger
+	notify NotifyFunc
+}
+
+// NewAchievementService: notify nil — достижения выдаются без уведомлений.
+func NewAchievementService(store repository.Store, logger *zap.Logger, notify NotifyFunc) *AchievementService {
+	return &AchievementService{store: store, logger: logger, notify: notify}
+}
+
+// Award сохраняет достижение пользователя userID и отправляет уведомление
+// в фоне: повторы доставки могут занять минуты, и ждать их в запросе
+// незачем. Ошибка доставки не отменяет достижение: недоставленное
+// уведомление остаётся в DeadLetters.
+func (s *AchievementService) Award(ctx context.Context, userID uint, title, description string) (*models.Achievement, error) {
+	_, err := s.store.Users().GetByID(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("user %d: %w", userID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	achievement := models.Achievement{UserID: userID, Title: title, Description: description}
+	if err := s.store.Achievements().Create(ctx, &achievement); err != nil {
+		return nil, fmt.Errorf("create achievement: %w", err)
+	}
+
+	if s.notify != nil {
+		message := "Вы получили достижение «" + title + "»."
+		if description != "" {
+			message += " " + description
+		}
+		job := NotificationJob{
+			UserID:  userID,
+			Type:    "achievement",
+			Subject: "Новое достижение: " + title,
+			Message: message,
+		}
+		// Отмена запроса не должна обрывать доставку.
+		go s.deliver(context.WithoutCancel(ctx), achievement.ID, job)
+	}
+	return &achievement, nil
+}
+
+func (s *AchievementService) deliver(ctx context.Context, achievementID uint, job NotificationJob) {
+	results := s.notify(ctx, []NotificationJob{job})
+	if len(results) == 1 && results[0].Err != nil {
+		s.logger.Warn("achievement_notification_failed",
+			zap.Uint("achievement_id", achievementID),
+			zap.Uint("user_id", job.UserID),
+			zap.Error(results[0].Err),
+		)
+	}
+}
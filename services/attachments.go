@@ -0,0 +1,324 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+	"github.com/Bekzhanizb/HabitTrackerBackend/storage"
+	"go.uber.org/zap"
+)
+
+// AttachmentLimits — ограничения на вложения дневника. Нулевые поля
+// заменяются значениями DefaultAttachmentLimits.
+type AttachmentLimits struct {
+	// MaxFileSize — наибольший размер одного файла в байтах.
+	MaxFileSize int64
+	// UserQuota — суммарный размер вложений одного пользователя.
+	UserQuota int64
+	// MaxPerDiary — наибольшее число вложений у одной записи.
+	MaxPerDiary int
+}
+
+var DefaultAttachmentLimits = AttachmentLimits{
+	MaxFileSize: 10 << 20,
+	UserQuota:   100 << 20,
+	MaxPerDiary: 20,
+}
+
+// attachmentTypes — разрешённые типы файлов. Тип определяется по
+// содержимому, а не по имени файла или заголовку клиента.
+var attachmentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"text/plain":      true,
+}
+
+// thumbnailTypes — изображения, которые умеет декодировать стандартная
+// библиотека; для webp миниатюра не строится.
+var thumbnailTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// encryptedContentType — тип вложений зашифрованных на клиенте записей.
+const encryptedContentType = "application/octet-stream"
+
+// AttachmentUsage — занятое вложениями место и лимиты пользователя.
+type AttachmentUsage struct {
+	Used        int64 `json:"used"`
+	Quota       int64 `json:"quota"`
+	MaxFileSize int64 `json:"max_file_size"`
+}
+
+// AttachmentService хранит файлы записей дневника: метаданные — в Store,
+// содержимое — в BlobStore.
+type AttachmentService struct {
+	store  repository.Store
+	blobs  storage.BlobStore
+	logger *zap.Logger
+	limits AttachmentLimits
+}
+
+func NewAttachmentService(store repository.Store, blobs storage.BlobStore, logger *zap.Logger, limits AttachmentLimits) *AttachmentService {
+	if limits.MaxFileSize <= 0 {
+		limits.MaxFileSize = DefaultAttachmentLimits.MaxFileSize
+	}
+	if limits.UserQuota <= 0 {
+		limits.UserQuota = DefaultAttachmentLimits.UserQuota
+	}
+	if limits.MaxPerDiary <= 0 {
+		limits.MaxPerDiary = DefaultAttachmentLimits.MaxPerDiary
+	}
+	return &AttachmentService{store: store, blobs: blobs, logger: logger, limits: limits}
+}
+
+func (s *AttachmentService) Limits() AttachmentLimits {
+	return s.limits
+}
+
+// Upload проверяет файл и сохраняет его как вложение записи diaryID.
+// Файлы пишутся в хранилище до транзакции; если квота или запись
+// не позволяют сохранить вложение, они удаляются.
+//
+// Квота проверяется под блокировкой записи, поэтому параллельные загрузки
+// в одну запись её не превысят; загрузки в разные записи могут превысить
+// квоту не больше чем на размер одновременно загружаемых файлов.
+func (s *AttachmentService) Upload(ctx context.Context, actor models.User, diaryID uint, fileName string, data []byte) (*models.DiaryAttachment, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty file: %w", ErrInvalidInput)
+	}
+	if int64(len(data)) > s.limits.MaxFileSize {
+		return nil, fmt.Errorf("file is %d bytes, limit %d: %w", len(data), s.limits.MaxFileSize, ErrTooLarge)
+	}
+
+	diary, err := findDiaryForActor(ctx, s.store, actor, diaryID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	attachment := &models.DiaryAttachment{
+		DiaryID:   diary.ID,
+		UserID:    diary.UserID,
+		FileName:  cleanFileName(fileName),
+		Size:      int64(len(data)),
+		Encrypted: diary.Encrypted,
+	}
+
+	var thumb []byte
+	if diary.Encrypted {
+		// Сервер не видит содержимого зашифрованной записи, поэтому
+		// и вложение принимает как есть.
+		attachment.ContentType = encryptedContentType
+	} else {
+		attachment.ContentType = sniffContentType(data)
+		if !attachmentTypes[attachment.ContentType] {
+			return nil, fmt.Errorf("%s: %w", attachment.ContentType, ErrUnsupportedMedia)
+		}
+		if thumbnailTypes[attachment.ContentType] {
+			if attachment.Width, attachment.Height, thumb, err = thumbnail(data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if attachment.StorageKey, err = newBlobKey(); err != nil {
+		return nil, err
+	}
+	if err := s.blobs.Put(ctx, attachment.StorageKey, data); err != nil {
+		return nil, fmt.Errorf("store attachment: %w", err)
+	}
+	if thumb != nil {
+		attachment.ThumbnailKey = attachment.StorageKey + "-thumb"
+		if err := s.blobs.Put(ctx, attachment.ThumbnailKey, thumb); err != nil {
+			s.removeBlobs(ctx, *attachment)
+			return nil, fmt.Errorf("store thumbnail: %w", err)
+		}
+	}
+
+	err = s.store.Transaction(ctx, func(tx repository.Store) error {
+		if _, err := findDiaryForActor(ctx, tx, actor, diaryID, true); err != nil {
+			return err
+		}
+
+		existing, err := tx.Attachments().ListByDiary(ctx, diaryID)
+		if err != nil {
+			return err
+		}
+		if len(existing) >= s.limits.MaxPerDiary {
+			return fmt.Errorf("diary %d already has %d attachments: %w", diaryID, len(existing), ErrConflict)
+		}
+
+		used, err := tx.Attachments().Usage(ctx, attachment.UserID)
+		if err != nil {
+			return err
+		}
+		if used+attachment.Size > s.limits.UserQuota {
+			return fmt.Errorf("storage quota exceeded: %d of %d bytes used: %w", used, s.limits.UserQuota, ErrTooLarge)
+		}
+
+		if err := tx.Attachments().Create(ctx, attachment); err != nil {
+			return fmt.Errorf("create attachment: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		s.removeBlobs(ctx, *attachment)
+		return nil, err
+	}
+
+	return attachment, nil
+}
+
+// List возвращает вложения записи.
+func (s *AttachmentService) List(ctx context.Context, actor models.User, diaryID uint) ([]models.DiaryAttachment, error) {
+	if _, err := findDiaryForActor(ctx, s.store, actor, diaryID, false); err != nil {
+		return nil, err
+	}
+	return s.store.Attachments().ListByDiary(ctx, diaryID)
+}
+
+// Open открывает содержимое вложения или его миниатюру. Вызывающий
+// закрывает reader.
+func (s *AttachmentService) Open(ctx context.Context, actor models.User, diaryID, attachmentID uint, thumb bool) (*models.DiaryAttachment, io.ReadSeekCloser, error) {
+	attachment, err := s.find(ctx, actor, diaryID, attachmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := attachment.StorageKey
+	if thumb {
+		if attachment.ThumbnailKey == "" {
+			return nil, nil, fmt.Errorf("attachment %d has no thumbnail: %w", attachmentID, ErrNotFound)
+		}
+		key = attachment.ThumbnailKey
+	}
+
+	content, err := s.blobs.Open(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, fmt.Errorf("attachment %d: %w: %w", attachmentID, err, ErrNotFound)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return attachment, content, nil
+}
+
+func (s *AttachmentService) Delete(ctx context.Context, actor models.User, diaryID, attachmentID uint) error {
+	attachment, err := s.find(ctx, actor, diaryID, attachmentID)
+	if err != nil {
+		return err
+	}
+
+	err = s.store.Attachments().Delete(ctx, attachment.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("attachment %d: %w", attachmentID, ErrNotFound)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.removeBlobs(ctx, *attachment)
+	return nil
+}
+
+// Usage возвращает занятое место пользователя; администратор может
+// запросить его для ownerID.
+func (s *AttachmentService) Usage(ctx context.Context, actor models.User, ownerID *uint) (*AttachmentUsage, error) {
+	userID := actor.ID
+	if owner := visibleOwner(actor, ownerID); owner != nil {
+		userID = *owner
+	}
+
+	used, err := s.store.Attachments().Usage(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &AttachmentUsage{Used: used, Quota: s.limits.UserQuota, MaxFileSize: s.limits.MaxFileSize}, nil
+}
+
+// find загружает вложение записи и проверяет права на запись.
+func (s *AttachmentService) find(ctx context.Context, actor models.User, diaryID, attachmentID uint) (*models.DiaryAttachment, error) {
+	if _, err := findDiaryForActor(ctx, s.store, actor, diaryID, false); err != nil {
+		return nil, err
+	}
+
+	attachment, err := s.store.Attachments().GetByID(ctx, attachmentID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && attachment.DiaryID != diaryID) {
+		return nil, fmt.Errorf("diary %d attachment %d: %w", diaryID, attachmentID, ErrNotFound)
+	}
+	return attachment, err
+}
+
+// removeBlobs удаляет файлы вложения. Ошибки только логируются: запись
+// в базе уже удалена или не создана, а осиротевший файл ничего не ломает.
+func (s *AttachmentService) removeBlobs(ctx context.Context, attachments ...models.DiaryAttachment) {
+	removeAttachmentBlobs(ctx, s.blobs, s.logger, attachments...)
+}
+
+func removeAttachmentBlobs(ctx context.Context, blobs storage.BlobStore, logger *zap.Logger, attachments ...models.DiaryAttachment) {
+	for _, attachment := range attachments {
+		for _, key := range []string{attachment.StorageKey, attachment.ThumbnailKey} {
+			if key == "" {
+				continue
+			}
+			if err := blobs.Delete(ctx, key); err != nil {
+				logger.Warn("attachment_blob_delete_failed", zap.String("key", key), zap.Error(err))
+			}
+		}
+	}
+}
+
+// sniffContentType определяет тип по первым байтам файла и отбрасывает
+// параметры вроде charset.
+func sniffContentType(data []byte) string {
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(data))
+	if err != nil {
+		return encryptedContentType
+	}
+	return mediaType
+}
+
+// cleanFileName оставляет от имени файла только базовое имя без
+// управляющих символов и обрезает его до 255 байт.
+func cleanFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	for len(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
+
+func newBlobKey() (string, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
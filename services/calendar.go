@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+)
+
+// Состояния дня в календаре.
+const (
+	DayNone      = "none"      // отметок нет
+	DayMissed    = "missed"    // есть отметки, но ни одна не выполнена
+	DayPartial   = "partial"   // выполнена часть отметок
+	DayCompleted = "completed" // выполнены все отметки
+)
+
+// calendarLevels — число уровней интенсивности, как в календаре активности GitHub.
+const calendarLevels = 4
+
+// CalendarRange — дни календаря включительно; границы дней считаются в Location.
+type CalendarRange struct {
+	From     time.Time
+	To       time.Time
+	Location *time.Location
+}
+
+// bounds переводит дни диапазона в полуинтервал моментов времени [start, end).
+func (r CalendarRange) bounds() (time.Time, time.Time) {
+	start := time.Date(r.From.Year(), r.From.Month(), r.From.Day(), 0, 0, 0, 0, r.Location)
+	end := time.Date(r.To.Year(), r.To.Month(), r.To.Day()+1, 0, 0, 0, 0, r.Location)
+	return start, end
+}
+
+type CalendarDay struct {
+	repository.DayActivity
+	State string `json:"state"`
+	// Level — интенсивность от 0 до 4 относительно самого активного дня диапазона.
+	Level int `json:"level"`
+}
+
+type Calendar struct {
+	UserID         uint          `json:"user_id"`
+	HabitID        *uint         `json:"habit_id,omitempty"`
+	From           string        `json:"from"`
+	To             string        `json:"to"`
+	Timezone       string        `json:"timezone"`
+	TotalCompleted int           `json:"total_completed"`
+	ActiveDays     int           `json:"active_days"`
+	MaxCompleted   int           `json:"max_completed"`
+	Days           []CalendarDay `json:"days"`
+}
+
+// HabitCalendar возвращает календарь одной привычки.
+func (s *StatsService) HabitCalendar(ctx context.Context, actor models.User, habitID uint, rng CalendarRange) (*Calendar, error) {
+	habit, err := s.store.Habits().GetByID(ctx, habitID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("habit %d: %w", habitID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !canManage(actor, habit.UserID) {
+		return nil, fmt.Errorf("habit %d: %w", habitID, ErrForbidden)
+	}
+
+	cal, err := s.calendar(ctx, repository.CalendarFilter{HabitID: &habitID}, rng)
+	if err != nil {
+		return nil, err
+	}
+	cal.UserID = habit.UserID
+	cal.HabitID = &habitID
+	return cal, nil
+}
+
+// UserCalendar возвращает сводный календарь всех привычек пользователя.
+// Администратор может запросить чужой календарь через ownerID.
+func (s *StatsService) UserCalendar(ctx context.Context, actor models.User, ownerID *uint, rng CalendarRange) (*Calendar, error) {
+	userID := actor.ID
+	if owner := visibleOwner(actor, ownerID); owner != nil {
+		userID = *owner
+	}
+
+	cal, err := s.calendar(ctx, repository.CalendarFilter{UserID: &userID}, rng)
+	if err != nil {
+		return nil, err
+	}
+	cal.UserID = userID
+	return cal, nil
+}
+
+func (s *StatsService) calendar(ctx context.Context, filter repository.CalendarFilter, rng CalendarRange) (*Calendar, error) {
+	filter.From, filter.To, filter.Location = rng.From, rng.To, rng.Location
+
+	days, err := s.store.HabitLogs().Calendar(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("calendar: %w", err)
+	}
+
+	cal := &Calendar{
+		From:     rng.From.Format(time.DateOnly),
+		To:       rng.To.Format(time.DateOnly),
+		Timezone: rng.Location.String(),
+		Days:     make([]CalendarDay, len(days)),
+	}
+	for _, day := range days {
+		cal.TotalCompleted += day.Completed
+		cal.MaxCompleted = max(cal.MaxCompleted, day.Completed)
+		if day.Completed > 0 {
+			cal.ActiveDays++
+		}
+	}
+
+	for i, day := range days {
+		cal.Days[i] = CalendarDay{
+			DayActivity: day,
+			State:       dayState(day),
+			Level:       dayLevel(day.Completed, cal.MaxCompleted),
+		}
+	}
+	return cal, nil
+}
+
+func dayState(day repository.DayActivity) string {
+	switch {
+	case day.Total == 0:
+		return DayNone
+	case day.Completed == 0:
+		return DayMissed
+	case day.Completed < day.Total:
+		return DayPartial
+	default:
+		return DayCompleted
+	}
+}
+
+// dayLevel раскладывает выполненные отметки на уровни 1–4; день без
+// выполненных отметок — уровень 0.
+func dayLevel(completed, maxCompleted int) int {
+	if completed == 0 || maxCompleted == 0 {
+		return 0
+	}
+	return (completed*calendarLevels + maxCompleted - 1) / maxCompleted
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+)
+
+// minCorrelationDays — сколько дней нужно в каждой группе (с выполнением
+// и без), чтобы считать коэффициент корреляции.
+const minCorrelationDays = 3
+
+// MoodEffect сравнивает среднюю оценку дня (настроение или энергию) в дни,
+// когда привычка выполнена, и в остальные дни. Difference — With минус
+// Without; Correlation — коэффициент Пирсона между выполнением (0/1) и
+// оценкой, nil при недостатке данных или постоянной оценке.
+type MoodEffect struct {
+	DaysWith    int      `json:"days_with"`
+	DaysWithout int      `json:"days_without"`
+	With        *float64 `json:"with"`
+	Without     *float64 `json:"without"`
+	Difference  *float64 `json:"difference"`
+	Correlation *float64 `json:"correlation"`
+}
+
+type HabitMoodCorrelation struct {
+	HabitID uint       `json:"habit_id"`
+	Title   string     `json:"title"`
+	Mood    MoodEffect `json:"mood"`
+	Energy  MoodEffect `json:"energy"`
+}
+
+// MoodCorrelations — связь привычек с самочувствием. Days — число дней
+// диапазона с оценкой настроения в дневнике.
+type MoodCorrelations struct {
+	UserID     uint                   `json:"user_id"`
+	From       string                 `json:"from"`
+	To         string                 `json:"to"`
+	Timezone   string                 `json:"timezone"`
+	Days       int                    `json:"days"`
+	MinSamples int                    `json:"min_samples"`
+	Habits     []HabitMoodCorrelation `json:"habits"`
+}
+
+// MoodCorrelations сопоставляет выполнение каждой привычки со средней
+// оценкой записей дневника за тот же день в часовом поясе rng. В выборку
+// привычки попадают только дни с оценкой, начиная с дня её создания;
+// день без выполненной отметки считается днём без привычки. Привычки
+// отсортированы по силе связи с настроением.
+func (s *StatsService) MoodCorrelations(ctx context.Context, actor models.User, ownerID *uint, rng CalendarRange) (*MoodCorrelations, error) {
+	userID := actor.ID
+	if owner := visibleOwner(actor, ownerID); owner != nil {
+		userID = *owner
+	}
+
+	moods, err := s.store.Diaries().MoodTimeline(ctx, repository.MoodFilter{
+		UserID: userID, From: rng.From, To: rng.To, Location: rng.Location,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mood timeline: %w", err)
+	}
+	habitDays, err := s.store.HabitLogs().HabitDays(ctx, repository.CalendarFilter{
+		UserID: &userID, From: rng.From, To: rng.To, Location: rng.Location,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("habit days: %w", err)
+	}
+	habits, _, err := s.store.Habits().List(ctx, repository.HabitFilter{UserID: &userID}, repository.Page{})
+	if err != nil {
+		return nil, fmt.Errorf("list habits: %w", err)
+	}
+
+	done := make(map[uint]map[string]bool, len(habits))
+	for _, day := range habitDays {
+		if day.Completed == 0 {
+			continue
+		}
+		if done[day.HabitID] == nil {
+			done[day.HabitID] = make(map[string]bool)
+		}
+		done[day.HabitID][day.Date] = true
+	}
+
+	result := &MoodCorrelations{
+		UserID:     userID,
+		From:       rng.From.Format(time.DateOnly),
+		To:         rng.To.Format(time.DateOnly),
+		Timezone:   rng.Location.String(),
+		MinSamples: minCorrelationDays,
+		Habits:     make([]HabitMoodCorrelation, 0, len(habits)),
+	}
+	for _, day := range moods {
+		if day.Mood != nil {
+			result.Days++
+		}
+	}
+
+	for _, habit := range habits {
+		created := habit.CreatedAt.In(rng.Location).Format(time.DateOnly)
+		var mood, energy samples
+		for _, day := range moods {
+			if day.Date < created {
+				continue
+			}
+			completed := done[habit.ID][day.Date]
+			mood.add(completed, day.Mood)
+			energy.add(completed, day.Energy)
+		}
+		result.Habits = append(result.Habits, HabitMoodCorrelation{
+			HabitID: habit.ID,
+			Title:   habit.Title,
+			Mood:    mood.effect(),
+			Energy:  energy.effect(),
+		})
+	}
+
+	sort.SliceStable(result.Habits, func(i, j int) bool {
+		return strength(result.Habits[i].Mood.Correlation) > strength(result.Habits[j].Mood.Correlation)
+	})
+	return result, nil
+}
+
+// samples — оценки дней, разделённые по выполнению привычки.
+type samples struct {
+	with, without []float64
+}
+
+func (s *samples) add(completed bool, score *float64) {
+	switch {
+	case score == nil:
+	case completed:
+		s.with = append(s.with, *score)
+	default:
+		s.without = append(s.without, *score)
+	}
+}
+
+func (s *samples) effect() MoodEffect {
+	effect := MoodEffect{
+		DaysWith:    len(s.with),
+		DaysWithout: len(s.without),
+		With:        mean(s.with),
+		Without:     mean(s.without),
+	}
+	if effect.With != nil && effect.Without != nil {
+		diff := *effect.With - *effect.Without
+		effect.Difference = &diff
+	}
+	if len(s.with) >= minCorrelationDays && len(s.without) >= minCorrelationDays {
+		effect.Correlation = s.pearson()
+	}
+	return effect
+}
+
+// pearson считает корреляцию между выполнением (1 в группе with, 0 в
+// группе without) и оценкой.
+func (s *samples) pearson() *float64 {
+	n := float64(len(s.with) + len(s.without))
+	var sumX, sumY, sumXY, sumYY float64
+	for _, y := range s.with {
+		sumX++
+		sumY += y
+		sumXY += y
+		sumYY += y * y
+	}
+	for _, y := range s.without {
+		sumY += y
+		sumYY += y * y
+	}
+	// Для x из нулей и единиц sumXX совпадает с sumX.
+	cov := n*sumXY - sumX*sumY
+	varX := n*sumX - sumX*sumX
+	varY := n*sumYY - sumY*sumY
+	if varX <= 0 || varY <= 0 {
+		return nil
+	}
+	r := cov / math.Sqrt(varX*varY)
+	return &r
+}
+
+func mean(values []float64) *float64 {
+	if len(values) == 0 {
+		return nil
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	m := sum / float64(len(values))
+	return &m
+}
+
+// strength — модуль коэффициента; отсутствующий коэффициент ниже любого.
+func strength(r *float64) float64 {
+	if r == nil {
+		return -1
+	}
+	return math.Abs(*r)
+}
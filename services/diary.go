@@ -0,0 +1,444 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/cache"
+	"github.com/Bekzhanizb/HabitTrackerBackend/encryption"
+	"github.com/Bekzhanizb/HabitTrackerBackend/markdown"
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+	"github.com/Bekzhanizb/HabitTrackerBackend/storage"
+	"go.uber.org/zap"
+)
+
+// DiaryService управляет записями дневника с проверкой прав доступа.
+type DiaryService struct {
+	store  repository.Store
+	blobs  storage.BlobStore
+	cache  cache.Cache
+	logger *zap.Logger
+}
+
+// NewDiaryService: blobs — хранилище вложений, из которого удаляются файлы
+// удалённых записей.
+func NewDiaryService(store repository.Store, blobs storage.BlobStore, c cache.Cache, logger *zap.Logger) *DiaryService {
+	return &DiaryService{store: store, blobs: blobs, cache: c, logger: logger}
+}
+
+type CreateDiaryInput struct {
+	UserID  uint
+	Title   string
+	Content string
+	Mood    *int
+	Energy  *int
+	Emotion string
+	Tags    []string
+	// Encryption включает клиентское шифрование: Content — шифротекст в base64.
+	Encryption *models.DiaryEncryption
+	// HabitID и HabitLogID связывают запись с привычкой владельца или её
+	// отметкой; отметка сама задаёт привычку.
+	HabitID    *uint
+	HabitLogID *uint
+	// PromptID — подсказка, на которую отвечает запись.
+	PromptID *uint
+}
+
+// UpdateDiaryInput — частичное обновление. Для Mood и Energy ноль очищает
+// оценку, пустая строка Emotion — эмоцию.
+type UpdateDiaryInput struct {
+	Title   *string
+	Content *string
+	Mood    *int
+	Energy  *int
+	Emotion *string
+	Tags    *[]string
+	// Encryption переводит запись в зашифрованный режим или обновляет его
+	// параметры; передаётся вместе с новым Content. Обратно в открытый
+	// режим запись не переводится.
+	Encryption *models.DiaryEncryption
+	// HabitID и HabitLogID меняют связь с привычкой; 0 снимает связь.
+	HabitID    *uint
+	HabitLogID *uint
+	// PromptID меняет подсказку записи; 0 снимает её.
+	PromptID *uint
+	// IfMatch — ETag из заголовка If-Match; пустой список не проверяется.
+	IfMatch []string
+}
+
+// findDiaryForActor загружает запись и проверяет права; lock блокирует
+// строку до конца транзакции.
+func findDiaryForActor(ctx context.Context, store repository.Store, actor models.User, diaryID uint, lock bool) (*models.Diary, error) {
+	get := store.Diaries().GetByID
+	if lock {
+		get = store.Diaries().GetForUpdate
+	}
+
+	diary, err := get(ctx, diaryID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("diary %d: %w", diaryID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !canManage(actor, diary.UserID) {
+		return nil, fmt.Errorf("diary %d: %w", diaryID, ErrForbidden)
+	}
+
+	return diary, nil
+}
+
+func (s *DiaryService) Create(ctx context.Context, actor models.User, in CreateDiaryInput) (*models.Diary, error) {
+	if !canManage(actor, in.UserID) {
+		return nil, fmt.Errorf("create diary for user %d: %w", in.UserID, ErrForbidden)
+	}
+
+	diary := models.Diary{
+		UserID:   in.UserID,
+		Title:    in.Title,
+		Content:  in.Content,
+		Mood:     in.Mood,
+		Energy:   in.Energy,
+		Emotion:  in.Emotion,
+		Tags:     normalizeTags(in.Tags),
+		PromptID: in.PromptID,
+	}
+	if err := applyEncryption(&diary, in.Encryption, true); err != nil {
+		return nil, err
+	}
+	if err := sanitizeContent(&diary, true); err != nil {
+		return nil, err
+	}
+	if diary.Mood == nil {
+		diary.Mood = emotionMood(diary.Emotion)
+	}
+	err := s.store.Transaction(ctx, func(tx repository.Store) error {
+		if err := linkHabit(ctx, tx, &diary, in.HabitID, in.HabitLogID); err != nil {
+			return err
+		}
+		if diary.PromptID != nil {
+			if err := checkPrompt(ctx, tx, *diary.PromptID); err != nil {
+				return err
+			}
+		}
+		if err := tx.Diaries().Create(ctx, &diary); err != nil {
+			return fmt.Errorf("create diary: %w", err)
+		}
+		return recordRevision(ctx, tx, actor.ID, nil, &diary, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	purgeCache(ctx, s.cache, s.logger, cache.ResourceDiary, diary.UserID)
+	renderContent(&diary)
+	return &diary, nil
+}
+
+// Get возвращает одну запись с проверкой прав.
+func (s *DiaryService) Get(ctx context.Context, actor models.User, diaryID uint) (*models.Diary, error) {
+	diary, err := findDiaryForActor(ctx, s.store, actor, diaryID, false)
+	if err != nil {
+		return nil, err
+	}
+	renderContent(diary)
+	return diary, nil
+}
+
+// List возвращает страницу записей пользователя; администратор может запросить
+// чужие через filter.UserID. Кроме страницы возвращаются курсор следующей
+// и время последнего изменения выборки для Last-Modified.
+func (s *DiaryService) List(ctx context.Context, actor models.User, filter repository.DiaryFilter, page repository.Page) ([]models.Diary, *repository.Cursor, time.Time, error) {
+	ownerID := filter.UserID
+	filter.UserID = visibleOwner(actor, ownerID)
+
+	diaries, next, err := s.store.Diaries().List(ctx, filter, page)
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+
+	modified := lastWrite(ctx, s.cache, s.logger, scopeTag(cache.ResourceDiary, actor, ownerID))
+	for i := range diaries {
+		modified = latest(modified, diaries[i].UpdatedAt)
+		renderContent(&diaries[i])
+	}
+	return diaries, next, modified, nil
+}
+
+// Search ищет записи по тексту с теми же правами, что и List. При
+// шифровании на сервере поисковый индекс не ведётся, и поиск выключен.
+func (s *DiaryService) Search(ctx context.Context, actor models.User, filter repository.DiaryFilter, query string, limit int) ([]repository.DiaryHit, error) {
+	if encryption.Enabled() {
+		return nil, fmt.Errorf("diary search with at-rest encryption: %w", ErrUnavailable)
+	}
+	filter.UserID = visibleOwner(actor, filter.UserID)
+
+	hits, err := s.store.Diaries().Search(ctx, filter, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("search diary: %w", err)
+	}
+	for i := range hits {
+		renderContent(&hits[i].Diary)
+	}
+	return hits, nil
+}
+
+func (s *DiaryService) Update(ctx context.Context, actor models.User, diaryID uint, in UpdateDiaryInput) (*models.Diary, error) {
+	var diary *models.Diary
+
+	err := s.store.Transaction(ctx, func(tx repository.Store) error {
+		var err error
+		diary, err = findDiaryForActor(ctx, tx, actor, diaryID, true)
+		if err != nil {
+			return err
+		}
+		if err := checkIfMatch(in.IfMatch, DiaryETag(diary)); err != nil {
+			return err
+		}
+		before := *diary
+
+		if in.Title != nil {
+			diary.Title = *in.Title
+		}
+		if in.Content != nil {
+			diary.Content = *in.Content
+		}
+		if err := applyEncryption(diary, in.Encryption, in.Content != nil); err != nil {
+			return err
+		}
+		if err := sanitizeContent(diary, in.Content != nil); err != nil {
+			return err
+		}
+		if in.Mood != nil {
+			diary.Mood = score(*in.Mood)
+		}
+		if in.Energy != nil {
+			diary.Energy = score(*in.Energy)
+		}
+		if in.Emotion != nil {
+			diary.Emotion = *in.Emotion
+			if in.Mood == nil {
+				diary.Mood = emotionMood(diary.Emotion)
+			}
+		}
+		if in.Tags != nil {
+			diary.Tags = normalizeTags(*in.Tags)
+		}
+		if err := linkHabit(ctx, tx, diary, in.HabitID, in.HabitLogID); err != nil {
+			return err
+		}
+		if in.PromptID != nil {
+			diary.PromptID = nil
+			if *in.PromptID != 0 {
+				if err := checkPrompt(ctx, tx, *in.PromptID); err != nil {
+					return err
+				}
+				id := *in.PromptID
+				diary.PromptID = &id
+			}
+		}
+
+		if err := tx.Diaries().Update(ctx, diary); err != nil {
+			return fmt.Errorf("update diary: %w", err)
+		}
+		if diary.Encrypted && !before.Encrypted {
+			// Открытые ревизии выдали бы текст зашифрованной записи: история
+			// начинается заново с первого шифротекста.
+			if err := tx.DiaryRevisions().DeleteByDiary(ctx, diary.ID); err != nil {
+				return fmt.Errorf("delete plaintext revisions: %w", err)
+			}
+			return recordRevision(ctx, tx, actor.ID, nil, diary, nil)
+		}
+		return recordRevision(ctx, tx, actor.ID, &before, diary, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	purgeCache(ctx, s.cache, s.logger, cache.ResourceDiary, diary.UserID)
+	renderContent(diary)
+	return diary, nil
+}
+
+func (s *DiaryService) Delete(ctx context.Context, actor models.User, diaryID uint) error {
+	var ownerID uint
+	var attachments []models.DiaryAttachment
+
+	err := s.store.Transaction(ctx, func(tx repository.Store) error {
+		diary, err := findDiaryForActor(ctx, tx, actor, diaryID, true)
+		if err != nil {
+			return err
+		}
+		ownerID = diary.UserID
+
+		if attachments, err = tx.Attachments().DeleteByDiary(ctx, diary.ID); err != nil {
+			return fmt.Errorf("delete diary attachments: %w", err)
+		}
+		if err := tx.DiaryRevisions().DeleteByDiary(ctx, diary.ID); err != nil {
+			return fmt.Errorf("delete diary revisions: %w", err)
+		}
+		if err := tx.Diaries().Delete(ctx, diary.ID); err != nil {
+			return fmt.Errorf("delete diary: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Файлы удаляются после фиксации: при откате транзакции они ещё нужны.
+	removeAttachmentBlobs(ctx, s.blobs, s.logger, attachments...)
+	purgeCache(ctx, s.cache, s.logger, cache.ResourceDiary, ownerID)
+	return nil
+}
+
+// applyEncryption проверяет режим шифрования записи после правки. Новый
+// текст зашифрованной записи должен приходить с новыми параметрами
+// (у каждого шифротекста свой nonce) и быть корректным base64.
+func applyEncryption(diary *models.Diary, enc *models.DiaryEncryption, contentChanged bool) error {
+	if enc != nil {
+		if !contentChanged {
+			return fmt.Errorf("encryption parameters without new content: %w", ErrInvalidInput)
+		}
+		diary.Encrypted, diary.Encryption = true, enc
+	} else if diary.Encrypted && contentChanged {
+		return fmt.Errorf("content of an encrypted entry needs encryption parameters: %w", ErrInvalidInput)
+	}
+
+	if diary.Encrypted && contentChanged {
+		if _, err := base64.StdEncoding.DecodeString(diary.Content); err != nil {
+			return fmt.Errorf("encrypted content must be base64: %w", ErrInvalidInput)
+		}
+	}
+	return nil
+}
+
+// sanitizeContent убирает сырой HTML из нового текста открытой записи.
+// Текст, от которого ничего не осталось, отклоняется.
+func sanitizeContent(diary *models.Diary, contentChanged bool) error {
+	if diary.Encrypted || !contentChanged {
+		return nil
+	}
+	diary.Content = markdown.Sanitize(diary.Content)
+	if strings.TrimSpace(diary.Content) == "" {
+		return fmt.Errorf("content is empty after removing HTML: %w", ErrInvalidInput)
+	}
+	return nil
+}
+
+// renderContent заполняет ContentHTML. Текст зашифрованной записи сервер
+// не читает, и поле остаётся пустым.
+func renderContent(diary *models.Diary) {
+	if diary.Encrypted {
+		diary.ContentHTML = ""
+		return
+	}
+	diary.ContentHTML = markdown.Render(diary.Content)
+}
+
+// normalizeTags приводит теги к нижнему регистру, обрезает пробелы и убирает
+// пустые и повторяющиеся, сохраняя порядок.
+func normalizeTags(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(out, tag) {
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+// emotionMood — оценка настроения по умолчанию для эмоции; nil, если эмоция не указана.
+func emotionMood(emotion string) *int {
+	if mood, ok := models.Emotions[emotion]; ok {
+		return &mood
+	}
+	return nil
+}
+
+func score(v int) *int {
+	if v == 0 {
+		return nil
+	}
+	return &v
+}
+
+// MoodTimeline — настроение и энергия по дням диапазона. Средние считаются
+// по записям с указанной оценкой; nil, если таких нет.
+type MoodTimeline struct {
+	UserID        uint                 `json:"user_id"`
+	From          string               `json:"from"`
+	To            string               `json:"to"`
+	Timezone      string               `json:"timezone"`
+	Entries       int                  `json:"entries"`
+	AverageMood   *float64             `json:"average_mood"`
+	AverageEnergy *float64             `json:"average_energy"`
+	Emotions      map[string]int       `json:"emotions"`
+	Days          []repository.MoodDay `json:"days"`
+}
+
+// MoodTimeline возвращает дни диапазона rng, в которые есть записи дневника.
+func (s *DiaryService) MoodTimeline(ctx context.Context, actor models.User, ownerID *uint, rng CalendarRange) (*MoodTimeline, error) {
+	userID := actor.ID
+	if owner := visibleOwner(actor, ownerID); owner != nil {
+		userID = *owner
+	}
+
+	days, err := s.store.Diaries().MoodTimeline(ctx, repository.MoodFilter{
+		UserID: userID, From: rng.From, To: rng.To, Location: rng.Location,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mood timeline: %w", err)
+	}
+
+	timeline := &MoodTimeline{
+		UserID:   userID,
+		From:     rng.From.Format(time.DateOnly),
+		To:       rng.To.Format(time.DateOnly),
+		Timezone: rng.Location.String(),
+		Emotions: map[string]int{},
+		Days:     days,
+	}
+	var mood, energy average
+	for _, day := range days {
+		timeline.Entries += day.Entries
+		mood.add(day.Mood)
+		energy.add(day.Energy)
+		for emotion, n := range day.Emotions {
+			timeline.Emotions[emotion] += n
+		}
+	}
+	timeline.AverageMood = mood.value()
+	timeline.AverageEnergy = energy.value()
+	return timeline, nil
+}
+
+// average — среднее дневных средних: каждый день весит одинаково
+// независимо от числа записей.
+type average struct {
+	sum float64
+	n   int
+}
+
+func (a *average) add(v *float64) {
+	if v != nil {
+		a.sum += *v
+		a.n++
+	}
+}
+
+func (a *average) value() *float64 {
+	if a.n == 0 {
+		return nil
+	}
+	v := a.sum / float64(a.n)
+	return &v
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/cache"
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+)
+
+// RevisionDiff — построчная разница заголовка и текста между ревизиями
+// From и To. Added и Removed считают строки обоих полей.
+type RevisionDiff struct {
+	DiaryID uint       `json:"diary_id"`
+	From    int        `json:"from"`
+	To      int        `json:"to"`
+	Added   int        `json:"added"`
+	Removed int        `json:"removed"`
+	Title   []DiffLine `json:"title"`
+	Content []DiffLine `json:"content"`
+}
+
+// recordRevision дописывает ревизию после записи в дневник, если заголовок
+// или текст изменились. У записей, созданных до появления ревизий, сначала
+// сохраняется прежнее состояние before, чтобы правку можно было откатить.
+func recordRevision(ctx context.Context, tx repository.Store, editor uint, before, after *models.Diary, restoredFrom *int) error {
+	latest, err := tx.DiaryRevisions().Latest(ctx, after.ID)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		if before != nil && !sameText(before.Title, before.Content, after) {
+			initial := models.DiaryRevision{
+				DiaryID:    before.ID,
+				Title:      before.Title,
+				Content:    before.Content,
+				Encryption: before.Encryption,
+				EditedBy:   before.UserID,
+				CreatedAt:  before.UpdatedAt,
+			}
+			if err := tx.DiaryRevisions().Create(ctx, &initial); err != nil {
+				return fmt.Errorf("create initial revision: %w", err)
+			}
+		}
+	case err != nil:
+		return fmt.Errorf("latest revision: %w", err)
+	case sameText(latest.Title, latest.Content, after):
+		return nil
+	}
+
+	rev := models.DiaryRevision{
+		DiaryID:      after.ID,
+		Title:        after.Title,
+		Content:      after.Content,
+		Encryption:   after.Encryption,
+		EditedBy:     editor,
+		RestoredFrom: restoredFrom,
+	}
+	if err := tx.DiaryRevisions().Create(ctx, &rev); err != nil {
+		return fmt.Errorf("create revision: %w", err)
+	}
+	return nil
+}
+
+func sameText(title, content string, d *models.Diary) bool {
+	return title == d.Title && content == d.Content
+}
+
+// Revisions возвращает ревизии записи от первой к последней.
+func (s *DiaryService) Revisions(ctx context.Context, actor models.User, diaryID uint) ([]models.DiaryRevision, error) {
+	if _, err := findDiaryForActor(ctx, s.store, actor, diaryID, false); err != nil {
+		return nil, err
+	}
+	return s.store.DiaryRevisions().List(ctx, diaryID)
+}
+
+// DiffRevisions сравнивает ревизии from и to; to == 0 — последняя ревизия.
+func (s *DiaryService) DiffRevisions(ctx context.Context, actor models.User, diaryID uint, from, to int) (*RevisionDiff, error) {
+	if _, err := findDiaryForActor(ctx, s.store, actor, diaryID, false); err != nil {
+		return nil, err
+	}
+
+	older, err := findRevision(ctx, s.store, diaryID, from)
+	if err != nil {
+		return nil, err
+	}
+	newer, err := findRevision(ctx, s.store, diaryID, to)
+	if err != nil {
+		return nil, err
+	}
+	if older.Encryption != nil || newer.Encryption != nil {
+		return nil, fmt.Errorf("diary %d: encrypted revisions are compared on the client: %w", diaryID, ErrConflict)
+	}
+
+	diff := &RevisionDiff{
+		DiaryID: diaryID,
+		From:    older.Number,
+		To:      newer.Number,
+		Title:   diffLines(older.Title, newer.Title),
+		Content: diffLines(older.Content, newer.Content),
+	}
+	for _, lines := range [][]DiffLine{diff.Title, diff.Content} {
+		for _, line := range lines {
+			switch line.Op {
+			case DiffInsert:
+				diff.Added++
+			case DiffDelete:
+				diff.Removed++
+			}
+		}
+	}
+	return diff, nil
+}
+
+// Restore возвращает записи заголовок и текст ревизии number. Восстановление —
+// обычная правка: она проверяет If-Match и добавляет новую ревизию, так что
+// история не теряется. Режим шифрования восстановлением не меняется:
+// открытая ревизия на зашифрованную запись — ErrConflict.
+func (s *DiaryService) Restore(ctx context.Context, actor models.User, diaryID uint, number int, ifMatch []string) (*models.Diary, error) {
+	var diary *models.Diary
+
+	err := s.store.Transaction(ctx, func(tx repository.Store) error {
+		var err error
+		diary, err = findDiaryForActor(ctx, tx, actor, diaryID, true)
+		if err != nil {
+			return err
+		}
+		if err := checkIfMatch(ifMatch, DiaryETag(diary)); err != nil {
+			return err
+		}
+		rev, err := findRevision(ctx, tx, diaryID, number)
+		if err != nil {
+			return err
+		}
+		if (rev.Encryption != nil) != diary.Encrypted {
+			return fmt.Errorf("diary %d revision %d has a different encryption mode: %w", diaryID, rev.Number, ErrConflict)
+		}
+
+		before := *diary
+		diary.Title, diary.Content = rev.Title, rev.Content
+		diary.Encryption = rev.Encryption
+		if err := tx.Diaries().Update(ctx, diary); err != nil {
+			return fmt.Errorf("restore diary: %w", err)
+		}
+		return recordRevision(ctx, tx, actor.ID, &before, diary, &rev.Number)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	purgeCache(ctx, s.cache, s.logger, cache.ResourceDiary, diary.UserID)
+	renderContent(diary)
+	return diary, nil
+}
+
+// findRevision загружает ревизию записи; number == 0 — последняя.
+func findRevision(ctx context.Context, store repository.Store, diaryID uint, number int) (*models.DiaryRevision, error) {
+	var rev *models.DiaryRevision
+	var err error
+	if number == 0 {
+		rev, err = store.DiaryRevisions().Latest(ctx, diaryID)
+	} else {
+		rev, err = store.DiaryRevisions().Get(ctx, diaryID, number)
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("diary %d revision %d: %w", diaryID, number, ErrNotFound)
+	}
+	return rev, err
+}
@@ -0,0 +1,22 @@
+package services
+
+import "errors"
+
+// Доменные ошибки сервисного слоя. Хендлеры сопоставляют их с HTTP-статусами
+// через errors.Is, поэтому сервисы оборачивают их через fmt.Errorf("...: %w").
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrForbidden = errors.New("forbidden")
+	ErrConflict  = errors.New("conflict")
+	// ErrInvalidInput — запрос корректен по форме, но противоречит
+	// состоянию ресурса или правилам, которые не выразить тегами валидации.
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrPreconditionFailed — If-Match не совпал с текущей версией ресурса.
+	ErrPreconditionFailed = errors.New("precondition failed")
+	// ErrTooLarge — файл больше допустимого или не помещается в квоту.
+	ErrTooLarge = errors.New("too large")
+	// ErrUnsupportedMedia — тип файла не входит в список разрешённых.
+	ErrUnsupportedMedia = errors.New("unsupported media type")
+	// ErrUnavailable — функция выключена настройками сервера.
+	ErrUnavailable = errors.New("unavailable")
+)
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+)
+
+// ETag отдельной записи строится из её updated_at: каждое изменение через
+// сервис сдвигает метку, поэтому это сильный валидатор для If-Match.
+func versionETag(kind string, id uint, updatedAt time.Time) string {
+	return fmt.Sprintf(`"%s-%d-%s"`, kind, id, strconv.FormatInt(updatedAt.UnixMicro(), 36))
+}
+
+func DiaryETag(d *models.Diary) string {
+	return versionETag("diary", d.ID, d.UpdatedAt)
+}
+
+func HabitETag(h *models.Habit) string {
+	return versionETag("habit", h.ID, h.UpdatedAt)
+}
+
+// checkIfMatch сравнивает If-Match с текущим ETag по строгим правилам
+// RFC 9110: слабые ETag не совпадают никогда, «*» совпадает с любой версией.
+// Пустой список означает, что клиент не передал предусловие.
+func checkIfMatch(ifMatch []string, current string) error {
+	if len(ifMatch) == 0 {
+		return nil
+	}
+	for _, tag := range ifMatch {
+		if tag == "*" || (!strings.HasPrefix(tag, "W/") && tag == current) {
+			return nil
+		}
+	}
+	return fmt.Errorf("if-match %v, current %s: %w", ifMatch, current, ErrPreconditionFailed)
+}
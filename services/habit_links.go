@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/cache"
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+)
+
+// Типы элементов ленты привычки.
+const (
+	TimelineLog   = "log"
+	TimelineDiary = "diary"
+)
+
+// TimelineItem — отметка привычки или связанная с ней запись дневника.
+// Date — день события в часовом поясе запроса.
+type TimelineItem struct {
+	Type  string           `json:"type"`
+	At    time.Time        `json:"at"`
+	Date  string           `json:"date"`
+	Log   *models.HabitLog `json:"log,omitempty"`
+	Diary *models.Diary    `json:"diary,omitempty"`
+}
+
+// HabitTimeline — отметки и записи дневника привычки от новых к старым.
+type HabitTimeline struct {
+	HabitID  uint           `json:"habit_id"`
+	From     string         `json:"from"`
+	To       string         `json:"to"`
+	Timezone string         `json:"timezone"`
+	Items    []TimelineItem `json:"items"`
+}
+
+// linkHabit применяет к записи связь с привычкой и отметкой: nil оставляет
+// связь как есть, 0 снимает её. Снятие привычки снимает и отметку, а
+// отметка сама задаёт привычку, так что habitID с ней можно не передавать.
+// Связать можно только привычку владельца записи.
+func linkHabit(ctx context.Context, tx repository.Store, diary *models.Diary, habitID, logID *uint) error {
+	if habitID != nil {
+		if *habitID == 0 {
+			if logID != nil && *logID != 0 {
+				return fmt.Errorf("habit_log_id without habit: %w", ErrInvalidInput)
+			}
+			diary.HabitID, diary.HabitLogID = nil, nil
+		} else {
+			if err := checkHabitOwner(ctx, tx, diary.UserID, *habitID); err != nil {
+				return err
+			}
+			if diary.HabitID == nil || *diary.HabitID != *habitID {
+				diary.HabitLogID = nil
+			}
+			id := *habitID
+			diary.HabitID = &id
+		}
+	}
+
+	if logID == nil {
+		return nil
+	}
+	if *logID == 0 {
+		diary.HabitLogID = nil
+		return nil
+	}
+
+	log, err := tx.HabitLogs().GetByID(ctx, *logID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("habit log %d not found: %w", *logID, ErrInvalidInput)
+	}
+	if err != nil {
+		return err
+	}
+	if habitID != nil && *habitID != log.HabitID {
+		return fmt.Errorf("habit log %d belongs to another habit: %w", log.ID, ErrInvalidInput)
+	}
+	if err := checkHabitOwner(ctx, tx, diary.UserID, log.HabitID); err != nil {
+		return err
+	}
+	diary.HabitID, diary.HabitLogID = &log.HabitID, &log.ID
+	return nil
+}
+
+// checkHabitOwner проверяет, что привычка есть и принадлежит ownerID.
+// Чужая привычка выглядит как несуществующая.
+func checkHabitOwner(ctx context.Context, store repository.Store, ownerID, habitID uint) error {
+	habit, err := store.Habits().GetByID(ctx, habitID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && habit.UserID != ownerID) {
+		return fmt.Errorf("habit %d not found: %w", habitID, ErrInvalidInput)
+	}
+	return err
+}
+
+// UpdateLogNote меняет заметку отметки привычки.
+func (s *HabitService) UpdateLogNote(ctx context.Context, actor models.User, logID uint, note string) (*models.HabitLog, error) {
+	var (
+		log     *models.HabitLog
+		ownerID uint
+	)
+
+	err := s.store.Transaction(ctx, func(tx repository.Store) error {
+		var err error
+		log, err = tx.HabitLogs().GetByID(ctx, logID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return fmt.Errorf("habit log %d: %w", logID, ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+
+		habit, err := findHabitForUpdate(ctx, tx, actor, log.HabitID)
+		if err != nil {
+			return err
+		}
+		ownerID = habit.UserID
+
+		if err := tx.HabitLogs().UpdateNote(ctx, log.ID, note); err != nil {
+			return fmt.Errorf("update habit log note: %w", err)
+		}
+		log.Note = note
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	purgeCache(ctx, s.cache, s.logger, cache.ResourceHabits, ownerID)
+	return log, nil
+}
+
+// Timeline возвращает отметки привычки вперемешку со связанными записями
+// дневника за дни диапазона, от новых к старым.
+func (s *HabitService) Timeline(ctx context.Context, actor models.User, habitID uint, rng CalendarRange) (*HabitTimeline, error) {
+	habit, err := s.GetHabit(ctx, actor, habitID)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := rng.bounds()
+	logs, _, err := s.store.HabitLogs().List(ctx, repository.HabitLogFilter{
+		HabitID: &habit.ID, From: &start, To: &end,
+	}, repository.Page{})
+	if err != nil {
+		return nil, fmt.Errorf("list habit logs: %w", err)
+	}
+	diaries, _, err := s.store.Diaries().List(ctx, repository.DiaryFilter{
+		UserID: &habit.UserID, HabitID: &habit.ID, From: &start, To: &end,
+	}, repository.Page{})
+	if err != nil {
+		return nil, fmt.Errorf("list linked diaries: %w", err)
+	}
+
+	items := make([]TimelineItem, 0, len(logs)+len(diaries))
+	for i := range logs {
+		items = append(items, TimelineItem{Type: TimelineLog, At: logs[i].Date, Log: &logs[i]})
+	}
+	for i := range diaries {
+		renderContent(&diaries[i])
+		items = append(items, TimelineItem{Type: TimelineDiary, At: diaries[i].CreatedAt, Diary: &diaries[i]})
+	}
+	// При равном времени отметка идёт раньше записи о ней.
+	sort.SliceStable(items, func(i, j int) bool { return items[i].At.After(items[j].At) })
+	for i := range items {
+		items[i].Date = items[i].At.In(rng.Location).Format(time.DateOnly)
+	}
+
+	return &HabitTimeline{
+		HabitID:  habit.ID,
+		From:     rng.From.Format(time.DateOnly),
+		To:       rng.To.Format(time.DateOnly),
+		Timezone: rng.Location.String(),
+		Items:    items,
+	}, nil
+}
@@ -1,13 +1,12 @@
 package services
 
 import (
+	"context"
 	"fmt"
-	"sync"
 	"time"
 
 	"github.com/Bekzhanizb/HabitTrackerBackend/cache"
-	"github.com/Bekzhanizb/HabitTrackerBackend/db"
-	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
 	"go.uber.org/zap"
 )
 
@@ -18,7 +17,6 @@ type HabitStats struct {
 	CompletionRate float64 `json:"completion_rate"`
 	CurrentStreak  int     `json:"current_streak"`
 	LongestStreak  int     `json:"longest_streak"`
-	Error          error   `json:"-"`
 }
 
 type UserHabitStats struct {
@@ -30,266 +28,85 @@ type UserHabitStats struct {
 	ProcessingTime time.Duration `json:"processing_time_ms"`
 }
 
-func CalculateUserHabitStatsConcurrently(userID uint, logger *zap.Logger) (*UserHabitStats, error) {
+// StatsService считает статистику выполнения привычек.
+type StatsService struct {
+	store  repository.Store
+	cache  cache.Cache
+	logger *zap.Logger
+}
+
+func NewStatsService(store repository.Store, c cache.Cache, logger *zap.Logger) *StatsService {
+	return &StatsService{store: store, cache: c, logger: logger}
+}
+
+// CalculateUserHabitStats считает статистику привычек пользователя по
+// дневным сводкам (см. RollupRepository.Stats) и кэширует её до следующей
+// записи в привычки.
+func (s *StatsService) CalculateUserHabitStats(ctx context.Context, userID uint) (*UserHabitStats, error) {
+	logger := s.logger
 	startTime := time.Now()
 
 	cacheKey := fmt.Sprintf("user_stats:%d", userID)
 	var cachedStats UserHabitStats
-	if err := cache.Get(cacheKey, &cachedStats); err == nil {
+	if err := cache.GetJSON(ctx, s.cache, cacheKey, &cachedStats); err == nil {
 		logger.Info("cache_hit", zap.String("key", cacheKey))
 		return &cachedStats, nil
 	}
 
-	var habits []models.Habit
-	if err := db.DB.Where("user_id = ?", userID).Find(&habits).Error; err != nil {
-		return nil, err
-	}
-
-	if len(habits) == 0 {
-		return &UserHabitStats{UserID: userID}, nil
-	}
-
-	statsChan := make(chan HabitStats, len(habits))
-	var wg sync.WaitGroup
-
-	for _, habit := range habits {
-		wg.Add(1)
-		go func(h models.Habit) {
-			defer wg.Done()
-			stats := calculateSingleHabitStats(h.ID, logger)
-			statsChan <- stats
-		}(habit)
+	rows, err := s.store.Rollups().Stats(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("habit stats: %w", err)
 	}
 
-	go func() {
-		wg.Wait()
-		close(statsChan)
-	}()
-
-	// 📊 СОБИРАЕМ РЕЗУЛЬТАТЫ ИЗ CHANNEL
-	var habitStats []HabitStats
-	var totalRate float64
-	activeCount := 0
-
-	// Читаем из channel пока он не закроется
-	for stat := range statsChan {
-		if stat.Error != nil {
-			logger.Warn("habit_stats_error",
-				zap.Uint("habit_id", stat.HabitID),
-				zap.Error(stat.Error),
-			)
-			continue
-		}
-		habitStats = append(habitStats, stat)
-		totalRate += stat.CompletionRate
-	}
-
-	for _, h := range habits {
-		if h.IsActive {
-			activeCount++
-		}
-	}
+	result := buildUserStats(userID, rows)
+	result.ProcessingTime = time.Since(startTime)
 
-	overallRate := 0.0
-	if len(habitStats) > 0 {
-		overallRate = totalRate / float64(len(habitStats))
+	// Cache результат; сбрасывается записями в привычки пользователя
+	tags := []string{cache.UserTag(userID), cache.ResourceTag(cache.ResourceHabits, userID)}
+	if err := cache.SetJSON(ctx, s.cache, cacheKey, result, 5*time.Minute, tags...); err != nil {
+		logger.Warn("stats_cache_set_failed", zap.Error(err))
 	}
 
-	result := &UserHabitStats{
-		UserID:         userID,
-		TotalHabits:    len(habits),
-		ActiveHabits:   activeCount,
-		OverallRate:    overallRate,
-		HabitStats:     habitStats,
-		ProcessingTime: time.Since(startTime),
-	}
-
-	// Cache результат
-	cache.Set(cacheKey, result, 5*time.Minute)
-
-	logger.Info("stats_calculated_concurrently",
+	logger.Info("stats_calculated",
 		zap.Uint("user_id", userID),
-		zap.Int("habits_count", len(habits)),
+		zap.Int("habits_count", len(rows)),
 		zap.Duration("duration", result.ProcessingTime),
 	)
 
 	return result, nil
 }
 
-func calculateSingleHabitStats(habitID uint, logger *zap.Logger) HabitStats {
-	stats := HabitStats{HabitID: habitID}
-
-	var logs []models.HabitLog
-	if err := db.DB.Where("habit_id = ?", habitID).
-		Order("date DESC").
-		Find(&logs).Error; err != nil {
-		stats.Error = err
-		return stats
+// buildUserStats собирает ответ из агрегатов БД. Общий процент — среднее
+// процентов привычек, включая привычки без логов.
+func buildUserStats(userID uint, rows []repository.HabitLogStats) *UserHabitStats {
+	result := &UserHabitStats{
+		UserID:      userID,
+		TotalHabits: len(rows),
+		HabitStats:  make([]HabitStats, 0, len(rows)),
 	}
 
-	stats.TotalLogs = len(logs)
-	completedCount := 0
-
-	for _, log := range logs {
-		if log.IsCompleted {
-			completedCount++
+	var totalRate float64
+	for _, row := range rows {
+		stats := HabitStats{
+			HabitID:       row.HabitID,
+			TotalLogs:     row.TotalLogs,
+			CompletedLogs: row.CompletedLogs,
+			CurrentStreak: row.CurrentStreak,
+			LongestStreak: row.LongestStreak,
 		}
-	}
-	stats.CompletedLogs = completedCount
-
-	if stats.TotalLogs > 0 {
-		stats.CompletionRate = float64(completedCount) / float64(stats.TotalLogs) * 100
-	}
-
-	// Calculate streaks
-	currentStreak := 0
-	longestStreak := 0
-	tempStreak := 0
-
-	for i, log := range logs {
-		if log.IsCompleted {
-			tempStreak++
-			if i == 0 {
-				currentStreak = tempStreak
-			}
-			if tempStreak > longestStreak {
-				longestStreak = tempStreak
-			}
-		} else {
-			if i == 0 {
-				currentStreak = 0
-			}
-			tempStreak = 0
+		if row.TotalLogs > 0 {
+			stats.CompletionRate = float64(row.CompletedLogs) / float64(row.TotalLogs) * 100
 		}
-	}
-
-	stats.CurrentStreak = currentStreak
-	stats.LongestStreak = longestStreak
-
-	return stats
-}
-
-/*
-╔═══════════════════════════════════════════════════════════════════╗
-║  WORKER POOL PATTERN - ДЛЯ МАССОВЫХ ОПЕРАЦИЙ                      ║
-╚═══════════════════════════════════════════════════════════════════╝
-
-ОБОСНОВАНИЕ:
-- Ограничиваем количество одновременных операций
-- Предотвращаем перегрузку внешних сервисов
-- Контролируемый параллелизм
-*/
-
-type NotificationJob struct {
-	UserID  uint
-	Message string
-	Type    string
-}
-
-func ProcessNotificationsConcurrently(jobs []NotificationJob, workerCount int, logger *zap.Logger) {
-	jobChan := make(chan NotificationJob, len(jobs))
-	resultChan := make(chan error, len(jobs))
-	var wg sync.WaitGroup
-
-	// 🔥 ЗАПУСКАЕМ WORKER POOL
-	for i := 0; i < workerCount; i++ {
-		wg.Add(1)
-		go notificationWorker(i, jobChan, resultChan, &wg, logger)
-	}
-
-	// Отправляем задачи в channel
-	for _, job := range jobs {
-		jobChan <- job
-	}
-	close(jobChan)
-
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
-
-	// Собираем результаты
-	successCount := 0
-	errorCount := 0
-	for err := range resultChan {
-		if err != nil {
-			errorCount++
-		} else {
-			successCount++
+		if row.IsActive {
+			result.ActiveHabits++
 		}
-	}
-
-	logger.Info("notifications_processed",
-		zap.Int("success", successCount),
-		zap.Int("errors", errorCount),
-		zap.Int("workers", workerCount),
-	)
-}
-
-func notificationWorker(id int, jobs <-chan NotificationJob, results chan<- error, wg *sync.WaitGroup, logger *zap.Logger) {
-	defer wg.Done()
 
-	for job := range jobs {
-		time.Sleep(50 * time.Millisecond) // Simulate sending
-
-		logger.Info("notification_sent",
-			zap.Int("worker_id", id),
-			zap.Uint("user_id", job.UserID),
-			zap.String("type", job.Type),
-		)
-
-		results <- nil
-	}
-}
-
-/*
-╔═══════════════════════════════════════════════════════════════════╗
-║  BULK OPERATIONS WITH GOROUTINES                                  ║
-╚═══════════════════════════════════════════════════════════════════╝
-*/
-
-func BulkUpdateHabitsActiveStatus(habitIDs []uint, isActive bool, logger *zap.Logger) error {
-	if len(habitIDs) == 0 {
-		return nil
-	}
-
-	errChan := make(chan error, len(habitIDs))
-	var wg sync.WaitGroup
-
-	// 🚀 Обновляем каждую привычку в отдельной горутине
-	for _, id := range habitIDs {
-		wg.Add(1)
-		go func(habitID uint) {
-			defer wg.Done()
-
-			if err := db.DB.Model(&models.Habit{}).
-				Where("id = ?", habitID).
-				Update("is_active", isActive).Error; err != nil {
-				errChan <- fmt.Errorf("failed to update habit %d: %w", habitID, err)
-				return
-			}
-
-			cache.Delete(fmt.Sprintf("habit:%d", habitID))
-			errChan <- nil
-		}(id)
+		totalRate += stats.CompletionRate
+		result.HabitStats = append(result.HabitStats, stats)
 	}
 
-	go func() {
-		wg.Wait()
-		close(errChan)
-	}()
-
-	for err := range errChan {
-		if err != nil {
-			logger.Error("bulk_update_error", zap.Error(err))
-			return err
-		}
+	if len(rows) > 0 {
+		result.OverallRate = totalRate / float64(len(rows))
 	}
-
-	logger.Info("bulk_update_completed",
-		zap.Int("count", len(habitIDs)),
-		zap.Bool("is_active", isActive),
-	)
-
-	return nil
+	return result
 }
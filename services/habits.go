@@ -0,0 +1,339 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/cache"
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+	"go.uber.org/zap"
+)
+
+// HabitService выполняет операции записи над привычками.
+// Каждый сценарий работает в одной транзакции БД, поэтому частичные записи
+// (привычка без начального лога, логи без привычки) невозможны.
+type HabitService struct {
+	store  repository.Store
+	cache  cache.Cache
+	logger *zap.Logger
+}
+
+func NewHabitService(store repository.Store, c cache.Cache, logger *zap.Logger) *HabitService {
+	return &HabitService{store: store, cache: c, logger: logger}
+}
+
+type CreateHabitInput struct {
+	UserID      uint
+	Title       string
+	Description string
+	Frequency   string
+}
+
+type UpdateHabitInput struct {
+	Title       *string
+	Description *string
+	Frequency   *string
+	IsActive    *bool
+	// IfMatch — ETag из заголовка If-Match; пустой список не проверяется.
+	IfMatch []string
+}
+
+func canManage(actor models.User, ownerID uint) bool {
+	return actor.Role == models.RoleAdmin || actor.ID == ownerID
+}
+
+// visibleOwner ограничивает выборку владельцем: обычный пользователь видит
+// только своё, администратор — данные ownerID или всех при nil.
+func visibleOwner(actor models.User, ownerID *uint) *uint {
+	if actor.Role != models.RoleAdmin {
+		return &actor.ID
+	}
+	return ownerID
+}
+
+// findHabitForUpdate загружает привычку с блокировкой строки и проверяет права.
+func findHabitForUpdate(ctx context.Context, tx repository.Store, actor models.User, habitID uint) (*models.Habit, error) {
+	habit, err := tx.Habits().GetForUpdate(ctx, habitID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("habit %d: %w", habitID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !canManage(actor, habit.UserID) {
+		return nil, fmt.Errorf("habit %d: %w", habitID, ErrForbidden)
+	}
+
+	return habit, nil
+}
+
+// CreateHabit создаёт привычку вместе с начальным логом.
+func (s *HabitService) CreateHabit(ctx context.Context, actor models.User, in CreateHabitInput) (*models.Habit, error) {
+	if !canManage(actor, in.UserID) {
+		return nil, fmt.Errorf("create habit for user %d: %w", in.UserID, ErrForbidden)
+	}
+
+	habit := models.Habit{
+		UserID:      in.UserID,
+		Title:       in.Title,
+		Description: in.Description,
+		Frequency:   in.Frequency,
+		IsActive:    true,
+	}
+
+	err := s.store.Transaction(ctx, func(tx repository.Store) error {
+		if err := tx.Habits().Create(ctx, &habit); err != nil {
+			return fmt.Errorf("create habit: %w", err)
+		}
+
+		seed := models.HabitLog{
+			HabitID:     habit.ID,
+			Date:        time.Now(),
+			IsCompleted: false,
+		}
+		if err := tx.HabitLogs().Create(ctx, &seed); err != nil {
+			return fmt.Errorf("create seed log: %w", err)
+		}
+		if err := tx.Rollups().ApplyLog(ctx, habit.UserID, seed); err != nil {
+			return fmt.Errorf("update rollups: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	purgeCache(ctx, s.cache, s.logger, cache.ResourceHabits, habit.UserID)
+	return &habit, nil
+}
+
+// LogHabit добавляет отметку выполнения к привычке; note — необязательная
+// заметка к ней.
+func (s *HabitService) LogHabit(ctx context.Context, actor models.User, habitID uint, isCompleted bool, note string) (*models.HabitLog, error) {
+	var (
+		log     models.HabitLog
+		ownerID uint
+	)
+
+	err := s.store.Transaction(ctx, func(tx repository.Store) error {
+		habit, err := findHabitForUpdate(ctx, tx, actor, habitID)
+		if err != nil {
+			return err
+		}
+
+		ownerID = habit.UserID
+		log = models.HabitLog{
+			HabitID:     habit.ID,
+			Date:        time.Now(),
+			IsCompleted: isCompleted,
+			Note:        note,
+		}
+		if err := tx.HabitLogs().Create(ctx, &log); err != nil {
+			return fmt.Errorf("create habit log: %w", err)
+		}
+		if err := tx.Rollups().ApplyLog(ctx, habit.UserID, log); err != nil {
+			return fmt.Errorf("update rollups: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	purgeCache(ctx, s.cache, s.logger, cache.ResourceHabits, ownerID)
+	return &log, nil
+}
+
+// UpdateHabit частично обновляет привычку.
+func (s *HabitService) UpdateHabit(ctx context.Context, actor models.User, habitID uint, in UpdateHabitInput) (*models.Habit, error) {
+	var habit *models.Habit
+
+	err := s.store.Transaction(ctx, func(tx repository.Store) error {
+		var err error
+		habit, err = findHabitForUpdate(ctx, tx, actor, habitID)
+		if err != nil {
+			return err
+		}
+		if err := checkIfMatch(in.IfMatch, HabitETag(habit)); err != nil {
+			return err
+		}
+
+		if in.Title != nil {
+			habit.Title = *in.Title
+		}
+		if in.Description != nil {
+			habit.Description = *in.Description
+		}
+		if in.Frequency != nil {
+			habit.Frequency = *in.Frequency
+		}
+		if in.IsActive != nil {
+			habit.IsActive = *in.IsActive
+		}
+
+		if err := tx.Habits().Update(ctx, habit); err != nil {
+			return fmt.Errorf("save habit: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	purgeCache(ctx, s.cache, s.logger, cache.ResourceHabits, habit.UserID)
+	return habit, nil
+}
+
+// DeleteHabit удаляет привычку вместе со всеми её логами. Записи дневника
+// остаются, но теряют связь с привычкой.
+func (s *HabitService) DeleteHabit(ctx context.Context, actor models.User, habitID uint) error {
+	var ownerID uint
+
+	err := s.store.Transaction(ctx, func(tx repository.Store) error {
+		habit, err := findHabitForUpdate(ctx, tx, actor, habitID)
+		if err != nil {
+			return err
+		}
+		ownerID = habit.UserID
+
+		if err := tx.Diaries().UnlinkHabit(ctx, habit.ID); err != nil {
+			return fmt.Errorf("unlink diaries: %w", err)
+		}
+		if err := tx.HabitLogs().DeleteByHabit(ctx, habit.ID); err != nil {
+			return fmt.Errorf("delete habit logs: %w", err)
+		}
+		if err := tx.Rollups().DeleteHabit(ctx, habit.UserID, habit.ID); err != nil {
+			return fmt.Errorf("delete habit rollups: %w", err)
+		}
+		if err := tx.Reminders().DeleteByHabit(ctx, habit.ID); err != nil {
+			return fmt.Errorf("delete habit reminders: %w", err)
+		}
+
+		if err := tx.Habits().Delete(ctx, habit.ID); err != nil {
+			return fmt.Errorf("delete habit: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	purgeCache(ctx, s.cache, s.logger, cache.ResourceHabits, ownerID)
+	purgeCache(ctx, s.cache, s.logger, cache.ResourceDiary, ownerID)
+	return nil
+}
+
+// GetHabit возвращает одну привычку с проверкой прав.
+func (s *HabitService) GetHabit(ctx context.Context, actor models.User, habitID uint) (*models.Habit, error) {
+	habit, err := s.store.Habits().GetByID(ctx, habitID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("habit %d: %w", habitID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !canManage(actor, habit.UserID) {
+		return nil, fmt.Errorf("habit %d: %w", habitID, ErrForbidden)
+	}
+	return habit, nil
+}
+
+// ListHabits возвращает страницу привычек. Обычный пользователь видит
+// только свои: filter.UserID для него заменяется его id. Администратор видит
+// все привычки или привычки пользователя filter.UserID.
+// Кроме страницы возвращаются курсор следующей и время последнего изменения
+// выборки (привычек или их логов).
+func (s *HabitService) ListHabits(ctx context.Context, actor models.User, filter repository.HabitFilter, page repository.Page) ([]models.Habit, *repository.Cursor, time.Time, error) {
+	ownerID := filter.UserID
+	filter.UserID = visibleOwner(actor, ownerID)
+	filter.WithUser = true
+
+	habits, next, err := s.store.Habits().List(ctx, filter, page)
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+
+	modified := lastWrite(ctx, s.cache, s.logger, scopeTag(cache.ResourceHabits, actor, ownerID))
+	for _, habit := range habits {
+		modified = latest(modified, habit.UpdatedAt)
+		for _, log := range habit.Logs {
+			modified = latest(modified, log.Date)
+		}
+	}
+	return habits, next, modified, nil
+}
+
+// ListLogs возвращает страницу логов с теми же правилами видимости, что и ListHabits.
+func (s *HabitService) ListLogs(ctx context.Context, actor models.User, filter repository.HabitLogFilter, page repository.Page) ([]models.HabitLog, *repository.Cursor, error) {
+	filter.UserID = visibleOwner(actor, filter.UserID)
+	filter.WithHabit = true
+	return s.store.HabitLogs().List(ctx, filter, page)
+}
+
+// BulkSetActive включает или выключает набор привычек одной транзакцией.
+// Если хотя бы одной привычки не существует, изменения откатываются.
+func (s *HabitService) BulkSetActive(ctx context.Context, habitIDs []uint, isActive bool) error {
+	if len(habitIDs) == 0 {
+		return nil
+	}
+
+	ids := uniqueIDs(habitIDs)
+	owners := make([]uint, 0, len(ids))
+
+	err := s.store.Transaction(ctx, func(tx repository.Store) error {
+		// Владельцы нужны, чтобы сбросить их кэш после коммита.
+		for _, id := range ids {
+			habit, err := tx.Habits().GetForUpdate(ctx, id)
+			if errors.Is(err, repository.ErrNotFound) {
+				return fmt.Errorf("habit %d: %w", id, ErrNotFound)
+			}
+			if err != nil {
+				return err
+			}
+			owners = append(owners, habit.UserID)
+		}
+
+		updated, err := tx.Habits().SetActive(ctx, ids, isActive)
+		if err != nil {
+			return fmt.Errorf("bulk update habits: %w", err)
+		}
+		if updated != int64(len(ids)) {
+			return fmt.Errorf("updated %d of %d habits: %w", updated, len(ids), ErrNotFound)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	purgeCache(ctx, s.cache, s.logger, cache.ResourceHabits, uniqueIDs(owners)...)
+
+	s.logger.Info("bulk_update_completed",
+		zap.Int("count", len(ids)),
+		zap.Bool("is_active", isActive),
+	)
+
+	return nil
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]struct{}, len(ids))
+	result := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		result = append(result, id)
+	}
+	return result
+}
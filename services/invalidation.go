@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/cache"
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"go.uber.org/zap"
+)
+
+// purgeCache сбрасывает закэшированные выборки ресурса после успешной записи.
+// Ошибка кэша не отменяет уже закоммиченную запись: устаревшие данные
+// в худшем случае истекут по TTL.
+func purgeCache(ctx context.Context, c cache.Cache, logger *zap.Logger, resource string, ownerIDs ...uint) {
+	tags := cache.WriteTags(resource, ownerIDs...)
+
+	// Время записи обновляется до сброса: запрос, успевший прочитать новые
+	// данные, уже не получит старый Last-Modified.
+	if err := cache.TouchTags(ctx, c, time.Now(), tags...); err != nil {
+		logger.Warn("cache_touch_failed", zap.Strings("tags", tags), zap.Error(err))
+	}
+	if err := c.InvalidateTags(ctx, tags...); err != nil {
+		logger.Warn("cache_invalidation_failed",
+			zap.String("resource", resource),
+			zap.Strings("tags", tags),
+			zap.Error(err),
+		)
+	}
+}
+
+// scopeTag возвращает тег, которым помечается выборка: своя для обычного
+// пользователя и общая для администратора без фильтра по владельцу.
+func scopeTag(resource string, actor models.User, ownerID *uint) string {
+	switch {
+	case actor.Role != models.RoleAdmin:
+		return cache.ResourceTag(resource, actor.ID)
+	case ownerID != nil:
+		return cache.ResourceTag(resource, *ownerID)
+	default:
+		return cache.AllResourceTag(resource)
+	}
+}
+
+// lastWrite возвращает время последней записи в выборку. Если отметки нет,
+// она выставляется в текущее время: лучше лишний раз отдать данные целиком,
+// чем ответить 304 на изменившуюся выборку.
+func lastWrite(ctx context.Context, c cache.Cache, logger *zap.Logger, tag string) time.Time {
+	at, err := cache.LastWrite(ctx, c, tag)
+	if err == nil {
+		return at
+	}
+	if !errors.Is(err, cache.ErrMiss) {
+		logger.Warn("cache_last_write_failed", zap.String("tag", tag), zap.Error(err))
+	}
+
+	at = time.Now()
+	if err := cache.TouchTags(ctx, c, at, tag); err != nil {
+		logger.Warn("cache_touch_failed", zap.String("tag", tag), zap.Error(err))
+	}
+	return at
+}
+
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
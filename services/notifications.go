@@ -0,0 +1,362 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/notify"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+	"go.uber.org/zap"
+)
+
+// NotificationJob — уведомление пользователю. Message — текст, Subject —
+// тема письма и заголовок во входящих.
+type NotificationJob struct {
+	UserID  uint
+	Message string
+	Type    string
+	Subject string
+}
+
+// ChannelResult — итог доставки уведомления по одному каналу.
+type ChannelResult struct {
+	Channel  string
+	Attempts int
+	// Skipped — канал не применим к получателю, например нет адреса почты.
+	Skipped bool
+	Err     error
+	// DeadLetterID — сохранённое недоставленное уведомление, если канал
+	// исчерпал попытки.
+	DeadLetterID uint
+}
+
+// NotificationResult — итог доставки задания по всем каналам. Err
+// объединяет ошибки каналов; nil — все применимые каналы доставили.
+type NotificationResult struct {
+	Job      NotificationJob
+	Channels []ChannelResult
+	Err      error
+}
+
+// RetryPolicy — повторы доставки по одному каналу. Пауза перед повтором
+// растёт вдвое с каждой попыткой, от BaseDelay до MaxDelay.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   2 * time.Second,
+	MaxDelay:    time.Minute,
+}
+
+// backoff возвращает паузу после неудачной попытки attempt. Половина паузы
+// случайна, чтобы повторы многих заданий не приходили в канал пачкой.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay << min(attempt-1, 30)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// notificationWorkers — размер пула по умолчанию.
+const notificationWorkers = 5
+
+/*
+╔═══════════════════════════════════════════════════════════════════╗
+║  WORKER POOL PATTERN - ДЛЯ МАССОВЫХ ОПЕРАЦИЙ                      ║
+╚═══════════════════════════════════════════════════════════════════╝
+
+ОБОСНОВАНИЕ:
+- Ограничиваем количество одновременных операций
+- Предотвращаем перегрузку внешних сервисов
+- Контролируемый параллелизм
+*/
+
+// ProcessNotificationsConcurrently доставляет задания через deliver
+// не более чем в workerCount потоков и возвращает результаты в порядке
+// заданий.
+func ProcessNotificationsConcurrently(ctx context.Context, jobs []NotificationJob, workerCount int, deliver func(context.Context, NotificationJob) NotificationResult) []NotificationResult {
+	results := make([]NotificationResult, len(jobs))
+	jobChan := make(chan int, len(jobs))
+	var wg sync.WaitGroup
+
+	for i := 0; i < max(workerCount, 1); i++ {
+		wg.Add(1)
+		go notificationWorker(ctx, jobChan, jobs, results, &wg, deliver)
+	}
+
+	for i := range jobs {
+		jobChan <- i
+	}
+	close(jobChan)
+
+	wg.Wait()
+	return results
+}
+
+// notificationWorker пишет результат в ячейку своего задания, поэтому
+// общий срез results не требует блокировки.
+func notificationWorker(ctx context.Context, indexes <-chan int, jobs []NotificationJob, results []NotificationResult, wg *sync.WaitGroup, deliver func(context.Context, NotificationJob) NotificationResult) {
+	defer wg.Done()
+
+	for i := range indexes {
+		results[i] = deliver(ctx, jobs[i])
+	}
+}
+
+// NotificationService рассылает уведомления по всем настроенным каналам
+// с повторами; что не удалось доставить, сохраняется в DeadLetters.
+type NotificationService struct {
+	store     repository.Store
+	logger    *zap.Logger
+	notifiers []notify.Notifier
+	retry     RetryPolicy
+	workers   int
+}
+
+// NewNotificationService: нулевые поля retry берутся из DefaultRetryPolicy.
+func NewNotificationService(store repository.Store, logger *zap.Logger, retry RetryPolicy, notifiers ...notify.Notifier) *NotificationService {
+	if retry.MaxAttempts <= 0 {
+		retry.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if retry.BaseDelay <= 0 {
+		retry.BaseDelay = DefaultRetryPolicy.BaseDelay
+	}
+	if retry.MaxDelay <= 0 {
+		retry.MaxDelay = DefaultRetryPolicy.MaxDelay
+	}
+	return &NotificationService{
+		store:     store,
+		logger:    logger,
+		notifiers: notifiers,
+		retry:     retry,
+		workers:   notificationWorkers,
+	}
+}
+
+// Process доставляет задания пулом воркеров и возвращает результаты
+// в порядке заданий.
+func (s *NotificationService) Process(ctx context.Context, jobs []NotificationJob) []NotificationResult {
+	results := ProcessNotificationsConcurrently(ctx, jobs, s.workers, s.deliver)
+
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	s.logger.Info("notifications_processed",
+		zap.Int("success", len(results)-failed),
+		zap.Int("errors", failed),
+		zap.Int("workers", s.workers),
+	)
+	return results
+}
+
+func (s *NotificationService) deliver(ctx context.Context, job NotificationJob) NotificationResult {
+	result := NotificationResult{Job: job}
+
+	user, err := s.store.Users().GetByID(ctx, job.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		err = fmt.Errorf("recipient %d: %w", job.UserID, ErrNotFound)
+	}
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	msg := notify.Message{
+		UserID:  job.UserID,
+		Email:   user.Email,
+		Type:    job.Type,
+		Subject: job.Subject,
+		Body:    job.Message,
+	}
+
+	var errs []error
+	for _, n := range s.notifiers {
+		ch := s.send(ctx, n, msg, s.retry.MaxAttempts)
+		if ch.Err != nil {
+			ch.DeadLetterID = s.deadLetter(ctx, msg, ch)
+			errs = append(errs, fmt.Errorf("%s: %w", ch.Channel, ch.Err))
+		}
+		result.Channels = append(result.Channels, ch)
+	}
+	result.Err = errors.Join(errs...)
+	return result
+}
+
+// send отправляет сообщение в канал, повторяя временные ошибки не более
+// attempts раз. Отмена контекста прекращает повторы.
+func (s *NotificationService) send(ctx context.Context, n notify.Notifier, msg notify.Message, attempts int) ChannelResult {
+	res := ChannelResult{Channel: n.Channel()}
+	for {
+		res.Attempts++
+		err := n.Notify(ctx, msg)
+		res.Err = err
+		if err == nil {
+			return res
+		}
+		if errors.Is(err, notify.ErrSkipped) {
+			res.Skipped, res.Err = true, nil
+			return res
+		}
+		if notify.IsPermanent(err) || res.Attempts >= attempts {
+			return res
+		}
+
+		delay := s.retry.backoff(res.Attempts)
+		s.logger.Warn("notification_retry",
+			zap.String("channel", res.Channel),
+			zap.Uint("user_id", msg.UserID),
+			zap.Int("attempt", res.Attempts),
+			zap.Duration("delay", delay),
+			zap.Error(err),
+		)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return res
+		case <-timer.C:
+		}
+	}
+}
+
+// deadLetter сохраняет недоставленное уведомление. Запись делается и после
+// отмены контекста, чтобы уведомления не терялись при остановке сервера.
+func (s *NotificationService) deadLetter(ctx context.Context, msg notify.Message, res ChannelResult) uint {
+	letter := &models.NotificationDeadLetter{
+		UserID:    msg.UserID,
+		Channel:   res.Channel,
+		Type:      msg.Type,
+		Subject:   msg.Subject,
+		Body:      msg.Body,
+		Attempts:  res.Attempts,
+		LastError: res.Err.Error(),
+	}
+	if err := s.store.DeadLetters().Create(context.WithoutCancel(ctx), letter); err != nil {
+		s.logger.Error("notification_dead_letter_failed",
+			zap.String("channel", res.Channel),
+			zap.Uint("user_id", msg.UserID),
+			zap.Error(err),
+		)
+		return 0
+	}
+
+	s.logger.Warn("notification_dead_lettered",
+		zap.Uint("dead_letter_id", letter.ID),
+		zap.String("channel", res.Channel),
+		zap.Uint("user_id", msg.UserID),
+		zap.Int("attempts", res.Attempts),
+		zap.Error(res.Err),
+	)
+	return letter.ID
+}
+
+// Inbox возвращает входящие actor; filter.UserID заменяется его id.
+func (s *NotificationService) Inbox(ctx context.Context, actor models.User, filter repository.NotificationFilter, page repository.Page) ([]models.Notification, *repository.Cursor, error) {
+	filter.UserID = actor.ID
+	return s.store.Notifications().List(ctx, filter, page)
+}
+
+// UnreadCount возвращает число непрочитанных входящих actor.
+func (s *NotificationService) UnreadCount(ctx context.Context, actor models.User) (int64, error) {
+	return s.store.Notifications().UnreadCount(ctx, actor.ID)
+}
+
+// MarkRead отмечает уведомление прочитанным. Входящие личные: чужое
+// уведомление недоступно и администратору.
+func (s *NotificationService) MarkRead(ctx context.Context, actor models.User, id uint) (*models.Notification, error) {
+	notification, err := s.store.Notifications().GetByID(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("notification %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if notification.UserID != actor.ID {
+		return nil, fmt.Errorf("notification %d: %w", id, ErrForbidden)
+	}
+	if notification.ReadAt != nil {
+		return notification, nil
+	}
+
+	now := time.Now().UTC()
+	if err := s.store.Notifications().MarkRead(ctx, id, now); err != nil {
+		return nil, err
+	}
+	notification.ReadAt = &now
+	return notification, nil
+}
+
+// MarkAllRead отмечает прочитанными все входящие actor и возвращает,
+// сколько было непрочитанных.
+func (s *NotificationService) MarkAllRead(ctx context.Context, actor models.User) (int64, error) {
+	return s.store.Notifications().MarkAllRead(ctx, actor.ID, time.Now().UTC())
+}
+
+// DeadLetters возвращает недоставленные уведомления.
+func (s *NotificationService) DeadLetters(ctx context.Context, filter repository.DeadLetterFilter, page repository.Page) ([]models.NotificationDeadLetter, *repository.Cursor, error) {
+	return s.store.DeadLetters().List(ctx, filter, page)
+}
+
+// RetryDeadLetter отправляет недоставленное уведомление ещё раз, одной
+// попыткой. Доставленное или ставшее неприменимым, например после
+// удаления адреса почты, удаляется; иначе у записи растёт число попыток.
+func (s *NotificationService) RetryDeadLetter(ctx context.Context, id uint) (*ChannelResult, error) {
+	letter, err := s.store.DeadLetters().GetByID(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("dead letter %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var notifier notify.Notifier
+	for _, n := range s.notifiers {
+		if n.Channel() == letter.Channel {
+			notifier = n
+		}
+	}
+	if notifier == nil {
+		return nil, fmt.Errorf("channel %q is not configured: %w", letter.Channel, ErrConflict)
+	}
+	user, err := s.store.Users().GetByID(ctx, letter.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("recipient %d no longer exists: %w", letter.UserID, ErrConflict)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := s.send(ctx, notifier, notify.Message{
+		UserID:  letter.UserID,
+		Email:   user.Email,
+		Type:    letter.Type,
+		Subject: letter.Subject,
+		Body:    letter.Body,
+	}, 1)
+	if res.Err == nil {
+		if err := s.store.DeadLetters().Delete(ctx, letter.ID); err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return nil, err
+		}
+		return &res, nil
+	}
+
+	letter.Attempts += res.Attempts
+	letter.LastError = res.Err.Error()
+	if err := s.store.DeadLetters().Update(ctx, letter); err != nil {
+		return nil, err
+	}
+	res.DeadLetterID = letter.ID
+	return &res, nil
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/notify"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+	"go.uber.org/zap"
+)
+
+// fakeNotifier отвечает ошибками из errs по очереди, затем успехом.
+type fakeNotifier struct {
+	channel string
+	mu      sync.Mutex
+	errs    []error
+	calls   int
+}
+
+func (n *fakeNotifier) Channel() string { return n.channel }
+
+func (n *fakeNotifier) Notify(ctx context.Context, msg notify.Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls++
+	if len(n.errs) == 0 {
+		return nil
+	}
+	err := n.errs[0]
+	n.errs = n.errs[1:]
+	return err
+}
+
+func TestNotificationServiceRetriesAndDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryStore()
+	user := models.User{Username: "alice"}
+	if err := store.Users().Create(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+
+	temporary := errors.New("connection reset")
+	flaky := &fakeNotifier{channel: "flaky", errs: []error{temporary, temporary}}
+	down := &fakeNotifier{channel: "down", errs: []error{temporary, temporary, temporary, temporary}}
+	rejected := &fakeNotifier{channel: "rejected", errs: []error{notify.Permanent(errors.New("410 gone"))}}
+	skipped := &fakeNotifier{channel: "skipped", errs: []error{notify.ErrSkipped}}
+
+	svc := NewNotificationService(store, zap.NewNop(),
+		RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond},
+		flaky, down, rejected, skipped)
+
+	results := svc.Process(ctx, []NotificationJob{
+		{UserID: user.ID, Type: "report", Subject: "Ready", Message: "Done"},
+		{UserID: 999, Type: "report", Message: "Nobody"},
+	})
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if !errors.Is(results[1].Err, ErrNotFound) || len(results[1].Channels) != 0 {
+		t.Fatalf("unknown recipient: %+v", results[1])
+	}
+
+	got := map[string]ChannelResult{}
+	for _, ch := range results[0].Channels {
+		got[ch.Channel] = ch
+	}
+	if ch := got["flaky"]; ch.Err != nil || ch.Attempts != 3 {
+		t.Fatalf("flaky channel: %+v", ch)
+	}
+	if ch := got["down"]; !errors.Is(ch.Err, temporary) || ch.Attempts != 3 || ch.DeadLetterID == 0 {
+		t.Fatalf("down channel: %+v", ch)
+	}
+	if ch := got["rejected"]; !notify.IsPermanent(ch.Err) || ch.Attempts != 1 || ch.DeadLetterID == 0 {
+		t.Fatalf("rejected channel: %+v", ch)
+	}
+	if ch := got["skipped"]; ch.Err != nil || !ch.Skipped {
+		t.Fatalf("skipped channel: %+v", ch)
+	}
+	if !errors.Is(results[0].Err, temporary) {
+		t.Fatalf("result error does not report channel failures: %v", results[0].Err)
+	}
+
+	letters, _, err := svc.DeadLetters(ctx, repository.DeadLetterFilter{Channel: "down"}, repository.Page{})
+	if err != nil || len(letters) != 1 {
+		t.Fatalf("dead letters: %+v, %v", letters, err)
+	}
+	letter := letters[0]
+	if letter.UserID != user.ID || letter.Subject != "Ready" || letter.Body != "Done" || letter.Attempts != 3 || letter.LastError == "" {
+		t.Fatalf("unexpected dead letter %+v", letter)
+	}
+
+	// Канал всё ещё падает: попытка добавляется к записи.
+	res, err := svc.RetryDeadLetter(ctx, letter.ID)
+	if err != nil || res.Err == nil {
+		t.Fatalf("retry while down: %+v, %v", res, err)
+	}
+	stored, _ := store.DeadLetters().GetByID(ctx, letter.ID)
+	if stored.Attempts != 4 {
+		t.Fatalf("attempts not recorded: %+v", stored)
+	}
+
+	res, err = svc.RetryDeadLetter(ctx, letter.ID)
+	if err != nil || res.Err != nil {
+		t.Fatalf("retry after recovery: %+v, %v", res, err)
+	}
+	if _, err := store.DeadLetters().GetByID(ctx, letter.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("delivered dead letter kept: %v", err)
+	}
+
+	orphan := models.NotificationDeadLetter{UserID: user.ID, Channel: "email", Type: "report"}
+	if err := store.DeadLetters().Create(ctx, &orphan); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.RetryDeadLetter(ctx, orphan.ID); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected conflict for unconfigured channel, got %v", err)
+	}
+}
+
+func TestNotificationServiceStopsRetryingOnCancel(t *testing.T) {
+	store := repository.NewMemoryStore()
+	user := models.User{Username: "alice"}
+	if err := store.Users().Create(context.Background(), &user); err != nil {
+		t.Fatal(err)
+	}
+
+	down := &fakeNotifier{channel: "down", errs: []error{errors.New("timeout"), errors.New("timeout")}}
+	svc := NewNotificationService(store, zap.NewNop(),
+		RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}, down)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	results := svc.Process(ctx, []NotificationJob{{UserID: user.ID, Type: "reminder", Message: "Run"}})
+
+	ch := results[0].Channels[0]
+	if ch.Attempts != 1 || ch.DeadLetterID == 0 {
+		t.Fatalf("expected one attempt and a dead letter, got %+v", ch)
+	}
+}
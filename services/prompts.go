@@ -0,0 +1,238 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+)
+
+// TodayPrompt — подсказка пользователя на день. Answered — на неё уже
+// ответили записью в этот день.
+type TodayPrompt struct {
+	Date     string               `json:"date"`
+	Timezone string               `json:"timezone"`
+	Prompt   models.JournalPrompt `json:"prompt"`
+	Answered bool                 `json:"answered"`
+}
+
+// PromptEngagement — отклик на подсказку. ResponseRate — записей на одну
+// выдачу; может быть больше 1, если на подсказку отвечают несколько раз
+// или выбирают её из библиотеки сами.
+type PromptEngagement struct {
+	Prompt       models.JournalPrompt `json:"prompt"`
+	Shown        int                  `json:"shown"`
+	Answered     int                  `json:"answered"`
+	Users        int                  `json:"users"`
+	ResponseRate *float64             `json:"response_rate"`
+}
+
+type PromptInput struct {
+	Category string
+	Text     string
+	IsActive *bool
+}
+
+// PromptService ведёт библиотеку подсказок и выдаёт их пользователям.
+type PromptService struct {
+	store repository.Store
+}
+
+func NewPromptService(store repository.Store) *PromptService {
+	return &PromptService{store: store}
+}
+
+// Today возвращает подсказку на сегодняшний день в loc. В течение дня
+// подсказка не меняется; новая выбирается из ещё не выданных пользователю,
+// а когда они кончились — из выданных раньше всех остальных. category
+// ограничивает выбор одной категорией.
+func (s *PromptService) Today(ctx context.Context, actor models.User, category string, loc *time.Location) (*TodayPrompt, error) {
+	now := time.Now().In(loc)
+	day := now.Format(time.DateOnly)
+
+	assignment, err := s.store.Prompts().Assignment(ctx, actor.ID, day, category)
+	if errors.Is(err, repository.ErrNotFound) {
+		assignment, err = s.assign(ctx, actor.ID, day, category)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	prompt, err := s.store.Prompts().GetByID(ctx, assignment.PromptID)
+	if err != nil {
+		return nil, fmt.Errorf("load prompt %d: %w", assignment.PromptID, err)
+	}
+
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	end := start.AddDate(0, 0, 1)
+	answers, err := s.store.Diaries().Count(ctx, repository.DiaryFilter{
+		UserID: &actor.ID, PromptID: &prompt.ID, From: &start, To: &end,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TodayPrompt{Date: day, Timezone: loc.String(), Prompt: *prompt, Answered: answers > 0}, nil
+}
+
+// assign выбирает и сохраняет подсказку на день. Если параллельный запрос
+// успел раньше, возвращается его выбор.
+func (s *PromptService) assign(ctx context.Context, userID uint, day, category string) (*models.PromptAssignment, error) {
+	active := true
+	prompts, err := s.store.Prompts().List(ctx, repository.PromptFilter{Category: category, IsActive: &active})
+	if err != nil {
+		return nil, err
+	}
+	if len(prompts) == 0 {
+		return nil, fmt.Errorf("no active prompts in category %q: %w", category, ErrNotFound)
+	}
+	lastShown, err := s.store.Prompts().LastShown(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	assignment := &models.PromptAssignment{
+		UserID:   userID,
+		Day:      day,
+		Category: category,
+		PromptID: pickPrompt(prompts, lastShown, userID, day),
+	}
+	err = s.store.Prompts().Assign(ctx, assignment)
+	if errors.Is(err, repository.ErrDuplicate) {
+		return s.store.Prompts().Assignment(ctx, userID, day, category)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("assign prompt: %w", err)
+	}
+	return assignment, nil
+}
+
+// pickPrompt выбирает среди невыданных подсказок псевдослучайно, но
+// одинаково для пользователя и дня; если выдано всё — самую давнюю.
+func pickPrompt(prompts []models.JournalPrompt, lastShown map[uint]string, userID uint, day string) uint {
+	var unseen []models.JournalPrompt
+	for _, p := range prompts {
+		if _, ok := lastShown[p.ID]; !ok {
+			unseen = append(unseen, p)
+		}
+	}
+	if len(unseen) > 0 {
+		h := fnv.New32a()
+		h.Write([]byte(strconv.FormatUint(uint64(userID), 10) + "/" + day))
+		return unseen[int(h.Sum32()%uint32(len(unseen)))].ID
+	}
+
+	oldest := slices.MinFunc(prompts, func(a, b models.JournalPrompt) int {
+		return cmp.Or(strings.Compare(lastShown[a.ID], lastShown[b.ID]), cmp.Compare(a.ID, b.ID))
+	})
+	return oldest.ID
+}
+
+// List возвращает подсказки библиотеки.
+func (s *PromptService) List(ctx context.Context, filter repository.PromptFilter) ([]models.JournalPrompt, error) {
+	return s.store.Prompts().List(ctx, filter)
+}
+
+func (s *PromptService) Create(ctx context.Context, in PromptInput) (*models.JournalPrompt, error) {
+	prompt := models.JournalPrompt{Category: in.Category, Text: in.Text, IsActive: true}
+	if in.IsActive != nil {
+		prompt.IsActive = *in.IsActive
+	}
+	if err := s.store.Prompts().Create(ctx, &prompt); err != nil {
+		return nil, fmt.Errorf("create prompt: %w", err)
+	}
+	return &prompt, nil
+}
+
+// Update меняет поля подсказки; пустые поля ввода не трогаются.
+func (s *PromptService) Update(ctx context.Context, id uint, in PromptInput) (*models.JournalPrompt, error) {
+	prompt, err := findPrompt(ctx, s.store, id)
+	if err != nil {
+		return nil, err
+	}
+	if in.Category != "" {
+		prompt.Category = in.Category
+	}
+	if in.Text != "" {
+		prompt.Text = in.Text
+	}
+	if in.IsActive != nil {
+		prompt.IsActive = *in.IsActive
+	}
+	if err := s.store.Prompts().Update(ctx, prompt); err != nil {
+		return nil, fmt.Errorf("update prompt: %w", err)
+	}
+	return prompt, nil
+}
+
+// Delete удаляет подсказку, на которую ещё никто не ответил; отвеченную
+// можно только выключить, чтобы записи не ссылались в пустоту.
+func (s *PromptService) Delete(ctx context.Context, id uint) error {
+	return s.store.Transaction(ctx, func(tx repository.Store) error {
+		if _, err := findPrompt(ctx, tx, id); err != nil {
+			return err
+		}
+		answers, err := tx.Diaries().Count(ctx, repository.DiaryFilter{PromptID: &id})
+		if err != nil {
+			return err
+		}
+		if answers > 0 {
+			return fmt.Errorf("prompt %d has %d answers, deactivate it instead: %w", id, answers, ErrConflict)
+		}
+		return tx.Prompts().Delete(ctx, id)
+	})
+}
+
+// Engagement считает выдачи и ответы по всем подсказкам библиотеки,
+// включая те, что ни разу не выдавались.
+func (s *PromptService) Engagement(ctx context.Context, filter repository.PromptStatsFilter) ([]PromptEngagement, error) {
+	prompts, err := s.store.Prompts().List(ctx, repository.PromptFilter{})
+	if err != nil {
+		return nil, err
+	}
+	stats, err := s.store.Prompts().Stats(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	byPrompt := make(map[uint]repository.PromptStat, len(stats))
+	for _, stat := range stats {
+		byPrompt[stat.PromptID] = stat
+	}
+
+	report := make([]PromptEngagement, 0, len(prompts))
+	for _, prompt := range prompts {
+		stat := byPrompt[prompt.ID]
+		row := PromptEngagement{Prompt: prompt, Shown: stat.Shown, Answered: stat.Answered, Users: stat.Users}
+		if stat.Shown > 0 {
+			rate := float64(stat.Answered) / float64(stat.Shown)
+			row.ResponseRate = &rate
+		}
+		report = append(report, row)
+	}
+	return report, nil
+}
+
+// checkPrompt проверяет подсказку, на которую отвечает запись.
+func checkPrompt(ctx context.Context, store repository.Store, id uint) error {
+	_, err := store.Prompts().GetByID(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("prompt %d not found: %w", id, ErrInvalidInput)
+	}
+	return err
+}
+
+func findPrompt(ctx context.Context, store repository.Store, id uint) (*models.JournalPrompt, error) {
+	prompt, err := store.Prompts().GetByID(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("prompt %d: %w", id, ErrNotFound)
+	}
+	return prompt, err
+}
@@ -0,0 +1,333 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/cache"
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxRemindersPerHabit ограничивает напоминания одной привычки.
+	maxRemindersPerHabit = 5
+	// reminderWindow — сколько после назначенного времени напоминание ещё
+	// отправляется, если планировщик пропустил нужную минуту: сервер
+	// перезапускался или местного времени не было из-за перевода часов.
+	reminderWindow  = 30 * time.Minute
+	reminderLockKey = "reminders:scheduler"
+	// reminderTimeLayout — формат времени напоминания.
+	reminderTimeLayout = "15:04"
+)
+
+// ReminderInput — время напоминания в формате HH:MM и дни недели от 1
+// (понедельник) до 7; пустые Days — каждый день.
+type ReminderInput struct {
+	Time string
+	Days []int
+}
+
+// ReminderService ведёт напоминания о привычках и раз в минуту рассылает
+// наступившие через notify.
+type ReminderService struct {
+	store   repository.Store
+	cache   cache.Cache
+	logger  *zap.Logger
+	notify  NotifyFunc
+	pending sync.WaitGroup
+}
+
+// NewReminderService: notify nil — напоминания только отмечаются
+// отправленными, без доставки.
+func NewReminderService(store repository.Store, c cache.Cache, logger *zap.Logger, notify NotifyFunc) *ReminderService {
+	return &ReminderService{store: store, cache: c, logger: logger, notify: notify}
+}
+
+// normalize проверяет время и дни и возвращает дни по порядку без повторов.
+func (in ReminderInput) normalize() (ReminderInput, error) {
+	if _, err := time.Parse(reminderTimeLayout, in.Time); err != nil || len(in.Time) != len(reminderTimeLayout) {
+		return in, fmt.Errorf("reminder time %q must be HH:MM: %w", in.Time, ErrInvalidInput)
+	}
+	days := make([]int, 0, len(in.Days))
+	for _, day := range in.Days {
+		if day < 1 || day > 7 {
+			return in, fmt.Errorf("reminder day %d must be 1..7: %w", day, ErrInvalidInput)
+		}
+		days = append(days, day)
+	}
+	slices.Sort(days)
+	in.Days = slices.Compact(days)
+	return in, nil
+}
+
+// habit возвращает привычку, если actor может ею управлять.
+func (s *ReminderService) habit(ctx context.Context, tx repository.Store, actor models.User, habitID uint) (*models.Habit, error) {
+	habit, err := tx.Habits().GetByID(ctx, habitID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("habit %d: %w", habitID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !canManage(actor, habit.UserID) {
+		return nil, fmt.Errorf("habit %d: %w", habitID, ErrForbidden)
+	}
+	return habit, nil
+}
+
+// reminder возвращает напоминание, если actor может управлять его привычкой.
+func (s *ReminderService) reminder(ctx context.Context, tx repository.Store, actor models.User, id uint) (*models.HabitReminder, error) {
+	reminder, err := tx.Reminders().GetByID(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("reminder %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !canManage(actor, reminder.UserID) {
+		return nil, fmt.Errorf("reminder %d: %w", id, ErrForbidden)
+	}
+	return reminder, nil
+}
+
+// List возвращает напоминания привычки по времени.
+func (s *ReminderService) List(ctx context.Context, actor models.User, habitID uint) ([]models.HabitReminder, error) {
+	if _, err := s.habit(ctx, s.store, actor, habitID); err != nil {
+		return nil, err
+	}
+	return s.store.Reminders().List(ctx, repository.ReminderFilter{HabitID: &habitID})
+}
+
+// Create добавляет напоминание привычке. Второе напоминание на то же время
+// и больше maxRemindersPerHabit напоминаний — ErrConflict.
+func (s *ReminderService) Create(ctx context.Context, actor models.User, habitID uint, in ReminderInput) (*models.HabitReminder, error) {
+	in, err := in.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	var reminder models.HabitReminder
+	err = s.store.Transaction(ctx, func(tx repository.Store) error {
+		habit, err := findHabitForUpdate(ctx, tx, actor, habitID)
+		if err != nil {
+			return err
+		}
+		if err := s.checkSlot(ctx, tx, habit.ID, in.Time, 0); err != nil {
+			return err
+		}
+
+		reminder = models.HabitReminder{HabitID: habit.ID, UserID: habit.UserID, Time: in.Time, Days: in.Days}
+		return tx.Reminders().Create(ctx, &reminder)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &reminder, nil
+}
+
+// checkSlot проверяет, что у привычки есть место для напоминания на время
+// at; excludeID — изменяемое напоминание.
+func (s *ReminderService) checkSlot(ctx context.Context, tx repository.Store, habitID uint, at string, excludeID uint) error {
+	existing, err := tx.Reminders().List(ctx, repository.ReminderFilter{HabitID: &habitID})
+	if err != nil {
+		return err
+	}
+	others := 0
+	for _, r := range existing {
+		if r.ID == excludeID {
+			continue
+		}
+		if r.Time == at {
+			return fmt.Errorf("habit %d already has a reminder at %s: %w", habitID, at, ErrConflict)
+		}
+		others++
+	}
+	if others >= maxRemindersPerHabit {
+		return fmt.Errorf("habit %d has %d reminders: %w", habitID, others, ErrConflict)
+	}
+	return nil
+}
+
+// Update меняет время и дни напоминания. Если сегодня оно уже приходило,
+// в новое время сегодня оно не повторится.
+func (s *ReminderService) Update(ctx context.Context, actor models.User, id uint, in ReminderInput) (*models.HabitReminder, error) {
+	in, err := in.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	var reminder *models.HabitReminder
+	err = s.store.Transaction(ctx, func(tx repository.Store) error {
+		reminder, err = s.reminder(ctx, tx, actor, id)
+		if err != nil {
+			return err
+		}
+		if _, err := findHabitForUpdate(ctx, tx, actor, reminder.HabitID); err != nil {
+			return err
+		}
+		if err := s.checkSlot(ctx, tx, reminder.HabitID, in.Time, reminder.ID); err != nil {
+			return err
+		}
+
+		reminder.Time, reminder.Days = in.Time, in.Days
+		return tx.Reminders().Update(ctx, reminder)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reminder, nil
+}
+
+func (s *ReminderService) Delete(ctx context.Context, actor models.User, id uint) error {
+	reminder, err := s.reminder(ctx, s.store, actor, id)
+	if err != nil {
+		return err
+	}
+	err = s.store.Reminders().Delete(ctx, reminder.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("reminder %d: %w", id, ErrNotFound)
+	}
+	return err
+}
+
+// Run раз в interval рассылает наступившие напоминания, пока не отменён
+// ctx. Интервал — не больше минуты, иначе напоминания будут опаздывать.
+func (s *ReminderService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.scheduled(ctx, interval)
+		}
+	}
+}
+
+// scheduled — один проход планировщика. Блокировка на полинтервала
+// избавляет экземпляры сервера от лишней работы и не отбрасывает тики
+// из-за дрожания таймера; от повторной отправки защищает MarkSent.
+func (s *ReminderService) scheduled(ctx context.Context, interval time.Duration) {
+	res, err := s.cache.Take(ctx, reminderLockKey, cache.TokenBucket{Capacity: 1, Period: interval / 2})
+	if err != nil {
+		s.logger.Warn("reminders_lock_failed", zap.Error(err))
+		return
+	}
+	if !res.Allowed {
+		return
+	}
+
+	if _, err := s.SendDue(ctx, time.Now()); err != nil {
+		s.logger.Error("reminders_failed", zap.Error(err))
+	}
+}
+
+// SendDue рассылает напоминания, время которых наступило к now в часовом
+// поясе владельца: не раньше назначенного и не позже reminderWindow.
+// Привычки, уже выполненные в этот местный день, пропускаются. Ошибка
+// с одним напоминанием не мешает остальным: уже отмеченные отправленными
+// доставляются всегда, а ошибки возвращаются вместе. Доставка с повторами
+// идёт в фоне, чтобы медленный канал не задерживал следующие проходы
+// планировщика; дождаться её можно через Wait. Возвращает число
+// поставленных в очередь уведомлений.
+func (s *ReminderService) SendDue(ctx context.Context, now time.Time) (int, error) {
+	reminders, err := s.store.Reminders().Due(ctx, now, reminderWindow)
+	if err != nil {
+		return 0, err
+	}
+
+	locations := make(map[string]*time.Location)
+	var jobs []NotificationJob
+	var errs []error
+	for _, r := range reminders {
+		loc, ok := locations[r.Timezone]
+		if !ok {
+			loc = s.location(r.UserID, r.Timezone)
+			locations[r.Timezone] = loc
+		}
+		local := now.In(loc)
+		day := local.Format(time.DateOnly)
+
+		done, err := s.completedOn(ctx, r.HabitID, local)
+		if err != nil {
+			s.logger.Error("reminder_check_failed", zap.Uint("reminder_id", r.ID), zap.Error(err))
+			errs = append(errs, fmt.Errorf("reminder %d: %w", r.ID, err))
+			continue
+		}
+		if done {
+			continue
+		}
+		claimed, err := s.store.Reminders().MarkSent(ctx, r.ID, day)
+		if err != nil {
+			s.logger.Error("reminder_mark_failed", zap.Uint("reminder_id", r.ID), zap.Error(err))
+			errs = append(errs, fmt.Errorf("reminder %d: %w", r.ID, err))
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		jobs = append(jobs, NotificationJob{
+			UserID:  r.UserID,
+			Type:    "reminder",
+			Subject: "Напоминание: " + r.HabitTitle,
+			Message: fmt.Sprintf("Пора выполнить привычку «%s»: сегодня она ещё не отмечена.", r.HabitTitle),
+		})
+	}
+	if len(jobs) > 0 {
+		s.logger.Info("reminders_due", zap.Int("count", len(jobs)))
+		if s.notify != nil {
+			s.pending.Add(1)
+			go func() {
+				defer s.pending.Done()
+				s.notify(ctx, jobs)
+			}()
+		}
+	}
+	return len(jobs), errors.Join(errs...)
+}
+
+// Wait ждёт доставки, начатые SendDue.
+func (s *ReminderService) Wait() {
+	s.pending.Wait()
+}
+
+// location возвращает часовой пояс пользователя; пустой или неизвестный —
+// UTC.
+func (s *ReminderService) location(userID uint, tz string) *time.Location {
+	if tz == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		s.logger.Warn("reminder_timezone_invalid", zap.Uint("user_id", userID), zap.String("timezone", tz))
+		return time.UTC
+	}
+	return loc
+}
+
+// completedOn сообщает, есть ли у привычки выполненная отметка в местный
+// день local.
+func (s *ReminderService) completedOn(ctx context.Context, habitID uint, local time.Time) (bool, error) {
+	from := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+	to := from.AddDate(0, 0, 1)
+	completed := true
+	logs, _, err := s.store.HabitLogs().List(ctx, repository.HabitLogFilter{
+		HabitID:     &habitID,
+		IsCompleted: &completed,
+		From:        &from,
+		To:          &to,
+	}, repository.Page{Limit: 1})
+	if err != nil {
+		return false, err
+	}
+	return len(logs) > 0, nil
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+	"go.uber.org/zap"
+)
+
+func TestReminderServiceSendDue(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryStore()
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip("no tzdata:", err)
+	}
+
+	user := models.User{Username: "alice", Timezone: "Asia/Tokyo"}
+	if err := store.Users().Create(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+	habit := func(title string, active bool) models.Habit {
+		h := models.Habit{UserID: user.ID, Title: title, IsActive: active}
+		if err := store.Habits().Create(ctx, &h); err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	stretch := habit("Stretch", true)
+	read := habit("Read", true)
+	run := habit("Run", true)
+	paused := habit("Paused", false)
+
+	var jobs []NotificationJob
+	svc := NewReminderService(store, nil, zap.NewNop(), func(ctx context.Context, batch []NotificationJob) []NotificationResult {
+		jobs = append(jobs, batch...)
+		return make([]NotificationResult, len(batch))
+	})
+	for _, r := range []struct {
+		habitID uint
+		days    []int
+	}{
+		{stretch.ID, nil},
+		{read.ID, []int{7}}, // только по воскресеньям
+		{run.ID, []int{1, 2}},
+		{paused.ID, nil},
+	} {
+		if _, err := svc.Create(ctx, user, r.habitID, ReminderInput{Time: "08:00", Days: r.days}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Понедельник 08:10 в Токио — ещё воскресенье 23:10 по UTC.
+	monday := time.Date(2026, 10, 19, 8, 10, 0, 0, tokyo)
+	logs := []models.HabitLog{
+		// Вчера по местному времени, хотя тот же день по UTC.
+		{HabitID: stretch.ID, Date: time.Date(2026, 10, 18, 23, 30, 0, 0, tokyo), IsCompleted: true},
+		{HabitID: run.ID, Date: time.Date(2026, 10, 19, 6, 0, 0, 0, tokyo), IsCompleted: true},
+	}
+	for i := range logs {
+		if err := store.HabitLogs().Create(ctx, &logs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := svc.SendDue(ctx, monday.Add(-11*time.Minute)); err != nil || n != 0 {
+		t.Fatalf("early reminders sent: %d, %v", n, err)
+	}
+	n, err := svc.SendDue(ctx, monday)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.Wait()
+	if n != 1 || len(jobs) != 1 || jobs[0].UserID != user.ID || jobs[0].Type != "reminder" || !strings.Contains(jobs[0].Subject, "Stretch") {
+		t.Fatalf("unexpected jobs: %d, %+v", n, jobs)
+	}
+	if n, err := svc.SendDue(ctx, monday.Add(time.Minute)); err != nil || n != 0 {
+		t.Fatalf("reminder sent twice: %d, %v", n, err)
+	}
+
+	// Во вторник приходят напоминания Stretch и Run: вчерашняя отметка Run
+	// на новый день не переносится. После окна напоминания не приходят.
+	if n, err := svc.SendDue(ctx, monday.Add(24*time.Hour+reminderWindow)); err != nil || n != 0 {
+		t.Fatalf("late reminder sent: %d, %v", n, err)
+	}
+	if n, err := svc.SendDue(ctx, monday.Add(24*time.Hour)); err != nil || n != 2 {
+		t.Fatalf("next day reminders: %d, %v", n, err)
+	}
+}
+
+// flakyReminders не может отметить отправленным напоминание failID.
+type flakyReminders struct {
+	repository.ReminderRepository
+	failID uint
+}
+
+func (r flakyReminders) MarkSent(ctx context.Context, id uint, day string) (bool, error) {
+	if id == r.failID {
+		return false, errors.New("connection reset")
+	}
+	return r.ReminderRepository.MarkSent(ctx, id, day)
+}
+
+type flakyReminderStore struct {
+	repository.Store
+	failID uint
+}
+
+func (s flakyReminderStore) Reminders() repository.ReminderRepository {
+	return flakyReminders{ReminderRepository: s.Store.Reminders(), failID: s.failID}
+}
+
+func TestReminderServiceSendDueSkipsFailures(t *testing.T) {
+	ctx := context.Background()
+	mem := repository.NewMemoryStore()
+	user := models.User{Username: "bob"}
+	if err := mem.Users().Create(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+	var reminders []*models.HabitReminder
+	for _, title := range []string{"Stretch", "Read"} {
+		h := models.Habit{UserID: user.ID, Title: title, IsActive: true}
+		if err := mem.Habits().Create(ctx, &h); err != nil {
+			t.Fatal(err)
+		}
+		r := models.HabitReminder{HabitID: h.ID, UserID: user.ID, Time: "08:00"}
+		if err := mem.Reminders().Create(ctx, &r); err != nil {
+			t.Fatal(err)
+		}
+		reminders = append(reminders, &r)
+	}
+
+	var jobs []NotificationJob
+	store := flakyReminderStore{Store: mem, failID: reminders[0].ID}
+	svc := NewReminderService(store, nil, zap.NewNop(), func(ctx context.Context, batch []NotificationJob) []NotificationResult {
+		jobs = append(jobs, batch...)
+		return make([]NotificationResult, len(batch))
+	})
+
+	n, err := svc.SendDue(ctx, time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC))
+	svc.Wait()
+	if err == nil || n != 1 || len(jobs) != 1 || !strings.Contains(jobs[0].Subject, "Read") {
+		t.Fatalf("SendDue = %d, %v; jobs %+v", n, err, jobs)
+	}
+
+	// Правка времени не сбрасывает отметку об отправке.
+	reminders[1].Time = "09:00"
+	if err := mem.Reminders().Update(ctx, reminders[1]); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := mem.Reminders().GetByID(ctx, reminders[1].ID)
+	if err != nil || stored.Time != "09:00" || stored.LastSentOn != "2026-10-19" {
+		t.Fatalf("after update: %+v, %v", stored, err)
+	}
+}
+
+func TestReminderInputNormalize(t *testing.T) {
+	in, err := ReminderInput{Time: "06:05", Days: []int{3, 1, 3}}.normalize()
+	if err != nil || len(in.Days) != 2 || in.Days[0] != 1 || in.Days[1] != 3 {
+		t.Fatalf("normalize: %+v, %v", in, err)
+	}
+	for _, bad := range []ReminderInput{{Time: "6:05"}, {Time: "24:00"}, {Time: "06:05", Days: []int{8}}} {
+		if _, err := bad.normalize(); err == nil {
+			t.Fatalf("accepted %+v", bad)
+		}
+	}
+}
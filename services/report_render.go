@@ -0,0 +1,82 @@
+package services
+
+import (
+	htmltemplate "html/template"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+)
+
+// Шаблоны отчёта. HTML собирается html/template, поэтому названия привычек
+// и достижений экранируются; в Markdown они попадают как есть.
+var reportFuncs = map[string]any{
+	"pct": func(v float64) string { return strings.TrimSuffix(strconv.FormatFloat(v, 'f', 1, 64), ".0") + "%" },
+	"title": func(period string) string {
+		if period == models.ReportMonthly {
+			return "Отчёт за месяц"
+		}
+		return "Отчёт за неделю"
+	},
+}
+
+var reportMarkdown = template.Must(template.New("report.md").Funcs(reportFuncs).Parse(
+	`# {{title .Period}}: {{.From}} — {{.To}}
+
+Выполнено {{.Completed}} из {{.Scheduled}} запланированных отметок ({{pct .Rate}}).
+Записей в дневнике: {{.DiaryEntries}}.
+
+## Привычки
+{{if .Habits}}
+| Привычка | Выполнено | План | Процент | Серия |
+|---|---|---|---|---|
+{{- range .Habits}}
+| {{.Title}} | {{.Completed}} | {{.Scheduled}} | {{pct .Rate}} | {{.StreakBefore}} → {{.StreakAfter}} |
+{{- end}}
+{{else}}
+Привычек пока нет.
+{{end}}
+## Достижения
+{{if .Achievements}}
+{{- range .Achievements}}
+- **{{.Title}}**{{if .Description}} — {{.Description}}{{end}}
+{{- end}}
+{{else}}
+Новых достижений нет.
+{{end}}`))
+
+var reportHTML = htmltemplate.Must(htmltemplate.New("report.html").Funcs(reportFuncs).Parse(
+	`<!DOCTYPE html>
+<html lang="ru">
+<head><meta charset="utf-8"><title>{{title .Period}}: {{.From}} — {{.To}}</title></head>
+<body>
+<h1>{{title .Period}}: {{.From}} — {{.To}}</h1>
+<p>Выполнено {{.Completed}} из {{.Scheduled}} запланированных отметок ({{pct .Rate}}).</p>
+<p>Записей в дневнике: {{.DiaryEntries}}.</p>
+<h2>Привычки</h2>
+{{if .Habits}}<table>
+<tr><th>Привычка</th><th>Выполнено</th><th>План</th><th>Процент</th><th>Серия</th></tr>
+{{range .Habits}}<tr><td>{{.Title}}</td><td>{{.Completed}}</td><td>{{.Scheduled}}</td><td>{{pct .Rate}}</td><td>{{.StreakBefore}} → {{.StreakAfter}}</td></tr>
+{{end}}</table>{{else}}<p>Привычек пока нет.</p>{{end}}
+<h2>Достижения</h2>
+{{if .Achievements}}<ul>
+{{range .Achievements}}<li><strong>{{.Title}}</strong>{{if .Description}} — {{.Description}}{{end}}</li>
+{{end}}</ul>{{else}}<p>Новых достижений нет.</p>{{end}}
+</body>
+</html>
+`))
+
+// RenderMarkdown возвращает отчёт в Markdown.
+func (d *ReportData) RenderMarkdown() (string, error) {
+	var b strings.Builder
+	err := reportMarkdown.Execute(&b, d)
+	return b.String(), err
+}
+
+// RenderHTML возвращает отчёт отдельной HTML-страницей.
+func (d *ReportData) RenderHTML() (string, error) {
+	var b strings.Builder
+	err := reportHTML.Execute(&b, d)
+	return b.String(), err
+}
@@ -0,0 +1,369 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/cache"
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+	"go.uber.org/zap"
+)
+
+// reportLockKey — ведро, через которое экземпляры договариваются, кто
+// запускает плановую генерацию отчётов.
+const reportLockKey = "reports:generate"
+
+// reportUsersPage — сколько пользователей задание читает за один запрос.
+const reportUsersPage = 100
+
+// ReportHabit — выполнение одной привычки за период. Scheduled — сколько
+// отметок ожидалось по частоте привычки; Rate не превышает 100%.
+type ReportHabit struct {
+	HabitID      uint    `json:"habit_id"`
+	Title        string  `json:"title"`
+	Frequency    string  `json:"frequency"`
+	Scheduled    int     `json:"scheduled"`
+	Completed    int     `json:"completed"`
+	Rate         float64 `json:"rate"`
+	StreakBefore int     `json:"streak_before"`
+	StreakAfter  int     `json:"streak_after"`
+	StreakChange int     `json:"streak_change"`
+}
+
+type ReportAchievement struct {
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	EarnedAt    time.Time `json:"earned_at"`
+}
+
+// ReportData — содержимое отчёта, которое хранится в Report.Data.
+type ReportData struct {
+	Period       string              `json:"period"`
+	From         string              `json:"from"`
+	To           string              `json:"to"`
+	Scheduled    int                 `json:"scheduled"`
+	Completed    int                 `json:"completed"`
+	Rate         float64             `json:"rate"`
+	Habits       []ReportHabit       `json:"habits"`
+	Achievements []ReportAchievement `json:"achievements"`
+	DiaryEntries int64               `json:"diary_entries"`
+}
+
+// NotifyFunc рассылает уведомления пачкой и возвращает результаты
+// в порядке заданий.
+type NotifyFunc func(ctx context.Context, jobs []NotificationJob) []NotificationResult
+
+// ReportService собирает и хранит отчёты о прогрессе за неделю и месяц.
+type ReportService struct {
+	store  repository.Store
+	cache  cache.Cache
+	logger *zap.Logger
+	// notify — канал доставки готовых отчётов; nil — отчёты только сохраняются.
+	notify NotifyFunc
+}
+
+func NewReportService(store repository.Store, c cache.Cache, logger *zap.Logger, notify NotifyFunc) *ReportService {
+	return &ReportService{store: store, cache: c, logger: logger, notify: notify}
+}
+
+// ReportPeriod возвращает дни периода kind, содержащего day: неделю
+// с понедельника или календарный месяц (UTC, как в сводках).
+func ReportPeriod(kind string, day time.Time) (from, to time.Time, err error) {
+	day = day.UTC()
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	switch kind {
+	case models.ReportWeekly:
+		from = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		return from, from.AddDate(0, 0, 6), nil
+	case models.ReportMonthly:
+		from = time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return from, from.AddDate(0, 1, -1), nil
+	default:
+		return from, to, fmt.Errorf("unknown report period %q", kind)
+	}
+}
+
+// Generate собирает и сохраняет отчёт пользователя за период kind,
+// содержащий day. Повторный отчёт за тот же период — ErrConflict.
+func (s *ReportService) Generate(ctx context.Context, userID uint, kind string, day time.Time) (*models.Report, error) {
+	from, to, err := ReportPeriod(kind, day)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.store.Users().GetByID(ctx, userID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, fmt.Errorf("user %d: %w", userID, ErrNotFound)
+		}
+		return nil, err
+	}
+
+	data, err := s.build(ctx, userID, kind, from, to)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("encode report: %w", err)
+	}
+
+	report := models.Report{UserID: userID, Period: kind, PeriodStart: from, PeriodEnd: to, Data: raw}
+	err = s.store.Reports().Create(ctx, &report)
+	if errors.Is(err, repository.ErrDuplicate) {
+		return nil, fmt.Errorf("%s report of user %d for %s: %w", kind, userID, from.Format(time.DateOnly), ErrConflict)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("save report: %w", err)
+	}
+	return &report, nil
+}
+
+// GenerateAll собирает отчёты за период всем пользователям, у которых их
+// ещё нет, и рассылает их, если задан канал доставки. Ошибка по одному
+// пользователю не останавливает остальных.
+func (s *ReportService) GenerateAll(ctx context.Context, kind string, day time.Time) (int, error) {
+	if _, _, err := ReportPeriod(kind, day); err != nil {
+		return 0, err
+	}
+
+	var (
+		created []*models.Report
+		failed  int
+		page    = repository.Page{Limit: reportUsersPage}
+	)
+	for {
+		users, next, err := s.store.Users().List(ctx, repository.UserFilter{}, page)
+		if err != nil {
+			return len(created), fmt.Errorf("list users: %w", err)
+		}
+		for _, user := range users {
+			report, err := s.Generate(ctx, user.ID, kind, day)
+			switch {
+			case errors.Is(err, ErrConflict):
+			case err != nil:
+				failed++
+				s.logger.Error("report_generation_failed", zap.Uint("user_id", user.ID), zap.String("period", kind), zap.Error(err))
+			default:
+				created = append(created, report)
+			}
+		}
+		if next == nil {
+			break
+		}
+		page.After = next
+	}
+
+	s.deliver(ctx, created)
+	s.logger.Info("reports_generated",
+		zap.String("period", kind),
+		zap.Time("day", day),
+		zap.Int("created", len(created)),
+		zap.Int("failed", failed),
+	)
+	return len(created), nil
+}
+
+func (s *ReportService) deliver(ctx context.Context, reports []*models.Report) {
+	if s.notify == nil || len(reports) == 0 {
+		return
+	}
+
+	jobs := make([]NotificationJob, 0, len(reports))
+	for _, r := range reports {
+		jobs = append(jobs, NotificationJob{
+			UserID:  r.UserID,
+			Type:    "report",
+			Subject: "Отчёт о прогрессе готов",
+			Message: fmt.Sprintf("Отчёт за период %s — %s готов", r.PeriodStart.Format(time.DateOnly), r.PeriodEnd.Format(time.DateOnly)),
+		})
+	}
+	results := s.notify(ctx, jobs)
+
+	// Доставленным считается отчёт, о котором сообщили все каналы;
+	// остальные попали в недоставленные уведомления.
+	at := time.Now()
+	for i, r := range reports {
+		if results[i].Err != nil {
+			continue
+		}
+		if err := s.store.Reports().MarkDelivered(ctx, r.ID, at); err != nil {
+			s.logger.Warn("report_mark_delivered_failed", zap.Uint("report_id", r.ID), zap.Error(err))
+		}
+	}
+}
+
+func (s *ReportService) build(ctx context.Context, userID uint, kind string, from, to time.Time) (*ReportData, error) {
+	end := to.AddDate(0, 0, 1)
+
+	habits, _, err := s.store.Habits().List(ctx, repository.HabitFilter{UserID: &userID, CreatedTo: &end}, repository.Page{})
+	if err != nil {
+		return nil, fmt.Errorf("list habits: %w", err)
+	}
+	// Серия на начало периода берётся из последней сводки до него,
+	// поэтому читается вся история до конца периода.
+	days, err := s.store.Rollups().Daily(ctx, repository.RollupFilter{UserID: userID, To: to})
+	if err != nil {
+		return nil, fmt.Errorf("daily rollups: %w", err)
+	}
+	achievements, err := s.store.Achievements().List(ctx, repository.AchievementFilter{UserID: &userID, From: &from, To: &end})
+	if err != nil {
+		return nil, fmt.Errorf("list achievements: %w", err)
+	}
+	diaries, err := s.store.Diaries().Count(ctx, repository.DiaryFilter{UserID: &userID, From: &from, To: &end})
+	if err != nil {
+		return nil, fmt.Errorf("count diaries: %w", err)
+	}
+
+	data := &ReportData{
+		Period:       kind,
+		From:         from.Format(time.DateOnly),
+		To:           to.Format(time.DateOnly),
+		Habits:       make([]ReportHabit, 0, len(habits)),
+		Achievements: make([]ReportAchievement, 0, len(achievements)),
+		DiaryEntries: diaries,
+	}
+
+	byHabit := make(map[uint]*ReportHabit, len(habits))
+	for _, habit := range habits {
+		data.Habits = append(data.Habits, ReportHabit{
+			HabitID:   habit.ID,
+			Title:     habit.Title,
+			Frequency: habit.Frequency,
+			Scheduled: scheduledLogs(habit, from, to),
+		})
+	}
+	for i := range data.Habits {
+		byHabit[data.Habits[i].HabitID] = &data.Habits[i]
+	}
+
+	// Сводки идут по возрастанию дня, поэтому последняя запись до
+	// границы периода и есть серия на эту границу.
+	inPeriod := period{from, to}
+	for _, day := range days {
+		h, ok := byHabit[day.HabitID]
+		if !ok {
+			continue
+		}
+		if day.Day.Before(from) {
+			h.StreakBefore = day.RunEnd
+		}
+		if inPeriod.contains(day.Day) {
+			h.Completed += day.Completed
+		}
+		h.StreakAfter = day.RunEnd
+	}
+
+	var done int
+	for i := range data.Habits {
+		h := &data.Habits[i]
+		h.StreakChange = h.StreakAfter - h.StreakBefore
+		h.Rate = rate(min(h.Completed, h.Scheduled), h.Scheduled)
+		data.Scheduled += h.Scheduled
+		data.Completed += h.Completed
+		done += min(h.Completed, h.Scheduled)
+	}
+	data.Rate = rate(done, data.Scheduled)
+
+	for _, a := range achievements {
+		data.Achievements = append(data.Achievements, ReportAchievement{Title: a.Title, Description: a.Description, EarnedAt: a.EarnedAt})
+	}
+	return data, nil
+}
+
+// scheduledLogs считает отметки, ожидаемые от привычки за дни from..to:
+// по одной в день, неделю или календарный месяц с момента её создания.
+// Неактивная привычка на паузе и отметок не ждёт.
+func scheduledLogs(habit models.Habit, from, to time.Time) int {
+	if !habit.IsActive {
+		return 0
+	}
+	created := habit.CreatedAt.UTC()
+	start := time.Date(created.Year(), created.Month(), created.Day(), 0, 0, 0, 0, time.UTC)
+	if start.Before(from) {
+		start = from
+	}
+	days := int(to.Sub(start).Hours()/24) + 1
+	if days <= 0 {
+		return 0
+	}
+
+	switch habit.Frequency {
+	case "weekly":
+		return (days + 6) / 7
+	case "monthly":
+		return (to.Year()-start.Year())*12 + int(to.Month()-start.Month()) + 1
+	default:
+		return days
+	}
+}
+
+// List возвращает отчёты; администратор может запросить чужие через filter.UserID.
+func (s *ReportService) List(ctx context.Context, actor models.User, filter repository.ReportFilter, page repository.Page) ([]models.Report, *repository.Cursor, error) {
+	filter.UserID = visibleOwner(actor, filter.UserID)
+	return s.store.Reports().List(ctx, filter, page)
+}
+
+// Get возвращает отчёт вместе с разобранным содержимым.
+func (s *ReportService) Get(ctx context.Context, actor models.User, id uint) (*models.Report, *ReportData, error) {
+	report, err := s.store.Reports().GetByID(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil, fmt.Errorf("report %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !canManage(actor, report.UserID) {
+		return nil, nil, fmt.Errorf("report %d: %w", id, ErrForbidden)
+	}
+
+	var data ReportData
+	if err := json.Unmarshal(report.Data, &data); err != nil {
+		return nil, nil, fmt.Errorf("decode report %d: %w", id, err)
+	}
+	return report, &data, nil
+}
+
+// Run раз в interval собирает отчёты за последние завершённые неделю и
+// месяц. Уже собранные отчёты пропускаются, поэтому interval может быть
+// меньше периода: так отчёт появляется вскоре после его окончания.
+func (s *ReportService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.scheduled(ctx, interval)
+		}
+	}
+}
+
+func (s *ReportService) scheduled(ctx context.Context, interval time.Duration) {
+	res, err := s.cache.Take(ctx, reportLockKey, cache.TokenBucket{Capacity: 1, Period: interval})
+	if err != nil {
+		s.logger.Warn("reports_lock_failed", zap.Error(err))
+		return
+	}
+	if !res.Allowed {
+		return
+	}
+
+	today := time.Now().UTC()
+	due := []struct {
+		kind string
+		day  time.Time
+	}{
+		{models.ReportWeekly, today.AddDate(0, 0, -7)},
+		{models.ReportMonthly, time.Date(today.Year(), today.Month(), 0, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, d := range due {
+		if _, err := s.GenerateAll(ctx, d.kind, d.day); err != nil {
+			s.logger.Error("reports_generation_failed", zap.String("period", d.kind), zap.Error(err))
+		}
+	}
+}
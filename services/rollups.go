@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/cache"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+	"go.uber.org/zap"
+)
+
+// rebuildLockKey — ведро, через которое экземпляры приложения договариваются,
+// кто выполняет плановую пересборку сводок.
+const rebuildLockKey = "rollups:rebuild"
+
+// RollupService пересобирает сводки по логам. LogHabit обновляет их сам,
+// пересборка исправляет расхождения: логи задним числом, ручные правки в БД.
+type RollupService struct {
+	store   repository.Store
+	cache   cache.Cache
+	logger  *zap.Logger
+	running atomic.Bool
+}
+
+func NewRollupService(store repository.Store, c cache.Cache, logger *zap.Logger) *RollupService {
+	return &RollupService{store: store, cache: c, logger: logger}
+}
+
+// Rebuild синхронно пересобирает сводки пользователя; userID == nil — всех.
+// Одновременно выполняется только одна пересборка.
+func (s *RollupService) Rebuild(ctx context.Context, userID *uint) error {
+	if !s.running.CompareAndSwap(false, true) {
+		return fmt.Errorf("rollup rebuild: %w", ErrConflict)
+	}
+	defer s.running.Store(false)
+	return s.rebuild(ctx, userID)
+}
+
+// RebuildAsync запускает полную пересборку в фоне и сразу возвращается.
+func (s *RollupService) RebuildAsync() error {
+	if !s.running.CompareAndSwap(false, true) {
+		return fmt.Errorf("rollup rebuild: %w", ErrConflict)
+	}
+	go func() {
+		defer s.running.Store(false)
+		if err := s.rebuild(context.Background(), nil); err != nil {
+			s.logger.Error("rollups_rebuild_failed", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+// Running сообщает, идёт ли сейчас пересборка.
+func (s *RollupService) Running() bool {
+	return s.running.Load()
+}
+
+func (s *RollupService) rebuild(ctx context.Context, userID *uint) error {
+	start := time.Now()
+	// Репозиторий сам делит пересборку на транзакции по пользователям:
+	// общая транзакция держала бы блокировки всех пользователей до конца.
+	if err := s.store.Rollups().Rebuild(ctx, userID); err != nil {
+		return fmt.Errorf("rebuild rollups: %w", err)
+	}
+
+	// Статистика кэшируется под тегами пользователя, поэтому после полной
+	// пересборки её проще удалить по шаблону ключа.
+	if userID != nil {
+		purgeCache(ctx, s.cache, s.logger, cache.ResourceHabits, *userID)
+	} else if err := s.cache.DeletePattern(ctx, "user_stats:*"); err != nil {
+		s.logger.Warn("cache_invalidation_failed", zap.String("pattern", "user_stats:*"), zap.Error(err))
+	}
+
+	fields := []zap.Field{zap.Duration("duration", time.Since(start))}
+	if userID != nil {
+		fields = append(fields, zap.Uint("user_id", *userID))
+	}
+	s.logger.Info("rollups_rebuilt", fields...)
+	return nil
+}
+
+// Run пересобирает все сводки раз в interval, пока не отменён ctx.
+// Ведро в общем кэше пропускает за interval одну пересборку на все экземпляры.
+func (s *RollupService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.scheduled(ctx, interval)
+		}
+	}
+}
+
+func (s *RollupService) scheduled(ctx context.Context, interval time.Duration) {
+	res, err := s.cache.Take(ctx, rebuildLockKey, cache.TokenBucket{Capacity: 1, Period: interval})
+	if err != nil {
+		s.logger.Warn("rollups_lock_failed", zap.Error(err))
+		return
+	}
+	if !res.Allowed {
+		return
+	}
+	if err := s.Rebuild(ctx, nil); err != nil {
+		s.logger.Error("rollups_rebuild_failed", zap.Error(err))
+	}
+}
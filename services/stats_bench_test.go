@@ -0,0 +1,268 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/cache"
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Бенчмарк сравнивает прежний расчёт статистики (горутина и полный список
+// логов на каждую привычку) с одним запросом к дневным сводкам.
+//
+// По умолчанию используется MemoryStore, где каждый вызов репозитория
+// занимает одно из poolSize «соединений» на roundTrip — так видна цена
+// N запросов против одного. С TEST_DATABASE_DSN бенчмарк дополнительно
+// гоняется на настоящем Postgres.
+//
+//	go test ./services -run '^$' -bench UserStats -benchmem
+
+const (
+	roundTrip = 200 * time.Microsecond
+	poolSize  = 10
+)
+
+// legacyUserStats — расчёт статистики до перехода на сводки.
+func legacyUserStats(ctx context.Context, store repository.Store, userID uint) (*UserHabitStats, error) {
+	habits, _, err := store.Habits().List(ctx, repository.HabitFilter{UserID: &userID}, repository.Page{})
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]repository.HabitLogStats, len(habits))
+	errs := make([]error, len(habits))
+	var wg sync.WaitGroup
+	for i, habit := range habits {
+		wg.Add(1)
+		go func(i int, h models.Habit) {
+			defer wg.Done()
+
+			logs, _, err := store.HabitLogs().List(ctx, repository.HabitLogFilter{HabitID: &h.ID}, repository.Page{})
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			row := repository.HabitLogStats{HabitID: h.ID, IsActive: h.IsActive, TotalLogs: len(logs)}
+			run := 0
+			for j, log := range logs {
+				if !log.IsCompleted {
+					run = 0
+					continue
+				}
+				row.CompletedLogs++
+				run++
+				if run == j+1 {
+					row.CurrentStreak = run
+				}
+				row.LongestStreak = max(row.LongestStreak, run)
+			}
+			rows[i] = row
+		}(i, habit)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buildUserStats(userID, rows), nil
+}
+
+// slowStore добавляет к вызовам статистики задержку сети и ограниченный пул соединений.
+type slowStore struct {
+	repository.Store
+	pool chan struct{}
+}
+
+func newSlowStore(store repository.Store) *slowStore {
+	return &slowStore{Store: store, pool: make(chan struct{}, poolSize)}
+}
+
+func (s *slowStore) wait() func() {
+	s.pool <- struct{}{}
+	time.Sleep(roundTrip)
+	return func() { <-s.pool }
+}
+
+func (s *slowStore) Habits() repository.HabitRepository {
+	return slowHabits{s.Store.Habits(), s}
+}
+
+func (s *slowStore) HabitLogs() repository.HabitLogRepository {
+	return slowHabitLogs{s.Store.HabitLogs(), s}
+}
+
+func (s *slowStore) Rollups() repository.RollupRepository {
+	return slowRollups{s.Store.Rollups(), s}
+}
+
+type slowHabits struct {
+	repository.HabitRepository
+	s *slowStore
+}
+
+func (r slowHabits) List(ctx context.Context, filter repository.HabitFilter, page repository.Page) ([]models.Habit, *repository.Cursor, error) {
+	defer r.s.wait()()
+	return r.HabitRepository.List(ctx, filter, page)
+}
+
+type slowRollups struct {
+	repository.RollupRepository
+	s *slowStore
+}
+
+func (r slowRollups) Stats(ctx context.Context, userID uint) ([]repository.HabitLogStats, error) {
+	defer r.s.wait()()
+	return r.RollupRepository.Stats(ctx, userID)
+}
+
+type slowHabitLogs struct {
+	repository.HabitLogRepository
+	s *slowStore
+}
+
+func (r slowHabitLogs) List(ctx context.Context, filter repository.HabitLogFilter, page repository.Page) ([]models.HabitLog, *repository.Cursor, error) {
+	defer r.s.wait()()
+	return r.HabitLogRepository.List(ctx, filter, page)
+}
+
+// seedStats создаёт пользователю habits привычек по logs логов с разрывами серий.
+func seedStats(tb testing.TB, store repository.Store, userID uint, habits, logs int) {
+	tb.Helper()
+	ctx := context.Background()
+
+	start := time.Now().AddDate(0, 0, -logs)
+	err := store.Transaction(ctx, func(tx repository.Store) error {
+		for i := 0; i < habits; i++ {
+			habit := models.Habit{UserID: userID, Title: fmt.Sprintf("habit-%d", i), Frequency: "daily", IsActive: i%4 != 0}
+			if err := tx.Habits().Create(ctx, &habit); err != nil {
+				return err
+			}
+			for j := 0; j < logs; j++ {
+				log := models.HabitLog{HabitID: habit.ID, Date: start.AddDate(0, 0, j), IsCompleted: (i+j)%7 != 0}
+				if err := tx.HabitLogs().Create(ctx, &log); err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Rollups().Rebuild(ctx, &userID)
+	})
+	if err != nil {
+		tb.Fatalf("seed: %v", err)
+	}
+}
+
+func sqlUserStats(store repository.Store) func(context.Context, uint) (*UserHabitStats, error) {
+	// Кэш сбрасывается перед каждым расчётом, чтобы прогон доходил до хранилища.
+	svc := NewStatsService(store, cache.NewLocalCache(10), zap.NewNop())
+	return func(ctx context.Context, userID uint) (*UserHabitStats, error) {
+		if err := svc.cache.Flush(ctx); err != nil {
+			return nil, err
+		}
+		return svc.CalculateUserHabitStats(ctx, userID)
+	}
+}
+
+func benchmarkUserStats(b *testing.B, store repository.Store, userID uint) {
+	ctx := context.Background()
+	run := map[string]func(context.Context, uint) (*UserHabitStats, error){
+		"legacy": func(ctx context.Context, userID uint) (*UserHabitStats, error) {
+			return legacyUserStats(ctx, store, userID)
+		},
+		"sql": sqlUserStats(store),
+	}
+
+	for _, name := range []string{"legacy", "sql"} {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := run[name](ctx, userID); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkUserStats(b *testing.B) {
+	for _, habits := range []int{10, 100} {
+		b.Run(fmt.Sprintf("memory/habits=%d", habits), func(b *testing.B) {
+			store := repository.NewMemoryStore()
+			seedStats(b, store, 1, habits, 60)
+			benchmarkUserStats(b, newSlowStore(store), 1)
+		})
+	}
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		return
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		b.Fatalf("open postgres: %v", err)
+	}
+	if err := db.AutoMigrate(&models.City{}, &models.User{}, &models.Habit{}, &models.HabitLog{},
+		&models.HabitDailyRollup{}, &models.UserWeeklyRollup{}); err != nil {
+		b.Fatalf("migrate: %v", err)
+	}
+	store := repository.NewPostgresStore(db)
+
+	for _, habits := range []int{10, 100} {
+		b.Run(fmt.Sprintf("postgres/habits=%d", habits), func(b *testing.B) {
+			user := models.User{Username: fmt.Sprintf("bench-%d", time.Now().UnixNano())}
+			if err := store.Users().Create(context.Background(), &user); err != nil {
+				b.Fatal(err)
+			}
+			b.Cleanup(func() {
+				db.Exec("DELETE FROM habit_daily_rollups WHERE user_id = ?", user.ID)
+				db.Exec("DELETE FROM user_weekly_rollups WHERE user_id = ?", user.ID)
+				db.Exec("DELETE FROM habit_logs WHERE habit_id IN (SELECT id FROM habits WHERE user_id = ?)", user.ID)
+				db.Exec("DELETE FROM habits WHERE user_id = ?", user.ID)
+				db.Delete(&models.User{}, user.ID)
+			})
+			seedStats(b, store, user.ID, habits, 60)
+			assertSameStats(b, store, user.ID)
+			benchmarkUserStats(b, store, user.ID)
+		})
+	}
+}
+
+// assertSameStats проверяет, что оба способа дают одинаковый ответ.
+func assertSameStats(tb testing.TB, store repository.Store, userID uint) {
+	tb.Helper()
+	ctx := context.Background()
+
+	legacy, err := legacyUserStats(ctx, store, userID)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	got, err := sqlUserStats(store)(ctx, userID)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	sort.Slice(legacy.HabitStats, func(i, j int) bool { return legacy.HabitStats[i].HabitID < legacy.HabitStats[j].HabitID })
+	got.ProcessingTime = 0
+	if !reflect.DeepEqual(legacy, got) {
+		tb.Fatalf("stats differ:\nlegacy: %+v\nsql:    %+v", legacy, got)
+	}
+}
+
+func TestUserStatsMatchLegacy(t *testing.T) {
+	store := repository.NewMemoryStore()
+	seedStats(t, store, 1, 12, 30)
+	assertSameStats(t, store, 1)
+}
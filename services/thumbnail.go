@@ -0,0 +1,89 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+)
+
+const (
+	// thumbnailSize — длина большей стороны миниатюры в пикселях.
+	thumbnailSize = 320
+	// maxImagePixels защищает от «бомб» — маленьких файлов, которые
+	// при декодировании занимают гигабайты памяти.
+	maxImagePixels = 50_000_000
+	// thumbnailSamples — число выборок по каждой оси на пиксель миниатюры.
+	thumbnailSamples = 3
+)
+
+// thumbnail декодирует изображение и возвращает его размеры и миниатюру
+// в JPEG. Прозрачные области заливаются белым.
+func thumbnail(data []byte) (width, height int, thumb []byte, err error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("decode image: %v: %w", err, ErrInvalidInput)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxImagePixels {
+		return 0, 0, nil, fmt.Errorf("image %dx%d exceeds %d pixels: %w", cfg.Width, cfg.Height, maxImagePixels, ErrTooLarge)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("decode image: %v: %w", err, ErrInvalidInput)
+	}
+
+	bounds := src.Bounds()
+	w, h := fitSize(bounds.Dx(), bounds.Dy())
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), downscale(src, dst.Bounds().Size()), image.Point{}, draw.Over)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return 0, 0, nil, fmt.Errorf("encode thumbnail: %w", err)
+	}
+	return bounds.Dx(), bounds.Dy(), buf.Bytes(), nil
+}
+
+// fitSize вписывает w×h в квадрат thumbnailSize с сохранением пропорций;
+// маленькие изображения не увеличиваются.
+func fitSize(w, h int) (int, int) {
+	if w <= thumbnailSize && h <= thumbnailSize {
+		return w, h
+	}
+	if w >= h {
+		return thumbnailSize, max(1, h*thumbnailSize/w)
+	}
+	return max(1, w*thumbnailSize/h), thumbnailSize
+}
+
+// downscale уменьшает изображение до size, усредняя по каждому пикселю
+// сетку thumbnailSamples×thumbnailSamples точек исходника. Это не так
+// аккуратно, как полноценный фильтр, но не требует сторонних пакетов.
+func downscale(src image.Image, size image.Point) *image.NRGBA {
+	b := src.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, size.X, size.Y))
+	const n = thumbnailSamples * thumbnailSamples
+
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			var r, g, bl, a uint32
+			for sy := 0; sy < thumbnailSamples; sy++ {
+				py := b.Min.Y + ((2*y*thumbnailSamples+2*sy+1)*b.Dy())/(2*size.Y*thumbnailSamples)
+				for sx := 0; sx < thumbnailSamples; sx++ {
+					px := b.Min.X + ((2*x*thumbnailSamples+2*sx+1)*b.Dx())/(2*size.X*thumbnailSamples)
+					cr, cg, cb, ca := src.At(px, py).RGBA()
+					r, g, bl, a = r+cr, g+cg, bl+cb, a+ca
+				}
+			}
+			// RGBA() отдаёт предумноженные значения; NRGBA.Set переведёт их сам.
+			c := color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)}
+			dst.Set(x, y, c)
+		}
+	}
+	return dst
+}
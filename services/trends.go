@@ -0,0 +1,247 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Bekzhanizb/HabitTrackerBackend/models"
+	"github.com/Bekzhanizb/HabitTrackerBackend/repository"
+)
+
+// rollingWindows — длины скользящих окон в днях, заканчивающихся в конце диапазона.
+var rollingWindows = []int{7, 30, 90}
+
+// RatePeriod — доля выполненных отметок за дни From..To включительно, в процентах.
+type RatePeriod struct {
+	From      string  `json:"from"`
+	To        string  `json:"to"`
+	Total     int     `json:"total"`
+	Completed int     `json:"completed"`
+	Rate      float64 `json:"rate"`
+}
+
+type RollingRate struct {
+	Days int `json:"days"`
+	RatePeriod
+}
+
+// PeriodComparison сравнивает текущий период с тем же числом дней
+// предыдущего. Delta — разница процентов в процентных пунктах.
+type PeriodComparison struct {
+	Current  RatePeriod `json:"current"`
+	Previous RatePeriod `json:"previous"`
+	Delta    float64    `json:"delta"`
+}
+
+type WeekTrend struct {
+	WeekStart  string  `json:"week_start"`
+	Total      int     `json:"total"`
+	Completed  int     `json:"completed"`
+	ActiveDays int     `json:"active_days"`
+	Rate       float64 `json:"rate"`
+}
+
+type WeekdayRate struct {
+	Weekday   string  `json:"weekday"`
+	Total     int     `json:"total"`
+	Completed int     `json:"completed"`
+	Rate      float64 `json:"rate"`
+}
+
+// HabitTrend — итоги привычки за диапазон. Лучший и худший дни недели
+// выбираются среди дней с отметками; при равенстве побеждает более ранний.
+type HabitTrend struct {
+	HabitID      uint          `json:"habit_id"`
+	Title        string        `json:"title"`
+	Total        int           `json:"total"`
+	Completed    int           `json:"completed"`
+	Rate         float64       `json:"rate"`
+	BestWeekday  string        `json:"best_weekday,omitempty"`
+	WorstWeekday string        `json:"worst_weekday,omitempty"`
+	Weekdays     []WeekdayRate `json:"weekdays"`
+}
+
+// Trends — динамика выполнения привычек. Всё, кроме Hours, считается по
+// сводкам с днями в UTC; часы суток — по логам в часовом поясе запроса.
+type Trends struct {
+	UserID         uint                      `json:"user_id"`
+	From           string                    `json:"from"`
+	To             string                    `json:"to"`
+	Timezone       string                    `json:"timezone"`
+	Rolling        []RollingRate             `json:"rolling"`
+	WeekOverWeek   PeriodComparison          `json:"week_over_week"`
+	MonthOverMonth PeriodComparison          `json:"month_over_month"`
+	Weeks          []WeekTrend               `json:"weeks"`
+	Habits         []HabitTrend              `json:"habits"`
+	Hours          []repository.HourActivity `json:"hours"`
+}
+
+// Trends считает динамику выполнения за диапазон rng. Скользящие окна и
+// сравнения периодов отсчитываются назад от rng.To и могут выходить за rng.From.
+func (s *StatsService) Trends(ctx context.Context, actor models.User, ownerID *uint, rng CalendarRange) (*Trends, error) {
+	userID := actor.ID
+	if owner := visibleOwner(actor, ownerID); owner != nil {
+		userID = *owner
+	}
+
+	week := weekPeriods(rng.To)
+	month := monthPeriods(rng.To)
+	from := earliest(rng.From, rng.To.AddDate(0, 0, 1-rollingWindows[len(rollingWindows)-1]), week[1].from, month[1].from)
+
+	days, err := s.store.Rollups().Daily(ctx, repository.RollupFilter{UserID: userID, From: from, To: rng.To})
+	if err != nil {
+		return nil, fmt.Errorf("daily rollups: %w", err)
+	}
+	weeks, err := s.store.Rollups().Weekly(ctx, repository.RollupFilter{UserID: userID, From: rng.From, To: rng.To})
+	if err != nil {
+		return nil, fmt.Errorf("weekly rollups: %w", err)
+	}
+	habits, _, err := s.store.Habits().List(ctx, repository.HabitFilter{UserID: &userID}, repository.Page{})
+	if err != nil {
+		return nil, fmt.Errorf("list habits: %w", err)
+	}
+	hours, err := s.store.HabitLogs().Hours(ctx, repository.CalendarFilter{
+		UserID: &userID, From: rng.From, To: rng.To, Location: rng.Location,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("hourly activity: %w", err)
+	}
+
+	trends := &Trends{
+		UserID:         userID,
+		From:           rng.From.Format(time.DateOnly),
+		To:             rng.To.Format(time.DateOnly),
+		Timezone:       rng.Location.String(),
+		Rolling:        make([]RollingRate, 0, len(rollingWindows)),
+		WeekOverWeek:   compare(days, week),
+		MonthOverMonth: compare(days, month),
+		Weeks:          make([]WeekTrend, 0, len(weeks)),
+		Habits:         habitTrends(habits, days, rng),
+		Hours:          hours,
+	}
+	for _, n := range rollingWindows {
+		trends.Rolling = append(trends.Rolling, RollingRate{
+			Days:       n,
+			RatePeriod: sumPeriod(days, period{rng.To.AddDate(0, 0, 1-n), rng.To}),
+		})
+	}
+	for _, w := range weeks {
+		trends.Weeks = append(trends.Weeks, WeekTrend{
+			WeekStart:  w.WeekStart.Format(time.DateOnly),
+			Total:      w.Total,
+			Completed:  w.Completed,
+			ActiveDays: w.ActiveDays,
+			Rate:       rate(w.Completed, w.Total),
+		})
+	}
+	return trends, nil
+}
+
+// period — дни from..to включительно.
+type period struct{ from, to time.Time }
+
+func (p period) contains(day time.Time) bool {
+	d := day.Format(time.DateOnly)
+	return d >= p.from.Format(time.DateOnly) && d <= p.to.Format(time.DateOnly)
+}
+
+// weekPeriods возвращает неделю до дня to (с понедельника) и те же дни прошлой недели.
+func weekPeriods(to time.Time) [2]period {
+	start := to.AddDate(0, 0, -(int(to.Weekday())+6)%7)
+	return [2]period{{start, to}, {start.AddDate(0, 0, -7), to.AddDate(0, 0, -7)}}
+}
+
+// monthPeriods возвращает месяц до дня to и те же дни прошлого месяца;
+// если в прошлом месяце дней меньше, период обрезается его концом.
+func monthPeriods(to time.Time) [2]period {
+	start := time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, time.UTC)
+	prevStart := start.AddDate(0, -1, 0)
+	prevTo := prevStart.AddDate(0, 0, to.Day()-1)
+	if !prevTo.Before(start) {
+		prevTo = start.AddDate(0, 0, -1)
+	}
+	return [2]period{{start, to}, {prevStart, prevTo}}
+}
+
+func compare(days []models.HabitDailyRollup, periods [2]period) PeriodComparison {
+	cmp := PeriodComparison{Current: sumPeriod(days, periods[0]), Previous: sumPeriod(days, periods[1])}
+	cmp.Delta = cmp.Current.Rate - cmp.Previous.Rate
+	return cmp
+}
+
+func sumPeriod(days []models.HabitDailyRollup, p period) RatePeriod {
+	sum := RatePeriod{From: p.from.Format(time.DateOnly), To: p.to.Format(time.DateOnly)}
+	for _, day := range days {
+		if p.contains(day.Day) {
+			sum.Total += day.Total
+			sum.Completed += day.Completed
+		}
+	}
+	sum.Rate = rate(sum.Completed, sum.Total)
+	return sum
+}
+
+func habitTrends(habits []models.Habit, days []models.HabitDailyRollup, rng CalendarRange) []HabitTrend {
+	inRange := period{rng.From, rng.To}
+	byHabit := make(map[uint]*[7]WeekdayRate, len(habits))
+	for _, habit := range habits {
+		byHabit[habit.ID] = new([7]WeekdayRate)
+	}
+	for _, day := range days {
+		weekdays, ok := byHabit[day.HabitID]
+		if !ok || !inRange.contains(day.Day) {
+			continue
+		}
+		wd := &weekdays[(int(day.Day.Weekday())+6)%7]
+		wd.Total += day.Total
+		wd.Completed += day.Completed
+	}
+
+	trends := make([]HabitTrend, 0, len(habits))
+	for _, habit := range habits {
+		trend := HabitTrend{HabitID: habit.ID, Title: habit.Title, Weekdays: make([]WeekdayRate, 7)}
+		best, worst := -1, -1
+		for i, wd := range byHabit[habit.ID] {
+			wd.Weekday = strings.ToLower(time.Weekday((i + 1) % 7).String())
+			wd.Rate = rate(wd.Completed, wd.Total)
+			trend.Weekdays[i] = wd
+			trend.Total += wd.Total
+			trend.Completed += wd.Completed
+
+			if wd.Total == 0 {
+				continue
+			}
+			if best < 0 || wd.Rate > trend.Weekdays[best].Rate {
+				best = i
+			}
+			if worst < 0 || wd.Rate < trend.Weekdays[worst].Rate {
+				worst = i
+			}
+		}
+		trend.Rate = rate(trend.Completed, trend.Total)
+		if best >= 0 {
+			trend.BestWeekday = trend.Weekdays[best].Weekday
+			trend.WorstWeekday = trend.Weekdays[worst].Weekday
+		}
+		trends = append(trends, trend)
+	}
+	return trends
+}
+
+func rate(completed, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(completed) / float64(total) * 100
+}
+
+func earliest(t time.Time, rest ...time.Time) time.Time {
+	for _, r := range rest {
+		if r.Before(t) {
+			t = r
+		}
+	}
+	return t
+}
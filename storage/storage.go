@@ -0,0 +1,134 @@
+// Package storage хранит файлы вложений. Файлы лежат вне публичной папки
+// uploads и отдаются только через хендлеры, которые проверяют права.
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore — хранилище файлов по ключу. Ключи выдаёт вызывающий; это
+// должны быть непрозрачные идентификаторы без разделителей пути.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	// Open возвращает содержимое с поддержкой Seek, чтобы файл можно было
+	// отдавать частями (Range).
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	// Delete не считает ошибкой отсутствие файла.
+	Delete(ctx context.Context, key string) error
+}
+
+func checkKey(key string) error {
+	if key == "" || key == "." || key == ".." || filepath.Base(key) != key {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
+
+// LocalStore хранит файлы в каталоге на диске.
+type LocalStore struct {
+	root string
+}
+
+// NewLocalStore создаёт каталог root, доступный только владельцу процесса.
+func NewLocalStore(root string) (*LocalStore, error) {
+	if err := os.MkdirAll(root, 0o700); err != nil {
+		return nil, err
+	}
+	return &LocalStore{root: root}, nil
+}
+
+// Put пишет файл через временный и переименование, чтобы читатели
+// не увидели его наполовину записанным.
+func (s *LocalStore) Put(ctx context.Context, key string, data []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.root, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.root, key))
+}
+
+func (s *LocalStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(s.root, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	return f, err
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(s.root, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// MemoryStore хранит файлы в памяти процесса — для тестов и локального
+// запуска без каталога под вложения.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	blobs map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{blobs: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) Put(ctx context.Context, key string, data []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[key] = bytes.Clone(data)
+	return nil
+}
+
+func (s *MemoryStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	return nopCloser{bytes.NewReader(data)}, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blobs, key)
+	return nil
+}
+
+type nopCloser struct{ *bytes.Reader }
+
+func (nopCloser) Close() error { return nil }
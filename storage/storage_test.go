@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	s, err := NewLocalStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Put(ctx, "abc", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	f, err := s.Open(ctx, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "hello" {
+		t.Fatalf("read %q", data)
+	}
+
+	entries, _ := os.ReadDir(root)
+	if len(entries) != 1 {
+		t.Fatalf("temporary files left behind: %v", entries)
+	}
+
+	for _, key := range []string{"", "..", "../abc", "a/b"} {
+		if err := s.Put(ctx, key, nil); err == nil {
+			t.Errorf("key %q must be rejected", key)
+		}
+	}
+
+	if err := s.Delete(ctx, "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, "abc"); err != nil {
+		t.Fatalf("deleting a missing blob: %v", err)
+	}
+	if _, err := s.Open(ctx, "abc"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
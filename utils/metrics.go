@@ -31,9 +31,18 @@ var (
 		},
 		[]string{"handler", "type"}, // handler - какой endpoint, type - тип ошибки
 	)
+
+	// Counter: Обращения к кэшу по результату (hit, miss, stale)
+	CacheRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "app_cache_requests_total",
+			Help: "Cache lookups by result",
+		},
+		[]string{"cache", "result"},
+	)
 )
 
 func InitMetrics() {
 	// Регистрируем метрики в Prometheus
-	prometheus.MustRegister(ReqCount, ReqDuration, ErrorCount)
+	prometheus.MustRegister(ReqCount, ReqDuration, ErrorCount, CacheRequests)
 }